@@ -105,6 +105,15 @@ struct {
     __type(value, __u32);
 } geo_allowed SEC(".maps");
 
+// GeoIP blocked countries (used instead of geo_allowed in block mode)
+struct {
+    __uint(type, BPF_MAP_TYPE_LPM_TRIE);
+    __uint(max_entries, 300000);
+    __uint(map_flags, BPF_F_NO_PREALLOC);
+    __type(key, struct lpm_key);
+    __type(value, __u32);
+} geo_blocked SEC(".maps");
+
 // Active connections (TC egress tracking)
 struct {
     __uint(type, BPF_MAP_TYPE_LRU_HASH);
@@ -159,6 +168,8 @@ struct {
 #define CONFIG_ENABLE_BLOCK_TTL   2  // v1.15.0: Enable Block Map TTL
 #define CONFIG_BLOCK_TTL_SECONDS  3  // v1.15.0: TTL in seconds (default 300)
 #define CONFIG_ENABLE_PKT_VALIDATION 4  // v1.15.0: Enable Packet Validation
+#define CONFIG_GEO_BLOCK_MODE     5  // 1 = drop sources in geo_blocked, pass the rest (country blacklist)
+#define CONFIG_RATE_LIMIT_BURST   6  // Token bucket size per IP, 0 = same as CONFIG_RATE_LIMIT_PPS
 
 // Port stats (optional, for monitoring)
 struct port_stats {
@@ -414,20 +425,36 @@ int xdp_traffic_filter(struct xdp_md *ctx) {
 
     // ============================================================
     // 6. PPS RATE LIMIT -> DROP if exceeded
+    //    Token bucket per source IP: refills at rate_limit_pps tokens/s
+    //    up to burst tokens, each packet takes one. A source may send
+    //    burst packets at once, then rate_limit_pps on average.
     // ============================================================
     __u32 cfg_key = CONFIG_RATE_LIMIT_PPS;
     __u32 *rate_limit_pps = bpf_map_lookup_elem(&config, &cfg_key);
     if (rate_limit_pps && *rate_limit_pps > 0) {
         __u64 now = bpf_ktime_get_ns();
+        __u64 rate = *rate_limit_pps;
+        __u64 burst = rate;
+        __u32 burst_key = CONFIG_RATE_LIMIT_BURST;
+        __u32 *burst_cfg = bpf_map_lookup_elem(&config, &burst_key);
+        if (burst_cfg && *burst_cfg > 0) burst = *burst_cfg;
+
         struct rate_limit_entry *rl = bpf_map_lookup_elem(&rate_limits, &src_ip);
         
         if (rl) {
             __u64 elapsed = now - rl->last_update;
-            if (elapsed > 1000000000ULL) elapsed = 1000000000ULL;
-            
-            __u64 tokens_to_add = (elapsed * (*rate_limit_pps)) / 1000000000ULL;
+
+            // Whole seconds first so elapsed * rate cannot overflow after a long idle
+            __u64 tokens_to_add = (elapsed / 1000000000ULL) * rate
+                + ((elapsed % 1000000000ULL) * rate) / 1000000000ULL;
             __u64 new_tokens = rl->tokens + tokens_to_add;
-            if (new_tokens > *rate_limit_pps) new_tokens = *rate_limit_pps;
+            // Advance the clock by the time the added tokens took, so the fraction of a
+            // token still accruing carries over. A full bucket has nothing to carry.
+            __u64 refilled_at = now;
+            if (new_tokens >= burst)
+                new_tokens = burst;
+            else
+                refilled_at = rl->last_update + (tokens_to_add * 1000000000ULL) / rate;
             
             if (new_tokens < 1) {
                 // === Block Map TTL: Auto-add to blocklist (v1.15.0) ===
@@ -454,15 +481,16 @@ int xdp_traffic_filter(struct xdp_md *ctx) {
                 return XDP_DROP;
             }
             rl->tokens = new_tokens - 1;
-            rl->last_update = now;
+            rl->last_update = refilled_at;
         } else {
-            struct rate_limit_entry new_rl = { .tokens = *rate_limit_pps - 1, .last_update = now };
+            struct rate_limit_entry new_rl = { .tokens = burst - 1, .last_update = now };
             bpf_map_update_elem(&rate_limits, &src_ip, &new_rl, BPF_ANY);
         }
     }
 
     // ============================================================
     // 7. GEOIP -> DROP if not in allowed countries
+    //    (block mode: DROP if in blocked countries)
     // ============================================================
     cfg_key = CONFIG_HARD_BLOCKING;
     __u32 *hard_blocking = bpf_map_lookup_elem(&config, &cfg_key);
@@ -470,7 +498,17 @@ int xdp_traffic_filter(struct xdp_md *ctx) {
     if (hard_blocking && *hard_blocking == 1) {
         struct lpm_key geo_key;
         set_key_ipv4(&geo_key, src_ip);
-        if (!bpf_map_lookup_elem(&geo_allowed, &geo_key)) {
+
+        __u32 mode_key = CONFIG_GEO_BLOCK_MODE;
+        __u32 *geo_block_mode = bpf_map_lookup_elem(&config, &mode_key);
+        int geo_drop;
+        if (geo_block_mode && *geo_block_mode == 1) {
+            geo_drop = bpf_map_lookup_elem(&geo_blocked, &geo_key) ? 1 : 0;
+        } else {
+            geo_drop = !bpf_map_lookup_elem(&geo_allowed, &geo_key);
+        }
+
+        if (geo_drop) {
             key = STAT_GEOIP_BLOCKED;
             __u64 *cnt = bpf_map_lookup_elem(&global_stats, &key);
             if (cnt) *cnt += 1;
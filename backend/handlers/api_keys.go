@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// APIKeyHeader carries an API key as an alternative to "Authorization: Bearer"
+	APIKeyHeader = "X-API-Key"
+
+	// API key scopes, mirroring the user roles
+	APIKeyScopeRead = "read" // Viewer rights
+	APIKeyScopeFull = "full" // Admin rights
+
+	apiKeyPrefix      = "kgp_"
+	apiKeyPrefixShown = 12 // Characters kept in APIKey.Prefix
+)
+
+// apiKeyScopeRoles maps a key scope to the role it acts with
+var apiKeyScopeRoles = map[string]string{
+	APIKeyScopeRead: RoleViewer,
+	APIKeyScopeFull: RoleAdmin,
+}
+
+// hashAPIKey returns the stored form of a key. Keys are long random strings, so a plain
+// SHA-256 is enough and keeps the per-request lookup cheap.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// isAPIKeyRequest reports whether the caller authenticated with an API key
+func isAPIKeyRequest(c *fiber.Ctx) bool {
+	_, ok := c.Locals("api_key").(*models.APIKey)
+	return ok
+}
+
+// AuthMiddleware accepts an X-API-Key header or falls back to JWT bearer authentication.
+// A valid key is exposed to the role checks as a token whose role follows the key's scope.
+func (h *Handler) AuthMiddleware(secret []byte) fiber.Handler {
+	jwtAuth := JWTAuthMiddleware(secret)
+	return func(c *fiber.Ctx) error {
+		key := strings.TrimSpace(c.Get(APIKeyHeader))
+		if key == "" {
+			return jwtAuth(c)
+		}
+
+		var apiKey models.APIKey
+		if err := h.DB.Where("key_hash = ?", hashAPIKey(key)).First(&apiKey).Error; err != nil {
+			system.Warn("Rejected unknown API key from %s", c.IP())
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid API key"})
+		}
+		now := time.Now()
+		if apiKey.RevokedAt != nil {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "API key has been revoked"})
+		}
+		if apiKey.ExpiresAt != nil && now.After(*apiKey.ExpiresAt) {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "API key has expired"})
+		}
+		// Account endpoints (password, two-factor) belong to people, not scripts
+		if strings.HasPrefix(c.Path(), "/api/auth/") {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "API keys cannot manage user accounts"})
+		}
+
+		role, ok := apiKeyScopeRoles[apiKey.Scope]
+		if !ok {
+			role = RoleViewer
+		}
+		h.DB.Model(&apiKey).UpdateColumns(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": c.IP(),
+		})
+
+		c.Locals("api_key", &apiKey)
+		c.Locals("user", &jwt.Token{Valid: true, Claims: jwt.MapClaims{
+			"user": "apikey:" + apiKey.Name,
+			"role": role,
+		}})
+		return c.Next()
+	}
+}
+
+// GetAPIKeys lists API keys (never the keys themselves)
+// GET /api/api-keys
+func (h *Handler) GetAPIKeys(c *fiber.Ctx) error {
+	var keys []models.APIKey
+	if err := h.DB.Order("id DESC").Find(&keys).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(keys)
+}
+
+// CreateAPIKey generates a new API key. The key is only returned in this response.
+// POST /api/api-keys {"name": "ci", "scope": "full", "expires_in_days": 90}
+func (h *Handler) CreateAPIKey(c *fiber.Ctx) error {
+	if isAPIKeyRequest(c) {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "API keys cannot create other API keys"})
+	}
+
+	var input struct {
+		Name          string `json:"name"`
+		Scope         string `json:"scope"`           // read (default) or full
+		ExpiresInDays int    `json:"expires_in_days"` // 0 = never
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	if err := cleanTextFields(textField{"name", &input.Name, maxNameLength}); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if input.Name == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Name is required"})
+	}
+	if input.Scope == "" {
+		input.Scope = APIKeyScopeRead
+	}
+	if _, ok := apiKeyScopeRoles[input.Scope]; !ok {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "scope must be 'read' or 'full'"})
+	}
+	if input.ExpiresInDays < 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "expires_in_days must not be negative (0 = never)"})
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate key"})
+	}
+	key := apiKeyPrefix + hex.EncodeToString(buf)
+
+	creator, _ := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)["user"].(string)
+	apiKey := models.APIKey{
+		Name:      input.Name,
+		KeyHash:   hashAPIKey(key),
+		Prefix:    key[:apiKeyPrefixShown],
+		Scope:     input.Scope,
+		CreatedBy: creator,
+	}
+	if input.ExpiresInDays > 0 {
+		expires := time.Now().AddDate(0, 0, input.ExpiresInDays)
+		apiKey.ExpiresAt = &expires
+	}
+	if err := h.DB.Create(&apiKey).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	system.Info("API key '%s' (%s) created by %s", apiKey.Name, apiKey.Scope, creator)
+	AddEvent("info", fmt.Sprintf("API key '%s' created with %s scope", apiKey.Name, apiKey.Scope))
+	return c.Status(http.StatusCreated).JSON(fiber.Map{
+		"api_key": apiKey,
+		"key":     key,
+		"message": "Store this key now, it cannot be shown again",
+	})
+}
+
+// RevokeAPIKey disables an API key; the record is kept for auditing
+// DELETE /api/api-keys/:id
+func (h *Handler) RevokeAPIKey(c *fiber.Ctx) error {
+	var apiKey models.APIKey
+	if err := h.DB.First(&apiKey, c.Params("id")).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "API key not found"})
+	}
+	if apiKey.RevokedAt != nil {
+		return c.JSON(apiKey)
+	}
+
+	now := time.Now()
+	if err := h.DB.Model(&apiKey).Update("revoked_at", now).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	apiKey.RevokedAt = &now
+
+	system.Info("API key '%s' revoked", apiKey.Name)
+	AddEvent("warning", fmt.Sprintf("API key '%s' revoked", apiKey.Name))
+	return c.JSON(apiKey)
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// auditBodyLimit is the largest JSON body inspected for a target name/IP
+const auditBodyLimit = 64 * 1024
+
+// auditActions describes routes in plain words; anything not listed is logged as "METHOD route"
+var auditActions = map[string]string{
+	"POST /api/origins":                             "Created origin",
+	"PUT /api/origins/:id":                          "Updated origin",
+	"DELETE /api/origins/:id":                       "Deleted origin",
+	"POST /api/origins/:id/drain":                   "Started draining origin",
+	"DELETE /api/origins/:id/drain":                 "Cancelled drain of origin",
+	"POST /api/services":                            "Created service",
+	"PUT /api/services/:id":                         "Updated service",
+	"DELETE /api/services/:id":                      "Deleted service",
+	"PUT /api/security/settings":                    "Updated security settings",
+	"POST /api/security/rules/allow":                "Allowed IP",
+	"DELETE /api/security/rules/allow/:id":          "Removed allow rule",
+	"POST /api/security/rules/block":                "Banned IP",
+	"DELETE /api/security/rules/block/:id":          "Removed ban",
+	"DELETE /api/security/offenders":                "Cleared offender history",
+	"POST /api/security/reconcile":                  "Reconciled firewall layers",
+	"DELETE /api/traffic/blocked":                   "Unblocked IP",
+	"POST /api/firewall/apply":                      "Applied firewall rules",
+	"POST /api/firewall/confirm":                    "Confirmed firewall rules",
+	"POST /api/firewall/custom-rules":               "Created custom rule",
+	"PUT /api/firewall/custom-rules/:id":            "Updated custom rule",
+	"DELETE /api/firewall/custom-rules/:id":         "Deleted custom rule",
+	"POST /api/firewall/egress-policies":            "Created egress policy",
+	"PUT /api/firewall/egress-policies/:id":         "Updated egress policy",
+	"DELETE /api/firewall/egress-policies/:id":      "Deleted egress policy",
+	"POST /api/security/countries/groups":           "Created country group",
+	"PUT /api/security/countries/groups/:id":        "Updated country group",
+	"DELETE /api/security/countries/groups/:id":     "Deleted country group",
+	"POST /api/security/geo-schedules":              "Created geo schedule",
+	"PUT /api/security/geo-schedules/:id":           "Updated geo schedule",
+	"DELETE /api/security/geo-schedules/:id":        "Deleted geo schedule",
+	"POST /api/signatures":                          "Created signature",
+	"PUT /api/signatures/:id":                       "Updated signature",
+	"DELETE /api/signatures/:id":                    "Deleted signature",
+	"POST /api/users":                               "Created user",
+	"PUT /api/users/:id/role":                       "Changed role of user",
+	"DELETE /api/users/:id":                         "Deleted user",
+	"POST /api/api-keys":                            "Created API key",
+	"DELETE /api/api-keys/:id":                      "Revoked API key",
+	"POST /api/wireguard/rotate-key":                "Rotated WireGuard server key",
+	"POST /api/wireguard/rotate-server-key":         "Rotated WireGuard server key",
+	"POST /api/backup/import":                       "Imported configuration backup",
+	"POST /api/system/reload":                       "Reloaded configuration",
+	"PUT /api/auth/password":                        "Changed own password",
+	"POST /api/auth/totp/verify":                    "Enabled two-factor authentication",
+	"POST /api/auth/totp/disable":                   "Disabled two-factor authentication",
+	"PUT /api/security/countries/names/:code":       "Renamed country",
+	"DELETE /api/security/countries/names/:code":    "Reset country name",
+	"DELETE /api/ip/intelligence/cache":             "Cleared IP intelligence cache",
+	"DELETE /api/ip/intelligence/cache/:ip":         "Cleared IP intelligence cache entry",
+	"PUT /api/flood/block-durations":                "Updated flood block durations",
+	"PUT /api/ebpf/rate-limit":                      "Updated XDP rate limit",
+	"PATCH /api/attacks/:id":                        "Annotated attack event",
+	"POST /api/geoip/import-maxmind-csv":            "Imported MaxMind CSV",
+	"POST /api/traffic/reset":                       "Reset traffic statistics",
+	"POST /api/signatures/reset-stats":              "Reset signature statistics",
+	"POST /api/signatures/:id/test-against-capture": "Tested signature against capture",
+}
+
+// requestUsername returns the user claim of the authenticated caller
+func requestUsername(c *fiber.Ctx) string {
+	token, ok := c.Locals("user").(*jwt.Token)
+	if !ok {
+		return ""
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return ""
+	}
+	username, _ := claims["user"].(string)
+	return username
+}
+
+// AuditMiddleware records every state-changing request with the caller, route and outcome.
+// Must run after AuthMiddleware.
+func (h *Handler) AuditMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+			return c.Next()
+		}
+
+		// Read the body before the handler runs; path parameters are only known after routing
+		fields := auditBodyFields(c)
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = http.StatusInternalServerError
+			var fe *fiber.Error
+			if errors.As(err, &fe) {
+				status = fe.Code
+			}
+		}
+
+		entry := models.AuditLog{
+			Timestamp: time.Now(),
+			Username:  requestUsername(c),
+			Role:      requestRole(c),
+			Method:    c.Method(),
+			Path:      c.Path(),
+			Status:    status,
+			Summary:   auditSummary(c, fields),
+			IP:        c.IP(),
+		}
+		if dbErr := h.DB.Create(&entry).Error; dbErr != nil {
+			system.Warn("Failed to write audit log for %s %s: %v", entry.Method, entry.Path, dbErr)
+		}
+		return err
+	}
+}
+
+// auditSummary combines the route description with what the request acted on: the path
+// parameters and identifying body fields
+func auditSummary(c *fiber.Ctx, fields []string) string {
+	route := c.Route().Path
+	summary, ok := auditActions[c.Method()+" "+route]
+	if !ok {
+		summary = c.Method() + " " + route
+	}
+	for _, param := range c.Route().Params {
+		if v := c.Params(param); v != "" {
+			if param == "id" {
+				v = "#" + v
+			}
+			summary += " " + v
+		}
+	}
+	for _, f := range fields {
+		summary += " " + f
+	}
+	return summary
+}
+
+// auditBodyFields picks identifying fields (name, ip, username) from a JSON body.
+// Nothing else from the body is kept, so passwords and keys never reach the log.
+func auditBodyFields(c *fiber.Ctx) []string {
+	body := c.Body()
+	if len(body) == 0 || len(body) > auditBodyLimit || !strings.Contains(c.Get(fiber.HeaderContentType), "json") {
+		return nil
+	}
+	var fields map[string]interface{}
+	if json.Unmarshal(body, &fields) != nil {
+		return nil
+	}
+	var out []string
+	for _, key := range []string{"name", "ip", "username"} {
+		if v, ok := fields[key].(string); ok && strings.TrimSpace(v) != "" {
+			out = append(out, fmt.Sprintf("%s=%q", key, truncateRunes(sanitizeText(v), maxLabelLength)))
+		}
+	}
+	return out
+}
+
+func truncateRunes(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max])
+}
+
+// GetAuditLog returns recorded admin actions, newest first
+// GET /api/audit?page=1&limit=50&user=&since=
+// since accepts RFC3339 or unix seconds
+func (h *Handler) GetAuditLog(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	limit := c.QueryInt("limit", 50)
+	user := c.Query("user", "")
+
+	since, err := parseTimeParam(c.Query("since"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid 'since' time: " + err.Error()})
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+	offset := (page - 1) * limit
+
+	query := h.DB.Model(&models.AuditLog{})
+	if user != "" {
+		query = query.Where("username = ?", user)
+	}
+	if !since.IsZero() {
+		query = query.Where("timestamp >= ?", since)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var entries []models.AuditLog
+	if err := query.Order("timestamp DESC").Offset(offset).Limit(limit).Find(&entries).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"page":    page,
+		"limit":   limit,
+		"total":   total,
+		"entries": entries,
+	})
+}
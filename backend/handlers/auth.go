@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"fmt"
 	"kg-proxy-web-gui/backend/models"
 	"kg-proxy-web-gui/backend/system"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,13 +13,11 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-// Secret key (in production, use env var)
-var jwtSecret = []byte("super-secret-key-change-me")
-
 // LoginRequest struct
 type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Code     string `json:"code"` // TOTP code, required when two-factor is enabled
 }
 
 func (h *Handler) Login(c *fiber.Ctx) error {
@@ -27,6 +27,14 @@ func (h *Handler) Login(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
 	}
 
+	// Per-IP throttle: stops password spraying that stays under each account's lockout
+	ip := c.IP()
+	if throttled, retryAfter := h.loginThrottled(ip); throttled {
+		seconds := int(retryAfter.Seconds()) + 1
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+		return c.Status(429).JSON(fiber.Map{"error": fmt.Sprintf("Too many failed logins from this address. Try again in %d seconds.", seconds)})
+	}
+
 	var admin models.Admin
 	result := h.DB.Where("username = ?", req.Username).First(&admin)
 
@@ -37,7 +45,7 @@ func (h *Handler) Login(c *fiber.Ctx) error {
 		if count == 0 && req.Username == "admin" && req.Password == "admin123!" {
 			// Create the user so it persists and shows up in User Management
 			hashed, _ := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-			admin = models.Admin{Username: req.Username, Password: string(hashed)}
+			admin = models.Admin{Username: req.Username, Password: string(hashed), Role: RoleAdmin}
 			if err := h.DB.Create(&admin).Error; err != nil {
 				system.Error("Failed to create default admin user: %v", err)
 			} else {
@@ -45,6 +53,7 @@ func (h *Handler) Login(c *fiber.Ctx) error {
 			}
 			goto GenerateToken
 		}
+		h.recordLoginFailure(ip, req.Username)
 		system.Warn("Failed login attempt for user: %s", req.Username)
 		return c.Status(401).JSON(fiber.Map{"error": "Invalid credentials"})
 	}
@@ -52,7 +61,7 @@ func (h *Handler) Login(c *fiber.Ctx) error {
 	// Check Lock
 	if admin.LockedUntil != nil && time.Now().Before(*admin.LockedUntil) {
 		minutes := int(time.Until(*admin.LockedUntil).Minutes()) + 1
-		return c.Status(403).JSON(fiber.Map{"error": "Account is locked. Try again in " + string(rune(minutes+'0')) + " minutes."})
+		return c.Status(403).JSON(fiber.Map{"error": fmt.Sprintf("Account is locked. Try again in %s.", pluralMinutes(minutes))})
 	}
 
 	// Verify Password
@@ -62,50 +71,124 @@ func (h *Handler) Login(c *fiber.Ctx) error {
 		if admin.Password == req.Password {
 			hashed, _ := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 			admin.Password = string(hashed)
-			admin.FailedAttempts = 0
-			admin.LockedUntil = nil
 			h.DB.Save(&admin)
 			goto GenerateToken
 		}
 
 		// Failed Login
-		admin.FailedAttempts++
-		now := time.Now()
-		admin.LastFailedAttempt = &now
-		if admin.FailedAttempts >= 5 {
-			lockUntil := now.Add(5 * time.Minute)
-			admin.LockedUntil = &lockUntil
-		}
-		h.DB.Save(&admin)
-
 		msg := "Invalid credentials"
-		if admin.FailedAttempts >= 5 {
-			msg = "Account locked for 5 minutes"
+		if lockout := h.recordFailedLogin(&admin); lockout > 0 {
+			msg = fmt.Sprintf("Account locked for %s", pluralMinutes(int(lockout.Minutes())))
 		}
+		h.recordLoginFailure(ip, req.Username)
 		system.Warn("Failed login attempt for user: %s (attempt %d)", req.Username, admin.FailedAttempts)
 		return c.Status(401).JSON(fiber.Map{"error": msg})
 	}
 
+GenerateToken:
+	// Second factor: failed codes count towards the same lockout as failed passwords,
+	// so the counter is only reset once both factors passed
+	if admin.TOTPEnabled && !h.checkTOTP(&admin, req.Code) {
+		if req.Code == "" {
+			return c.Status(401).JSON(fiber.Map{"error": "Two-factor code required", "totp_required": true})
+		}
+		msg := "Invalid two-factor code"
+		if lockout := h.recordFailedLogin(&admin); lockout > 0 {
+			msg = fmt.Sprintf("Account locked for %s", pluralMinutes(int(lockout.Minutes())))
+		}
+		h.recordLoginFailure(ip, req.Username)
+		system.Warn("Invalid two-factor code for user: %s (attempt %d)", req.Username, admin.FailedAttempts)
+		return c.Status(401).JSON(fiber.Map{"error": msg, "totp_required": true})
+	}
+
 	// Success
-	admin.FailedAttempts = 0
-	admin.LockedUntil = nil
-	h.DB.Save(&admin)
+	if admin.ID != 0 && (admin.FailedAttempts != 0 || admin.LockedUntil != nil) {
+		admin.FailedAttempts = 0
+		admin.LockedUntil = nil
+		h.DB.Save(&admin)
+	}
 	system.Info("User logged in: %s", req.Username)
 
-GenerateToken:
 	// Generate JWT
+	role := admin.Role
+	if !ValidRole(role) {
+		role = RoleAdmin // Accounts created before roles existed
+	}
 	claims := jwt.MapClaims{
 		"user": req.Username,
+		"role": role,
 		"exp":  time.Now().Add(time.Hour * 24).Unix(),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	t, err := token.SignedString(jwtSecret)
+	t, err := token.SignedString(h.jwtSecret)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Could not login"})
 	}
 
+	response := fiber.Map{"token": t, "role": role}
+	if previous := h.recordLogin(&admin); previous != nil {
+		response["last_login_at"] = previous
+	}
+	if IsCSRFEnabled() {
+		csrfToken, err := issueCSRFToken(c)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Could not login"})
+		}
+		response["csrf_token"] = csrfToken
+	}
+
 	AddEvent("success", "User logged in: "+req.Username)
-	return c.JSON(fiber.Map{"token": t})
+	return c.JSON(response)
+}
+
+// Login lockout defaults and the upper bounds accepted in settings
+const (
+	defaultLoginMaxAttempts    = 5
+	defaultLoginLockoutMinutes = 5
+	maxLoginAttemptsLimit      = 100
+	maxLoginLockoutMinutes     = 24 * 60
+)
+
+// loginLockoutPolicy returns the failed-attempt threshold and lock duration from the settings
+func (h *Handler) loginLockoutPolicy() (int, time.Duration) {
+	attempts, minutes := defaultLoginMaxAttempts, defaultLoginLockoutMinutes
+	var settings models.SecuritySettings
+	if err := h.DB.First(&settings, 1).Error; err == nil {
+		if settings.LoginMaxAttempts > 0 {
+			attempts = settings.LoginMaxAttempts
+		}
+		if settings.LoginLockoutMinutes > 0 {
+			minutes = settings.LoginLockoutMinutes
+		}
+	}
+	return attempts, time.Duration(minutes) * time.Minute
+}
+
+// recordFailedLogin counts a failed attempt and locks the account once the threshold is reached.
+// Returns the lock duration when the account got locked, otherwise 0.
+func (h *Handler) recordFailedLogin(admin *models.Admin) time.Duration {
+	maxAttempts, lockout := h.loginLockoutPolicy()
+	admin.FailedAttempts++
+	now := time.Now()
+	admin.LastFailedAttempt = &now
+	locked := admin.FailedAttempts >= maxAttempts
+	if locked {
+		lockUntil := now.Add(lockout)
+		admin.LockedUntil = &lockUntil
+	}
+	h.DB.Save(admin)
+	if !locked {
+		return 0
+	}
+	return lockout
+}
+
+// pluralMinutes formats a minute count for user-facing messages
+func pluralMinutes(minutes int) string {
+	if minutes == 1 {
+		return "1 minute"
+	}
+	return fmt.Sprintf("%d minutes", minutes)
 }
 
 // ChangePassword handler
@@ -154,10 +237,17 @@ func (h *Handler) ChangePassword(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"message": "Password updated"})
 }
 
-// JWTAuthMiddleware validates JWT token
-func JWTAuthMiddleware() fiber.Handler {
+// JWTAuthMiddleware validates JWT tokens signed with secret
+func JWTAuthMiddleware(secret []byte) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("Authorization")
+		// EventSource (SSE) and browser WebSockets cannot send headers; accept the token as a query parameter for streams only
+		isStream := strings.Contains(c.Get("Accept"), "text/event-stream") || strings.EqualFold(c.Get("Upgrade"), "websocket")
+		if authHeader == "" && isStream {
+			if token := c.Query("access_token"); token != "" {
+				authHeader = "Bearer " + token
+			}
+		}
 		if authHeader == "" {
 			return c.Status(401).JSON(fiber.Map{"error": "Missing authorization header"})
 		}
@@ -174,7 +264,7 @@ func JWTAuthMiddleware() fiber.Handler {
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 				return nil, fiber.NewError(401, "Invalid signing method")
 			}
-			return jwtSecret, nil
+			return secret, nil
 		})
 
 		if err != nil || !token.Valid {
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"bytes"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTOTPAdmin stores an admin with a password and an enabled TOTP secret, returning the secret
+func newTOTPAdmin(t *testing.T, h *Handler, username, password string) string {
+	t.Helper()
+	key := bytes.Repeat([]byte{7}, 32)
+	h.SetTOTPKey(key)
+
+	secret := "JBSWY3DPEHPK3PXP"
+	encrypted, err := system.EncryptSecret(key, secret)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	hashed, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	admin := models.Admin{Username: username, Password: string(hashed), Role: RoleAdmin, TOTPSecret: encrypted, TOTPEnabled: true}
+	if err := h.DB.Create(&admin).Error; err != nil {
+		t.Fatalf("create admin: %v", err)
+	}
+	return secret
+}
+
+// wrongTOTPCode returns a code that is not valid in the current skew window
+func wrongTOTPCode(t *testing.T, secret string) string {
+	t.Helper()
+	valid := make(map[string]bool)
+	now := time.Now()
+	for _, offset := range []time.Duration{-30 * time.Second, 0, 30 * time.Second} {
+		code, err := totp.GenerateCodeCustom(secret, now.Add(offset), totpValidateOpts)
+		if err != nil {
+			t.Fatalf("generate code: %v", err)
+		}
+		valid[code] = true
+	}
+	for _, code := range []string{"000000", "111111", "222222", "333333"} {
+		if !valid[code] {
+			return code
+		}
+	}
+	t.Fatal("no invalid code found")
+	return ""
+}
+
+func TestLoginWrongTOTPCodesLockAccount(t *testing.T) {
+	h := newTestHandler(t)
+	app := newTestApp()
+	app.Post("/login", h.Login)
+
+	secret := newTOTPAdmin(t, h, "totp-user", "correct-password")
+	wrong := wrongTOTPCode(t, secret)
+	body := map[string]string{"username": "totp-user", "password": "correct-password", "code": wrong}
+
+	for i := 1; i <= defaultLoginMaxAttempts; i++ {
+		if code := doJSON(t, app, http.MethodPost, "/login", body, nil); code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status %d, want 401", i, code)
+		}
+	}
+
+	var admin models.Admin
+	h.DB.Where("username = ?", "totp-user").First(&admin)
+	if admin.FailedAttempts != defaultLoginMaxAttempts {
+		t.Errorf("FailedAttempts = %d, want %d", admin.FailedAttempts, defaultLoginMaxAttempts)
+	}
+	if admin.LockedUntil == nil || !admin.LockedUntil.After(time.Now()) {
+		t.Fatalf("account not locked after %d wrong codes", defaultLoginMaxAttempts)
+	}
+
+	// Even the right code is refused while locked
+	valid, _ := totp.GenerateCodeCustom(secret, time.Now(), totpValidateOpts)
+	body["code"] = valid
+	if code := doJSON(t, app, http.MethodPost, "/login", body, nil); code != http.StatusForbidden {
+		t.Errorf("login while locked: status %d, want 403", code)
+	}
+}
+
+func TestLoginResetsFailuresOnlyAfterTOTP(t *testing.T) {
+	h := newTestHandler(t)
+	app := newTestApp()
+	app.Post("/login", h.Login)
+
+	secret := newTOTPAdmin(t, h, "totp-user2", "correct-password")
+	body := map[string]string{"username": "totp-user2", "password": "correct-password", "code": wrongTOTPCode(t, secret)}
+	doJSON(t, app, http.MethodPost, "/login", body, nil)
+	doJSON(t, app, http.MethodPost, "/login", body, nil)
+
+	var admin models.Admin
+	h.DB.Where("username = ?", "totp-user2").First(&admin)
+	if admin.FailedAttempts != 2 {
+		t.Fatalf("FailedAttempts = %d after two wrong codes, want 2", admin.FailedAttempts)
+	}
+
+	body["code"], _ = totp.GenerateCodeCustom(secret, time.Now(), totpValidateOpts)
+	if code := doJSON(t, app, http.MethodPost, "/login", body, nil); code != http.StatusOK {
+		t.Fatalf("login with valid code: status %d", code)
+	}
+	h.DB.Where("username = ?", "totp-user2").First(&admin)
+	if admin.FailedAttempts != 0 || admin.LockedUntil != nil {
+		t.Errorf("failures not reset after a full login: attempts=%d locked=%v", admin.FailedAttempts, admin.LockedUntil)
+	}
+}
@@ -24,6 +24,21 @@ type BackupData struct {
 // ExportConfig exports all configuration as JSON
 // GET /api/backup/export
 func (h *Handler) ExportConfig(c *fiber.Ctx) error {
+	backup := h.collectBackup()
+
+	// Set filename for download
+	filename := "kg-proxy-backup-" + time.Now().Format("2006-01-02") + ".json"
+	c.Set("Content-Disposition", "attachment; filename="+filename)
+	c.Set("Content-Type", "application/json")
+
+	system.Info("Configuration exported")
+	AddEvent("success", "Configuration exported")
+
+	return c.JSON(backup)
+}
+
+// collectBackup reads the current configuration from the database
+func (h *Handler) collectBackup() BackupData {
 	backup := BackupData{
 		ExportedAt: time.Now(),
 		Version:    "1.0",
@@ -36,16 +51,7 @@ func (h *Handler) ExportConfig(c *fiber.Ctx) error {
 	h.DB.Find(&backup.AllowIPs)
 	h.DB.Find(&backup.BanIPs)
 	h.DB.Find(&backup.AllowForeign)
-
-	// Set filename for download
-	filename := "kg-proxy-backup-" + time.Now().Format("2006-01-02") + ".json"
-	c.Set("Content-Disposition", "attachment; filename="+filename)
-	c.Set("Content-Type", "application/json")
-
-	system.Info("Configuration exported")
-	AddEvent("success", "Configuration exported")
-
-	return c.JSON(backup)
+	return backup
 }
 
 // ImportConfig imports configuration from JSON
@@ -130,10 +136,17 @@ func (h *Handler) ImportConfig(c *fiber.Ctx) error {
 			existing.SYNCookies = backup.SecuritySettings.SYNCookies
 			existing.ProtectionLevel = backup.SecuritySettings.ProtectionLevel
 			existing.GeoAllowCountries = backup.SecuritySettings.GeoAllowCountries
+			if backup.SecuritySettings.GeoMode != "" { // Absent in backups taken before block mode existed
+				existing.GeoMode = backup.SecuritySettings.GeoMode
+				existing.GeoBlockCountries = backup.SecuritySettings.GeoBlockCountries
+			}
 			existing.SmartBanning = backup.SecuritySettings.SmartBanning
 			existing.SteamQueryBypass = backup.SecuritySettings.SteamQueryBypass
+			existing.SteamQueryPorts = backup.SecuritySettings.SteamQueryPorts
+			existing.SteamQueryScope = backup.SecuritySettings.SteamQueryScope
 			existing.XDPHardBlocking = backup.SecuritySettings.XDPHardBlocking
 			existing.XDPRateLimitPPS = backup.SecuritySettings.XDPRateLimitPPS
+			existing.XDPRateLimitBurst = backup.SecuritySettings.XDPRateLimitBurst
 			tx.Save(&existing)
 		}
 	}
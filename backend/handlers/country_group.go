@@ -2,20 +2,84 @@ package handlers
 
 import (
 	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/services"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-// GetCountryGroups returns all country groups
+// countryGroupInfo is a country group enriched with its live filtering state
+type countryGroupInfo struct {
+	models.CountryGroup
+	CountryCount int  `json:"country_count"`
+	CIDRCount    int  `json:"cidr_count"` // Ranges loaded for the group's countries
+	Active       bool `json:"active"`     // Every country is in the geo filter currently in force
+}
+
+// GetCountryGroups returns all country groups with their country count, loaded CIDR count
+// and whether the geo filter currently covers them
 // GET /api/security/countries/groups
 func (h *Handler) GetCountryGroups(c *fiber.Ctx) error {
 	var groups []models.CountryGroup
 	if err := h.DB.Order("name ASC").Find(&groups).Error; err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
-	return c.JSON(groups)
+
+	filtered := h.geoFilterCountries()
+	infos := make([]countryGroupInfo, 0, len(groups))
+	for _, group := range groups {
+		codes := countryGroupCodes(group)
+		info := countryGroupInfo{CountryGroup: group, CountryCount: len(codes), Active: len(codes) > 0}
+		for _, cc := range codes {
+			if h.Firewall != nil && h.Firewall.GeoIP != nil {
+				info.CIDRCount += len(h.Firewall.GeoIP.GetCountryCIDRs(cc))
+			}
+			if !filtered[cc] {
+				info.Active = false
+			}
+		}
+		infos = append(infos, info)
+	}
+	return c.JSON(infos)
+}
+
+// GetCountryGroupCIDRs expands a country group to the CIDR ranges currently loaded for its countries
+// GET /api/security/countries/groups/:id/cidrs
+func (h *Handler) GetCountryGroupCIDRs(c *fiber.Ctx) error {
+	var group models.CountryGroup
+	if err := h.DB.First(&group, c.Params("id")).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Group not found"})
+	}
+	if h.Firewall == nil || h.Firewall.GeoIP == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "GeoIP service not available"})
+	}
+
+	type countryCIDRs struct {
+		Code  string   `json:"code"`
+		CIDRs []string `json:"cidrs"`
+	}
+	countries := []countryCIDRs{}
+	missing := []string{}
+	total := 0
+	for _, cc := range countryGroupCodes(group) {
+		cidrs := h.Firewall.GeoIP.GetCountryCIDRs(cc)
+		if len(cidrs) == 0 {
+			missing = append(missing, cc)
+			cidrs = []string{}
+		}
+		countries = append(countries, countryCIDRs{Code: cc, CIDRs: cidrs})
+		total += len(cidrs)
+	}
+
+	return c.JSON(fiber.Map{
+		"id":        group.ID,
+		"name":      group.Name,
+		"countries": countries,
+		"missing":   missing,
+		"total":     total,
+	})
 }
 
 // CreateCountryGroup creates a new country group
@@ -25,6 +89,9 @@ func (h *Handler) CreateCountryGroup(c *fiber.Ctx) error {
 	if err := c.BodyParser(&input); err != nil {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
 	}
+	if err := cleanCountryGroupText(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
 
 	if input.Name == "" {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Name is required"})
@@ -62,6 +129,12 @@ func (h *Handler) UpdateCountryGroup(c *fiber.Ctx) error {
 	if err := c.BodyParser(&input); err != nil {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
 	}
+	if err := cleanCountryGroupText(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if input.Name == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Name is required"})
+	}
 
 	group.Name = input.Name
 	group.Description = input.Description
@@ -98,3 +171,43 @@ func (h *Handler) DeleteCountryGroup(c *fiber.Ctx) error {
 	}
 	return c.JSON(fiber.Map{"success": true})
 }
+
+// cleanCountryGroupText sanitizes the free-text fields of a country group
+func cleanCountryGroupText(group *models.CountryGroup) error {
+	return cleanTextFields(
+		textField{"name", &group.Name, maxNameLength},
+		textField{"description", &group.Description, maxDescriptionLength},
+		textField{"color", &group.Color, maxNameLength},
+	)
+}
+
+// countryGroupCodes returns the group's country codes
+func countryGroupCodes(group models.CountryGroup) []string {
+	var codes []string
+	for _, cc := range strings.Split(group.Countries, ",") {
+		if cc = strings.TrimSpace(cc); cc != "" {
+			codes = append(codes, cc)
+		}
+	}
+	return codes
+}
+
+// geoFilterCountries returns the countries the geo filter currently acts on: the allowed countries
+// in force (including geo schedules) in allow mode, the blocked countries in block mode
+func (h *Handler) geoFilterCountries() map[string]bool {
+	set := make(map[string]bool)
+	var settings models.SecuritySettings
+	if err := h.DB.First(&settings, 1).Error; err != nil {
+		return set
+	}
+	var countries []string
+	if services.GeoBlockModeActive(&settings) {
+		countries = services.GeoBlockCountries(&settings)
+	} else if h.Firewall != nil {
+		countries = h.Firewall.EffectiveGeoCountries(&settings, time.Now())
+	}
+	for _, cc := range countries {
+		set[cc] = true
+	}
+	return set
+}
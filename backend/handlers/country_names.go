@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Operator overrides merged over builtinCountryNames
+var (
+	countryNameOverrides   = map[string]string{}
+	countryNameOverridesMu sync.RWMutex
+)
+
+// loadCountryNameOverrides refreshes the override cache from the database
+func loadCountryNameOverrides(db *gorm.DB) {
+	var rows []models.CountryNameOverride
+	if err := db.Find(&rows).Error; err != nil {
+		system.Warn("Failed to load country name overrides: %v", err)
+		return
+	}
+
+	overrides := make(map[string]string, len(rows))
+	for _, row := range rows {
+		overrides[row.Code] = row.Name
+	}
+
+	countryNameOverridesMu.Lock()
+	countryNameOverrides = overrides
+	countryNameOverridesMu.Unlock()
+}
+
+func lookupCountryNameOverride(code string) (string, bool) {
+	countryNameOverridesMu.RLock()
+	defer countryNameOverridesMu.RUnlock()
+	name, ok := countryNameOverrides[code]
+	return name, ok
+}
+
+// GetCountryNames returns the effective country display names and the active overrides
+// GET /api/security/countries/names
+func (h *Handler) GetCountryNames(c *fiber.Ctx) error {
+	var overrides []models.CountryNameOverride
+	h.DB.Order("code ASC").Find(&overrides)
+
+	names := make(map[string]string, len(builtinCountryNames)+len(overrides))
+	for code, name := range builtinCountryNames {
+		names[code] = name
+	}
+	for _, o := range overrides {
+		names[o.Code] = o.Name
+	}
+
+	return c.JSON(fiber.Map{"names": names, "overrides": overrides})
+}
+
+// SetCountryNameOverride creates or updates the display name for a country code
+// PUT /api/security/countries/names/:code
+func (h *Handler) SetCountryNameOverride(c *fiber.Ctx) error {
+	code := strings.ToUpper(strings.TrimSpace(c.Params("code")))
+	if len(code) != 2 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Country code must be 2 letters"})
+	}
+
+	var input struct {
+		Name string `json:"name"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	if err := cleanTextFields(textField{"name", &input.Name, maxNameLength}); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if input.Name == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Name is required"})
+	}
+
+	var override models.CountryNameOverride
+	h.DB.Where("code = ?", code).First(&override)
+	override.Code = code
+	override.Name = input.Name
+	if err := h.DB.Save(&override).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	loadCountryNameOverrides(h.DB)
+	AddEvent("info", "Country name override set: "+code+" = "+input.Name)
+	return c.JSON(override)
+}
+
+// DeleteCountryNameOverride restores the built-in display name for a country code
+// DELETE /api/security/countries/names/:code
+func (h *Handler) DeleteCountryNameOverride(c *fiber.Ctx) error {
+	code := strings.ToUpper(strings.TrimSpace(c.Params("code")))
+
+	result := h.DB.Where("code = ?", code).Delete(&models.CountryNameOverride{})
+	if result.Error != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": result.Error.Error()})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Override not found"})
+	}
+
+	loadCountryNameOverrides(h.DB)
+	AddEvent("info", "Country name override removed: "+code)
+	return c.JSON(fiber.Map{"success": true})
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// CSRFCookieName holds the double-submit token; readable by the frontend so it can echo it back
+	CSRFCookieName = "kg_csrf"
+	// CSRFHeaderName must carry the same value as the cookie on state-changing requests
+	CSRFHeaderName = "X-CSRF-Token"
+)
+
+// csrfEnabled is off by default: the frontend authenticates with a bearer header,
+// which a cross-site form cannot forge. Enable it when tokens may end up in cookies.
+var csrfEnabled atomic.Bool
+
+// SetCSRFEnabled toggles double-submit CSRF checks (KG_CSRF_PROTECTION)
+func SetCSRFEnabled(enabled bool) {
+	csrfEnabled.Store(enabled)
+}
+
+// IsCSRFEnabled reports whether CSRF checks are active
+func IsCSRFEnabled() bool {
+	return csrfEnabled.Load()
+}
+
+// issueCSRFToken generates a fresh token and sets it as a same-site cookie
+func issueCSRFToken(c *fiber.Ctx) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	c.Cookie(&fiber.Cookie{
+		Name:     CSRFCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  time.Now().Add(24 * time.Hour), // Matches JWT lifetime
+		Secure:   c.Protocol() == "https",
+		HTTPOnly: false, // The frontend copies it into the header
+		SameSite: fiber.CookieSameSiteStrictMode,
+	})
+	return token, nil
+}
+
+// CSRFMiddleware rejects state-changing requests whose X-CSRF-Token header
+// does not match the kg_csrf cookie issued at login. No-op unless enabled.
+func CSRFMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !csrfEnabled.Load() {
+			return c.Next()
+		}
+		// API keys are sent explicitly by scripts, never attached by a browser
+		if isAPIKeyRequest(c) {
+			return c.Next()
+		}
+
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+			return c.Next()
+		}
+
+		cookie := c.Cookies(CSRFCookieName)
+		header := c.Get(CSRFHeaderName)
+		if cookie == "" || header == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) != 1 {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Invalid or missing CSRF token"})
+		}
+
+		return c.Next()
+	}
+}
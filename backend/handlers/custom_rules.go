@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/services"
+	"kg-proxy-web-gui/backend/system"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// customRuleInput is the editable part of a CustomRule
+type customRuleInput struct {
+	Table       string `json:"table"`
+	Chain       string `json:"chain"`
+	Rule        string `json:"rule"`
+	Description string `json:"description"`
+	Enabled     *bool  `json:"enabled"`
+	Order       int    `json:"order"`
+}
+
+// GetCustomRules lists operator-supplied iptables rules in application order
+// GET /api/firewall/custom-rules
+func (h *Handler) GetCustomRules(c *fiber.Ctx) error {
+	var rules []models.CustomRule
+	if err := h.DB.Order("rule_table, chain, position, id").Find(&rules).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(rules)
+}
+
+// CreateCustomRule validates and stores a custom rule, then re-applies the firewall
+// POST /api/firewall/custom-rules
+func (h *Handler) CreateCustomRule(c *fiber.Ctx) error {
+	var input customRuleInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	rule := models.CustomRule{
+		Table:       input.Table,
+		Chain:       input.Chain,
+		Rule:        input.Rule,
+		Description: input.Description,
+		Enabled:     input.Enabled == nil || *input.Enabled,
+		Order:       input.Order,
+	}
+	if err := h.checkCustomRule(&rule); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := h.DB.Create(&rule).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	system.Info("Custom firewall rule #%d added: %s %s %s", rule.ID, rule.Table, rule.Chain, rule.Rule)
+	AddEvent("info", fmt.Sprintf("Custom firewall rule #%d added to %s/%s", rule.ID, rule.Table, rule.Chain))
+	if h.Firewall != nil && rule.Enabled {
+		go h.Firewall.ApplyRules()
+	}
+	return c.Status(http.StatusCreated).JSON(rule)
+}
+
+// UpdateCustomRule replaces a custom rule's fields, then re-applies the firewall
+// PUT /api/firewall/custom-rules/:id
+func (h *Handler) UpdateCustomRule(c *fiber.Ctx) error {
+	var rule models.CustomRule
+	if err := h.DB.First(&rule, c.Params("id")).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Custom rule not found"})
+	}
+
+	var input customRuleInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	rule.Table = input.Table
+	rule.Chain = input.Chain
+	rule.Rule = input.Rule
+	rule.Description = input.Description
+	rule.Order = input.Order
+	if input.Enabled != nil {
+		rule.Enabled = *input.Enabled
+	}
+	if err := h.checkCustomRule(&rule); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := h.DB.Save(&rule).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	system.Info("Custom firewall rule #%d updated: %s %s %s (enabled=%v)", rule.ID, rule.Table, rule.Chain, rule.Rule, rule.Enabled)
+	if h.Firewall != nil {
+		go h.Firewall.ApplyRules()
+	}
+	return c.JSON(rule)
+}
+
+// DeleteCustomRule removes a custom rule, then re-applies the firewall
+// DELETE /api/firewall/custom-rules/:id
+func (h *Handler) DeleteCustomRule(c *fiber.Ctx) error {
+	var rule models.CustomRule
+	if err := h.DB.First(&rule, c.Params("id")).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Custom rule not found"})
+	}
+	if err := h.DB.Delete(&rule).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	system.Info("Custom firewall rule #%d deleted", rule.ID)
+	AddEvent("info", fmt.Sprintf("Custom firewall rule #%d removed from %s/%s", rule.ID, rule.Table, rule.Chain))
+	if h.Firewall != nil {
+		go h.Firewall.ApplyRules()
+	}
+	return c.JSON(fiber.Map{"message": "Custom rule deleted"})
+}
+
+// checkCustomRule runs the static safety checks and an iptables dry run
+func (h *Handler) checkCustomRule(rule *models.CustomRule) error {
+	if err := cleanTextFields(textField{"description", &rule.Description, maxDescriptionLength}); err != nil {
+		return err
+	}
+	if err := services.ValidateCustomRule(rule); err != nil {
+		return err
+	}
+	if h.Firewall != nil {
+		return h.Firewall.TestCustomRule(rule)
+	}
+	return nil
+}
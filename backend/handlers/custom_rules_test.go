@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"kg-proxy-web-gui/backend/models"
+	"testing"
+)
+
+func TestCreateCustomRuleDisabled(t *testing.T) {
+	h := newTestHandler(t)
+	app := newTestApp()
+	app.Post("/firewall/custom-rules", h.CreateCustomRule)
+
+	disabled := false
+	for i := 0; i < 2; i++ {
+		body := map[string]interface{}{"table": "filter", "chain": "INPUT", "rule": "-p tcp --dport 8080 -j ACCEPT", "enabled": &disabled}
+		if status := doJSON(t, app, "POST", "/firewall/custom-rules", body, nil); status != 201 {
+			t.Fatalf("create status = %d, want 201", status)
+		}
+	}
+
+	var rules []models.CustomRule
+	h.DB.Order("id").Find(&rules)
+	if len(rules) != 2 || rules[0].ID == rules[1].ID {
+		t.Fatalf("rules = %+v, want two rows with their own IDs", rules)
+	}
+	for _, rule := range rules {
+		if rule.Enabled {
+			t.Errorf("rule #%d stored as enabled", rule.ID)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/services"
 	"net/http"
 	"os/exec"
 	"regexp"
@@ -132,38 +134,94 @@ func (h *Handler) RunTraceroute(c *fiber.Ctx) error {
 	})
 }
 
-// CheckWireGuardConnectivity pings the Origin Peer via WG interface
+// wgHandshakeStaleAfter is the handshake age after which an origin counts as unreachable.
+// An active tunnel re-handshakes every 2 minutes, so anything older means no traffic got through.
+const wgHandshakeStaleAfter = 3 * time.Minute
+
+// Origin reachability states reported by CheckWireGuardConnectivity
+const (
+	wgReachOK       = "ok"        // Handshake within wgHandshakeStaleAfter
+	wgReachStale    = "stale"     // Last handshake is older
+	wgReachNever    = "never"     // Peer loaded but never completed a handshake
+	wgReachNotOnWG0 = "not_on_wg" // Peer exists in the database but not on wg0
+	wgReachNoPeer   = "no_peer"   // Origin has no WireGuard peer
+)
+
+// wgOriginReachability is the WireGuard view of one origin
+type wgOriginReachability struct {
+	OriginID        uint       `json:"origin_id"`
+	Name            string     `json:"name"`
+	WgIP            string     `json:"wg_ip"`
+	State           string     `json:"state"`
+	LastHandshake   *time.Time `json:"last_handshake,omitempty"`
+	HandshakeAgeSec *int64     `json:"handshake_age_sec,omitempty"`
+	Endpoint        string     `json:"endpoint,omitempty"`
+	RxBytes         int64      `json:"rx_bytes"`
+	TxBytes         int64      `json:"tx_bytes"`
+}
+
+// CheckWireGuardConnectivity reports per-origin reachability from the wg0 handshake ages
+// (a passive check: nothing is sent to the origins)
 // GET /api/tools/wg-ping
 func (h *Handler) CheckWireGuardConnectivity(c *fiber.Ctx) error {
 	if h.WG == nil {
 		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "WireGuard service not initialized"})
 	}
 
-	// We ping the Origin Peer IP (e.g. 10.200.0.2)
-	// We need to know which origin. For now, let's ping all known origins and return results.
-
-	// Get all origins
-	// Handler doesn't have direct access to Origin model list without DB query
-	// But allowed to query DB.
-
-	type OriginStatus struct {
-		Name      string `json:"name"`
-		IP        string `json:"ip"`
-		Alive     bool   `json:"alive"`
-		LatencyMs int64  `json:"latency_ms"`
-	}
-
-	// TODO: Fetch origins from DB
-	// We can implement a simplified version pinging the gateway or just one.
-
-	// Using h.WG to check handshake is better (non-intrusive)
 	status, err := h.WG.GetStatus()
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	// Parse status
-	// We can just return the handshake times which is "passive ping"
+	var origins []models.Origin
+	if err := h.DB.Preload("Peer").Order("name").Find(&origins).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	live := make(map[string]services.WGPeerStats, len(status.Peers))
+	for _, p := range status.Peers {
+		live[p.PublicKey] = p
+	}
+
+	now := time.Now()
+	counts := make(map[string]int)
+	results := make([]wgOriginReachability, 0, len(origins))
+	for _, o := range origins {
+		r := wgOriginReachability{OriginID: o.ID, Name: o.Name, WgIP: o.WgIP}
+		peer, loaded := services.WGPeerStats{}, false
+		if o.Peer != nil {
+			peer, loaded = live[o.Peer.PublicKey]
+		}
+		switch {
+		case o.Peer == nil:
+			r.State = wgReachNoPeer
+		case !loaded:
+			r.State = wgReachNotOnWG0
+		case peer.LastHandshake == nil:
+			r.State = wgReachNever
+		default:
+			age := int64(now.Sub(*peer.LastHandshake).Seconds())
+			r.LastHandshake, r.HandshakeAgeSec = peer.LastHandshake, &age
+			r.State = wgReachOK
+			if now.Sub(*peer.LastHandshake) > wgHandshakeStaleAfter {
+				r.State = wgReachStale
+			}
+		}
+		if loaded {
+			r.Endpoint, r.RxBytes, r.TxBytes = peer.Endpoint, peer.RxBytes, peer.TxBytes
+		}
+		counts[r.State]++
+		results = append(results, r)
+	}
 
-	return c.JSON(status)
+	return c.JSON(fiber.Map{
+		"interface":       status.Interface,
+		"up":              status.Up,
+		"mtu":             status.MTU,
+		"mock_mode":       status.MockMode,
+		"stale_after_sec": int(wgHandshakeStaleAfter.Seconds()),
+		"origins":         results,
+		"summary":         counts,
+		"peers":           status.Peers,
+	})
 }
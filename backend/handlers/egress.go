@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/services"
+	"kg-proxy-web-gui/backend/system"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// egressPolicyInput is the editable part of an EgressPolicy
+type egressPolicyInput struct {
+	OriginID    uint   `json:"origin_id"`
+	Destination string `json:"destination"`
+	Protocol    string `json:"protocol"`
+	Ports       string `json:"ports"`
+	Description string `json:"description"`
+	Enabled     *bool  `json:"enabled"`
+}
+
+// GetEgressPolicies lists the destinations origins may connect to when egress filtering is enabled
+// GET /api/firewall/egress-policies
+func (h *Handler) GetEgressPolicies(c *fiber.Ctx) error {
+	var policies []models.EgressPolicy
+	if err := h.DB.Order("origin_id, id").Find(&policies).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var settings models.SecuritySettings
+	h.DB.First(&settings)
+	return c.JSON(fiber.Map{
+		"enabled":  settings.EgressFilterEnabled,
+		"mode":     settings.EgressFilterMode,
+		"policies": policies,
+	})
+}
+
+// CreateEgressPolicy stores an allowed egress destination, then re-applies the firewall
+// POST /api/firewall/egress-policies
+func (h *Handler) CreateEgressPolicy(c *fiber.Ctx) error {
+	var input egressPolicyInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	policy := models.EgressPolicy{
+		OriginID:    input.OriginID,
+		Destination: input.Destination,
+		Protocol:    input.Protocol,
+		Ports:       input.Ports,
+		Description: input.Description,
+		Enabled:     input.Enabled == nil || *input.Enabled,
+	}
+	if err := h.checkEgressPolicy(&policy); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := h.DB.Create(&policy).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	system.Info("Egress policy #%d added: origin=%d dst=%s %s %s", policy.ID, policy.OriginID, policy.Destination, policy.Protocol, policy.Ports)
+	AddEvent("info", fmt.Sprintf("Egress policy #%d added", policy.ID))
+	h.reapplyEgress()
+	return c.Status(http.StatusCreated).JSON(policy)
+}
+
+// UpdateEgressPolicy replaces an egress policy's fields, then re-applies the firewall
+// PUT /api/firewall/egress-policies/:id
+func (h *Handler) UpdateEgressPolicy(c *fiber.Ctx) error {
+	var policy models.EgressPolicy
+	if err := h.DB.First(&policy, c.Params("id")).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Egress policy not found"})
+	}
+
+	var input egressPolicyInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	policy.OriginID = input.OriginID
+	policy.Destination = input.Destination
+	policy.Protocol = input.Protocol
+	policy.Ports = input.Ports
+	policy.Description = input.Description
+	if input.Enabled != nil {
+		policy.Enabled = *input.Enabled
+	}
+	if err := h.checkEgressPolicy(&policy); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := h.DB.Save(&policy).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	system.Info("Egress policy #%d updated (enabled=%v)", policy.ID, policy.Enabled)
+	h.reapplyEgress()
+	return c.JSON(policy)
+}
+
+// DeleteEgressPolicy removes an egress policy, then re-applies the firewall
+// DELETE /api/firewall/egress-policies/:id
+func (h *Handler) DeleteEgressPolicy(c *fiber.Ctx) error {
+	var policy models.EgressPolicy
+	if err := h.DB.First(&policy, c.Params("id")).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Egress policy not found"})
+	}
+	if err := h.DB.Delete(&policy).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	system.Info("Egress policy #%d deleted", policy.ID)
+	AddEvent("info", fmt.Sprintf("Egress policy #%d removed", policy.ID))
+	h.reapplyEgress()
+	return c.JSON(fiber.Map{"message": "Egress policy deleted"})
+}
+
+// checkEgressPolicy validates the policy and that its origin exists
+func (h *Handler) checkEgressPolicy(policy *models.EgressPolicy) error {
+	if err := cleanTextFields(textField{"description", &policy.Description, maxDescriptionLength}); err != nil {
+		return err
+	}
+	if err := services.ValidateEgressPolicy(policy); err != nil {
+		return err
+	}
+	if policy.OriginID != 0 {
+		var count int64
+		h.DB.Model(&models.Origin{}).Where("id = ?", policy.OriginID).Count(&count)
+		if count == 0 {
+			return fmt.Errorf("origin %d not found", policy.OriginID)
+		}
+	}
+	return nil
+}
+
+// reapplyEgress re-applies the firewall when egress filtering is active
+func (h *Handler) reapplyEgress() {
+	var settings models.SecuritySettings
+	if h.Firewall == nil || h.DB.First(&settings).Error != nil || !settings.EgressFilterEnabled {
+		return
+	}
+	go h.Firewall.ApplyRules()
+}
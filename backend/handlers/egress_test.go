@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"kg-proxy-web-gui/backend/models"
+	"testing"
+)
+
+func TestCreateEgressPolicyDisabled(t *testing.T) {
+	h := newTestHandler(t)
+	app := newTestApp()
+	app.Post("/firewall/egress-policies", h.CreateEgressPolicy)
+
+	body := map[string]interface{}{"destination": "203.0.113.0/24", "protocol": "tcp", "ports": "443", "enabled": false}
+	if status := doJSON(t, app, "POST", "/firewall/egress-policies", body, nil); status != 201 {
+		t.Fatalf("create status = %d, want 201", status)
+	}
+
+	var policy models.EgressPolicy
+	if err := h.DB.First(&policy).Error; err != nil {
+		t.Fatalf("load policy: %v", err)
+	}
+	if policy.Enabled {
+		t.Error("policy created with enabled:false was stored as enabled")
+	}
+}
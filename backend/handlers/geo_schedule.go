@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/services"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// geoScheduleInput is the body of create/update geo schedule requests
+type geoScheduleInput struct {
+	Name      string `json:"name"`
+	Days      string `json:"days"`
+	StartHour int    `json:"start_hour"`
+	EndHour   int    `json:"end_hour"`
+	Countries string `json:"countries"`
+	Mode      string `json:"mode"`
+	Enabled   *bool  `json:"enabled"` // Defaults to true
+}
+
+// apply copies the input onto a schedule and validates it
+func (in geoScheduleInput) apply(sch *models.GeoSchedule) error {
+	sch.Name = in.Name
+	sch.Days = in.Days
+	sch.StartHour = in.StartHour
+	sch.EndHour = in.EndHour
+	sch.Countries = in.Countries
+	sch.Mode = in.Mode
+	sch.Enabled = in.Enabled == nil || *in.Enabled
+	if err := cleanTextFields(textField{"name", &sch.Name, maxNameLength}); err != nil {
+		return err
+	}
+	return services.NormalizeGeoSchedule(sch)
+}
+
+// GetGeoSchedules returns all geo schedules, the ones active right now and the resulting allowed countries
+// GET /api/security/geo-schedules
+func (h *Handler) GetGeoSchedules(c *fiber.Ctx) error {
+	var schedules []models.GeoSchedule
+	if err := h.DB.Order("id ASC").Find(&schedules).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var settings models.SecuritySettings
+	if err := h.DB.First(&settings, 1).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load settings"})
+	}
+
+	now := time.Now()
+	active := make([]uint, 0)
+	for _, sch := range schedules {
+		if services.GeoScheduleActive(sch, now) {
+			active = append(active, sch.ID)
+		}
+	}
+	effective := strings.Split(settings.GeoAllowCountries, ",")
+	if h.Firewall != nil {
+		effective = h.Firewall.EffectiveGeoCountries(&settings, now)
+	}
+
+	return c.JSON(fiber.Map{
+		"schedules":           schedules,
+		"active":              active,
+		"base_countries":      settings.GeoAllowCountries,
+		"effective_countries": effective,
+		"server_time":         now.Format(time.RFC3339),
+	})
+}
+
+// CreateGeoSchedule adds a geo schedule and re-applies the firewall if it is active now
+// POST /api/security/geo-schedules
+func (h *Handler) CreateGeoSchedule(c *fiber.Ctx) error {
+	var input geoScheduleInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	var schedule models.GeoSchedule
+	if err := input.apply(&schedule); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := h.DB.Create(&schedule).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	AddEvent("info", fmt.Sprintf("Geo schedule '%s' created (%s %s)", schedule.Name, schedule.Mode, schedule.Countries))
+	h.applyGeoSchedules()
+	return c.Status(http.StatusCreated).JSON(schedule)
+}
+
+// UpdateGeoSchedule replaces a geo schedule
+// PUT /api/security/geo-schedules/:id
+func (h *Handler) UpdateGeoSchedule(c *fiber.Ctx) error {
+	var schedule models.GeoSchedule
+	if err := h.DB.First(&schedule, c.Params("id")).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Schedule not found"})
+	}
+
+	var input geoScheduleInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	if err := input.apply(&schedule); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := h.DB.Save(&schedule).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	AddEvent("info", fmt.Sprintf("Geo schedule '%s' updated", schedule.Name))
+	h.applyGeoSchedules()
+	return c.JSON(schedule)
+}
+
+// DeleteGeoSchedule removes a geo schedule
+// DELETE /api/security/geo-schedules/:id
+func (h *Handler) DeleteGeoSchedule(c *fiber.Ctx) error {
+	var schedule models.GeoSchedule
+	if err := h.DB.First(&schedule, c.Params("id")).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Schedule not found"})
+	}
+	if err := h.DB.Delete(&schedule).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	AddEvent("info", fmt.Sprintf("Geo schedule '%s' deleted", schedule.Name))
+	h.applyGeoSchedules()
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// applyGeoSchedules re-applies the firewall so a schedule change takes effect without waiting for the watcher
+func (h *Handler) applyGeoSchedules() {
+	if h.Firewall != nil {
+		go h.Firewall.ApplyRules()
+	}
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"kg-proxy-web-gui/backend/models"
+	"testing"
+)
+
+func TestCreateGeoScheduleDisabled(t *testing.T) {
+	h := newTestHandler(t)
+	app := newTestApp()
+	app.Post("/security/geo-schedules", h.CreateGeoSchedule)
+
+	body := map[string]interface{}{"name": "weekend", "days": "sat,sun", "start_hour": 18, "end_hour": 24, "countries": "JP", "mode": "add", "enabled": false}
+	if status := doJSON(t, app, "POST", "/security/geo-schedules", body, nil); status != 201 {
+		t.Fatalf("create status = %d, want 201", status)
+	}
+
+	var schedule models.GeoSchedule
+	if err := h.DB.First(&schedule).Error; err != nil {
+		t.Fatalf("load schedule: %v", err)
+	}
+	if schedule.Enabled {
+		t.Error("schedule created with enabled:false was stored as enabled")
+	}
+}
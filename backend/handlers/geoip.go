@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/services"
+	"kg-proxy-web-gui/backend/system"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// effectiveCountry compares one country's configured state with what is actually enforced
+type effectiveCountry struct {
+	Code       string `json:"code"`
+	Configured bool   `json:"configured"`   // Listed in GeoAllowCountries or an active geo schedule
+	CachedCIDR int    `json:"cached_cidrs"` // Ranges downloaded (source of the geo_allowed ipset)
+	XDPCIDR    int    `json:"xdp_cidrs"`    // Ranges in the XDP geo_allowed map (-1 when eBPF is off)
+	Status     string `json:"status"`       // ok, no_ranges, stale
+	Detail     string `json:"detail,omitempty"`
+}
+
+// GetEffectiveGeoIP compares the configured allowed countries with the ranges actually loaded.
+// A configured country with zero ranges has all its traffic dropped; a country still in the
+// XDP map after being removed from settings is still allowed until the map is rebuilt.
+// GET /api/geoip/effective
+func (h *Handler) GetEffectiveGeoIP(c *fiber.Ctx) error {
+	var settings models.SecuritySettings
+	if err := h.DB.First(&settings).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load settings"})
+	}
+	if h.Firewall == nil || h.Firewall.GeoIP == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "GeoIP service not initialized"})
+	}
+
+	configured := make(map[string]bool)
+	for _, cc := range h.Firewall.EffectiveGeoCountries(&settings, time.Now()) {
+		configured[cc] = true
+	}
+
+	cached := make(map[string]int)
+	for cc, cidrs := range h.Firewall.GeoIP.GetAllCountryCIDRs() {
+		cached[strings.ToUpper(cc)] = len(cidrs)
+	}
+
+	xdpEnabled := h.EBPF != nil && h.EBPF.IsEnabled()
+	geoMap := services.GeoMapStatus{Countries: map[string]int{}}
+	if xdpEnabled {
+		geoMap = h.EBPF.GetGeoMapStatus()
+	}
+
+	codes := make(map[string]bool)
+	for cc := range configured {
+		codes[cc] = true
+	}
+	for cc := range geoMap.Countries {
+		codes[cc] = true
+	}
+
+	countries := make([]effectiveCountry, 0, len(codes))
+	var missing, stale []string
+	for cc := range codes {
+		entry := effectiveCountry{
+			Code:       cc,
+			Configured: configured[cc],
+			CachedCIDR: cached[cc],
+			XDPCIDR:    -1,
+			Status:     "ok",
+		}
+		if xdpEnabled {
+			entry.XDPCIDR = geoMap.Countries[cc]
+		}
+		switch {
+		case entry.Configured && (entry.CachedCIDR == 0 || entry.XDPCIDR == 0):
+			entry.Status = "no_ranges"
+			entry.Detail = "Allowed in settings but no ranges are loaded: its traffic is dropped by the geo filter"
+			missing = append(missing, cc)
+		case !entry.Configured && entry.XDPCIDR > 0:
+			entry.Status = "stale"
+			entry.Detail = "Removed from settings but still in the XDP map: its traffic is still allowed"
+			stale = append(stale, cc)
+		}
+		countries = append(countries, entry)
+	}
+	sort.Slice(countries, func(i, j int) bool { return countries[i].Code < countries[j].Code })
+	sort.Strings(missing)
+	sort.Strings(stale)
+
+	var warnings []string
+	if geoMap.FailSafeActive {
+		warnings = append(warnings, "XDP fail-safe active: the geo_allowed map is empty, so hard blocking is disabled and the XDP geo filter is bypassed")
+	}
+	if geoMap.Truncated {
+		warnings = append(warnings, "XDP geo_allowed map limit reached: some ranges were not loaded")
+	}
+	if len(missing) > 0 {
+		warnings = append(warnings, "Configured countries with no loaded ranges: "+strings.Join(missing, ", "))
+	}
+	if len(stale) > 0 {
+		warnings = append(warnings, "Countries still allowed by XDP but no longer configured: "+strings.Join(stale, ", "))
+	}
+
+	return c.JSON(fiber.Map{
+		"configured":         len(configured),
+		"countries":          countries,
+		"missing":            missing,
+		"stale":              stale,
+		"ipset_entries":      h.Firewall.IPSetEntryCount("geo_allowed"),
+		"xdp_enabled":        xdpEnabled,
+		"xdp_total_cidrs":    geoMap.TotalCIDRs,
+		"xdp_fail_safe":      geoMap.FailSafeActive,
+		"xdp_map_updated_at": geoMap.UpdatedAt,
+		"warnings":           warnings,
+	})
+}
+
+// ImportMaxMindCSV imports country CIDRs from MaxMind's GeoLite2-Country CSV edition.
+// The parsed import is cached for 24h; ?force=true downloads again regardless.
+// When the CSV is the selected country source the firewall is re-applied with the new ranges,
+// rolled back unless POST /api/firewall/confirm follows.
+// POST /api/geoip/import-maxmind-csv
+func (h *Handler) ImportMaxMindCSV(c *fiber.Ctx) error {
+	if h.Firewall == nil || h.Firewall.GeoIP == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "GeoIP service not initialized"})
+	}
+
+	summary, err := h.Firewall.GeoIP.ImportMaxMindCSV(c.QueryBool("force"))
+	if err != nil {
+		system.Warn("MaxMind CSV import failed: %v", err)
+		return c.Status(http.StatusBadGateway).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	active := h.Firewall.GeoIP.GetCountryCIDRSource() == services.CountryCIDRSourceMaxMindCSV
+	if active && !summary.Cached {
+		AddEvent("success", fmt.Sprintf("MaxMind country CIDRs imported (%d ranges), re-applying firewall", summary.TotalCIDRs))
+		go h.Firewall.ApplyRulesConfirmed()
+	}
+	return c.JSON(fiber.Map{
+		"import": summary,
+		"active": active, // false: stored, but country_cidr_source is still ipverse
+	})
+}
+
+// GetGeoIPFeeds returns the refresh schedule and last outcome of the GeoIP and threat feeds
+// GET /api/geoip/feeds
+func (h *Handler) GetGeoIPFeeds(c *fiber.Ctx) error {
+	if h.Firewall == nil || h.Firewall.GeoIP == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "GeoIP service not initialized"})
+	}
+	return c.JSON(h.Firewall.GeoIP.GetFeedStatus())
+}
+
+// GetGeoIPUpdateStatus returns the database build date, update policy and when the next refresh is due
+// GET /api/geoip/status
+func (h *Handler) GetGeoIPUpdateStatus(c *fiber.Ctx) error {
+	if h.Firewall == nil || h.Firewall.GeoIP == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "GeoIP service not initialized"})
+	}
+	return c.JSON(h.Firewall.GeoIP.GetUpdateStatus())
+}
+
+// CheckGeoIPUpdate compares the local database with MaxMind's latest build and downloads it only if newer.
+// A download re-applies the firewall, rolled back unless POST /api/firewall/confirm follows.
+// ?dry_run=true reports availability without downloading.
+// POST /api/geoip/check-update
+func (h *Handler) CheckGeoIPUpdate(c *fiber.Ctx) error {
+	if h.Firewall == nil || h.Firewall.GeoIP == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "GeoIP service not initialized"})
+	}
+
+	check, err := h.Firewall.GeoIP.CheckForUpdate(!c.QueryBool("dry_run"))
+	if err != nil {
+		return c.Status(http.StatusBadGateway).JSON(fiber.Map{"error": err.Error(), "check": check})
+	}
+	if check.Downloaded {
+		AddEvent("success", "GeoIP database updated to build "+check.RemoteBuild.Format("2006-01-02"))
+		go h.Firewall.ApplyRulesConfirmed()
+	}
+	return c.JSON(check)
+}
+
+// GetUnknownCountryStatus reports the unknown country (XX) policy and how much traffic falls into
+// the XX bucket: sources GeoIP places in no country
+// GET /api/geoip/unknown-country
+func (h *Handler) GetUnknownCountryStatus(c *fiber.Ctx) error {
+	var settings models.SecuritySettings
+	if err := h.DB.First(&settings).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load settings"})
+	}
+	if h.Firewall == nil || h.Firewall.GeoIP == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "GeoIP service not initialized"})
+	}
+
+	policy := settings.UnknownCountryPolicy
+	if policy == "" {
+		policy = services.UnknownCountryBlock
+	}
+
+	result := fiber.Map{
+		"policy":      policy,
+		"allowed":     h.Firewall.GeoIP.UnknownCountryAllowedNow(),
+		"xdp_enabled": false,
+	}
+	if cidrs, err := h.Firewall.GeoIP.UnclassifiedCIDRs(); err != nil {
+		result["unclassified_cidrs"] = 0
+		result["error"] = err.Error()
+	} else {
+		result["unclassified_cidrs"] = len(cidrs)
+	}
+
+	// Live XDP sample: sources that looked up as XX
+	if h.EBPF != nil && h.EBPF.IsEnabled() {
+		var packets int
+		var bytes int64
+		var ips, blocked int
+		for _, entry := range h.EBPF.GetTrafficData() {
+			if entry.CountryCode != services.UnknownCountryCode {
+				continue
+			}
+			packets += entry.PacketCount
+			bytes += entry.ByteCount
+			ips++
+			if entry.Blocked {
+				blocked++
+			}
+		}
+		result["xdp_enabled"] = true
+		result["xdp_cidrs"] = h.EBPF.GetGeoMapStatus().Countries[services.UnknownCountryCode]
+		result["active_ips"] = ips
+		result["blocked_ips"] = blocked
+		result["packets"] = packets
+		result["bytes"] = bytes
+	}
+
+	var attacks24h int64
+	h.DB.Model(&models.AttackEvent{}).
+		Where("country_code = ? AND timestamp >= ?", services.UnknownCountryCode, time.Now().Add(-24*time.Hour)).
+		Count(&attacks24h)
+	result["attacks_24h"] = attacks24h
+
+	return c.JSON(result)
+}
@@ -5,8 +5,10 @@ import (
 	"kg-proxy-web-gui/backend/models"
 	"kg-proxy-web-gui/backend/services"
 	"kg-proxy-web-gui/backend/system"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/skip2/go-qrcode"
 	"gorm.io/gorm"
 )
 
@@ -16,16 +18,26 @@ type Handler struct {
 	Firewall *services.FirewallService
 	EBPF     *services.EBPFService
 	Webhook  *services.WebhookService
+	Offenses *services.OffenseTracker
+
+	jwtSecret []byte // Signs login tokens, see SetJWTSecret
+	totpKey   []byte // Encrypts TOTP secrets, see SetTOTPKey
+}
+
+func NewHandler(db *gorm.DB, wg *services.WireGuardService, fw *services.FirewallService, ebpf *services.EBPFService, webhook *services.WebhookService, offenses *services.OffenseTracker) *Handler {
+	loadCountryNameOverrides(db)
+	return &Handler{DB: db, WG: wg, Firewall: fw, EBPF: ebpf, Webhook: webhook, Offenses: offenses}
 }
 
-func NewHandler(db *gorm.DB, wg *services.WireGuardService, fw *services.FirewallService, ebpf *services.EBPFService, webhook *services.WebhookService) *Handler {
-	return &Handler{DB: db, WG: wg, Firewall: fw, EBPF: ebpf, Webhook: webhook}
+// SetJWTSecret sets the key Login signs tokens with (must match JWTAuthMiddleware's)
+func (h *Handler) SetJWTSecret(secret []byte) {
+	h.jwtSecret = secret
 }
 
 // GetOrigins - List all origins
 func (h *Handler) GetOrigins(c *fiber.Ctx) error {
 	var origins []models.Origin
-	if err := h.DB.Preload("Services").Find(&origins).Error; err != nil {
+	if err := h.DB.Preload("Services").Preload("Peer").Find(&origins).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 	return c.JSON(origins)
@@ -37,12 +49,37 @@ func (h *Handler) CreateOrigin(c *fiber.Ctx) error {
 	if err := c.BodyParser(&origin); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
 	}
+	// Opt-in: existing origins and clients that don't send this keep plain key pairs
+	var opts struct {
+		UsePresharedKey bool `json:"use_preshared_key"`
+	}
+	c.BodyParser(&opts)
+	if err := cleanTextFields(textField{"name", &origin.Name, maxNameLength}); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Tunnel IP: lowest free address unless the client picked a free one explicitly
+	if origin.WgIP == "" {
+		wgIP, err := h.WG.AllocateWgIP()
+		if err != nil {
+			return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+		}
+		origin.WgIP = wgIP
+	} else if err := h.WG.ValidateWgIP(origin.WgIP, 0); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
 
 	// Generate WireGuard Keys
 	priv, pub, err := h.WG.GenerateKeys()
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to generate keys: " + err.Error()})
 	}
+	psk := ""
+	if opts.UsePresharedKey {
+		if psk, err = h.WG.GeneratePresharedKey(); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to generate preshared key: " + err.Error()})
+		}
+	}
 
 	// Save to DB (Origin + WG Peer)
 	// Transaction
@@ -53,9 +90,10 @@ func (h *Handler) CreateOrigin(c *fiber.Ctx) error {
 	}
 
 	peer := models.WireGuardPeer{
-		OriginID:   origin.ID,
-		PublicKey:  pub,
-		PrivateKey: priv, // In real app, might want to output this once or store securely
+		OriginID:     origin.ID,
+		PublicKey:    pub,
+		PrivateKey:   priv, // In real app, might want to output this once or store securely
+		PresharedKey: psk,
 	}
 	if err := tx.Create(&peer).Error; err != nil {
 		tx.Rollback()
@@ -78,16 +116,18 @@ func (h *Handler) CreateOrigin(c *fiber.Ctx) error {
 	// Endpoint
 	endpoint := fmt.Sprintf("%s:51820", vpsIP)
 	serverPubKey := h.WG.GetServerPublicKey()
+	dns := h.wgClientDNS()
 
 	return c.Status(201).JSON(fiber.Map{
 		"origin": origin,
 		"wg_config": fiber.Map{
 			"private_key":       priv,
 			"public_key":        pub,
+			"preshared_key":     psk,
 			"server_public_key": serverPubKey,
 			"allowed_ips":       allowedIPs,
 			"endpoint":          endpoint,
-			"dns":               "168.126.63.1",
+			"dns":               dns,
 		},
 	})
 }
@@ -104,9 +144,17 @@ func (h *Handler) UpdateOrigin(c *fiber.Ctx) error {
 	if err := c.BodyParser(&input); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
 	}
+	if err := cleanTextFields(textField{"name", &input.Name, maxNameLength}); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
 
 	origin.Name = input.Name
-	origin.WgIP = input.WgIP
+	if input.WgIP != "" && input.WgIP != origin.WgIP {
+		if err := h.WG.ValidateWgIP(input.WgIP, origin.ID); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		origin.WgIP = input.WgIP
+	}
 
 	if err := h.DB.Save(&origin).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
@@ -122,6 +170,7 @@ func (h *Handler) UpdateOrigin(c *fiber.Ctx) error {
 	allowedIPs, _ := h.WG.GenerateAllowedIPs(vpsIP, "10.0.0.0/8")
 	endpoint := fmt.Sprintf("%s:51820", vpsIP)
 	serverPubKey := h.WG.GetServerPublicKey()
+	dns := h.wgClientDNS()
 
 	return c.JSON(fiber.Map{
 		"origin": origin,
@@ -131,15 +180,241 @@ func (h *Handler) UpdateOrigin(c *fiber.Ctx) error {
 			"server_public_key": serverPubKey,
 			"allowed_ips":       allowedIPs,
 			"endpoint":          endpoint,
-			"dns":               "168.126.63.1",
+			"dns":               dns,
 		},
 	})
 }
 
-// ApplyFirewall - Trigger firewall update
-func (h *Handler) ApplyFirewall(c *fiber.Ctx) error {
-	if err := h.Firewall.ApplyRules(); err != nil {
+// wgClientDNS returns the DNS servers written into origin client configs
+func (h *Handler) wgClientDNS() string {
+	var settings models.SecuritySettings
+	if err := h.DB.First(&settings, 1).Error; err != nil {
+		return "168.126.63.1"
+	}
+	return settings.WGClientDNS
+}
+
+// originClientConfig assembles an origin's WireGuard client config; shared by the .conf and QR endpoints.
+// On failure it returns the HTTP status to answer with.
+func (h *Handler) originClientConfig(id string) (models.Origin, string, int, error) {
+	var origin models.Origin
+	if err := h.DB.First(&origin, id).Error; err != nil {
+		return origin, "", 404, fmt.Errorf("Origin not found")
+	}
+	var peer models.WireGuardPeer
+	if err := h.DB.Where("origin_id = ?", origin.ID).First(&peer).Error; err != nil {
+		return origin, "", 404, fmt.Errorf("Origin has no WireGuard peer")
+	}
+	if origin.WgIP == "" {
+		return origin, "", 409, fmt.Errorf("Origin has no WireGuard IP")
+	}
+
+	endpoint, allowedIPs, err := h.clientConfigRoute()
+	if err != nil {
+		return origin, "", 500, err
+	}
+
+	config, err := h.WG.GenerateClientConfig(&peer, origin.WgIP, endpoint, allowedIPs, h.wgClientDNS())
+	if err != nil {
+		return origin, "", 503, err
+	}
+	return origin, config, 200, nil
+}
+
+// clientConfigRoute returns the endpoint and AllowedIPs shared by every origin's client config
+func (h *Handler) clientConfigRoute() (string, string, error) {
+	sysInfo := services.NewSysInfoService()
+	vpsIP := sysInfo.GetPublicIP()
+	allowedIPs, err := h.WG.GenerateAllowedIPs(vpsIP, "10.0.0.0/8")
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to compute AllowedIPs: %v", err)
+	}
+	return fmt.Sprintf("%s:51820", vpsIP), allowedIPs, nil
+}
+
+// GetOriginConfig - Download a complete WireGuard client config for an origin as wg0-client.conf
+// GET /api/origins/:id/config
+func (h *Handler) GetOriginConfig(c *fiber.Ctx) error {
+	origin, config, status, err := h.originClientConfig(c.Params("id"))
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Same name as in the setup guide (/etc/wireguard/wg0-client.conf)
+	c.Set("Content-Disposition", "attachment; filename=wg0-client.conf")
+	c.Set("Content-Type", "text/plain; charset=utf-8")
+	system.Info("WireGuard config downloaded for Origin %d (%s)", origin.ID, origin.Name)
+	return c.SendString(config)
+}
+
+// originQRSize is the QR image edge in pixels; large enough for a phone to read a full tunnel config
+const originQRSize = 512
+
+// GetOriginConfigQR - The origin's WireGuard client config as a scannable PNG QR code
+// GET /api/origins/:id/config/qr
+func (h *Handler) GetOriginConfigQR(c *fiber.Ctx) error {
+	origin, config, status, err := h.originClientConfig(c.Params("id"))
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	png, err := qrcode.Encode(config, qrcode.Medium, originQRSize)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to render QR code: " + err.Error()})
+	}
+
+	c.Set("Content-Type", "image/png")
+	c.Set("Cache-Control", "no-store") // Contains the peer private key
+	system.Info("WireGuard config QR generated for Origin %d (%s)", origin.ID, origin.Name)
+	return c.Send(png)
+}
+
+// Drain timeout bounds (minutes)
+const (
+	defaultDrainMinutes = 30
+	maxDrainMinutes     = 24 * 60
+)
+
+// DrainOrigin - Stop forwarding new connections to an origin and remove its peer after a timeout
+// POST /api/origins/:id/drain {"timeout_minutes": 30}
+func (h *Handler) DrainOrigin(c *fiber.Ctx) error {
+	var origin models.Origin
+	if err := h.DB.First(&origin, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Origin not found"})
+	}
+
+	var input struct {
+		TimeoutMinutes int `json:"timeout_minutes"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
+		}
+	}
+	if input.TimeoutMinutes <= 0 {
+		input.TimeoutMinutes = defaultDrainMinutes
+	}
+	if input.TimeoutMinutes > maxDrainMinutes {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("timeout_minutes must be at most %d", maxDrainMinutes)})
+	}
+	if origin.DrainState == services.OriginDrainDrained {
+		return c.Status(409).JSON(fiber.Map{"error": "Origin is already drained; cancel the drain first"})
+	}
+
+	until := time.Now().Add(time.Duration(input.TimeoutMinutes) * time.Minute)
+	if err := h.DB.Model(&origin).Updates(map[string]interface{}{
+		"drain_state": services.OriginDrainDraining,
+		"drain_until": until,
+	}).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	origin.DrainState = services.OriginDrainDraining
+	origin.DrainUntil = &until
+
+	system.Info("Origin %s draining until %s", origin.Name, until.Format("15:04:05"))
+	AddEvent("warning", fmt.Sprintf("Origin %s draining: no new connections, peer removed in %d min", origin.Name, input.TimeoutMinutes))
+	go h.Firewall.ApplyRules()
+
+	return c.JSON(fiber.Map{
+		"origin":          origin,
+		"active_sessions": h.Firewall.CountOriginSessions(origin.WgIP),
+	})
+}
+
+// GetOriginDrain - Drain status of an origin, including sessions still forwarded to it (-1 = unknown)
+// GET /api/origins/:id/drain
+func (h *Handler) GetOriginDrain(c *fiber.Ctx) error {
+	var origin models.Origin
+	if err := h.DB.First(&origin, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Origin not found"})
+	}
+	return c.JSON(fiber.Map{
+		"drain_state":     origin.DrainState,
+		"drain_until":     origin.DrainUntil,
+		"active_sessions": h.Firewall.CountOriginSessions(origin.WgIP),
+	})
+}
+
+// CancelOriginDrain - Resume forwarding to an origin, re-adding its peer if it was already drained
+// DELETE /api/origins/:id/drain
+func (h *Handler) CancelOriginDrain(c *fiber.Ctx) error {
+	var origin models.Origin
+	if err := h.DB.Preload("Peer").First(&origin, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Origin not found"})
+	}
+	if origin.DrainState == "" {
+		return c.JSON(fiber.Map{"message": "Origin is not draining"})
+	}
+
+	if origin.DrainState == services.OriginDrainDrained && origin.Peer != nil {
+		if err := h.WG.AddPeer(origin.Peer, origin.WgIP); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to restore WireGuard peer: " + err.Error()})
+		}
+	}
+
+	if err := h.DB.Model(&origin).Updates(map[string]interface{}{
+		"drain_state": "",
+		"drain_until": nil,
+	}).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
-	return c.JSON(fiber.Map{"status": "applied", "message": "Firewall rules updated successfully"})
+
+	system.Info("Origin %s drain cancelled, forwarding resumed", origin.Name)
+	AddEvent("success", fmt.Sprintf("Origin %s back in service", origin.Name))
+	go h.Firewall.ApplyRules()
+
+	return c.JSON(fiber.Map{"message": "Drain cancelled"})
+}
+
+// PreviewFirewall - The rulesets an apply would restore, without applying them
+// GET /api/firewall/preview
+func (h *Handler) PreviewFirewall(c *fiber.Ctx) error {
+	preview, err := h.Firewall.PreviewRules()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(preview)
+}
+
+// ApplyFirewall - Trigger firewall update. The previous rules come back after
+// services.FirewallConfirmTimeout unless POST /api/firewall/confirm is called; ?confirm=false
+// applies without a rollback.
+// POST /api/firewall/apply
+func (h *Handler) ApplyFirewall(c *fiber.Ctx) error {
+	if !c.QueryBool("confirm", true) {
+		if err := h.Firewall.ApplyRules(); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"status": "applied", "message": "Firewall rules updated successfully"})
+	}
+
+	deadline, err := h.Firewall.ApplyRulesConfirmed()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error(), "confirm_deadline": deadline})
+	}
+	if deadline == nil {
+		return c.JSON(fiber.Map{"status": "applied", "message": "Firewall rules updated successfully (current rules could not be saved, no rollback)"})
+	}
+	return c.JSON(fiber.Map{
+		"status":           "pending_confirmation",
+		"message":          fmt.Sprintf("Firewall rules applied. Confirm within %s or the previous rules are restored", services.FirewallConfirmTimeout),
+		"confirm_deadline": deadline,
+	})
+}
+
+// GetFirewallApplyStatus returns the outcome of the last apply, including the rollback deadline
+// of an apply waiting for confirmation
+// GET /api/firewall/apply-status
+func (h *Handler) GetFirewallApplyStatus(c *fiber.Ctx) error {
+	return c.JSON(h.Firewall.GetApplyStatus())
+}
+
+// ConfirmFirewall keeps the rules of a pending apply and cancels its rollback
+// POST /api/firewall/confirm
+func (h *Handler) ConfirmFirewall(c *fiber.Ctx) error {
+	if !h.Firewall.ConfirmRules() {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "No firewall apply is waiting for confirmation"})
+	}
+	AddEvent("success", "Firewall rules confirmed")
+	return c.JSON(fiber.Map{"status": "confirmed", "message": "Firewall rules confirmed"})
 }
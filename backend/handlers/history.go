@@ -1,8 +1,15 @@
 package handlers
 
 import (
+	"bufio"
+	"encoding/json"
+	"fmt"
 	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/services"
+	"kg-proxy-web-gui/backend/system"
+	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -42,12 +49,35 @@ func (h *Handler) GetTrafficHistory(c *fiber.Ctx) error {
 }
 
 // GetAttackHistory returns attack event history
-// GET /api/attacks?page=1&limit=50&type=&country=
+// GET /api/attacks?page=1&limit=50&type=&country=&from=&to=&reviewed=&label=&since_last_login=
+// from/to accept RFC3339 or unix seconds. since_last_login=true starts the range at the caller's
+// previous login and adds a summary of what happened since.
 func (h *Handler) GetAttackHistory(c *fiber.Ctx) error {
 	page := c.QueryInt("page", 1)
 	limit := c.QueryInt("limit", 50)
 	attackType := c.Query("type", "")
 	country := c.Query("country", "")
+	reviewed := c.Query("reviewed", "")
+	label := c.Query("label", "")
+
+	from, err := parseTimeParam(c.Query("from"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid 'from' time: " + err.Error()})
+	}
+	to, err := parseTimeParam(c.Query("to"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid 'to' time: " + err.Error()})
+	}
+	since, sinceLogin, err := h.sinceLastLogin(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if sinceLogin && since.After(from) {
+		from = since
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "'to' must not be before 'from'"})
+	}
 
 	if page < 1 {
 		page = 1
@@ -66,6 +96,21 @@ func (h *Handler) GetAttackHistory(c *fiber.Ctx) error {
 	if country != "" {
 		query = query.Where("country_code = ?", country)
 	}
+	if reviewed != "" {
+		query = query.Where("reviewed = ?", reviewed == "true" || reviewed == "1")
+	}
+	if label != "" {
+		query = query.Where("label = ?", label)
+	}
+	// Time range (timestamp is indexed)
+	switch {
+	case !from.IsZero() && !to.IsZero():
+		query = query.Where("timestamp BETWEEN ? AND ?", from, to)
+	case !from.IsZero():
+		query = query.Where("timestamp >= ?", from)
+	case !to.IsZero():
+		query = query.Where("timestamp <= ?", to)
+	}
 
 	var total int64
 	query.Count(&total)
@@ -75,14 +120,105 @@ func (h *Handler) GetAttackHistory(c *fiber.Ctx) error {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	return c.JSON(fiber.Map{
+	result := fiber.Map{
 		"page":   page,
 		"limit":  limit,
 		"total":  total,
 		"events": events,
+	}
+	if sinceLogin {
+		result["since"] = since
+		result["summary"] = h.attacksSinceSummary(since)
+	}
+	return c.JSON(result)
+}
+
+// UpdateAttackEvent sets operator annotations (label, notes, reviewed) on an attack event.
+// Only fields present in the body are changed.
+// PATCH /api/attacks/:id
+func (h *Handler) UpdateAttackEvent(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid event ID"})
+	}
+
+	var event models.AttackEvent
+	if err := h.DB.First(&event, id).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Attack event not found"})
+	}
+
+	var input struct {
+		Label    *string `json:"label"`
+		Notes    *string `json:"notes"`
+		Reviewed *bool   `json:"reviewed"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	if input.Label != nil {
+		event.Label = *input.Label
+	}
+	if input.Notes != nil {
+		event.Notes = *input.Notes
+	}
+	if err := cleanTextFields(
+		textField{"label", &event.Label, maxLabelLength},
+		textField{"notes", &event.Notes, maxDescriptionLength},
+	); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if input.Reviewed != nil && *input.Reviewed != event.Reviewed {
+		event.Reviewed = *input.Reviewed
+		if event.Reviewed {
+			now := time.Now()
+			event.ReviewedAt = &now
+		} else {
+			event.ReviewedAt = nil
+		}
+	}
+
+	if err := h.DB.Save(&event).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(event)
+}
+
+// GetAttackCaptures lists the packet captures taken for an attack event
+// GET /api/attacks/:id/captures
+func (h *Handler) GetAttackCaptures(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid event ID"})
+	}
+
+	var event models.AttackEvent
+	if err := h.DB.First(&event, id).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Attack event not found"})
+	}
+
+	captures, err := services.CapturesForAttack(event.ID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"event_id": event.ID,
+		"captures": captures,
 	})
 }
 
+// parseTimeParam parses an RFC3339 timestamp or unix seconds; empty input yields the zero time
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
 // GetAttackStats returns aggregated attack statistics
 // GET /api/attacks/stats
 func (h *Handler) GetAttackStats(c *fiber.Ctx) error {
@@ -140,6 +276,10 @@ func (h *Handler) GetAttackStats(c *fiber.Ctx) error {
 	var totalBlocked int64
 	h.DB.Model(&models.AttackEvent{}).Where("action = ?", "blocked").Count(&totalBlocked)
 
+	// Events merged by the per-IP cap
+	var collapsed struct{ Total int64 }
+	h.DB.Model(&models.AttackEvent{}).Select("COALESCE(SUM(collapsed), 0) as total").Scan(&collapsed)
+
 	stats := models.AttackStats{
 		TodayCount:    todayCount,
 		WeekCount:     weekCount,
@@ -148,7 +288,132 @@ func (h *Handler) GetAttackStats(c *fiber.Ctx) error {
 		TopCountry:    topCountry.CountryCode,
 		TopAttackerIP: topAttacker.SourceIP,
 		TotalBlocked:  totalBlocked,
+
+		CollapsedEvents: collapsed.Total,
 	}
 
 	return c.JSON(stats)
 }
+
+// attackStreamHeartbeat keeps idle SSE connections (and proxies in between) from timing out
+const attackStreamHeartbeat = 15 * time.Second
+
+// StreamAttacks pushes newly detected attack events as Server-Sent Events.
+// EventSource cannot set headers, so the token may also be passed as ?access_token=.
+// GET /api/attacks/stream
+func (h *Handler) StreamAttacks(c *fiber.Ctx) error {
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no") // Disable nginx response buffering
+
+	events, cancel := services.SubscribeAttacks()
+	system.Debug("Attack stream client connected (%d active)", services.AttackStreamSubscribers())
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer func() {
+			cancel()
+			system.Debug("Attack stream client disconnected")
+		}()
+
+		heartbeat := time.NewTicker(attackStreamHeartbeat)
+		defer heartbeat.Stop()
+
+		// Initial comment so clients see the stream open immediately
+		fmt.Fprint(w, ": connected\n\n")
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(event)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "event: attack\nid: %d\ndata: %s\n\n", event.ID, data)
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+			}
+			// Flush fails once the client has gone away
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+// GetBlockHistory returns the block/unblock timeline for a single IP, newest first.
+// Entries created by automated blocking include the triggering attack event.
+// GET /api/ip/:ip/block-history?limit=100
+func (h *Handler) GetBlockHistory(c *fiber.Ctx) error {
+	ip := c.Params("ip")
+	if net.ParseIP(ip) == nil {
+		if _, _, err := net.ParseCIDR(ip); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid IP address"})
+		}
+	}
+
+	limit := c.QueryInt("limit", 100)
+	if limit < 1 || limit > 500 {
+		limit = 100
+	}
+
+	var history []models.BlockHistory
+	if err := h.DB.Where("ip = ?", ip).Order("timestamp DESC").Limit(limit).Find(&history).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Resolve triggering attack events (may already be purged by retention)
+	eventIDs := make([]uint, 0)
+	for _, entry := range history {
+		if entry.AttackEventID != nil {
+			eventIDs = append(eventIDs, *entry.AttackEventID)
+		}
+	}
+	events := make(map[uint]models.AttackEvent)
+	if len(eventIDs) > 0 {
+		var found []models.AttackEvent
+		h.DB.Where("id IN ?", eventIDs).Find(&found)
+		for _, e := range found {
+			events[e.ID] = e
+		}
+	}
+
+	type timelineEntry struct {
+		models.BlockHistory
+		AttackEvent *models.AttackEvent `json:"attack_event,omitempty"`
+	}
+	timeline := make([]timelineEntry, 0, len(history))
+	for _, entry := range history {
+		te := timelineEntry{BlockHistory: entry}
+		if entry.AttackEventID != nil {
+			if e, ok := events[*entry.AttackEventID]; ok {
+				te.AttackEvent = &e
+			}
+		}
+		timeline = append(timeline, te)
+	}
+
+	// Current state for context
+	var currentlyBanned bool
+	var banCount int64
+	h.DB.Model(&models.BanIP{}).Where("ip = ?", ip).Count(&banCount)
+	currentlyBanned = banCount > 0
+	if !currentlyBanned && h.EBPF != nil {
+		currentlyBanned = h.EBPF.LookupBlockedIP(ip) != nil
+	}
+
+	return c.JSON(fiber.Map{
+		"ip":       ip,
+		"blocked":  currentlyBanned,
+		"count":    len(timeline),
+		"timeline": timeline,
+	})
+}
@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/services"
+	"kg-proxy-web-gui/backend/system"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	incidentDefaultWindow = time.Hour
+	incidentMaxWindow     = 31 * 24 * time.Hour
+	incidentMaxEvents     = 100000            // Attack events exported per bundle
+	incidentMaxPCAPBytes  = 512 * 1024 * 1024 // Captures beyond this are listed but left out
+	incidentTopAttackers  = 20
+	incidentRedacted      = "[redacted]"
+)
+
+// IncidentAttacker is one source IP in the incident summary
+type IncidentAttacker struct {
+	IP          string `json:"ip"`
+	CountryCode string `json:"country_code"`
+	Events      int    `json:"events"`
+	Packets     int64  `json:"packets"`
+	PeakPPS     int64  `json:"peak_pps"`
+}
+
+// IncidentSummary is summary.json in the incident bundle
+type IncidentSummary struct {
+	GeneratedAt     time.Time          `json:"generated_at"`
+	GeneratedBy     string             `json:"generated_by"`
+	From            time.Time          `json:"from"`
+	To              time.Time          `json:"to"`
+	AttackEvents    int                `json:"attack_events"`
+	EventsTruncated bool               `json:"events_truncated"`
+	UniqueSources   int                `json:"unique_sources"`
+	PeakPPS         int64              `json:"peak_pps"`
+	PeakPPSAt       *time.Time         `json:"peak_pps_at,omitempty"`
+	PeakBlockedPPS  int64              `json:"peak_blocked_pps"`
+	TopAttackers    []IncidentAttacker `json:"top_attackers"`
+	ByAction        map[string]int     `json:"by_action"`      // Mitigation breakdown
+	ByAttackType    map[string]int     `json:"by_attack_type"` // Detection breakdown
+	ByCountry       map[string]int     `json:"by_country"`     // Events per source country code
+	Snapshots       int                `json:"traffic_snapshots"`
+	Captures        []string           `json:"captures"`
+	SkippedCaptures []string           `json:"skipped_captures,omitempty"` // Over the size limit
+}
+
+// incidentCapture is a PCAP file overlapping the incident window
+type incidentCapture struct {
+	name string
+	path string
+	size int64
+}
+
+// CreateIncidentReport streams a zip with everything needed to hand an incident off:
+// attack events (CSV and JSON), traffic snapshots, overlapping PCAP captures, a config
+// snapshot with secrets removed, and a generated summary.
+// POST /api/reports/incident {"from": "2026-01-02T15:00:00Z", "to": "..."} (RFC3339 or unix seconds)
+func (h *Handler) CreateIncidentReport(c *fiber.Ctx) error {
+	var input struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+		}
+	}
+	from, err := parseTimeParam(input.From)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid 'from' time"})
+	}
+	to, err := parseTimeParam(input.To)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid 'to' time"})
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-incidentDefaultWindow)
+	}
+	if !from.Before(to) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "'from' must be before 'to'"})
+	}
+	if to.Sub(from) > incidentMaxWindow {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Time range must not exceed 31 days"})
+	}
+
+	var events []models.AttackEvent
+	if err := h.DB.Where("timestamp BETWEEN ? AND ?", from, to).
+		Order("timestamp ASC").Limit(incidentMaxEvents + 1).Find(&events).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	truncated := len(events) > incidentMaxEvents
+	if truncated {
+		events = events[:incidentMaxEvents]
+	}
+
+	var snapshots []models.TrafficSnapshot
+	if err := h.DB.Where("timestamp BETWEEN ? AND ?", from, to).
+		Order("timestamp ASC").Find(&snapshots).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	config := h.collectBackup()
+	redactIncidentConfig(&config)
+
+	username, _ := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)["user"].(string)
+	summary := buildIncidentSummary(events, snapshots, from, to)
+	summary.GeneratedBy = username
+	summary.EventsTruncated = truncated
+
+	var captures []incidentCapture
+	var captureBytes int64
+	for _, capture := range incidentCaptures(from, to) {
+		if captureBytes+capture.size > incidentMaxPCAPBytes {
+			summary.SkippedCaptures = append(summary.SkippedCaptures, capture.name)
+			continue
+		}
+		captureBytes += capture.size
+		captures = append(captures, capture)
+		summary.Captures = append(summary.Captures, capture.name)
+	}
+
+	filename := "kg-proxy-incident-" + from.Format("20060102-1504") + ".zip"
+	c.Set("Content-Type", "application/zip")
+	c.Set("Content-Disposition", "attachment; filename="+filename)
+
+	system.Info("Incident report %s generated by %s: %d events, %d snapshots, %d captures",
+		filename, username, len(events), len(snapshots), len(captures))
+	AddEvent("info", fmt.Sprintf("Incident report generated for %s - %s", from.Format(time.RFC3339), to.Format(time.RFC3339)))
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		zw := zip.NewWriter(w)
+		if err := writeIncidentZip(zw, &summary, events, snapshots, &config, captures); err != nil {
+			system.Warn("Incident report %s incomplete: %v", filename, err)
+		}
+		zw.Close()
+		w.Flush()
+	})
+	return nil
+}
+
+// redactIncidentConfig clears credentials; the bundle is meant to leave the box
+func redactIncidentConfig(config *BackupData) {
+	settings := &config.SecuritySettings
+	for _, secret := range []*string{&settings.MaxMindLicenseKey, &settings.DiscordWebhookURL, &settings.IPIntelligenceAPIKey} {
+		if *secret != "" {
+			*secret = incidentRedacted
+		}
+	}
+}
+
+// buildIncidentSummary derives top attackers, peak traffic and the mitigation breakdown
+func buildIncidentSummary(events []models.AttackEvent, snapshots []models.TrafficSnapshot, from, to time.Time) IncidentSummary {
+	summary := IncidentSummary{
+		GeneratedAt:  time.Now(),
+		From:         from,
+		To:           to,
+		AttackEvents: len(events),
+		Snapshots:    len(snapshots),
+		ByAction:     make(map[string]int),
+		ByAttackType: make(map[string]int),
+		ByCountry:    make(map[string]int),
+		TopAttackers: []IncidentAttacker{},
+		Captures:     []string{},
+	}
+
+	attackers := make(map[string]*IncidentAttacker)
+	for _, e := range events {
+		summary.ByAction[e.Action]++
+		summary.ByAttackType[e.AttackType]++
+		if e.CountryCode != "" {
+			summary.ByCountry[e.CountryCode]++
+		}
+		a, ok := attackers[e.SourceIP]
+		if !ok {
+			a = &IncidentAttacker{IP: e.SourceIP, CountryCode: e.CountryCode}
+			attackers[e.SourceIP] = a
+		}
+		a.Events++
+		a.Packets += e.Count
+		if e.PPS > a.PeakPPS {
+			a.PeakPPS = e.PPS
+		}
+	}
+	summary.UniqueSources = len(attackers)
+
+	ranked := make([]IncidentAttacker, 0, len(attackers))
+	for _, a := range attackers {
+		ranked = append(ranked, *a)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Packets != ranked[j].Packets {
+			return ranked[i].Packets > ranked[j].Packets
+		}
+		return ranked[i].Events > ranked[j].Events
+	})
+	if len(ranked) > incidentTopAttackers {
+		ranked = ranked[:incidentTopAttackers]
+	}
+	summary.TopAttackers = ranked
+
+	for i := range snapshots {
+		s := &snapshots[i]
+		if s.TotalPPS > summary.PeakPPS {
+			summary.PeakPPS = s.TotalPPS
+			summary.PeakPPSAt = &s.Timestamp
+		}
+		if s.BlockedPPS > summary.PeakBlockedPPS {
+			summary.PeakBlockedPPS = s.BlockedPPS
+		}
+	}
+	return summary
+}
+
+// incidentCaptures returns finished PCAP files whose capture time overlaps [from, to].
+// A capture starts at the time in its name (capture_20060102-150405.pcap) and ends at its last write.
+func incidentCaptures(from, to time.Time) []incidentCapture {
+	svc := services.NewPCAPService()
+	files, err := svc.GetCaptureFiles()
+	if err != nil {
+		return nil
+	}
+	status := svc.GetStatus()
+
+	var captures []incidentCapture
+	for _, name := range files {
+		if status.IsCapturing && name == status.CurrentFile {
+			continue // Still being written
+		}
+		path := filepath.Join(svc.GetCaptureDir(), name)
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		start := info.ModTime()
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, "capture_"), ".pcap")
+		if t, err := time.ParseInLocation("20060102-150405", stamp, time.Local); err == nil {
+			start = t
+		}
+		if start.After(to) || info.ModTime().Before(from) {
+			continue
+		}
+		captures = append(captures, incidentCapture{name: name, path: path, size: info.Size()})
+	}
+	sort.Slice(captures, func(i, j int) bool { return captures[i].name < captures[j].name })
+	return captures
+}
+
+// writeIncidentZip writes the bundle entries; the summary goes first so a truncated
+// download still carries it
+func writeIncidentZip(zw *zip.Writer, summary *IncidentSummary, events []models.AttackEvent,
+	snapshots []models.TrafficSnapshot, config *BackupData, captures []incidentCapture) error {
+	jsonEntries := []struct {
+		name  string
+		value interface{}
+	}{
+		{"summary.json", summary},
+		{"attacks.json", events},
+		{"traffic_snapshots.json", snapshots},
+		{"config.json", config},
+	}
+	for _, entry := range jsonEntries {
+		f, err := zw.Create(entry.name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(entry.value); err != nil {
+			return fmt.Errorf("%s: %v", entry.name, err)
+		}
+	}
+
+	f, err := zw.Create("attacks.csv")
+	if err != nil {
+		return err
+	}
+	if err := writeAttackCSV(f, events); err != nil {
+		return fmt.Errorf("attacks.csv: %v", err)
+	}
+
+	for _, capture := range captures {
+		if err := copyIntoZip(zw, "captures/"+capture.name, capture.path); err != nil {
+			return fmt.Errorf("%s: %v", capture.name, err)
+		}
+	}
+	return nil
+}
+
+func writeAttackCSV(w io.Writer, events []models.AttackEvent) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "timestamp", "source_ip", "country_code", "country_name", "attack_type",
+		"action", "pps", "bps", "count", "duration", "label", "reviewed", "details"})
+	for _, e := range events {
+		cw.Write([]string{
+			strconv.FormatUint(uint64(e.ID), 10),
+			e.Timestamp.Format(time.RFC3339),
+			e.SourceIP,
+			e.CountryCode,
+			e.CountryName,
+			e.AttackType,
+			e.Action,
+			strconv.FormatInt(e.PPS, 10),
+			strconv.FormatInt(e.BPS, 10),
+			strconv.FormatInt(e.Count, 10),
+			strconv.Itoa(e.Duration),
+			e.Label,
+			strconv.FormatBool(e.Reviewed),
+			e.Details,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func copyIntoZip(zw *zip.Writer, name, path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/services"
+	"net"
 	"net/http"
 	"time"
 
@@ -22,7 +24,9 @@ type IPInfoResponse struct {
 	BlockTTL    int64                `json:"block_ttl,omitempty"` // Seconds remaining
 	Traffic     *IPTrafficStats      `json:"traffic,omitempty"`
 	History     []models.AttackEvent `json:"history,omitempty"`
-	WhoisLink   string               `json:"whois_link"`
+
+	Intelligence *services.IPIntelligenceResult `json:"intelligence,omitempty"` // Provider verdict incl. score, if configured
+	WhoisLink    string                         `json:"whois_link"`
 }
 
 type IPTrafficStats struct {
@@ -57,8 +61,12 @@ func (h *Handler) GetIPInfo(c *fiber.Ctx) error {
 		// We will rely on external services if configured, or basic DB.
 	}
 
-	// Fallback/Enhancement if external API key is configured
-	// TODO: Implement external API call (ipinfo.io or similar) if key exists in settings
+	// IP intelligence verdict (cached for 24h) when a provider key is configured
+	if h.Firewall != nil && h.Firewall.GeoIP != nil && net.ParseIP(ip) != nil {
+		if intel, err := h.Firewall.GeoIP.CheckIPIntelligence(ip); err == nil {
+			response.Intelligence = intel
+		}
+	}
 
 	// 2. Check Block/Allow Status
 	// Check Manual Whitelist
@@ -150,3 +158,36 @@ func FetchExternalIPInfo(ip string) (string, string) {
 
 	return data.AS, data.ISP
 }
+
+// GetIPIntelligenceCache returns IP intelligence cache size and hit/miss counts
+// GET /api/ip/intelligence/cache
+func (h *Handler) GetIPIntelligenceCache(c *fiber.Ctx) error {
+	if h.Firewall == nil || h.Firewall.GeoIP == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "GeoIP service not initialized"})
+	}
+	return c.JSON(h.Firewall.GeoIP.GetIPIntelligenceCacheStats())
+}
+
+// ClearIPIntelligenceCache drops cached intelligence so the next lookup re-checks the provider.
+// Without :ip the whole cache is cleared.
+// DELETE /api/ip/intelligence/cache
+// DELETE /api/ip/intelligence/cache/:ip
+func (h *Handler) ClearIPIntelligenceCache(c *fiber.Ctx) error {
+	if h.Firewall == nil || h.Firewall.GeoIP == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "GeoIP service not initialized"})
+	}
+
+	ip := c.Params("ip")
+	if ip != "" && net.ParseIP(ip) == nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid IP address"})
+	}
+
+	removed := h.Firewall.GeoIP.ClearIPIntelligenceCache(ip)
+	if ip == "" {
+		AddEvent("info", fmt.Sprintf("IP intelligence cache cleared (%d entries)", removed))
+	}
+	return c.JSON(fiber.Map{
+		"removed": removed,
+		"cache":   h.Firewall.GeoIP.GetIPIntelligenceCacheStats(),
+	})
+}
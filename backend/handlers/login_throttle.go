@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/services"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Per-IP login throttle defaults and the upper bounds accepted in settings
+const (
+	defaultLoginIPMaxFailures    = 20
+	defaultLoginIPWindowSeconds  = 60
+	maxLoginIPMaxFailuresLimit   = 1000
+	maxLoginIPWindowSecondsLimit = 24 * 60 * 60
+)
+
+// loginFailures holds the failed login timestamps of each source IP (sliding window).
+// In memory only: a restart clears it, which the per-account lockout still covers.
+var loginFailures struct {
+	sync.Mutex
+	byIP map[string][]time.Time
+}
+
+// loginThrottlePolicy returns the per-IP failure limit and window from the settings
+func (h *Handler) loginThrottlePolicy() (int, time.Duration) {
+	limit, seconds := defaultLoginIPMaxFailures, defaultLoginIPWindowSeconds
+	var settings models.SecuritySettings
+	if err := h.DB.First(&settings, 1).Error; err == nil {
+		if settings.LoginIPMaxFailures > 0 {
+			limit = settings.LoginIPMaxFailures
+		}
+		if settings.LoginIPWindowSeconds > 0 {
+			seconds = settings.LoginIPWindowSeconds
+		}
+	}
+	return limit, time.Duration(seconds) * time.Second
+}
+
+// loginIPExempt reports whether ip is on the manual whitelist (single IPs or CIDRs)
+func (h *Handler) loginIPExempt(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	var allowIPs []models.AllowIP
+	h.DB.Find(&allowIPs)
+	entries := make([]string, 0, len(allowIPs))
+	for _, a := range allowIPs {
+		entries = append(entries, a.IP)
+	}
+	nets, _ := services.ParseCIDRList(strings.Join(entries, ","))
+	for _, n := range nets {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// recentLoginFailures drops failures older than window and returns how many remain for ip,
+// with the time the oldest one leaves the window. Caller holds loginFailures.
+func recentLoginFailures(ip string, window time.Duration, now time.Time) (int, time.Time) {
+	times := loginFailures.byIP[ip]
+	cutoff := now.Add(-window)
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	times = times[i:]
+	if len(times) == 0 {
+		delete(loginFailures.byIP, ip)
+		return 0, time.Time{}
+	}
+	loginFailures.byIP[ip] = times
+	return len(times), times[0].Add(window)
+}
+
+// loginThrottled reports whether ip has used up its failed logins for the window,
+// and how long until the next attempt is accepted
+func (h *Handler) loginThrottled(ip string) (bool, time.Duration) {
+	limit, window := h.loginThrottlePolicy()
+	now := time.Now()
+
+	loginFailures.Lock()
+	count, retryAt := recentLoginFailures(ip, window, now)
+	loginFailures.Unlock()
+
+	if count < limit || h.loginIPExempt(ip) {
+		return false, 0
+	}
+	return true, retryAt.Sub(now)
+}
+
+// recordLoginFailure counts a failed login from ip, whatever the username.
+// The event feed gets one entry when the IP reaches the limit, not one per rejected attempt.
+func (h *Handler) recordLoginFailure(ip, username string) {
+	limit, window := h.loginThrottlePolicy()
+	now := time.Now()
+
+	loginFailures.Lock()
+	if loginFailures.byIP == nil {
+		loginFailures.byIP = make(map[string][]time.Time)
+	}
+	count, _ := recentLoginFailures(ip, window, now)
+	reached := false
+	if count < limit {
+		loginFailures.byIP[ip] = append(loginFailures.byIP[ip], now)
+		count++
+		reached = count == limit
+	}
+	loginFailures.Unlock()
+
+	if reached && !h.loginIPExempt(ip) {
+		AddEvent("warning", fmt.Sprintf("Login throttled for %s: %d failed logins within %s (last user: %s)",
+			ip, count, window, sanitizeText(username)))
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"kg-proxy-web-gui/backend/system"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// logStreamPing keeps idle log sockets alive through proxies
+const logStreamPing = 30 * time.Second
+
+// StreamLogs tails the system log over a WebSocket, one JSON LogLine per message.
+// ?level=warn|error sends only lines at or above that level (default info).
+// Browsers cannot set headers on WebSocket, so the token may be passed as ?access_token=.
+// GET /api/logs/stream
+func (h *Handler) StreamLogs(c *fiber.Ctx) error {
+	minLevel, ok := system.ParseLogLevel(c.Query("level"))
+	if !ok {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "level must be info, warn or error"})
+	}
+
+	return upgradeWebSocket(c, func(ws *wsConn) {
+		lines, cancel := system.SubscribeLogs()
+		defer cancel()
+
+		ping := time.NewTicker(logStreamPing)
+		defer ping.Stop()
+
+		for {
+			select {
+			case <-ws.Done():
+				return
+			case line, ok := <-lines:
+				if !ok {
+					return
+				}
+				if level, _ := system.ParseLogLevel(line.Level); level < minLevel {
+					continue
+				}
+				data, err := json.Marshal(line)
+				if err != nil {
+					continue
+				}
+				if err := ws.WriteText(data); err != nil {
+					return
+				}
+			case <-ping.C:
+				if err := ws.Ping(); err != nil {
+					return
+				}
+			}
+		}
+	})
+}
@@ -1,6 +1,9 @@
 package handlers
 
 import (
+	"bufio"
+	"encoding/json"
+	"fmt"
 	"kg-proxy-web-gui/backend/services"
 	"kg-proxy-web-gui/backend/system"
 	"path/filepath"
@@ -16,6 +19,7 @@ func SetupPCAPRoutes(router fiber.Router) {
 	pcap.Post("/start", StartCapture)
 	pcap.Post("/stop", StopCapture)
 	pcap.Get("/status", GetCaptureStatus)
+	pcap.Get("/stream", StreamCaptureProgress)
 	pcap.Get("/files", ListCaptureFiles)
 	pcap.Get("/files/:filename", DownloadCaptureFile)
 	pcap.Delete("/files/:filename", DeleteCaptureFile)
@@ -41,7 +45,7 @@ func StartCapture(c *fiber.Ctx) error {
 		duration = 60 * time.Second // Default 1 min
 	}
 
-	filename, err := svc.StartCapture(req.Interface, duration, req.Filter)
+	filename, err := svc.StartCapture(req.Interface, duration, req.Filter, services.CaptureMeta{Trigger: services.CaptureTriggerManual})
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -70,14 +74,81 @@ func GetCaptureStatus(c *fiber.Ctx) error {
 	return c.JSON(svc.GetStatus())
 }
 
-// ListCaptureFiles lists all pcap files
+// pcapProgressInterval is how often StreamCaptureProgress pushes an update
+const pcapProgressInterval = time.Second
+
+// StreamCaptureProgress pushes the capture status as Server-Sent Events while a capture runs.
+// The stream ends with a "done" event once the capture stops (immediately if none is running).
+// EventSource cannot set headers, so the token may also be passed as ?access_token=.
+// GET /api/pcap/stream
+func StreamCaptureProgress(c *fiber.Ctx) error {
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no") // Disable nginx response buffering
+
+	svc := services.NewPCAPService()
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ticker := time.NewTicker(pcapProgressInterval)
+		defer ticker.Stop()
+
+		for {
+			status := svc.GetStatus()
+			data, err := json.Marshal(status)
+			if err != nil {
+				return
+			}
+			event := "progress"
+			if !status.IsCapturing {
+				event = "done"
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+			// Flush fails once the client has gone away
+			if err := w.Flush(); err != nil || !status.IsCapturing {
+				return
+			}
+			<-ticker.C
+		}
+	})
+	return nil
+}
+
+// ListCaptureFiles lists the pcap files, newest first.
+// ?trigger=manual|auto and ?attack_id= filter by what started the capture; ?detail=true returns
+// size, time and trigger metadata instead of plain file names.
+// GET /api/pcap/files
 func ListCaptureFiles(c *fiber.Ctx) error {
+	trigger := c.Query("trigger")
+	if trigger != "" && !services.ValidCaptureTrigger(trigger) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "trigger must be manual or auto"})
+	}
+	attackID := c.QueryInt("attack_id", 0)
+	if attackID < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid attack_id"})
+	}
+
 	svc := services.NewPCAPService()
-	files, err := svc.GetCaptureFiles()
+	captures, err := svc.ListCaptures()
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
-	return c.JSON(files)
+
+	filtered := []services.CaptureFile{}
+	names := []string{}
+	for _, capture := range captures {
+		if trigger != "" && capture.Trigger != trigger {
+			continue
+		}
+		if attackID != 0 && capture.AttackEventID != uint(attackID) {
+			continue
+		}
+		filtered = append(filtered, capture)
+		names = append(names, capture.Name)
+	}
+	if c.QueryBool("detail") {
+		return c.JSON(filtered)
+	}
+	return c.JSON(names)
 }
 
 // DownloadCaptureFile downloads a specific file
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"kg-proxy-web-gui/backend/models"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// publicStatusTTL is how long the public status is served from cache
+const publicStatusTTL = 5 * time.Second
+
+// PublicStatus is everything the public badge endpoint exposes: aggregate numbers, no IPs or config
+type PublicStatus struct {
+	ProtectionActive    bool      `json:"protection_active"`
+	TotalPPS            int64     `json:"total_pps"`
+	BlockedPPS          int64     `json:"blocked_pps"`
+	AttacksBlockedToday int64     `json:"attacks_blocked_today"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// publicStatusCache absorbs badge traffic so every request doesn't hit the DB and eBPF maps
+var publicStatusCache struct {
+	sync.Mutex
+	enabled bool
+	status  PublicStatus
+	expires time.Time
+}
+
+// GetPublicStatus returns aggregate protection numbers for status badges (opt-in, no auth)
+// GET /api/public/status
+func (h *Handler) GetPublicStatus(c *fiber.Ctx) error {
+	publicStatusCache.Lock()
+	if time.Now().After(publicStatusCache.expires) {
+		publicStatusCache.enabled, publicStatusCache.status = h.buildPublicStatus()
+		publicStatusCache.expires = time.Now().Add(publicStatusTTL)
+	}
+	enabled, status := publicStatusCache.enabled, publicStatusCache.status
+	publicStatusCache.Unlock()
+
+	if !enabled {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Public status is disabled"})
+	}
+	c.Set("Cache-Control", "public, max-age=5")
+	c.Set("Access-Control-Allow-Origin", "*")
+	return c.JSON(status)
+}
+
+// buildPublicStatus reads the current numbers; the first return value is the opt-in setting
+func (h *Handler) buildPublicStatus() (bool, PublicStatus) {
+	var settings models.SecuritySettings
+	if err := h.DB.First(&settings, 1).Error; err != nil || !settings.PublicStatusEnabled {
+		return false, PublicStatus{}
+	}
+
+	now := time.Now()
+	status := PublicStatus{UpdatedAt: now}
+
+	inMaintenance := settings.MaintenanceUntil != nil && settings.MaintenanceUntil.After(now)
+	firewallOK := h.Firewall == nil || h.Firewall.GetApplyStatus().Error == ""
+	if h.EBPF != nil && h.EBPF.IsEnabled() {
+		stats := h.EBPF.GetStats()
+		status.TotalPPS = stats.TotalPPS
+		status.BlockedPPS = stats.BlockedPPS
+		status.ProtectionActive = !inMaintenance && firewallOK && len(h.EBPF.GetXDPStatus().Unprotected) == 0
+	}
+
+	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	h.DB.Model(&models.AttackEvent{}).Where("timestamp >= ?", todayStart).Count(&status.AttacksBlockedToday)
+
+	return true, status
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// reloadSetting names a setting and how ReloadConfig treats it
+type reloadSetting struct {
+	Name   string `json:"name"`
+	Source string `json:"source"` // settings (database) or env
+	Note   string `json:"note,omitempty"`
+}
+
+// hotReloadSettings are re-read from the database and pushed into the running services by ReloadConfig
+var hotReloadSettings = []reloadSetting{
+	{"discord_webhook_url", "settings", "Alert destination"},
+	{"xdp_hard_blocking, xdp_rate_limit_pps", "settings", "XDP config map"},
+	{"event_batch_seconds, event_aggregator_max_keys, event_queue_size, attack_events_per_ip_cap", "settings", "Attack event aggregation"},
+	{"new_country_alert, country_spike_factor", "settings", "Country watch thresholds"},
+	{"ip_stats_top_k, ip_stats_poll_seconds", "settings", "Traffic snapshot sampling"},
+	{"geo_resolve_workers, flood grace overrides, flood block durations", "settings", "Flood protection"},
+	{"auto_promote_*, recurrence_promote_*, abuse_score_block_threshold", "settings", "Repeat offender promotion"},
+	{"country_cidr_source, geoip_update_interval_hours, geoip_max_age_hours", "settings", "GeoIP refresh policy"},
+	{"ip_intelligence_provider, ip_intelligence_api_key, maxmind_license_key", "settings", "Used from the next lookup or download"},
+	{"exclude_internal_traffic, internal_exclude_cidrs", "settings", "Internal traffic exclusion"},
+	{"wg_handshake_alert_minutes", "settings", "Stale WireGuard handshake alert"},
+	{"pcap_auto_capture*, pcap_*_retention_days", "settings", "Packet capture on attack and retention"},
+	{"firewall rules (geo, bans, ports, protection level)", "settings", "Re-applied with ipset/iptables-restore, existing connections are kept"},
+}
+
+// restartRequiredSettings are only read at startup; changing them needs a backend restart
+var restartRequiredSettings = []reloadSetting{
+	{"KG_DATA_DIR", "env", "Database, keys and captures are opened once"},
+	{"KG_JWT_SECRET", "env", "Signing key is loaded once; rotating it would log everyone out"},
+	{"KG_LISTEN_ADDR", "env", "Listener is bound at startup"},
+	{"KG_WG_SUBNET", "env", "wg0 addressing is set up at startup"},
+	{"KG_CSRF_PROTECTION", "env", "Middleware mode is set at startup"},
+	{"KG_REQUIRE_FIREWALL", "env", "Only checked at startup"},
+	{"KG_STATIC_MAX_AGE", "env", "Static file handlers are built at startup"},
+	{"MAXMIND_LICENSE_KEY", "env", "Fallback when no key is saved in settings"},
+	{"GOGC, GOMEMLIMIT", "env", "Go runtime reads them at process start"},
+	{"tls_enabled, tls_cert_file, tls_key_file, tls_redirect_http, tls_autocert_domain, tls_autocert_email", "settings", "Listener is bound at startup"},
+	{"wan_interface, additional_interfaces, ebpf_enabled", "settings", "Applied when security settings are saved: XDP is re-attached, which briefly interrupts filtering"},
+}
+
+// ReloadConfig re-reads the saved settings and re-applies them to the running services without a
+// restart. Environment variables cannot change for a running process, so settings read from them
+// (and the listener/TLS setup) are reported as restart-required instead.
+// POST /api/system/reload
+func (h *Handler) ReloadConfig(c *fiber.Ctx) error {
+	var settings models.SecuritySettings
+	if err := h.DB.First(&settings, 1).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load settings"})
+	}
+
+	h.applyRuntimeSettings(&settings)
+	if h.Firewall != nil {
+		if h.Firewall.FloodProtect != nil {
+			h.Firewall.FloodProtect.ApplyBlockDurations(&settings)
+		}
+		if h.Firewall.GeoIP != nil && settings.MaxMindLicenseKey != "" {
+			h.Firewall.GeoIP.SetLicenseKey(settings.MaxMindLicenseKey)
+		}
+	}
+
+	firewallErr := ""
+	if h.Firewall != nil {
+		if err := h.Firewall.ApplyRules(); err != nil {
+			firewallErr = err.Error()
+		}
+	}
+
+	username := requestUsername(c)
+	if firewallErr != "" {
+		AddEvent("warning", "Configuration reloaded by "+username+", but firewall rules failed to apply: "+firewallErr)
+	} else {
+		AddEvent("info", "Configuration reloaded by "+username)
+	}
+	system.Info("Configuration reloaded by %s", username)
+
+	result := fiber.Map{
+		"reloaded":         hotReloadSettings,
+		"restart_required": restartRequiredSettings,
+	}
+	if firewallErr != "" {
+		result["firewall_error"] = firewallErr
+	}
+	return c.JSON(result)
+}
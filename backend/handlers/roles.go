@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// User roles, embedded in the JWT at login
+const (
+	RoleAdmin  = "admin"  // Full control
+	RoleViewer = "viewer" // Dashboard access: read-only, secrets hidden
+)
+
+// ValidRole reports whether role is a known user role
+func ValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleViewer
+}
+
+// requestRole returns the role claim of the authenticated caller ("" for tokens issued before roles existed)
+func requestRole(c *fiber.Ctx) string {
+	token, ok := c.Locals("user").(*jwt.Token)
+	if !ok {
+		return ""
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return ""
+	}
+	role, _ := claims["role"].(string)
+	return role
+}
+
+// isAdminRequest reports whether the caller holds the admin role
+func isAdminRequest(c *fiber.Ctx) bool {
+	return requestRole(c) == RoleAdmin
+}
+
+// roleDenied is the 403 returned when a viewer (or a token without a role) hits an admin route
+func roleDenied(c *fiber.Ctx) error {
+	msg := "This action requires the admin role"
+	if requestRole(c) == "" {
+		msg = "Session has no role, please log in again"
+	}
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": msg})
+}
+
+// ReadOnlyForViewers rejects state-changing requests from non-admin accounts.
+// Viewers may still manage their own account (/api/auth/*). Must run after JWTAuthMiddleware.
+func ReadOnlyForViewers() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if isAdminRequest(c) {
+			return c.Next()
+		}
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+			return c.Next()
+		}
+		if strings.HasPrefix(c.Path(), "/api/auth/") {
+			return c.Next() // Own password and two-factor settings
+		}
+		return roleDenied(c)
+	}
+}
+
+// RequireRole restricts a route to one role, for reads that expose secrets or raw internals
+func RequireRole(role string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if requestRole(c) != role {
+			return roleDenied(c)
+		}
+		return c.Next()
+	}
+}
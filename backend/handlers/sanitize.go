@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Maximum lengths for user-supplied free text, in characters
+const (
+	maxNameLength        = 64
+	maxLabelLength       = 128
+	maxReasonLength      = 256
+	maxDescriptionLength = 1024
+)
+
+// textField is one user-supplied string checked by cleanTextFields
+type textField struct {
+	name  string
+	value *string
+	max   int
+}
+
+// sanitizeText trims s and strips control characters. Line breaks and tabs become spaces, so a
+// stored value can't forge log lines or break webhook and iptables comment formatting.
+func sanitizeText(s string) string {
+	s = strings.ToValidUTF8(s, "")
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		switch {
+		case r == '\n' || r == '\r' || r == '\t':
+			b.WriteRune(' ')
+		case unicode.IsControl(r):
+			// dropped
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// cleanTextFields sanitizes each field in place and rejects any longer than its limit
+func cleanTextFields(fields ...textField) error {
+	for _, f := range fields {
+		*f.value = sanitizeText(*f.value)
+		if utf8.RuneCountInString(*f.value) > f.max {
+			return fmt.Errorf("%s must be at most %d characters", f.name, f.max)
+		}
+	}
+	return nil
+}
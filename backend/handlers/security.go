@@ -3,15 +3,35 @@ package handlers
 import (
 	"fmt"
 	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/services"
 	"kg-proxy-web-gui/backend/system"
 	"net"
 	"net/http"
+	"net/mail"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+// maxAttackEventsPerIPCap bounds the stored attack events per source IP
+const maxAttackEventsPerIPCap = 100000
+
+// maxWGHandshakeAlertMinutes bounds the stale WireGuard handshake alert threshold (one day)
+const maxWGHandshakeAlertMinutes = 24 * 60
+
+// Packet capture setting bounds
+const (
+	maxPCAPAutoCaptureSeconds = 300
+	maxPCAPRetentionDays      = 365
+)
+
+// maxFloodGraceSec bounds the per-level flood grace period (one hour)
+const maxFloodGraceSec = 3600
+
+// maxProtectionReminderMinutes bounds the unprotected-state reminder grace period (one week)
+const maxProtectionReminderMinutes = 7 * 24 * 60
+
 // GetSecuritySettings - Get current security settings
 func (h *Handler) GetSecuritySettings(c *fiber.Ctx) error {
 	var settings models.SecuritySettings
@@ -34,6 +54,13 @@ func (h *Handler) GetSecuritySettings(c *fiber.Ctx) error {
 		h.DB.Create(&settings)
 	}
 
+	// Viewers see the configuration but not the credentials in it
+	if !isAdminRequest(c) {
+		settings.MaxMindLicenseKey = ""
+		settings.IPIntelligenceAPIKey = ""
+		settings.DiscordWebhookURL = ""
+	}
+
 	return c.JSON(settings)
 }
 
@@ -46,26 +73,99 @@ func (h *Handler) UpdateSecuritySettings(c *fiber.Ctx) error {
 		SYNCookies                bool     `json:"syn_cookies"`
 		ProtectionLevel           int      `json:"protection_level"`
 		GeoAllowCountries         []string `json:"geo_allow_countries"`
+		UnknownCountryPolicy      string   `json:"unknown_country_policy"` // "" keeps the current value
+		GeoMode                   string   `json:"geo_mode"`               // "" keeps the current value
+		GeoBlockCountries         *string  `json:"geo_block_countries"`    // Comma-separated; nil keeps the current value
 		SmartBanning              bool     `json:"smart_banning"`
 		SteamQueryBypass          bool     `json:"steam_query_bypass"`
+		SteamQueryPorts           string   `json:"steam_query_ports"` // Comma-separated
+		SteamQueryScope           string   `json:"steam_query_scope"`
 		EBPFEnabled               bool     `json:"ebpf_enabled"`
 		TrafficStatsResetInterval int      `json:"traffic_stats_reset_interval"`
 		MaxMindLicenseKey         string   `json:"maxmind_license_key"`
+		CountryCIDRSource         string   `json:"country_cidr_source"`
+		GeoIPUpdateIntervalHours  int      `json:"geoip_update_interval_hours"`
+		GeoIPMaxAgeHours          int      `json:"geoip_max_age_hours"`
 		BlockedIPs                []string `json:"blocked_ips"`
+		WANInterface              string   `json:"wan_interface"`
+		// Management HTTPS
+		TLSEnabled           bool   `json:"tls_enabled"`
+		TLSCertFile          string `json:"tls_cert_file"`
+		TLSKeyFile           string `json:"tls_key_file"`
+		TLSRedirectHTTP      bool   `json:"tls_redirect_http"`
+		TLSAutocertDomain    string `json:"tls_autocert_domain"` // Let's Encrypt instead of the cert/key files
+		TLSAutocertEmail     string `json:"tls_autocert_email"`
+		AdditionalInterfaces string `json:"additional_interfaces"` // Comma-separated
+		EnableIPv6           *bool  `json:"enable_ipv6"`           // nil keeps the current value
+		// Login lockout (0 keeps the current value)
+		LoginMaxAttempts    int `json:"login_max_attempts"`
+		LoginLockoutMinutes int `json:"login_lockout_minutes"`
+		// Per-IP login throttle (0 keeps the current value)
+		LoginIPMaxFailures   int `json:"login_ip_max_failures"`
+		LoginIPWindowSeconds int `json:"login_ip_window_seconds"`
+		// WireGuard client config (nil keeps the current value)
+		WGClientDNS             *string `json:"wg_client_dns"`
+		WGHandshakeAlertMinutes *int    `json:"wg_handshake_alert_minutes"` // 0 turns the alert off
 		// XDP Settings
 		XDPHardBlocking bool `json:"xdp_hard_blocking"`
 		XDPRateLimitPPS int  `json:"xdp_rate_limit_pps"`
 		// Discord Webhook
-		DiscordWebhookURL string `json:"discord_webhook_url"`
-		AlertOnAttack     bool   `json:"alert_on_attack"`
-		AlertOnBlock      bool   `json:"alert_on_block"`
+		DiscordWebhookURL  string `json:"discord_webhook_url"`
+		AlertOnAttack      bool   `json:"alert_on_attack"`
+		AlertOnBlock       bool   `json:"alert_on_block"`
+		NewCountryAlert    bool   `json:"new_country_alert"`
+		CountrySpikeFactor int    `json:"country_spike_factor"`
 		// IP Intelligence
-		IPIntelligenceEnabled bool   `json:"ip_intelligence_enabled"`
-		IPIntelligenceAPIKey  string `json:"ip_intelligence_api_key"`
+		IPIntelligenceEnabled    bool   `json:"ip_intelligence_enabled"`
+		IPIntelligenceProvider   string `json:"ip_intelligence_provider"`
+		IPIntelligenceAPIKey     string `json:"ip_intelligence_api_key"`
+		AbuseScoreBlockThreshold int    `json:"abuse_score_block_threshold"`
 		// Data Retention
 		AttackHistoryDays int `json:"attack_history_days"`
 		// Maintenance Mode
 		MaintenanceUntil *time.Time `json:"maintenance_until"`
+		// Reminder while unprotected (nil keeps the current value, 0 turns it off)
+		ProtectionReminderMinutes *int `json:"protection_reminder_minutes"`
+		// Dangerous Ports (comma-separated)
+		BlockedDestPorts             string `json:"blocked_dest_ports"`
+		BlockedReflectionSourcePorts string `json:"blocked_reflection_source_ports"`
+		// Event Aggregation
+		EventBatchSeconds      int `json:"event_batch_seconds"`
+		EventQueueSize         int `json:"event_queue_size"`
+		EventAggregatorMaxKeys int `json:"event_aggregator_max_keys"`
+		GeoResolveWorkers      int `json:"geo_resolve_workers"`
+		// Per-IP attack event cap (nil keeps the current value, 0 = unlimited)
+		AttackEventsPerIPCap *int `json:"attack_events_per_ip_cap"`
+		// Packet capture (nil keeps the current value; retention 0 = keep forever)
+		PCAPAutoCapture         *bool `json:"pcap_auto_capture"`
+		PCAPAutoCaptureMinPPS   *int  `json:"pcap_auto_capture_min_pps"`
+		PCAPAutoCaptureSeconds  *int  `json:"pcap_auto_capture_seconds"`
+		PCAPManualRetentionDays *int  `json:"pcap_manual_retention_days"`
+		PCAPAutoRetentionDays   *int  `json:"pcap_auto_retention_days"`
+		// Per-IP Stats Sampling
+		IPStatsTopK        int `json:"ip_stats_top_k"`
+		IPStatsPollSeconds int `json:"ip_stats_poll_seconds"`
+		// Flood Warmup (per protection level; grace nil keeps the current value, -1 = level default, 0 = none)
+		FloodGraceSecLow        *int `json:"flood_grace_sec_low"`
+		FloodGraceSecStandard   *int `json:"flood_grace_sec_standard"`
+		FloodGraceSecHigh       *int `json:"flood_grace_sec_high"`
+		FloodMinSamplesLow      int  `json:"flood_min_samples_low"`
+		FloodMinSamplesStandard int  `json:"flood_min_samples_standard"`
+		FloodMinSamplesHigh     int  `json:"flood_min_samples_high"`
+		// Repeat Offender Promotion
+		AutoPromoteThreshold   int `json:"auto_promote_threshold"`
+		AutoPromoteWindowHours int `json:"auto_promote_window_hours"`
+		// Recurrence Promotion
+		RecurrencePromoteThreshold int `json:"recurrence_promote_threshold"`
+		RecurrencePromoteDays      int `json:"recurrence_promote_days"`
+		// Internal Traffic
+		ExcludeInternalTraffic bool   `json:"exclude_internal_traffic"`
+		InternalExcludeCIDRs   string `json:"internal_exclude_cidrs"`
+		// Origin Egress Filtering
+		EgressFilterEnabled bool   `json:"egress_filter_enabled"`
+		EgressFilterMode    string `json:"egress_filter_mode"`
+		// Public Status Badge
+		PublicStatusEnabled bool `json:"public_status_enabled"`
 	}
 
 	if err := c.BodyParser(&input); err != nil {
@@ -79,8 +179,198 @@ func (h *Handler) UpdateSecuritySettings(c *fiber.Ctx) error {
 		settings.ID = 1
 	}
 
-	// Capture old key for change detection
+	// Validate explicit WAN interface before touching anything
+	input.WANInterface = strings.TrimSpace(input.WANInterface)
+	if input.WANInterface != "" {
+		if err := system.ValidateInterface(input.WANInterface); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	additionalIfaces := system.ParseInterfaceList(input.AdditionalInterfaces)
+	for _, name := range additionalIfaces {
+		if err := system.ValidateInterface(name); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	// Refuse to enable HTTPS with a certificate that wouldn't load on restart (lockout)
+	input.TLSCertFile = strings.TrimSpace(input.TLSCertFile)
+	input.TLSKeyFile = strings.TrimSpace(input.TLSKeyFile)
+	input.TLSAutocertDomain = strings.ToLower(strings.TrimSpace(input.TLSAutocertDomain))
+	input.TLSAutocertEmail = strings.TrimSpace(input.TLSAutocertEmail)
+	if input.TLSAutocertDomain != "" {
+		if err := system.ValidateAutocertDomain(input.TLSAutocertDomain); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+	} else if input.TLSEnabled {
+		if err := system.ValidateKeyPair(input.TLSCertFile, input.TLSKeyFile); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	if input.TLSAutocertEmail != "" {
+		if _, err := mail.ParseAddress(input.TLSAutocertEmail); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "tls_autocert_email: invalid address"})
+		}
+	}
+
+	// Validate dangerous port lists
+	blockedDestPorts, err := services.ParsePortList(input.BlockedDestPorts)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "blocked_dest_ports: " + err.Error()})
+	}
+	reflectionPorts, err := services.ParsePortList(input.BlockedReflectionSourcePorts)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "blocked_reflection_source_ports: " + err.Error()})
+	}
+	steamQueryPorts, err := services.ParsePortList(input.SteamQueryPorts)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "steam_query_ports: " + err.Error()})
+	}
+	internalCIDRs, err := services.ParseCIDRList(input.InternalExcludeCIDRs)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "internal_exclude_cidrs: " + err.Error()})
+	}
+	switch input.CountryCIDRSource {
+	case "":
+		input.CountryCIDRSource = services.CountryCIDRSourceIPVerse
+	case services.CountryCIDRSourceIPVerse, services.CountryCIDRSourceMaxMindCSV:
+	default:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "country_cidr_source must be 'ipverse' or 'maxmind_csv'"})
+	}
+	if input.UnknownCountryPolicy != "" && !services.ValidUnknownCountryPolicy(input.UnknownCountryPolicy) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "unknown_country_policy must be 'block', 'allow' or 'allow_if_whitelisted'"})
+	}
+	if input.GeoMode != "" && !services.ValidGeoMode(input.GeoMode) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "geo_mode must be 'allow' or 'block'"})
+	}
+	var geoBlockCountries []string
+	if input.GeoBlockCountries != nil {
+		for _, cc := range strings.Split(*input.GeoBlockCountries, ",") {
+			cc = strings.ToUpper(strings.TrimSpace(cc))
+			if cc == "" {
+				continue
+			}
+			if len(cc) != 2 {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "geo_block_countries: invalid country code " + cc})
+			}
+			geoBlockCountries = append(geoBlockCountries, cc)
+		}
+	}
+	if input.LoginMaxAttempts < 0 || input.LoginMaxAttempts > maxLoginAttemptsLimit {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("login_max_attempts must be between 1 and %d", maxLoginAttemptsLimit)})
+	}
+	if input.LoginLockoutMinutes < 0 || input.LoginLockoutMinutes > maxLoginLockoutMinutes {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("login_lockout_minutes must be between 1 and %d", maxLoginLockoutMinutes)})
+	}
+	if input.LoginIPMaxFailures < 0 || input.LoginIPMaxFailures > maxLoginIPMaxFailuresLimit {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("login_ip_max_failures must be between 1 and %d", maxLoginIPMaxFailuresLimit)})
+	}
+	if input.LoginIPWindowSeconds < 0 || input.LoginIPWindowSeconds > maxLoginIPWindowSecondsLimit {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("login_ip_window_seconds must be between 1 and %d", maxLoginIPWindowSecondsLimit)})
+	}
+	if input.ProtectionReminderMinutes != nil && (*input.ProtectionReminderMinutes < 0 || *input.ProtectionReminderMinutes > maxProtectionReminderMinutes) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("protection_reminder_minutes must be between 0 and %d", maxProtectionReminderMinutes)})
+	}
+	var wgClientDNS []string
+	if input.WGClientDNS != nil {
+		for _, entry := range strings.Split(*input.WGClientDNS, ",") {
+			if entry = strings.TrimSpace(entry); entry == "" {
+				continue
+			}
+			if net.ParseIP(entry) == nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "wg_client_dns: invalid IP address " + entry})
+			}
+			wgClientDNS = append(wgClientDNS, entry)
+		}
+	}
+	if input.WGHandshakeAlertMinutes != nil && (*input.WGHandshakeAlertMinutes < 0 || *input.WGHandshakeAlertMinutes > maxWGHandshakeAlertMinutes) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("wg_handshake_alert_minutes must be between 0 and %d", maxWGHandshakeAlertMinutes)})
+	}
+	if input.IPIntelligenceProvider == "" {
+		input.IPIntelligenceProvider = services.IPIntelProviderIPInfo
+	}
+	if !services.ValidIPIntelligenceProvider(input.IPIntelligenceProvider) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "ip_intelligence_provider must be 'ipinfo', 'abuseipdb', 'ipqualityscore' or 'proxycheck'"})
+	}
+	if input.AbuseScoreBlockThreshold < 0 || input.AbuseScoreBlockThreshold > 100 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "abuse_score_block_threshold must be between 0 and 100"})
+	}
+	if input.CountrySpikeFactor < 0 || input.CountrySpikeFactor > 100 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "country_spike_factor must be between 0 and 100"})
+	}
+	// Aggregator limits bound memory use under spoofed-source floods (0 keeps the current value)
+	if input.EventQueueSize != 0 && (input.EventQueueSize < 1000 || input.EventQueueSize > 1000000) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "event_queue_size must be between 1000 and 1000000"})
+	}
+	if input.EventAggregatorMaxKeys != 0 && (input.EventAggregatorMaxKeys < 1000 || input.EventAggregatorMaxKeys > 1000000) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "event_aggregator_max_keys must be between 1000 and 1000000"})
+	}
+
+	if input.AttackEventsPerIPCap != nil && (*input.AttackEventsPerIPCap < 0 || *input.AttackEventsPerIPCap > maxAttackEventsPerIPCap) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("attack_events_per_ip_cap must be between 0 and %d", maxAttackEventsPerIPCap)})
+	}
+
+	if input.PCAPAutoCaptureMinPPS != nil && *input.PCAPAutoCaptureMinPPS < 1 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "pcap_auto_capture_min_pps must be at least 1"})
+	}
+	if input.PCAPAutoCaptureSeconds != nil && (*input.PCAPAutoCaptureSeconds < 1 || *input.PCAPAutoCaptureSeconds > maxPCAPAutoCaptureSeconds) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("pcap_auto_capture_seconds must be between 1 and %d", maxPCAPAutoCaptureSeconds)})
+	}
+	for name, days := range map[string]*int{
+		"pcap_manual_retention_days": input.PCAPManualRetentionDays,
+		"pcap_auto_retention_days":   input.PCAPAutoRetentionDays,
+	} {
+		if days != nil && (*days < 0 || *days > maxPCAPRetentionDays) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("%s must be between 0 and %d", name, maxPCAPRetentionDays)})
+		}
+	}
+
+	for name, sec := range map[string]*int{
+		"flood_grace_sec_low":      input.FloodGraceSecLow,
+		"flood_grace_sec_standard": input.FloodGraceSecStandard,
+		"flood_grace_sec_high":     input.FloodGraceSecHigh,
+	} {
+		if sec != nil && (*sec < services.FloodGraceDefault || *sec > maxFloodGraceSec) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("%s must be between -1 (level default) and %d", name, maxFloodGraceSec)})
+		}
+	}
+
+	if input.GeoResolveWorkers < 0 || input.GeoResolveWorkers > 16 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "geo_resolve_workers must be between 1 and 16"})
+	}
+
+	// GeoIP update cadence: 0 keeps the weekly default, at most 90 days
+	for _, v := range []struct {
+		name  string
+		value *int
+	}{{"geoip_update_interval_hours", &input.GeoIPUpdateIntervalHours}, {"geoip_max_age_hours", &input.GeoIPMaxAgeHours}} {
+		if *v.value == 0 {
+			*v.value = int(services.DefaultGeoIPUpdateInterval.Hours())
+		}
+		if *v.value < 1 || *v.value > 90*24 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": v.name + " must be between 1 and 2160"})
+		}
+	}
+	switch input.EgressFilterMode {
+	case "":
+		input.EgressFilterMode = services.EgressModeDrop
+	case services.EgressModeDrop, services.EgressModeLog:
+	default:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "egress_filter_mode must be 'drop' or 'log'"})
+	}
+	switch input.SteamQueryScope {
+	case "":
+		input.SteamQueryScope = services.SteamQueryScopeGlobal
+	case services.SteamQueryScopeGlobal, services.SteamQueryScopeServices:
+	default:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "steam_query_scope must be 'global' or 'services'"})
+	}
+
+	// Capture old values for change detection
 	oldLicenseKey := settings.MaxMindLicenseKey
+	oldWANInterface := settings.WANInterface
+	oldAdditionalInterfaces := settings.AdditionalInterfaces
+	oldTLS := fmt.Sprintf("%v|%s|%s|%v|%s|%s", settings.TLSEnabled, settings.TLSCertFile, settings.TLSKeyFile, settings.TLSRedirectHTTP, settings.TLSAutocertDomain, settings.TLSAutocertEmail)
 
 	// Update fields
 	settings.GlobalProtection = input.GlobalProtection
@@ -89,12 +379,41 @@ func (h *Handler) UpdateSecuritySettings(c *fiber.Ctx) error {
 	settings.SYNCookies = input.SYNCookies
 	settings.ProtectionLevel = input.ProtectionLevel
 	settings.GeoAllowCountries = strings.Join(input.GeoAllowCountries, ",")
+	if input.UnknownCountryPolicy != "" {
+		settings.UnknownCountryPolicy = input.UnknownCountryPolicy
+	}
+	if input.GeoMode != "" {
+		settings.GeoMode = input.GeoMode
+	}
+	if input.GeoBlockCountries != nil {
+		settings.GeoBlockCountries = strings.Join(geoBlockCountries, ",")
+	}
 	settings.SmartBanning = input.SmartBanning
 	settings.SteamQueryBypass = input.SteamQueryBypass
+	settings.SteamQueryPorts = services.FormatPortList(steamQueryPorts)
+	settings.SteamQueryScope = input.SteamQueryScope
 	settings.EBPFEnabled = input.EBPFEnabled
 	settings.TrafficStatsResetInterval = input.TrafficStatsResetInterval
 	settings.MaxMindLicenseKey = input.MaxMindLicenseKey
+	settings.CountryCIDRSource = input.CountryCIDRSource
+	settings.GeoIPUpdateIntervalHours = input.GeoIPUpdateIntervalHours
+	settings.GeoIPMaxAgeHours = input.GeoIPMaxAgeHours
 	settings.MaintenanceUntil = input.MaintenanceUntil // Update Maintenance Mode
+	if input.ProtectionReminderMinutes != nil {
+		settings.ProtectionReminderMinutes = *input.ProtectionReminderMinutes
+	}
+	settings.WANInterface = input.WANInterface
+	settings.AdditionalInterfaces = strings.Join(additionalIfaces, ",")
+	if input.EnableIPv6 != nil {
+		settings.EnableIPv6 = *input.EnableIPv6
+	}
+	// Management HTTPS
+	settings.TLSEnabled = input.TLSEnabled
+	settings.TLSCertFile = input.TLSCertFile
+	settings.TLSKeyFile = input.TLSKeyFile
+	settings.TLSRedirectHTTP = input.TLSRedirectHTTP
+	settings.TLSAutocertDomain = input.TLSAutocertDomain
+	settings.TLSAutocertEmail = input.TLSAutocertEmail
 	// XDP Settings
 	settings.XDPHardBlocking = input.XDPHardBlocking
 	settings.XDPRateLimitPPS = input.XDPRateLimitPPS
@@ -102,13 +421,114 @@ func (h *Handler) UpdateSecuritySettings(c *fiber.Ctx) error {
 	settings.DiscordWebhookURL = input.DiscordWebhookURL
 	settings.AlertOnAttack = input.AlertOnAttack
 	settings.AlertOnBlock = input.AlertOnBlock
+	settings.NewCountryAlert = input.NewCountryAlert
+	settings.CountrySpikeFactor = input.CountrySpikeFactor
 	// IP Intelligence
 	settings.IPIntelligenceEnabled = input.IPIntelligenceEnabled
+	settings.IPIntelligenceProvider = input.IPIntelligenceProvider
 	settings.IPIntelligenceAPIKey = input.IPIntelligenceAPIKey
+	settings.AbuseScoreBlockThreshold = input.AbuseScoreBlockThreshold
+	// Login lockout
+	if input.LoginMaxAttempts > 0 {
+		settings.LoginMaxAttempts = input.LoginMaxAttempts
+	}
+	if input.LoginLockoutMinutes > 0 {
+		settings.LoginLockoutMinutes = input.LoginLockoutMinutes
+	}
+	if input.LoginIPMaxFailures > 0 {
+		settings.LoginIPMaxFailures = input.LoginIPMaxFailures
+	}
+	if input.LoginIPWindowSeconds > 0 {
+		settings.LoginIPWindowSeconds = input.LoginIPWindowSeconds
+	}
 	// Data Retention
 	if input.AttackHistoryDays > 0 {
 		settings.AttackHistoryDays = input.AttackHistoryDays
 	}
+	// Dangerous Ports
+	settings.BlockedDestPorts = services.FormatPortList(blockedDestPorts)
+	settings.BlockedReflectionSourcePorts = services.FormatPortList(reflectionPorts)
+	// Event Aggregation
+	if input.EventBatchSeconds > 0 {
+		settings.EventBatchSeconds = input.EventBatchSeconds
+	}
+	if input.EventQueueSize > 0 {
+		settings.EventQueueSize = input.EventQueueSize
+	}
+	if input.EventAggregatorMaxKeys > 0 {
+		settings.EventAggregatorMaxKeys = input.EventAggregatorMaxKeys
+	}
+	if input.GeoResolveWorkers > 0 {
+		settings.GeoResolveWorkers = input.GeoResolveWorkers
+	}
+	if input.AttackEventsPerIPCap != nil {
+		settings.AttackEventsPerIPCap = *input.AttackEventsPerIPCap
+	}
+	// Packet capture
+	if input.PCAPAutoCapture != nil {
+		settings.PCAPAutoCapture = *input.PCAPAutoCapture
+	}
+	if input.PCAPAutoCaptureMinPPS != nil {
+		settings.PCAPAutoCaptureMinPPS = *input.PCAPAutoCaptureMinPPS
+	}
+	if input.PCAPAutoCaptureSeconds != nil {
+		settings.PCAPAutoCaptureSeconds = *input.PCAPAutoCaptureSeconds
+	}
+	if input.PCAPManualRetentionDays != nil {
+		settings.PCAPManualRetentionDays = *input.PCAPManualRetentionDays
+	}
+	if input.PCAPAutoRetentionDays != nil {
+		settings.PCAPAutoRetentionDays = *input.PCAPAutoRetentionDays
+	}
+	// Per-IP Stats Sampling
+	if input.IPStatsTopK > 0 {
+		settings.IPStatsTopK = input.IPStatsTopK
+	}
+	if input.IPStatsPollSeconds > 0 {
+		settings.IPStatsPollSeconds = input.IPStatsPollSeconds
+	}
+	// Flood Warmup
+	if input.FloodGraceSecLow != nil {
+		settings.FloodGraceSecLow = *input.FloodGraceSecLow
+	}
+	if input.FloodGraceSecStandard != nil {
+		settings.FloodGraceSecStandard = *input.FloodGraceSecStandard
+	}
+	if input.FloodGraceSecHigh != nil {
+		settings.FloodGraceSecHigh = *input.FloodGraceSecHigh
+	}
+	settings.FloodMinSamplesLow = input.FloodMinSamplesLow
+	settings.FloodMinSamplesStandard = input.FloodMinSamplesStandard
+	settings.FloodMinSamplesHigh = input.FloodMinSamplesHigh
+	// Repeat Offender Promotion
+	settings.AutoPromoteThreshold = input.AutoPromoteThreshold
+	if input.AutoPromoteWindowHours > 0 {
+		settings.AutoPromoteWindowHours = input.AutoPromoteWindowHours
+	}
+	// Recurrence Promotion
+	settings.RecurrencePromoteThreshold = input.RecurrencePromoteThreshold
+	if input.RecurrencePromoteDays > 0 {
+		settings.RecurrencePromoteDays = input.RecurrencePromoteDays
+	}
+	// Internal Traffic
+	settings.ExcludeInternalTraffic = input.ExcludeInternalTraffic
+	cidrs := make([]string, 0, len(internalCIDRs))
+	for _, n := range internalCIDRs {
+		cidrs = append(cidrs, n.String())
+	}
+	settings.InternalExcludeCIDRs = strings.Join(cidrs, ",")
+	// WireGuard client config
+	if input.WGClientDNS != nil {
+		settings.WGClientDNS = strings.Join(wgClientDNS, ", ")
+	}
+	if input.WGHandshakeAlertMinutes != nil {
+		settings.WGHandshakeAlertMinutes = *input.WGHandshakeAlertMinutes
+	}
+	// Origin Egress Filtering
+	settings.EgressFilterEnabled = input.EgressFilterEnabled
+	settings.EgressFilterMode = input.EgressFilterMode
+	// Public Status Badge
+	settings.PublicStatusEnabled = input.PublicStatusEnabled
 
 	// Save to DB
 	if result.Error != nil {
@@ -117,6 +537,16 @@ func (h *Handler) UpdateSecuritySettings(c *fiber.Ctx) error {
 		h.DB.Save(&settings)
 	}
 
+	// Switch WAN interfaces: detach from the old NICs so Enable re-attaches to the new set
+	if settings.WANInterface != oldWANInterface || settings.AdditionalInterfaces != oldAdditionalInterfaces {
+		system.SetWANInterface(settings.WANInterface)
+		system.SetAdditionalInterfaces(additionalIfaces)
+		system.Info("Protected interfaces changed: %v", system.GetProtectedInterfaces())
+		if h.EBPF != nil && h.EBPF.IsEnabled() {
+			h.EBPF.Disable()
+		}
+	}
+
 	// Enable/Disable eBPF based on settings
 	if h.EBPF != nil {
 		if settings.EBPFEnabled {
@@ -137,6 +567,11 @@ func (h *Handler) UpdateSecuritySettings(c *fiber.Ctx) error {
 
 	system.Info("Security settings updated: eBPF=%v, Protection=%d", settings.EBPFEnabled, settings.ProtectionLevel)
 	AddEvent("success", "Security settings applied")
+	if fmt.Sprintf("%v|%s|%s|%v|%s|%s", settings.TLSEnabled, settings.TLSCertFile, settings.TLSKeyFile, settings.TLSRedirectHTTP, settings.TLSAutocertDomain, settings.TLSAutocertEmail) != oldTLS {
+		AddEvent("warning", "HTTPS settings changed: restart the backend to apply")
+	}
+
+	h.applyRuntimeSettings(&settings)
 
 	// Update GeoIP service with new license key only if it changed
 	if input.MaxMindLicenseKey != "" && input.MaxMindLicenseKey != oldLicenseKey && h.Firewall != nil && h.Firewall.GeoIP != nil {
@@ -151,9 +586,21 @@ func (h *Handler) UpdateSecuritySettings(c *fiber.Ctx) error {
 		}
 	}
 
-	// Apply Firewall Rules
+	// Apply Firewall Rules; the UI confirms them once it can still reach the API afterwards
 	if h.Firewall != nil {
-		go h.Firewall.ApplyRules()
+		go h.Firewall.ApplyRulesConfirmed()
+	}
+
+	return c.JSON(fiber.Map{"message": "Settings applied successfully", "settings": settings})
+}
+
+// applyRuntimeSettings pushes the saved settings into the running services that cache them.
+// Firewall rules are not re-applied here.
+func (h *Handler) applyRuntimeSettings(settings *models.SecuritySettings) {
+	if h.Firewall != nil && h.Firewall.GeoIP != nil {
+		h.Firewall.GeoIP.SetCountryCIDRSource(settings.CountryCIDRSource)
+		h.Firewall.GeoIP.SetUpdatePolicy(time.Duration(settings.GeoIPUpdateIntervalHours)*time.Hour, time.Duration(settings.GeoIPMaxAgeHours)*time.Hour)
+		h.Firewall.GeoIP.SetIPIntelligenceProvider(settings.IPIntelligenceProvider, settings.IPIntelligenceAPIKey)
 	}
 
 	// Update Webhook Service
@@ -163,10 +610,44 @@ func (h *Handler) UpdateSecuritySettings(c *fiber.Ctx) error {
 
 	// Update eBPF Config (XDP settings)
 	if h.EBPF != nil {
-		h.EBPF.UpdateConfig(settings.XDPHardBlocking, settings.XDPRateLimitPPS)
+		h.EBPF.UpdateConfig(settings.XDPHardBlocking, settings.XDPRateLimitPPS, settings.XDPRateLimitBurst)
+		h.EBPF.SetAggregatorInterval(settings.EventBatchSeconds)
+		h.EBPF.SetAggregatorLimits(settings.EventAggregatorMaxKeys, settings.EventQueueSize)
+		h.EBPF.SetCountryWatch(settings.NewCountryAlert, settings.CountrySpikeFactor)
+		h.EBPF.SetIPStatsSampling(settings.IPStatsTopK, settings.IPStatsPollSeconds)
 	}
 
-	return c.JSON(fiber.Map{"message": "Settings applied successfully", "settings": settings})
+	// Update flood warmup overrides and the event resolver pool
+	if h.Firewall != nil && h.Firewall.FloodProtect != nil {
+		h.Firewall.FloodProtect.SetGeoResolveWorkers(settings.GeoResolveWorkers)
+		h.Firewall.FloodProtect.ApplyGraceSettings(settings)
+		// The level may have changed, and with it the default rate limit block duration
+		if h.EBPF != nil {
+			h.EBPF.SetRateLimitBlockTTL(h.Firewall.FloodProtect.BlockDurationFor(services.BlockReasonRateLimit))
+		}
+	}
+
+	// Update repeat offender promotion
+	if h.Offenses != nil {
+		h.Offenses.SetConfig(settings.AutoPromoteThreshold, settings.AutoPromoteWindowHours)
+		h.Offenses.SetRecurrenceConfig(settings.RecurrencePromoteThreshold, settings.RecurrencePromoteDays)
+		h.Offenses.SetIntelligenceBan(settings.IPIntelligenceEnabled, settings.AbuseScoreBlockThreshold)
+	}
+
+	// Per-IP cap of stored attack events (flood and eBPF writers)
+	services.SetAttackEventCap(settings.AttackEventsPerIPCap)
+
+	// Packet capture on attack and retention
+	services.SetAutoCapture(settings.PCAPAutoCapture, settings.PCAPAutoCaptureMinPPS, settings.PCAPAutoCaptureSeconds)
+	services.SetCaptureRetention(settings.PCAPManualRetentionDays, settings.PCAPAutoRetentionDays)
+
+	// Stale WireGuard handshake alert
+	if h.WG != nil {
+		h.WG.SetHandshakeAlertMinutes(settings.WGHandshakeAlertMinutes)
+	}
+
+	// Update internal traffic exclusion (validated when the settings were saved)
+	services.ApplyInternalExclusion(settings.ExcludeInternalTraffic, settings.InternalExcludeCIDRs)
 }
 
 // TestWebhook sends a test notification to the configured Discord webhook
@@ -212,6 +693,9 @@ func (h *Handler) AddAllowIP(c *fiber.Ctx) error {
 	if err := c.BodyParser(&input); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
 	}
+	if err := cleanTextFields(textField{"label", &input.Label, maxLabelLength}); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
 
 	// Validate and normalize IP/CIDR
 	normalized, err := validateAndNormalizeCIDR(input.IP)
@@ -283,6 +767,9 @@ func (h *Handler) AddBanIP(c *fiber.Ctx) error {
 	if err := c.BodyParser(&input); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
 	}
+	if err := cleanTextFields(textField{"reason", &input.Reason, maxReasonLength}); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
 
 	// Validate and normalize IP/CIDR
 	normalized, err := validateAndNormalizeCIDR(input.IP)
@@ -292,10 +779,46 @@ func (h *Handler) AddBanIP(c *fiber.Ctx) error {
 	input.IP = normalized
 	input.IsAuto = false
 
+	// Optional TTL: the ban is lifted automatically once it expires
+	var ttl struct {
+		DurationSeconds int `json:"duration_seconds"`
+	}
+	_ = c.BodyParser(&ttl)
+	if ttl.DurationSeconds < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "duration_seconds must be positive (0 = permanent)"})
+	}
+	if ttl.DurationSeconds > 0 {
+		if input.ExpiresAt != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Set either duration_seconds or expires_at, not both"})
+		}
+		expiresAt := time.Now().Add(time.Duration(ttl.DurationSeconds) * time.Second)
+		input.ExpiresAt = &expiresAt
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return c.Status(400).JSON(fiber.Map{"error": "expires_at must be in the future"})
+	}
+
+	// Without an explicit expiry, a configured manual block duration applies
+	if input.ExpiresAt == nil && h.Firewall != nil && h.Firewall.FloodProtect != nil {
+		if d := h.Firewall.FloodProtect.BlockDurationFor(services.BlockReasonManual); d > 0 {
+			expiresAt := time.Now().Add(d)
+			input.ExpiresAt = &expiresAt
+		}
+	}
+
 	if err := h.DB.Create(&input).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	services.LogBlockHistory(h.DB, models.BlockHistory{
+		IP:        input.IP,
+		Action:    services.BlockActionBlocked,
+		Reason:    "manual",
+		Source:    "manual",
+		ExpiresAt: input.ExpiresAt,
+		Details:   input.Reason,
+	})
+
 	if h.Firewall != nil {
 		go h.Firewall.ApplyRules()
 	}
@@ -305,16 +828,82 @@ func (h *Handler) AddBanIP(c *fiber.Ctx) error {
 // DeleteBanIP removes an IP from blacklist
 func (h *Handler) DeleteBanIP(c *fiber.Ctx) error {
 	id := c.Params("id")
-	if err := h.DB.Delete(&models.BanIP{}, id).Error; err != nil {
+	var ban models.BanIP
+	if err := h.DB.First(&ban, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Ban not found"})
+	}
+	if err := h.DB.Delete(&ban).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	services.LogBlockHistory(h.DB, models.BlockHistory{
+		IP:      ban.IP,
+		Action:  services.BlockActionUnblocked,
+		Reason:  "manual",
+		Source:  "manual",
+		Details: "Removed from blacklist (was: " + ban.Reason + ")",
+	})
+
 	if h.Firewall != nil {
 		go h.Firewall.ApplyRules()
 	}
 	return c.JSON(fiber.Map{"success": true})
 }
 
+// GetOffenders returns repeat offense counters for auto-blocked IPs
+// GET /api/security/offenders
+func (h *Handler) GetOffenders(c *fiber.Ctx) error {
+	if h.Offenses == nil {
+		return c.JSON(fiber.Map{"offenders": []services.OffenseRecord{}, "total": 0})
+	}
+
+	offenders := h.Offenses.GetOffenses()
+	return c.JSON(fiber.Map{"offenders": offenders, "total": len(offenders)})
+}
+
+// ClearOffenders resets the offense counter and block recurrence for one IP (body {"ip": "..."}) or all IPs
+// DELETE /api/security/offenders
+func (h *Handler) ClearOffenders(c *fiber.Ctx) error {
+	var input struct {
+		IP string `json:"ip"`
+	}
+	// Body is optional: empty body clears all counters
+	_ = c.BodyParser(&input)
+
+	if h.Offenses != nil {
+		h.Offenses.ClearOffenses(input.IP)
+	}
+
+	if input.IP == "" {
+		AddEvent("info", "All repeat offender counters cleared")
+	} else {
+		AddEvent("info", "Repeat offender counter cleared: "+input.IP)
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// ExportUpstreamBlocklist returns permanently banned IPs flagged for upstream blocking
+// (routers, hosting provider ACLs). ?format=txt returns one IP per line.
+// GET /api/security/upstream-blocklist
+func (h *Handler) ExportUpstreamBlocklist(c *fiber.Ctx) error {
+	var bans []models.BanIP
+	if err := h.DB.Where("upstream = ? AND expires_at IS NULL", true).Order("created_at ASC").Find(&bans).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if c.Query("format") == "txt" {
+		var sb strings.Builder
+		for _, b := range bans {
+			sb.WriteString(b.IP)
+			sb.WriteString("\n")
+		}
+		c.Set("Content-Type", "text/plain; charset=utf-8")
+		return c.SendString(sb.String())
+	}
+
+	return c.JSON(fiber.Map{"entries": bans, "total": len(bans)})
+}
+
 // CheckIPStatus checks if an IP is allowed/blocked/geo-blocked
 func (h *Handler) CheckIPStatus(c *fiber.Ctx) error {
 	ip := c.Params("ip")
@@ -358,3 +947,343 @@ func (h *Handler) CheckIPStatus(c *fiber.Ctx) error {
 		"reason": reason,
 	})
 }
+
+// SimulateSecurityImpact previews which currently active source IPs a geo policy change would cut off.
+// Omitted fields keep their current value, so {"block_vpn": true} previews just that toggle.
+// POST /api/security/impact
+func (h *Handler) SimulateSecurityImpact(c *fiber.Ctx) error {
+	var input struct {
+		GeoAllowCountries *[]string `json:"geo_allow_countries"`
+		BlockVPN          *bool     `json:"block_vpn"`
+		BlockTOR          *bool     `json:"block_tor"`
+		UnknownCountry    *string   `json:"unknown_country_policy"`
+		SampleLimit       int       `json:"sample_limit"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	if h.EBPF == nil || !h.EBPF.IsEnabled() {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "eBPF monitoring is disabled; no live traffic to evaluate"})
+	}
+	if h.Firewall == nil || h.Firewall.GeoIP == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "GeoIP service not initialized"})
+	}
+	if input.SampleLimit <= 0 || input.SampleLimit > 500 {
+		input.SampleLimit = 50
+	}
+
+	var settings models.SecuritySettings
+	if err := h.DB.First(&settings).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load settings"})
+	}
+	current := services.GeoPolicyFromSettings(&settings)
+	proposed := current
+	if input.GeoAllowCountries != nil {
+		proposed.AllowCountries = nil
+		for _, cc := range *input.GeoAllowCountries {
+			if cc = strings.ToUpper(strings.TrimSpace(cc)); cc != "" {
+				proposed.AllowCountries = append(proposed.AllowCountries, cc)
+			}
+		}
+	}
+	if input.BlockVPN != nil {
+		proposed.BlockVPN = *input.BlockVPN
+	}
+	if input.BlockTOR != nil {
+		proposed.BlockTOR = *input.BlockTOR
+	}
+	if input.UnknownCountry != nil {
+		if !services.ValidUnknownCountryPolicy(*input.UnknownCountry) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "unknown_country_policy must be 'block', 'allow' or 'allow_if_whitelisted'"})
+		}
+		proposed.UnknownCountry = *input.UnknownCountry
+	}
+
+	// Whitelisted and allow_foreign sources RETURN before the geo checks in GEO_GUARD
+	var exemptList []string
+	var allowIPs []models.AllowIP
+	h.DB.Find(&allowIPs)
+	for _, a := range allowIPs {
+		exemptList = append(exemptList, a.IP)
+	}
+	var allowForeign []models.AllowForeign
+	h.DB.Find(&allowForeign)
+	for _, a := range allowForeign {
+		exemptList = append(exemptList, a.IP)
+	}
+	var exempt []*net.IPNet
+	for _, entry := range exemptList {
+		if nets, err := services.ParseCIDRList(entry); err == nil {
+			exempt = append(exempt, nets...)
+		}
+	}
+
+	report := h.Firewall.GeoIP.EvaluateGeoImpact(h.EBPF.GetTrafficData(), current, proposed, exempt, input.SampleLimit)
+
+	var warnings []string
+	if !h.Firewall.GeoIP.HasDatabase() {
+		warnings = append(warnings, "No MaxMind database loaded: every source resolves to an unknown country, so the country impact cannot be estimated")
+	}
+	if report.ActiveIPs == 0 {
+		warnings = append(warnings, "No active traffic sampled yet")
+	}
+	if report.ActiveIPs > 0 && report.NewlyBlocked*2 > report.ActiveIPs {
+		warnings = append(warnings, fmt.Sprintf("This change would cut off %d of %d active sources", report.NewlyBlocked, report.ActiveIPs))
+	}
+
+	return c.JSON(fiber.Map{
+		"current":  current,
+		"proposed": proposed,
+		"impact":   report,
+		"warnings": warnings,
+	})
+}
+
+// GetSecurityConsistency compares the ban/allow lists across the database, ipsets and eBPF maps
+// GET /api/security/consistency
+func (h *Handler) GetSecurityConsistency(c *fiber.Ctx) error {
+	if h.Firewall == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "Firewall service not initialized"})
+	}
+	return c.JSON(h.Firewall.CheckConsistency())
+}
+
+// ReconcileSecurityLayers rebuilds the ipsets and eBPF ban/allow entries from the database
+// POST /api/security/reconcile
+func (h *Handler) ReconcileSecurityLayers(c *fiber.Ctx) error {
+	if h.Firewall == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "Firewall service not initialized"})
+	}
+	report, err := h.Firewall.Reconcile()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if report.Consistent {
+		AddEvent("success", "Ban/allow lists reconciled across ipset and eBPF")
+	} else {
+		AddEvent("warning", "Ban/allow lists reconciled, but mismatches remain")
+	}
+	return c.JSON(report)
+}
+
+// GetSecurityReport returns what the box enforces right now: the last applied iptables/ipset rules,
+// eBPF config, allowed countries, enabled signatures and list sizes. ?format=text downloads it as a document.
+// GET /api/security/report
+func (h *Handler) GetSecurityReport(c *fiber.Ctx) error {
+	if h.Firewall == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "Firewall service not initialized"})
+	}
+	report := h.Firewall.BuildSecurityReport()
+
+	if c.Query("format") == "text" {
+		filename := "kg-proxy-security-report-" + report.GeneratedAt.Format("2006-01-02-1504") + ".txt"
+		c.Set("Content-Disposition", "attachment; filename="+filename)
+		c.Set("Content-Type", "text/plain; charset=utf-8")
+		return c.SendString(report.Text())
+	}
+	return c.JSON(report)
+}
+
+// GetFloodThresholds returns the thresholds the current protection level actually enforces, plus every level for comparison
+// GET /api/flood/thresholds
+func (h *Handler) GetFloodThresholds(c *fiber.Ctx) error {
+	if h.Firewall == nil || h.Firewall.FloodProtect == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "Flood protection not initialized"})
+	}
+	current, levels := h.Firewall.FloodProtect.GetThresholds()
+	return c.JSON(fiber.Map{"current": current, "levels": levels})
+}
+
+// GetFloodQueueStats returns the attack-event queue and country resolution pool statistics
+// GET /api/flood/queue
+func (h *Handler) GetFloodQueueStats(c *fiber.Ctx) error {
+	if h.Firewall == nil || h.Firewall.FloodProtect == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "Flood protection not initialized"})
+	}
+	return c.JSON(h.Firewall.FloodProtect.GetGeoResolveStats())
+}
+
+// GetBlockDurations returns how long blocks last for each reason
+// GET /api/flood/block-durations
+func (h *Handler) GetBlockDurations(c *fiber.Ctx) error {
+	if h.Firewall == nil || h.Firewall.FloodProtect == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "Flood protection not initialized"})
+	}
+	return c.JSON(fiber.Map{
+		"durations":   h.Firewall.FloodProtect.GetBlockDurations(),
+		"max_seconds": int(services.MaxBlockDuration.Seconds()),
+	})
+}
+
+// UpdateBlockDurations sets per-reason block durations in seconds (0 = level default, manual 0 = permanent)
+// PUT /api/flood/block-durations
+func (h *Handler) UpdateBlockDurations(c *fiber.Ctx) error {
+	if h.Firewall == nil || h.Firewall.FloodProtect == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "Flood protection not initialized"})
+	}
+
+	var input struct {
+		Manual    *int `json:"manual"`
+		RateLimit *int `json:"rate_limit"`
+		GeoIP     *int `json:"geoip"`
+		Flood     *int `json:"flood"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	var settings models.SecuritySettings
+	if err := h.DB.First(&settings, 1).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load settings"})
+	}
+
+	for _, f := range []struct {
+		name  string
+		value *int
+		dest  *int
+	}{
+		{"manual", input.Manual, &settings.BlockDurationManualSec},
+		{"rate_limit", input.RateLimit, &settings.BlockDurationRateLimitSec},
+		{"geoip", input.GeoIP, &settings.BlockDurationGeoIPSec},
+		{"flood", input.Flood, &settings.BlockDurationFloodSec},
+	} {
+		if f.value == nil {
+			continue
+		}
+		if err := services.ValidateBlockDurationSec(f.name, *f.value); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		*f.dest = *f.value
+	}
+
+	if err := h.DB.Model(&settings).Select(
+		"block_duration_manual_sec", "block_duration_rate_limit_sec", "block_duration_geoip_sec", "block_duration_flood_sec",
+	).Updates(&settings).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save settings"})
+	}
+
+	fp := h.Firewall.FloodProtect
+	fp.ApplyBlockDurations(&settings)
+	if h.EBPF != nil {
+		h.EBPF.SetRateLimitBlockTTL(fp.BlockDurationFor(services.BlockReasonRateLimit))
+	}
+
+	AddEvent("info", "Block durations updated")
+	return c.JSON(fiber.Map{"durations": fp.GetBlockDurations()})
+}
+
+// Bounds of the XDP per-IP token bucket (packets per second / packets)
+const (
+	maxXDPRateLimitPPS   = 10000000
+	maxXDPRateLimitBurst = 100000000
+)
+
+// xdpRateLimitSemantics documents the token bucket for API consumers
+const xdpRateLimitSemantics = "Each source IP has a bucket of 'burst' tokens that refills at 'pps' tokens per second. " +
+	"Every packet takes one token; packets arriving at an empty bucket are dropped (and the source blocked when block TTL is on). " +
+	"A source can send 'burst' packets at once and 'pps' packets per second on average. burst 0 = same as pps, pps 0 = limiter off."
+
+// xdpRateLimitView describes the saved rate limiter settings
+func (h *Handler) xdpRateLimitView(settings *models.SecuritySettings) fiber.Map {
+	effectiveBurst := settings.XDPRateLimitBurst
+	if effectiveBurst == 0 {
+		effectiveBurst = settings.XDPRateLimitPPS
+	}
+	return fiber.Map{
+		"pps":             settings.XDPRateLimitPPS,
+		"burst":           settings.XDPRateLimitBurst,
+		"effective_burst": effectiveBurst,
+		"enabled":         settings.XDPRateLimitPPS > 0,
+		"ebpf_enabled":    h.EBPF != nil && h.EBPF.IsEnabled(),
+		"semantics":       xdpRateLimitSemantics,
+	}
+}
+
+// GetXDPRateLimit returns the token bucket parameters of the XDP per-IP rate limiter
+// GET /api/ebpf/rate-limit
+func (h *Handler) GetXDPRateLimit(c *fiber.Ctx) error {
+	var settings models.SecuritySettings
+	if err := h.DB.First(&settings, 1).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load settings"})
+	}
+	return c.JSON(h.xdpRateLimitView(&settings))
+}
+
+// UpdateXDPRateLimit sets the refill rate and bucket size of the XDP per-IP rate limiter
+// PUT /api/ebpf/rate-limit {"pps": 5000, "burst": 20000}
+func (h *Handler) UpdateXDPRateLimit(c *fiber.Ctx) error {
+	var input struct {
+		PPS   *int `json:"pps"`
+		Burst *int `json:"burst"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	if input.PPS != nil && (*input.PPS < 0 || *input.PPS > maxXDPRateLimitPPS) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("pps must be between 0 and %d", maxXDPRateLimitPPS)})
+	}
+	if input.Burst != nil && (*input.Burst < 0 || *input.Burst > maxXDPRateLimitBurst) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("burst must be between 0 and %d", maxXDPRateLimitBurst)})
+	}
+
+	var settings models.SecuritySettings
+	if err := h.DB.First(&settings, 1).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load settings"})
+	}
+	if input.PPS != nil {
+		settings.XDPRateLimitPPS = *input.PPS
+	}
+	if input.Burst != nil {
+		settings.XDPRateLimitBurst = *input.Burst
+	}
+	if err := h.DB.Model(&settings).Select("xdp_rate_limit_pps", "xdp_rate_limit_burst").Updates(&settings).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save settings"})
+	}
+
+	if h.EBPF != nil {
+		h.EBPF.UpdateConfig(settings.XDPHardBlocking, settings.XDPRateLimitPPS, settings.XDPRateLimitBurst)
+	}
+
+	AddEvent("info", fmt.Sprintf("XDP rate limit updated: %d pps, burst %d", settings.XDPRateLimitPPS, settings.XDPRateLimitBurst))
+	return c.JSON(h.xdpRateLimitView(&settings))
+}
+
+// SimulateGeoGuardChain walks the GEO_GUARD rule order for a batch of IPs and reports which rule decides each
+// POST /api/security/simulate-chain
+func (h *Handler) SimulateGeoGuardChain(c *fiber.Ctx) error {
+	var input struct {
+		IPs      []string `json:"ips"`
+		Protocol string   `json:"protocol"` // udp (default) or tcp
+		Port     int      `json:"port"`     // Destination port, 0 = none
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	if len(input.IPs) == 0 || len(input.IPs) > 1000 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Provide between 1 and 1000 IPs"})
+	}
+	input.Protocol = strings.ToLower(input.Protocol)
+	switch input.Protocol {
+	case "":
+		input.Protocol = "udp"
+	case "udp", "tcp":
+	default:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "protocol must be udp or tcp"})
+	}
+	if input.Port < 0 || input.Port > 65535 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid port"})
+	}
+
+	results := h.Firewall.SimulateGeoGuard(input.IPs, input.Protocol, input.Port)
+	summary := map[string]int{}
+	for _, r := range results {
+		summary[r.MatchedStep]++
+	}
+	return c.JSON(fiber.Map{
+		"protocol": input.Protocol,
+		"port":     input.Port,
+		"results":  results,
+		"summary":  summary,
+		"note":     "Simulates the first packet of a new connection; established flows and the XDP layer are not covered",
+	})
+}
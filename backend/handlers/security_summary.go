@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/services"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// protectionLevelMeanings explains each protection level in plain words
+var protectionLevelMeanings = [3]string{
+	"Low: generous flood thresholds and short blocks, for busy servers where false positives hurt more than attacks",
+	"Standard: balanced thresholds suited to most game servers",
+	"High: strict thresholds and long blocks, new sources are watched closely before being trusted",
+}
+
+// GetSecuritySummary returns a read-only, human-readable rollup of the active protection:
+// what the settings say combined with what the running services actually enforce
+// GET /api/security/summary
+func (h *Handler) GetSecuritySummary(c *fiber.Ctx) error {
+	var settings models.SecuritySettings
+	if err := h.DB.First(&settings, 1).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load settings"})
+	}
+	now := time.Now()
+
+	// Protection level
+	level := settings.ProtectionLevel
+	if level < 0 || level >= len(protectionLevelMeanings) {
+		level = 1
+	}
+	protection := fiber.Map{
+		"enabled": settings.GlobalProtection,
+		"level":   level,
+		"meaning": protectionLevelMeanings[level],
+	}
+	if !settings.GlobalProtection {
+		protection["meaning"] = "Global protection is OFF: no geo, flood or ban rules are enforced"
+	}
+
+	// Geo filtering
+	var countries []string
+	for _, cc := range strings.Split(settings.GeoAllowCountries, ",") {
+		if cc = strings.ToUpper(strings.TrimSpace(cc)); cc != "" {
+			countries = append(countries, cc)
+		}
+	}
+	sort.Strings(countries)
+	var activeSchedules []string
+	if h.Firewall != nil {
+		countries = h.Firewall.EffectiveGeoCountries(&settings, now)
+		for _, sch := range h.Firewall.ActiveGeoSchedules(now) {
+			activeSchedules = append(activeSchedules, sch.Name)
+		}
+	}
+	ebpfEnabled := h.EBPF != nil && h.EBPF.IsEnabled()
+	var missingCountries, unprotected []string
+	cidrSource := settings.CountryCIDRSource
+	if h.Firewall != nil && h.Firewall.GeoIP != nil {
+		cidrSource = h.Firewall.GeoIP.GetCountryCIDRSource()
+	}
+	geo := fiber.Map{
+		"allowed_countries": countries,
+		"base_countries":    settings.GeoAllowCountries,
+		"active_schedules":  activeSchedules,
+		"cidr_source":       cidrSource,
+		"block_vpn":         settings.BlockVPN,
+		"block_tor":         settings.BlockTOR,
+	}
+	if len(countries) == 0 {
+		geo["description"] = "No countries configured: geo filtering allows nothing"
+	} else {
+		geo["description"] = fmt.Sprintf("Only traffic from %s reaches the game ports", strings.Join(countries, ", "))
+	}
+	if ebpfEnabled {
+		geoMap := h.EBPF.GetGeoMapStatus()
+		var effective, missing []string
+		for _, cc := range countries {
+			if geoMap.Countries[cc] > 0 {
+				effective = append(effective, cc)
+			} else {
+				missing = append(missing, cc)
+			}
+		}
+		geo["effective_countries"] = effective
+		geo["missing_countries"] = missing
+		missingCountries = missing
+		geo["xdp_cidrs"] = geoMap.TotalCIDRs
+		geo["xdp_map_truncated"] = geoMap.Truncated
+		geo["xdp_fail_safe"] = geoMap.FailSafeActive
+	}
+
+	// XDP
+	xdp := fiber.Map{
+		"ebpf_enabled":     ebpfEnabled,
+		"hard_blocking":    settings.XDPHardBlocking,
+		"rate_limit_pps":   settings.XDPRateLimitPPS,
+		"rate_limit_burst": settings.XDPRateLimitBurst,
+	}
+	switch {
+	case !ebpfEnabled:
+		xdp["description"] = "eBPF is off: filtering is done by iptables only"
+	case settings.XDPHardBlocking:
+		xdp["description"] = "Blocked and non-allowed traffic is dropped in XDP before it reaches iptables"
+	default:
+		xdp["description"] = "XDP counts and marks traffic, iptables makes the final drop decision"
+	}
+	if settings.XDPRateLimitPPS > 0 {
+		burst := settings.XDPRateLimitBurst
+		if burst == 0 {
+			burst = settings.XDPRateLimitPPS
+		}
+		xdp["rate_limit"] = fmt.Sprintf("Sources above %d packets/s are rate limited (bursts of up to %d packets pass)", settings.XDPRateLimitPPS, burst)
+	} else {
+		xdp["rate_limit"] = "Per-IP rate limit disabled"
+	}
+	if ebpfEnabled {
+		status := h.EBPF.GetXDPStatus()
+		xdp["interfaces"] = len(status.Interfaces)
+		xdp["generic_fallback"] = status.GenericFallback
+		xdp["unprotected_interfaces"] = status.Unprotected
+		unprotected = status.Unprotected
+		agg := h.EBPF.GetAggregatorStats()
+		xdp["event_queue"] = fmt.Sprintf("%d/%d", agg.QueueDepth, agg.QueueCapacity)
+		xdp["event_keys"] = fmt.Sprintf("%d/%d", agg.PendingKeys, agg.MaxKeys)
+		xdp["events_dropped"] = agg.DroppedTotal
+	}
+
+	// Flood protection
+	var flood fiber.Map
+	if h.Firewall != nil && h.Firewall.FloodProtect != nil {
+		current, _ := h.Firewall.FloodProtect.GetThresholds()
+		flood = fiber.Map{
+			"thresholds":      current,
+			"block_durations": h.Firewall.FloodProtect.GetBlockDurations(),
+			"blocked_ips":     len(h.Firewall.FloodProtect.GetBlockedIPs()),
+			"description": fmt.Sprintf("A source is blocked for %s after %d violations of %d packets/s or %.0f connections/s",
+				time.Duration(current.BlockDurationSec)*time.Second, current.MaxViolations, current.MaxPacketsPerSec, current.MaxConnPerSec),
+		}
+	}
+
+	// Notifications (the webhook URL itself is never returned)
+	discord := settings.DiscordWebhookURL != ""
+	var channels []string
+	if discord {
+		channels = append(channels, "discord")
+	}
+	notifications := fiber.Map{
+		"channels":          channels,
+		"alert_on_attack":   discord && settings.AlertOnAttack,
+		"alert_on_block":    discord && settings.AlertOnBlock,
+		"new_country_alert": discord && settings.NewCountryAlert,
+	}
+	if !discord {
+		notifications["description"] = "No notification channel configured: alerts only appear in the dashboard"
+	}
+
+	// Retention
+	retention := fiber.Map{
+		"attack_history_days":          settings.AttackHistoryDays,
+		"traffic_stats_reset_interval": settings.TrafficStatsResetInterval,
+		"description":                  fmt.Sprintf("Attack history is kept for %d days", settings.AttackHistoryDays),
+	}
+
+	// Maintenance
+	inMaintenance := settings.MaintenanceUntil != nil && settings.MaintenanceUntil.After(now)
+	maintenance := fiber.Map{"active": false}
+	if inMaintenance {
+		maintenance = fiber.Map{
+			"active":      true,
+			"until":       settings.MaintenanceUntil,
+			"description": fmt.Sprintf("All blocking is disabled for another %s", settings.MaintenanceUntil.Sub(now).Round(time.Minute)),
+		}
+	}
+
+	var warnings []string
+	if !settings.GlobalProtection {
+		warnings = append(warnings, "Global protection is disabled")
+	}
+	if inMaintenance {
+		warnings = append(warnings, "Maintenance mode is active: blocking is bypassed")
+	}
+	if len(missingCountries) > 0 {
+		warnings = append(warnings, "Allowed countries with no loaded ranges: "+strings.Join(missingCountries, ", "))
+	}
+	if len(unprotected) > 0 {
+		warnings = append(warnings, "Interfaces not filtered by XDP: "+strings.Join(unprotected, ", "))
+	}
+
+	return c.JSON(fiber.Map{
+		"protection":    protection,
+		"geo":           geo,
+		"xdp":           xdp,
+		"flood":         flood,
+		"notifications": notifications,
+		"retention":     retention,
+		"maintenance":   maintenance,
+		"warnings":      warnings,
+		"generated_at":  now,
+		"firewall":      h.firewallApplySummary(),
+	})
+}
+
+// firewallApplySummary reports whether the last rule apply succeeded
+func (h *Handler) firewallApplySummary() *services.FirewallApplyStatus {
+	if h.Firewall == nil {
+		return nil
+	}
+	status := h.Firewall.GetApplyStatus()
+	return &status
+}
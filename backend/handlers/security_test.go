@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// The policy page loads the settings, turns geo_allow_countries into a list and PUTs the whole
+// object back; every other field, including geo_block_countries, goes back as it came.
+func TestSecuritySettingsRoundTrip(t *testing.T) {
+	h := newTestHandler(t)
+	app := newTestApp()
+	app.Get("/security/settings", h.GetSecuritySettings)
+	app.Put("/security/settings", h.UpdateSecuritySettings)
+
+	var settings map[string]interface{}
+	if code := doJSON(t, app, http.MethodGet, "/security/settings", nil, &settings); code != http.StatusOK {
+		t.Fatalf("GET status %d", code)
+	}
+	if _, ok := settings["geo_block_countries"].(string); !ok {
+		t.Fatalf("geo_block_countries = %#v, want a string", settings["geo_block_countries"])
+	}
+
+	settings["geo_allow_countries"] = strings.Split(settings["geo_allow_countries"].(string), ",")
+	settings["geo_block_countries"] = "cn, ru"
+	var resp map[string]interface{}
+	if code := doJSON(t, app, http.MethodPut, "/security/settings", settings, &resp); code != http.StatusOK {
+		t.Fatalf("PUT status %d: %v", code, resp)
+	}
+
+	var saved map[string]interface{}
+	doJSON(t, app, http.MethodGet, "/security/settings", nil, &saved)
+	if got := saved["geo_block_countries"]; got != "CN,RU" {
+		t.Errorf("geo_block_countries = %v, want CN,RU", got)
+	}
+}
+
+func TestSecuritySettingsRejectsInvalidBlockCountry(t *testing.T) {
+	h := newTestHandler(t)
+	app := newTestApp()
+	app.Put("/security/settings", h.UpdateSecuritySettings)
+
+	body := map[string]interface{}{"geo_block_countries": "CN,RUS"}
+	if code := doJSON(t, app, http.MethodPut, "/security/settings", body, nil); code != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", code)
+	}
+}
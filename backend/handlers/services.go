@@ -27,6 +27,7 @@ func (h *Handler) CreateService(c *fiber.Ctx) error {
 		PublicPortEnd  int    `json:"public_port_end"` // Optional, for range
 		PrivatePort    int    `json:"private_port"`
 		PrivatePortEnd int    `json:"private_port_end"` // Optional
+		IsQueryPort    bool   `json:"is_query_port"`
 	}
 
 	var input struct {
@@ -38,6 +39,13 @@ func (h *Handler) CreateService(c *fiber.Ctx) error {
 	if err := c.BodyParser(&input); err != nil {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
 	}
+	fields := []textField{{"name", &input.Name, maxNameLength}}
+	for i := range input.Ports {
+		fields = append(fields, textField{"port name", &input.Ports[i].Name, maxNameLength})
+	}
+	if err := cleanTextFields(fields...); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
 
 	// Validate origin exists
 	var origin models.Origin
@@ -66,6 +74,7 @@ func (h *Handler) CreateService(c *fiber.Ctx) error {
 			PublicPortEnd:  p.PublicPortEnd,
 			PrivatePort:    p.PrivatePort,
 			PrivatePortEnd: p.PrivatePortEnd,
+			IsQueryPort:    p.IsQueryPort,
 		}
 		if err := h.DB.Create(&port).Error; err != nil {
 			system.Warn("Failed to create port %d for service %s: %v", p.PublicPort, service.Name, err)
@@ -101,6 +110,7 @@ func (h *Handler) UpdateService(c *fiber.Ctx) error {
 		PublicPortEnd  int    `json:"public_port_end"`
 		PrivatePort    int    `json:"private_port"`
 		PrivatePortEnd int    `json:"private_port_end"`
+		IsQueryPort    bool   `json:"is_query_port"`
 	}
 
 	var input struct {
@@ -112,6 +122,13 @@ func (h *Handler) UpdateService(c *fiber.Ctx) error {
 	if err := c.BodyParser(&input); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
 	}
+	fields := []textField{{"name", &input.Name, maxNameLength}}
+	for i := range input.Ports {
+		fields = append(fields, textField{"port name", &input.Ports[i].Name, maxNameLength})
+	}
+	if err := cleanTextFields(fields...); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
 
 	// Update fields
 	service.Name = input.Name
@@ -141,6 +158,7 @@ func (h *Handler) UpdateService(c *fiber.Ctx) error {
 			PublicPortEnd:  p.PublicPortEnd,
 			PrivatePort:    p.PrivatePort,
 			PrivatePortEnd: p.PrivatePortEnd,
+			IsQueryPort:    p.IsQueryPort,
 		}
 		if err := tx.Create(&port).Error; err != nil {
 			tx.Rollback()
@@ -181,6 +199,38 @@ func (h *Handler) DeleteService(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"message": "Service deleted"})
 }
 
+// TestService - Verify DNAT rules and origin reachability for every port of a service
+func (h *Handler) TestService(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var service models.Service
+
+	if err := h.DB.Preload("Origin").Preload("Ports").First(&service, id).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Service not found"})
+	}
+
+	if h.Firewall == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "Firewall service not available"})
+	}
+
+	results := h.Firewall.TestServiceForwarding(&service)
+
+	ok := len(results) > 0
+	for _, r := range results {
+		if !r.DNATPresent || !r.Reachable {
+			ok = false
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"service_id": service.ID,
+		"service":    service.Name,
+		"origin":     service.Origin.Name,
+		"wg_ip":      service.Origin.WgIP,
+		"ok":         ok,
+		"ports":      results,
+	})
+}
+
 // DeleteOrigin - Delete an origin and its services
 func (h *Handler) DeleteOrigin(c *fiber.Ctx) error {
 	id := c.Params("id")
@@ -2,6 +2,10 @@ package handlers
 
 import (
 	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/services"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -21,11 +25,17 @@ func (h *Handler) CreateSignature(c *fiber.Ctx) error {
 	if err := c.BodyParser(&sig); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "잘못된 요청 형식"})
 	}
+	if err := cleanSignatureText(&sig); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
 
 	// Validate required fields
 	if sig.Name == "" || sig.Protocol == "" || sig.Category == "" {
 		return c.Status(400).JSON(fiber.Map{"error": "이름, 프로토콜, 카테고리는 필수입니다"})
 	}
+	if err := services.ValidateSignatureRule(sig); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
 
 	// Check if name already exists
 	var existing models.AttackSignature
@@ -38,6 +48,11 @@ func (h *Handler) CreateSignature(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": "시그니처 생성 실패"})
 	}
 
+	// Enforcement lives in the firewall rules
+	if h.Firewall != nil && sig.Enabled {
+		go h.Firewall.ApplyRules()
+	}
+
 	return c.Status(201).JSON(sig)
 }
 
@@ -54,6 +69,9 @@ func (h *Handler) UpdateSignature(c *fiber.Ctx) error {
 	if err := c.BodyParser(&update); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "잘못된 요청 형식"})
 	}
+	if err := cleanSignatureText(&update); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
 
 	// Builtin signatures can only toggle enabled status
 	if existing.IsBuiltin {
@@ -68,15 +86,32 @@ func (h *Handler) UpdateSignature(c *fiber.Ctx) error {
 		existing.Action = update.Action
 		existing.PPSLimit = update.PPSLimit
 		existing.Enabled = update.Enabled
+		if err := services.ValidateSignatureRule(existing); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
 	}
 
 	if err := h.DB.Save(&existing).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "시그니처 업데이트 실패"})
 	}
 
+	if h.Firewall != nil {
+		go h.Firewall.ApplyRules()
+	}
+
 	return c.JSON(existing)
 }
 
+// cleanSignatureText sanitizes the free-text fields of a signature
+func cleanSignatureText(sig *models.AttackSignature) error {
+	return cleanTextFields(
+		textField{"name", &sig.Name, maxNameLength},
+		textField{"category", &sig.Category, maxNameLength},
+		textField{"protocol", &sig.Protocol, maxNameLength},
+		textField{"action", &sig.Action, maxNameLength},
+	)
+}
+
 // DeleteSignature - Delete an attack signature
 func (h *Handler) DeleteSignature(c *fiber.Ctx) error {
 	id := c.Params("id")
@@ -94,6 +129,9 @@ func (h *Handler) DeleteSignature(c *fiber.Ctx) error {
 	if err := h.DB.Delete(&sig).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "시그니처 삭제 실패"})
 	}
+	if h.Firewall != nil && sig.Enabled {
+		go h.Firewall.ApplyRules()
+	}
 
 	return c.JSON(fiber.Map{"message": "시그니처가 삭제되었습니다"})
 }
@@ -108,3 +146,51 @@ func (h *Handler) ResetSignatureStats(c *fiber.Ctx) error {
 	}
 	return c.JSON(fiber.Map{"message": "시그니처 통계가 초기화되었습니다"})
 }
+
+// signatureTestTimeout bounds a single capture scan so large files can't tie up a request
+const signatureTestTimeout = 15 * time.Second
+
+const (
+	defaultSignatureTestPackets = 200000
+	maxSignatureTestPackets     = 2000000
+)
+
+// TestSignatureAgainstCapture - Run a signature over a stored PCAP file and report matches
+// POST /api/signatures/:id/test-against-capture {"file": "capture_x.pcap", "max_packets": 200000}
+func (h *Handler) TestSignatureAgainstCapture(c *fiber.Ctx) error {
+	var sig models.AttackSignature
+	if err := h.DB.First(&sig, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "시그니처를 찾을 수 없습니다"})
+	}
+
+	var req struct {
+		File       string `json:"file"`
+		MaxPackets int    `json:"max_packets"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.File == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "캡처 파일을 지정해야 합니다"})
+	}
+	if req.MaxPackets <= 0 {
+		req.MaxPackets = defaultSignatureTestPackets
+	}
+	if req.MaxPackets > maxSignatureTestPackets {
+		req.MaxPackets = maxSignatureTestPackets
+	}
+
+	// Only files inside the capture directory (prevent directory traversal)
+	captureDir := services.NewPCAPService().GetCaptureDir()
+	fullPath := filepath.Join(captureDir, req.File)
+	if filepath.Dir(fullPath) != filepath.Clean(captureDir) {
+		return c.Status(403).JSON(fiber.Map{"error": "잘못된 파일 경로"})
+	}
+	if _, err := os.Stat(fullPath); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "캡처 파일을 찾을 수 없습니다"})
+	}
+
+	result, err := services.TestSignatureAgainstCapture(sig, fullPath, req.MaxPackets, signatureTestTimeout)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	result.File = req.File
+	return c.JSON(result)
+}
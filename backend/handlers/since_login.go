@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"errors"
+	"kg-proxy-web-gui/backend/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// sinceLoginTopAttackers is how many attackers the since-last-login summary lists
+const sinceLoginTopAttackers = 5
+
+// attackerRollupColumns aggregates attack events per source into attacksSinceAttacker
+const attackerRollupColumns = "source_ip, MAX(country_code) as country_code, COUNT(*) as events, " +
+	"COALESCE(SUM(count), 0) as packets, COALESCE(MAX(pps), 0) as peak_pps"
+
+// recordLogin moves the account's last login to PreviousSeenAt and stamps the new one.
+// Returns the previous login (nil on the first login).
+func (h *Handler) recordLogin(admin *models.Admin) *time.Time {
+	if admin.ID == 0 {
+		return nil
+	}
+	previous := admin.LastSeenAt
+	now := time.Now()
+	if err := h.DB.Model(admin).UpdateColumns(map[string]interface{}{
+		"previous_seen_at": previous,
+		"last_seen_at":     now,
+	}).Error; err != nil {
+		return previous
+	}
+	admin.PreviousSeenAt, admin.LastSeenAt = previous, &now
+	return previous
+}
+
+// sinceLastLogin resolves ?since_last_login=true to the caller's previous login.
+// The zero time (everything) is returned for an account's first session.
+func (h *Handler) sinceLastLogin(c *fiber.Ctx) (time.Time, bool, error) {
+	if !c.QueryBool("since_last_login") {
+		return time.Time{}, false, nil
+	}
+	username := requestUsername(c)
+	var admin models.Admin
+	if username == "" || h.DB.Where("username = ?", username).First(&admin).Error != nil {
+		return time.Time{}, false, errors.New("since_last_login needs a user session (not an API key)")
+	}
+	if admin.PreviousSeenAt == nil {
+		return time.Time{}, true, nil
+	}
+	return *admin.PreviousSeenAt, true, nil
+}
+
+// sinceParam reads ?since= (RFC3339 or unix seconds) or ?since_last_login=true
+func (h *Handler) sinceParam(c *fiber.Ctx) (time.Time, bool, error) {
+	if value := c.Query("since"); value != "" {
+		since, err := parseTimeParam(value)
+		if err != nil {
+			return time.Time{}, false, errors.New("Invalid 'since' time: " + err.Error())
+		}
+		return since, true, nil
+	}
+	return h.sinceLastLogin(c)
+}
+
+// attacksSinceAttacker is one source in the since-last-login rollup
+type attacksSinceAttacker struct {
+	SourceIP    string `json:"source_ip"`
+	CountryCode string `json:"country_code"`
+	Events      int64  `json:"events"`
+	Packets     int64  `json:"packets"`
+	PeakPPS     int64  `json:"peak_pps"`
+}
+
+// attacksSinceSummary rolls up the attack events recorded after since: totals per type and
+// country, the top sources by packets and the biggest source with no events before since
+func (h *Handler) attacksSinceSummary(since time.Time) fiber.Map {
+	after := func() *gorm.DB {
+		return h.DB.Model(&models.AttackEvent{}).Where("timestamp > ?", since)
+	}
+
+	var total, uniqueSources int64
+	after().Count(&total)
+	after().Distinct("source_ip").Count(&uniqueSources)
+
+	var typeRows []struct {
+		AttackType string
+		Count      int64
+	}
+	after().Select("attack_type, COUNT(*) as count").Group("attack_type").Scan(&typeRows)
+	byType := make(map[string]int64, len(typeRows))
+	for _, r := range typeRows {
+		byType[r.AttackType] = r.Count
+	}
+
+	var countryRows []struct {
+		CountryCode string
+		Count       int64
+	}
+	after().Select("country_code, COUNT(*) as count").Where("country_code <> ''").Group("country_code").Scan(&countryRows)
+	byCountry := make(map[string]int64, len(countryRows))
+	for _, r := range countryRows {
+		byCountry[r.CountryCode] = r.Count
+	}
+
+	top := []attacksSinceAttacker{}
+	after().Select(attackerRollupColumns).
+		Group("source_ip").Order("packets DESC").Limit(sinceLoginTopAttackers).Scan(&top)
+
+	// Sources with no events before the cutoff: new since the last visit
+	var topNew []attacksSinceAttacker
+	earlier := h.DB.Model(&models.AttackEvent{}).Select("source_ip").Where("timestamp <= ?", since)
+	after().Select(attackerRollupColumns).
+		Where("source_ip NOT IN (?)", earlier).
+		Group("source_ip").Order("packets DESC").Limit(1).Scan(&topNew)
+
+	summary := fiber.Map{
+		"new_events":       total,
+		"unique_sources":   uniqueSources,
+		"by_type":          byType,
+		"by_country":       byCountry,
+		"top_attackers":    top,
+		"top_new_attacker": nil,
+	}
+	if len(topNew) > 0 {
+		summary["top_new_attacker"] = topNew[0]
+	}
+	return summary
+}
@@ -29,12 +29,24 @@ type SystemStatus struct {
 	Events         []SystemEvent     `json:"events"`
 	RequiredPorts  []PortRequirement `json:"required_ports"`
 	ActiveDefenses []string          `json:"active_defenses"`
+	Interfaces     []string          `json:"interfaces"` // Protected WAN interfaces (XDP-attached when eBPF runs)
+
+	SteamBypass services.SteamBypassStats `json:"steam_bypass"` // Packets that skipped GeoIP via A2S signature match
+
+	FirewallDegraded bool                         `json:"firewall_degraded"` // Rules are not being enforced (missing tools or last apply failed)
+	FirewallApply    services.FirewallApplyStatus `json:"firewall_apply"`
+
+	// Whether traffic is filtered at all; anything but "protected" should show a warning banner
+	Protection services.ProtectionState `json:"protection"`
+
+	EventsDropped uint64 `json:"events_dropped"` // Attack events lost to the eBPF aggregator limits
 }
 
 type SystemEvent struct {
-	Time    string `json:"time"`
-	Type    string `json:"type"` // info, warning, error, success
-	Message string `json:"message"`
+	Time    string    `json:"time"`
+	At      time.Time `json:"at"`   // Full timestamp, for ?since filtering
+	Type    string    `json:"type"` // info, warning, error, success
+	Message string    `json:"message"`
 }
 
 type PortRequirement struct {
@@ -63,8 +75,10 @@ func AddEvent(eventType, message string) {
 	eventMutex.Lock()
 	defer eventMutex.Unlock()
 
+	now := time.Now()
 	event := SystemEvent{
-		Time:    time.Now().Format("15:04:05"),
+		Time:    now.Format("15:04:05"),
+		At:      now,
 		Type:    eventType,
 		Message: message,
 	}
@@ -129,7 +143,7 @@ func (h *Handler) GetSystemStatus(c *fiber.Ctx) error {
 		{Port: 22, Protocol: "TCP", Service: "SSH", Description: "Remote Management"},
 		{Port: 80, Protocol: "TCP", Service: "HTTP", Description: "Web Redirect"},
 		{Port: 443, Protocol: "TCP", Service: "HTTPS", Description: "Web GUI (Secure)"},
-		{Port: 8080, Protocol: "TCP", Service: "HTTP", Description: "Web GUI (Alternative)"},
+		{Port: system.GetListenPort(), Protocol: "TCP", Service: "HTTP", Description: "Web GUI (" + system.GetListenAddr() + ")"},
 		{Port: 51820, Protocol: "UDP", Service: "WireGuard", Description: "VPN Tunnel"},
 	}
 
@@ -154,6 +168,17 @@ func (h *Handler) GetSystemStatus(c *fiber.Ctx) error {
 	// Get network IO
 	networkRX, networkTX := sysInfo.GetNetworkIO()
 
+	// Protected interfaces: report actual XDP attachments when available
+	interfaces := system.GetProtectedInterfaces()
+	if h.EBPF != nil && h.EBPF.IsEnabled() {
+		if attached := h.EBPF.GetAttachedInterfaces(); len(attached) > 0 {
+			interfaces = attached
+		}
+	}
+
+	var settings models.SecuritySettings
+	settingsErr := h.DB.First(&settings, 1).Error
+
 	// Build status with real data
 	status := SystemStatus{
 		OS:            runtime.GOOS,
@@ -170,10 +195,10 @@ func (h *Handler) GetSystemStatus(c *fiber.Ctx) error {
 		FirewallRules: rules,
 		Events:        GetEventLog(),
 		RequiredPorts: requiredPorts,
+		Interfaces:    interfaces,
 		ActiveDefenses: func() []string {
 			var defs []string
-			var settings models.SecuritySettings
-			if err := h.DB.First(&settings, 1).Error; err == nil {
+			if settingsErr == nil {
 				if settings.GlobalProtection {
 					defs = append(defs, "Invalid Packet Drop")
 					defs = append(defs, "TCP Flag Validation")
@@ -198,6 +223,15 @@ func (h *Handler) GetSystemStatus(c *fiber.Ctx) error {
 				} else {
 					defs = append(defs, "Standard Flood Detection")
 				}
+				if settings.SteamQueryBypass {
+					if settings.SteamQueryScope == "services" {
+						defs = append(defs, "Steam Query Bypass (service query ports)")
+					} else if settings.SteamQueryPorts != "" {
+						defs = append(defs, "Steam Query Bypass (ports "+settings.SteamQueryPorts+")")
+					} else {
+						defs = append(defs, "Steam Query Bypass (all UDP ports)")
+					}
+				}
 			} else {
 				// Default assumption if DB read fails (defaults)
 				defs = []string{"Invalid Packet Drop", "Bogon Filtering", "Standard Flood Detection"}
@@ -206,12 +240,48 @@ func (h *Handler) GetSystemStatus(c *fiber.Ctx) error {
 		}(),
 	}
 
+	if settingsErr == nil {
+		status.SteamBypass = h.Firewall.GetSteamBypassStats(&settings)
+	}
+	status.FirewallApply = h.Firewall.GetApplyStatus()
+	status.FirewallDegraded = system.GetCapabilities().Degraded || status.FirewallApply.Error != ""
+	status.Protection = h.Firewall.ProtectionState()
+	if h.EBPF != nil {
+		status.EventsDropped = h.EBPF.GetAggregatorStats().DroppedTotal
+	}
+
 	return c.JSON(status)
 }
 
-// GetEvents returns recent events
+// GetEvents returns recent events. With ?since= (RFC3339 or unix seconds) or ?since_last_login=true
+// only newer events are returned, together with a count per type.
+// GET /api/events
 func (h *Handler) GetEvents(c *fiber.Ctx) error {
-	return c.JSON(GetEventLog())
+	since, filtered, err := h.sinceParam(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	events := GetEventLog()
+	if !filtered {
+		return c.JSON(events)
+	}
+
+	newer := []SystemEvent{}
+	byType := make(map[string]int)
+	for _, e := range events {
+		if e.At.After(since) {
+			newer = append(newer, e)
+			byType[e.Type]++
+		}
+	}
+	return c.JSON(fiber.Map{
+		"since":  since,
+		"events": newer,
+		"summary": fiber.Map{
+			"total":   len(newer),
+			"by_type": byType,
+		},
+	})
 }
 
 // GetFirewallStatus returns current iptables rules
@@ -242,6 +312,23 @@ func (h *Handler) GetServerInfo(c *fiber.Ctx) error {
 		"public_ip":            publicIP,
 		"wireguard_port":       51820,
 		"wireguard_public_key": serverPubKey,
-		"wg_subnet":            "10.200.0.0/24",
+		"wg_subnet":            services.WGSubnet(),
+	})
+}
+
+// GetSchemaVersion returns the database schema version and recent migrations
+// GET /api/system/schema
+func (h *Handler) GetSchemaVersion(c *fiber.Ctx) error {
+	return c.JSON(services.GetSchemaStatus())
+}
+
+// GetSystemCapabilities reports which external tools were found and whether the firewall can be enforced
+// GET /api/system/capabilities
+func (h *Handler) GetSystemCapabilities(c *fiber.Ctx) error {
+	// Re-check so the result reflects packages installed since startup
+	caps := system.DetectCapabilities()
+	return c.JSON(fiber.Map{
+		"capabilities":   caps,
+		"firewall_apply": h.Firewall.GetApplyStatus(),
 	})
 }
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/services"
+	"kg-proxy-web-gui/backend/system"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultThreatWindowMinutes = 15
+	maxThreatWindowMinutes     = 24 * 60
+	defaultThreatMinPPS        = 1000
+	maxThreatEntries           = 1000
+)
+
+// GetCurrentThreats merges blocked IPs, active flood trackers, flagged IP intelligence and
+// recent high-PPS attack events into one list, deduplicated by IP and ranked by severity
+// GET /api/threats/current?minutes=15&min_pps=1000&limit=200
+func (h *Handler) GetCurrentThreats(c *fiber.Ctx) error {
+	minutes := c.QueryInt("minutes", defaultThreatWindowMinutes)
+	if minutes <= 0 || minutes > maxThreatWindowMinutes {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("minutes must be between 1 and %d", maxThreatWindowMinutes),
+		})
+	}
+	minPPS := c.QueryInt("min_pps", defaultThreatMinPPS)
+	if minPPS < 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "min_pps must not be negative"})
+	}
+	limit := c.QueryInt("limit", 200)
+	if limit <= 0 || limit > maxThreatEntries {
+		limit = maxThreatEntries
+	}
+
+	now := time.Now()
+	agg := services.NewThreatAggregator()
+	var unavailable []string
+
+	// Currently blocked in the eBPF map
+	if h.EBPF != nil && h.EBPF.IsEnabled() {
+		blocked, err := h.EBPF.IterateBlockedIPs()
+		if err != nil {
+			system.Warn("Threats: failed to read blocked IPs: %v", err)
+			unavailable = append(unavailable, services.ThreatSourceBlocked)
+		}
+		for _, b := range blocked {
+			entry := agg.Add(b.IP, services.ThreatSourceBlocked, "Blocked ("+b.Reason+")", b.CountryCode, b.CountryName, 0, time.Time{})
+			entry.Blocked = true
+			if b.ExpiresAt.After(entry.ExpiresAt) {
+				entry.ExpiresAt = b.ExpiresAt
+			}
+		}
+	} else {
+		unavailable = append(unavailable, services.ThreatSourceBlocked)
+	}
+
+	// Flood trackers with open violations or active blocks
+	if h.Firewall != nil && h.Firewall.FloodProtect != nil {
+		for _, t := range h.Firewall.FloodProtect.GetActiveTrackers() {
+			reason := fmt.Sprintf("Flood: %d violations at %d pps", t.Violations, t.PacketsPerSec)
+			if t.Blocked {
+				reason = fmt.Sprintf("Flood blocked after %d violations", t.Violations)
+			}
+			entry := agg.Add(t.IP, services.ThreatSourceFlood, reason, "", "", int64(t.PacketsPerSec), t.LastSeen)
+			if t.Blocked {
+				entry.Blocked = true
+				if t.BlockedUntil.After(entry.ExpiresAt) {
+					entry.ExpiresAt = t.BlockedUntil
+				}
+			}
+		}
+	} else {
+		unavailable = append(unavailable, services.ThreatSourceFlood)
+	}
+
+	// Recent high-PPS attack events
+	var events []models.AttackEvent
+	if err := h.DB.Where("timestamp >= ? AND pps >= ?", now.Add(-time.Duration(minutes)*time.Minute), minPPS).
+		Order("pps DESC").Limit(maxThreatEntries).Find(&events).Error; err != nil {
+		system.Warn("Threats: failed to load attack events: %v", err)
+		unavailable = append(unavailable, services.ThreatSourceAttack)
+	}
+	for _, e := range events {
+		reason := fmt.Sprintf("Attack: %s at %d pps", e.AttackType, e.PPS)
+		agg.Add(e.SourceIP, services.ThreatSourceAttack, reason, e.CountryCode, e.CountryName, e.PPS, e.Timestamp)
+	}
+
+	// IP intelligence flags
+	var geoip *services.GeoIPService
+	if h.Firewall != nil {
+		geoip = h.Firewall.GeoIP
+	}
+	if geoip != nil {
+		for _, r := range geoip.FlaggedIPIntelligence() {
+			agg.Add(r.IP, services.ThreatSourceIntel, intelThreatReason(r), r.Country, "", 0, time.Time{})
+		}
+	} else {
+		unavailable = append(unavailable, services.ThreatSourceIntel)
+	}
+
+	threats := agg.List()
+	total := len(threats)
+	if len(threats) > limit {
+		threats = threats[:limit]
+	}
+	// Fill in countries only for the entries actually returned
+	if geoip != nil {
+		for i := range threats {
+			if threats[i].CountryName != "" {
+				continue
+			}
+			name, code := geoip.GetCountry(threats[i].IP)
+			if threats[i].CountryCode == "" {
+				threats[i].CountryCode = code
+			}
+			if strings.EqualFold(code, threats[i].CountryCode) {
+				threats[i].CountryName = name
+			}
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"data":                threats,
+		"count":               len(threats),
+		"total":               total,
+		"window_minutes":      minutes,
+		"min_pps":             minPPS,
+		"unavailable_sources": unavailable,
+		"generated_at":        now,
+	})
+}
+
+// intelThreatReason describes why IP intelligence flagged an address
+func intelThreatReason(r services.IPIntelligenceResult) string {
+	var flags []string
+	if r.Threat {
+		flags = append(flags, "known threat")
+	}
+	if r.IsTor {
+		flags = append(flags, "Tor")
+	}
+	if r.IsVPN {
+		flags = append(flags, "VPN")
+	}
+	if r.IsProxy {
+		flags = append(flags, "proxy")
+	}
+	if r.Score != nil {
+		flags = append(flags, fmt.Sprintf("risk score %d", *r.Score))
+	}
+	reason := "IP intelligence: " + strings.Join(flags, ", ")
+	if r.Provider != "" {
+		reason += " (" + r.Provider + ")"
+	}
+	return reason
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// totpIssuer is shown as the account label in authenticator apps
+const totpIssuer = "KG-Proxy"
+
+// totpValidateOpts: 30s steps, 6 digits, one step of clock drift either way
+var totpValidateOpts = totp.ValidateOpts{
+	Period:    30,
+	Skew:      1,
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
+// SetTOTPKey sets the key TOTP secrets are encrypted with at rest
+func (h *Handler) SetTOTPKey(key []byte) {
+	h.totpKey = key
+}
+
+// checkTOTP verifies a code against an admin's encrypted TOTP secret
+func (h *Handler) checkTOTP(admin *models.Admin, code string) bool {
+	if admin.TOTPSecret == "" || len(code) != 6 {
+		return false
+	}
+	secret, err := system.DecryptSecret(h.totpKey, admin.TOTPSecret)
+	if err != nil {
+		system.Error("Failed to decrypt TOTP secret of %s: %v", admin.Username, err)
+		return false
+	}
+	ok, err := totp.ValidateCustom(code, secret, time.Now(), totpValidateOpts)
+	return err == nil && ok
+}
+
+// currentAdmin loads the account of the authenticated caller
+func (h *Handler) currentAdmin(c *fiber.Ctx) (*models.Admin, error) {
+	token := c.Locals("user").(*jwt.Token)
+	username, _ := token.Claims.(jwt.MapClaims)["user"].(string)
+	var admin models.Admin
+	if err := h.DB.Where("username = ?", username).First(&admin).Error; err != nil {
+		return nil, err
+	}
+	return &admin, nil
+}
+
+// EnrollTOTP generates a new TOTP secret for the caller and returns its otpauth:// URI.
+// The secret only becomes required at login once confirmed with VerifyTOTP.
+// POST /api/auth/totp/enroll
+func (h *Handler) EnrollTOTP(c *fiber.Ctx) error {
+	admin, err := h.currentAdmin(c)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if admin.TOTPEnabled {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Two-factor authentication is already enabled; disable it first"})
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: totpIssuer, AccountName: admin.Username})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate secret"})
+	}
+	encrypted, err := system.EncryptSecret(h.totpKey, key.Secret())
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to store secret"})
+	}
+	if err := h.DB.Model(admin).Update("totp_secret", encrypted).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"otpauth_uri": key.URL(),
+		"secret":      key.Secret(), // For manual entry
+	})
+}
+
+// VerifyTOTP confirms enrollment with a code from the authenticator app and turns 2FA on
+// POST /api/auth/totp/verify
+func (h *Handler) VerifyTOTP(c *fiber.Ctx) error {
+	var input struct {
+		Code string `json:"code"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	admin, err := h.currentAdmin(c)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if admin.TOTPSecret == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Enroll first"})
+	}
+	if !h.checkTOTP(admin, input.Code) {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid code"})
+	}
+
+	h.DB.Model(admin).Update("totp_enabled", true)
+	system.Info("Two-factor authentication enabled for %s", admin.Username)
+	AddEvent("success", "Two-factor authentication enabled for "+admin.Username)
+	return c.JSON(fiber.Map{"message": "Two-factor authentication enabled"})
+}
+
+// DisableTOTP turns 2FA off after re-checking the caller's password
+// POST /api/auth/totp/disable
+func (h *Handler) DisableTOTP(c *fiber.Ctx) error {
+	var input struct {
+		Password string `json:"password"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	admin, err := h.currentAdmin(c)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(admin.Password), []byte(input.Password)); err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Incorrect password"})
+	}
+
+	h.DB.Model(admin).Updates(map[string]interface{}{"totp_secret": "", "totp_enabled": false})
+	system.Warn("Two-factor authentication disabled for %s", admin.Username)
+	AddEvent("warning", "Two-factor authentication disabled for "+admin.Username)
+	return c.JSON(fiber.Map{"message": "Two-factor authentication disabled"})
+}
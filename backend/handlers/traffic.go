@@ -1,9 +1,14 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"kg-proxy-web-gui/backend/models"
 	"kg-proxy-web-gui/backend/services"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -16,6 +21,54 @@ func (h *Handler) GetTrafficData(c *fiber.Ctx) error {
 		})
 	}
 
+	return c.JSON(h.trafficSnapshot())
+}
+
+// trafficStreamInterval is how often StreamTraffic pushes a snapshot
+const trafficStreamInterval = 2 * time.Second
+
+// StreamTraffic pushes the GetTrafficData payload over a WebSocket every trafficStreamInterval
+// (?interval=1 for every second) until the client disconnects. The token may be passed as
+// ?access_token= since browsers cannot set headers on WebSocket.
+// GET /api/traffic/ws
+func (h *Handler) StreamTraffic(c *fiber.Ctx) error {
+	if h.EBPF == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "eBPF service not initialized",
+		})
+	}
+	interval := trafficStreamInterval
+	switch c.Query("interval") {
+	case "":
+	case "1":
+		interval = time.Second
+	case "2":
+	default:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "interval must be 1 or 2"})
+	}
+
+	return upgradeWebSocket(c, func(ws *wsConn) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			data, err := json.Marshal(h.trafficSnapshot())
+			if err == nil {
+				if err := ws.WriteText(data); err != nil {
+					return
+				}
+			}
+			select {
+			case <-ws.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// trafficSnapshot builds the per-IP traffic list and stats sent by GetTrafficData and StreamTraffic
+func (h *Handler) trafficSnapshot() fiber.Map {
 	data := h.EBPF.GetTrafficData()
 
 	// Convert to frontend format
@@ -57,11 +110,11 @@ func (h *Handler) GetTrafficData(c *fiber.Ctx) error {
 		"blocked_packets":  stats.BlockedPackets, // For graph (cumulative)
 	}
 
-	return c.JSON(fiber.Map{
+	return fiber.Map{
 		"data":    trafficList,
 		"enabled": h.EBPF.IsEnabled(),
 		"stats":   statsMap,
-	})
+	}
 }
 
 // ResetTrafficStats manually resets traffic statistics
@@ -83,53 +136,58 @@ func (h *Handler) ResetTrafficStats(c *fiber.Ctx) error {
 	})
 }
 
+// getCountryName returns the map display name for a country code (operator overrides first)
 func getCountryName(code string) string {
-	// Country names MUST match world-atlas GeoJSON names exactly for map visualization
-	// Source: https://cdn.jsdelivr.net/npm/world-atlas@2/countries-110m.json
-	countryMap := map[string]string{
-		"AF": "Afghanistan", "AL": "Albania", "DZ": "Algeria", "AO": "Angola", "AR": "Argentina",
-		"AM": "Armenia", "AU": "Australia", "AT": "Austria", "AZ": "Azerbaijan", "BS": "Bahamas",
-		"BD": "Bangladesh", "BY": "Belarus", "BE": "Belgium", "BZ": "Belize", "BJ": "Benin",
-		"BT": "Bhutan", "BO": "Bolivia", "BA": "Bosnia and Herz.", "BW": "Botswana", "BR": "Brazil",
-		"BN": "Brunei Darussalam", "BG": "Bulgaria", "BF": "Burkina Faso", "BI": "Burundi", "KH": "Cambodia",
-		"CM": "Cameroon", "CA": "Canada", "CF": "Central African Rep.", "TD": "Chad", "CL": "Chile",
-		"CN": "China", "CO": "Colombia", "CG": "Congo", "CD": "Dem. Rep. Congo", "CR": "Costa Rica",
-		"CI": "Côte d'Ivoire", "HR": "Croatia", "CU": "Cuba", "CY": "Cyprus", "CZ": "Czechia",
-		"DK": "Denmark", "DJ": "Djibouti", "DO": "Dominican Rep.", "EC": "Ecuador", "EG": "Egypt",
-		"SV": "El Salvador", "GQ": "Eq. Guinea", "ER": "Eritrea", "EE": "Estonia", "ET": "Ethiopia",
-		"FK": "Falkland Is.", "FJ": "Fiji", "FI": "Finland", "FR": "France", "TF": "Fr. S. Antarctic Lands",
-		"GA": "Gabon", "GM": "Gambia", "GE": "Georgia", "DE": "Germany", "GH": "Ghana",
-		"GR": "Greece", "GL": "Greenland", "GT": "Guatemala", "GN": "Guinea", "GW": "Guinea-Bissau",
-		"GY": "Guyana", "HT": "Haiti", "HN": "Honduras", "HU": "Hungary", "IS": "Iceland",
-		"IN": "India", "ID": "Indonesia", "IR": "Iran, Islamic Republic of", "IQ": "Iraq", "IE": "Ireland",
-		"IL": "Israel", "IT": "Italy", "JM": "Jamaica", "JP": "Japan", "JO": "Jordan",
-		"KZ": "Kazakhstan", "KE": "Kenya", "KP": "North Korea", "KR": "South Korea", "XK": "Kosovo",
-		"KW": "Kuwait", "KG": "Kyrgyzstan", "LA": "Lao People's Democratic Republic", "LV": "Latvia", "LB": "Lebanon",
-		"LS": "Lesotho", "LR": "Liberia", "LY": "Libya", "LT": "Lithuania", "LU": "Luxembourg",
-		"MK": "Macedonia", "MG": "Madagascar", "MW": "Malawi", "MY": "Malaysia", "ML": "Mali",
-		"MR": "Mauritania", "MX": "Mexico", "MD": "Moldova, Republic of", "MN": "Mongolia", "ME": "Montenegro",
-		"MA": "Morocco", "MZ": "Mozambique", "MM": "Myanmar", "NA": "Namibia", "NP": "Nepal",
-		"NL": "Netherlands", "NC": "New Caledonia", "NZ": "New Zealand", "NI": "Nicaragua", "NE": "Niger",
-		"NG": "Nigeria", "NO": "Norway", "OM": "Oman", "PK": "Pakistan", "PS": "Palestine",
-		"PA": "Panama", "PG": "Papua New Guinea", "PY": "Paraguay", "PE": "Peru", "PH": "Philippines",
-		"PL": "Poland", "PT": "Portugal", "PR": "Puerto Rico", "QA": "Qatar", "RO": "Romania",
-		"RU": "Russia", "RW": "Rwanda", "SA": "Saudi Arabia", "SN": "Senegal", "RS": "Serbia",
-		"SL": "Sierra Leone", "SG": "Singapore", "SK": "Slovakia", "SI": "Slovenia", "SB": "Solomon Is.",
-		"SO": "Somalia", "ZA": "South Africa", "SS": "S. Sudan", "ES": "Spain", "LK": "Sri Lanka",
-		"SD": "Sudan", "SR": "Suriname", "SZ": "eSwatini", "SE": "Sweden", "CH": "Switzerland",
-		"SY": "Syrian Arab Republic", "TW": "Taiwan", "TJ": "Tajikistan", "TZ": "Tanzania", "TH": "Thailand",
-		"TL": "Timor-Leste", "TG": "Togo", "TT": "Trinidad and Tobago", "TN": "Tunisia", "TR": "Turkey",
-		"TM": "Turkmenistan", "UG": "Uganda", "UA": "Ukraine", "AE": "United Arab Emirates",
-		"GB": "United Kingdom", "US": "United States of America", "UY": "Uruguay", "UZ": "Uzbekistan",
-		"VU": "Vanuatu", "VE": "Venezuela", "VN": "Vietnam", "EH": "W. Sahara", "YE": "Yemen",
-		"ZM": "Zambia", "ZW": "Zimbabwe",
-	}
-	if name, ok := countryMap[code]; ok {
+	if name, ok := lookupCountryNameOverride(code); ok {
+		return name
+	}
+	if name, ok := builtinCountryNames[code]; ok {
 		return name
 	}
 	return code
 }
 
+// Country names MUST match world-atlas GeoJSON names exactly for map visualization
+// Source: https://cdn.jsdelivr.net/npm/world-atlas@2/countries-110m.json
+var builtinCountryNames = map[string]string{
+	"AF": "Afghanistan", "AL": "Albania", "DZ": "Algeria", "AO": "Angola", "AR": "Argentina",
+	"AM": "Armenia", "AU": "Australia", "AT": "Austria", "AZ": "Azerbaijan", "BS": "Bahamas",
+	"BD": "Bangladesh", "BY": "Belarus", "BE": "Belgium", "BZ": "Belize", "BJ": "Benin",
+	"BT": "Bhutan", "BO": "Bolivia", "BA": "Bosnia and Herz.", "BW": "Botswana", "BR": "Brazil",
+	"BN": "Brunei Darussalam", "BG": "Bulgaria", "BF": "Burkina Faso", "BI": "Burundi", "KH": "Cambodia",
+	"CM": "Cameroon", "CA": "Canada", "CF": "Central African Rep.", "TD": "Chad", "CL": "Chile",
+	"CN": "China", "CO": "Colombia", "CG": "Congo", "CD": "Dem. Rep. Congo", "CR": "Costa Rica",
+	"CI": "Côte d'Ivoire", "HR": "Croatia", "CU": "Cuba", "CY": "Cyprus", "CZ": "Czechia",
+	"DK": "Denmark", "DJ": "Djibouti", "DO": "Dominican Rep.", "EC": "Ecuador", "EG": "Egypt",
+	"SV": "El Salvador", "GQ": "Eq. Guinea", "ER": "Eritrea", "EE": "Estonia", "ET": "Ethiopia",
+	"FK": "Falkland Is.", "FJ": "Fiji", "FI": "Finland", "FR": "France", "TF": "Fr. S. Antarctic Lands",
+	"GA": "Gabon", "GM": "Gambia", "GE": "Georgia", "DE": "Germany", "GH": "Ghana",
+	"GR": "Greece", "GL": "Greenland", "GT": "Guatemala", "GN": "Guinea", "GW": "Guinea-Bissau",
+	"GY": "Guyana", "HT": "Haiti", "HN": "Honduras", "HU": "Hungary", "IS": "Iceland",
+	"IN": "India", "ID": "Indonesia", "IR": "Iran, Islamic Republic of", "IQ": "Iraq", "IE": "Ireland",
+	"IL": "Israel", "IT": "Italy", "JM": "Jamaica", "JP": "Japan", "JO": "Jordan",
+	"KZ": "Kazakhstan", "KE": "Kenya", "KP": "North Korea", "KR": "South Korea", "XK": "Kosovo",
+	"KW": "Kuwait", "KG": "Kyrgyzstan", "LA": "Lao People's Democratic Republic", "LV": "Latvia", "LB": "Lebanon",
+	"LS": "Lesotho", "LR": "Liberia", "LY": "Libya", "LT": "Lithuania", "LU": "Luxembourg",
+	"MK": "Macedonia", "MG": "Madagascar", "MW": "Malawi", "MY": "Malaysia", "ML": "Mali",
+	"MR": "Mauritania", "MX": "Mexico", "MD": "Moldova, Republic of", "MN": "Mongolia", "ME": "Montenegro",
+	"MA": "Morocco", "MZ": "Mozambique", "MM": "Myanmar", "NA": "Namibia", "NP": "Nepal",
+	"NL": "Netherlands", "NC": "New Caledonia", "NZ": "New Zealand", "NI": "Nicaragua", "NE": "Niger",
+	"NG": "Nigeria", "NO": "Norway", "OM": "Oman", "PK": "Pakistan", "PS": "Palestine",
+	"PA": "Panama", "PG": "Papua New Guinea", "PY": "Paraguay", "PE": "Peru", "PH": "Philippines",
+	"PL": "Poland", "PT": "Portugal", "PR": "Puerto Rico", "QA": "Qatar", "RO": "Romania",
+	"RU": "Russia", "RW": "Rwanda", "SA": "Saudi Arabia", "SN": "Senegal", "RS": "Serbia",
+	"SL": "Sierra Leone", "SG": "Singapore", "SK": "Slovakia", "SI": "Slovenia", "SB": "Solomon Is.",
+	"SO": "Somalia", "ZA": "South Africa", "SS": "S. Sudan", "ES": "Spain", "LK": "Sri Lanka",
+	"SD": "Sudan", "SR": "Suriname", "SZ": "eSwatini", "SE": "Sweden", "CH": "Switzerland",
+	"SY": "Syrian Arab Republic", "TW": "Taiwan", "TJ": "Tajikistan", "TZ": "Tanzania", "TH": "Thailand",
+	"TL": "Timor-Leste", "TG": "Togo", "TT": "Trinidad and Tobago", "TN": "Tunisia", "TR": "Turkey",
+	"TM": "Turkmenistan", "UG": "Uganda", "UA": "Ukraine", "AE": "United Arab Emirates",
+	"GB": "United Kingdom", "US": "United States of America", "UY": "Uruguay", "UZ": "Uzbekistan",
+	"VU": "Vanuatu", "VE": "Venezuela", "VN": "Vietnam", "EH": "W. Sahara", "YE": "Yemen",
+	"ZM": "Zambia", "ZW": "Zimbabwe",
+}
+
 func getStatus(blocked bool) string {
 	if blocked {
 		return "blocked"
@@ -186,6 +244,40 @@ func (h *Handler) GetPortStats(c *fiber.Ctx) error {
 	})
 }
 
+// GetServiceStats returns traffic per configured service, summed over its public ports
+// GET /api/services/stats
+func (h *Handler) GetServiceStats(c *fiber.Ctx) error {
+	if h.EBPF == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "eBPF service not initialized",
+		})
+	}
+
+	var svcs []models.Service
+	if err := h.DB.Preload("Ports").Find(&svcs).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	stats := services.ServiceTrafficStats(svcs, h.EBPF.GetAllPortStats())
+	return c.JSON(fiber.Map{
+		"services": stats,
+		"count":    len(stats),
+	})
+}
+
+// GetSeenCountries returns every source country observed in traffic, newest first
+// GET /api/traffic/countries/seen
+func (h *Handler) GetSeenCountries(c *fiber.Ctx) error {
+	var seen []models.SeenCountry
+	if err := h.DB.Order("first_seen desc").Find(&seen).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"countries": seen,
+		"count":     len(seen),
+	})
+}
+
 // GetBlockedIPList returns a list of currently blocked IPs
 // GET /api/traffic/blocked
 func (h *Handler) GetBlockedIPList(c *fiber.Ctx) error {
@@ -208,6 +300,33 @@ func (h *Handler) GetBlockedIPList(c *fiber.Ctx) error {
 	})
 }
 
+// GetActiveConnections lists the remote addresses origins recently connected out to (TC egress
+// tracking), whose replies XDP lets through. Ports and protocol are not tracked, only the address.
+// GET /api/traffic/connections
+func (h *Handler) GetActiveConnections(c *fiber.Ctx) error {
+	if h.EBPF == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "eBPF service not initialized",
+		})
+	}
+
+	conns, truncated, err := h.EBPF.IterateActiveConnections()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to read active connections: %v", err),
+		})
+	}
+	if conns == nil {
+		conns = []services.ConnectionInfo{}
+	}
+
+	return c.JSON(fiber.Map{
+		"data":      conns,
+		"count":     len(conns),
+		"truncated": truncated,
+	})
+}
+
 // UnblockIP removes an IP from the blocklist
 // DELETE /api/traffic/blocked
 func (h *Handler) UnblockIP(c *fiber.Ctx) error {
@@ -234,7 +353,169 @@ func (h *Handler) UnblockIP(c *fiber.Ctx) error {
 		})
 	}
 
+	services.LogBlockHistory(h.DB, models.BlockHistory{
+		IP:      input.IP,
+		Action:  services.BlockActionUnblocked,
+		Reason:  "manual",
+		Source:  "manual",
+		Details: "Removed from XDP blocklist",
+	})
+
 	return c.JSON(fiber.Map{
 		"message": fmt.Sprintf("IP %s has been unblocked", input.IP),
 	})
 }
+
+// GetAggregatorStats returns the eBPF event aggregator queue depth and drop counters
+// GET /api/ebpf/aggregator
+func (h *Handler) GetAggregatorStats(c *fiber.Ctx) error {
+	if h.EBPF == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "eBPF service not initialized",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"enabled":    h.EBPF.IsEnabled(),
+		"aggregator": h.EBPF.GetAggregatorStats(),
+	})
+}
+
+// BenchmarkEBPFMap measures blocked_ips Put/Delete throughput with synthetic entries
+// POST /api/ebpf/benchmark
+func (h *Handler) BenchmarkEBPFMap(c *fiber.Ctx) error {
+	if h.EBPF == nil || !h.EBPF.IsEnabled() {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "eBPF is not enabled",
+		})
+	}
+
+	var input struct {
+		Entries int `json:"entries"`
+	}
+	c.BodyParser(&input)
+	if input.Entries == 0 {
+		input.Entries = 10000
+	}
+
+	result, err := h.EBPF.BenchmarkBlockedMap(input.Entries)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrBenchmarkRefused) {
+			status = http.StatusConflict
+		}
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(result)
+}
+
+// GetEBPFCounters returns the raw cumulative XDP global counters (no delta/PPS math)
+// GET /api/ebpf/counters
+func (h *Handler) GetEBPFCounters(c *fiber.Ctx) error {
+	if h.EBPF == nil || !h.EBPF.IsEnabled() {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "eBPF is not enabled",
+		})
+	}
+
+	counters, err := h.EBPF.GetRawCounters()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"counters":  counters,
+		"timestamp": time.Now(),
+	})
+}
+
+// maxBPFMapSample bounds the geo_allowed/geo_blocked sample a dump may request
+const maxBPFMapSample = 10000
+
+// GetBPFMaps lists the pinned BPF maps the debug API can read
+// GET /api/ebpf/maps
+func (h *Handler) GetBPFMaps(c *fiber.Ctx) error {
+	if h.EBPF == nil || !h.EBPF.IsEnabled() {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "eBPF is not enabled"})
+	}
+	maps, err := h.EBPF.ListBPFMaps()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"maps": maps})
+}
+
+// DumpBPFMap returns the decoded contents of one BPF map (read-only).
+// geo_allowed and geo_blocked are sampled (?limit=, default 100); the other maps are returned in full.
+// GET /api/ebpf/maps/:name
+func (h *Handler) DumpBPFMap(c *fiber.Ctx) error {
+	if h.EBPF == nil || !h.EBPF.IsEnabled() {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "eBPF is not enabled"})
+	}
+
+	name := c.Params("name")
+	known := false
+	for _, n := range services.BPFMapNames {
+		if n == name {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"error": fmt.Sprintf("unknown map %q, expected one of: %s", name, strings.Join(services.BPFMapNames, ", ")),
+		})
+	}
+
+	limit := c.QueryInt("limit", 0)
+	if limit < 0 || limit > maxBPFMapSample {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("limit must be between 1 and %d", maxBPFMapSample)})
+	}
+
+	dump, err := h.EBPF.DumpBPFMap(name, limit)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(dump)
+}
+
+// GetEBPFCapabilities reports how the XDP filter is running, including generic-mode fallback
+// GET /api/ebpf/capabilities
+func (h *Handler) GetEBPFCapabilities(c *fiber.Ctx) error {
+	if h.EBPF == nil {
+		return c.JSON(fiber.Map{"ebpf_enabled": false})
+	}
+	xdp := h.EBPF.GetXDPStatus()
+	return c.JSON(fiber.Map{
+		"ebpf_enabled":         h.EBPF.IsEnabled(),
+		"xdp":                  xdp,
+		"xdp_generic_fallback": xdp.GenericFallback,
+	})
+}
+
+// GetTCStatus reports the TC egress attachment and outbound connection tracking state
+// GET /api/ebpf/tc-status
+func (h *Handler) GetTCStatus(c *fiber.Ctx) error {
+	if h.EBPF == nil || !h.EBPF.IsEnabled() {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "eBPF is not enabled",
+		})
+	}
+	return c.JSON(h.EBPF.GetTCStatus())
+}
+
+// GetIPStatsSampling returns the per-IP stats sampling state (top-K size, backoff, last scan)
+// GET /api/ebpf/sampling
+func (h *Handler) GetIPStatsSampling(c *fiber.Ctx) error {
+	if h.EBPF == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "eBPF service not initialized",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"enabled":  h.EBPF.IsEnabled(),
+		"sampling": h.EBPF.GetIPStatsSampling(),
+	})
+}
@@ -27,24 +27,78 @@ func (h *Handler) CreateUser(c *fiber.Ctx) error {
 	var input struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
+		Role     string `json:"role"` // Defaults to admin
 	}
 	if err := c.BodyParser(&input); err != nil {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
+	if err := cleanTextFields(textField{"username", &input.Username, maxNameLength}); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if input.Username == "" || input.Password == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Username and password are required"})
+	}
+	if input.Role == "" {
+		input.Role = RoleAdmin
+	}
+	if !ValidRole(input.Role) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "role must be 'admin' or 'viewer'"})
+	}
 
 	hashed, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Could not hash password"})
 	}
-	user := models.Admin{Username: input.Username, Password: string(hashed)}
+	user := models.Admin{Username: input.Username, Password: string(hashed), Role: input.Role}
 	if result := h.DB.Create(&user); result.Error != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": result.Error.Error()})
 	}
-	return c.JSON(fiber.Map{"message": "User created", "user": user.Username})
+	return c.JSON(fiber.Map{"message": "User created", "user": user.Username, "role": user.Role})
+}
+
+// UpdateUserRole switches a user between admin and viewer (applies at their next login)
+// PUT /api/users/:id/role
+func (h *Handler) UpdateUserRole(c *fiber.Ctx) error {
+	var input struct {
+		Role string `json:"role"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	if !ValidRole(input.Role) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "role must be 'admin' or 'viewer'"})
+	}
+
+	var user models.Admin
+	if err := h.DB.First(&user, c.Params("id")).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if user.Role != RoleViewer && input.Role == RoleViewer && h.adminCount() <= 1 {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Cannot demote the last admin"})
+	}
+
+	if err := h.DB.Model(&user).Update("role", input.Role).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Role updated", "user": user.Username, "role": input.Role})
+}
+
+// adminCount returns how many accounts hold the admin role
+func (h *Handler) adminCount() int64 {
+	var count int64
+	h.DB.Model(&models.Admin{}).Where("role = ? OR role = '' OR role IS NULL", RoleAdmin).Count(&count)
+	return count
 }
 
 func (h *Handler) DeleteUser(c *fiber.Ctx) error {
 	id := c.Params("id")
+	var user models.Admin
+	if err := h.DB.First(&user, id).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if user.Role != RoleViewer && h.adminCount() <= 1 {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Cannot delete the last admin"})
+	}
 	if result := h.DB.Delete(&models.Admin{}, id); result.Error != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": result.Error.Error()})
 	}
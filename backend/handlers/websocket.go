@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// No websocket dependency is vendored, so this implements the small server-side
+// subset of RFC 6455 the live feeds need: unfragmented text frames out,
+// ping/close handling in. Client payloads are read and discarded.
+
+const (
+	wsGUID         = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	wsOpText       = 0x1
+	wsOpClose      = 0x8
+	wsOpPing       = 0x9
+	wsOpPong       = 0xA
+	wsWriteTimeout = 10 * time.Second
+	wsMaxControl   = 125 // Control frame payload limit
+	wsMaxInbound   = 1 << 16
+)
+
+// wsConn is a hijacked connection speaking the WebSocket framing protocol
+type wsConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	mu     sync.Mutex // Serializes writes from the feed and the read loop (pong/close)
+	done   chan struct{}
+	once   sync.Once
+}
+
+// upgradeWebSocket completes the WebSocket handshake and runs handler on the hijacked connection.
+// The connection is closed when handler returns.
+func upgradeWebSocket(c *fiber.Ctx, handler func(ws *wsConn)) error {
+	if !strings.EqualFold(c.Get("Upgrade"), "websocket") {
+		return c.Status(http.StatusUpgradeRequired).JSON(fiber.Map{"error": "WebSocket upgrade required"})
+	}
+	key := c.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Missing Sec-WebSocket-Key"})
+	}
+
+	sum := sha1.Sum([]byte(key + wsGUID))
+	c.Status(http.StatusSwitchingProtocols)
+	c.Set("Upgrade", "websocket")
+	c.Set("Connection", "Upgrade")
+	c.Set("Sec-WebSocket-Accept", base64.StdEncoding.EncodeToString(sum[:]))
+
+	c.Context().Hijack(func(conn net.Conn) {
+		ws := &wsConn{
+			conn:   conn,
+			reader: bufio.NewReader(conn),
+			done:   make(chan struct{}),
+		}
+		go ws.readLoop()
+		handler(ws)
+		ws.Close()
+	})
+	return nil
+}
+
+// Done is closed once the peer disconnects or sends a close frame
+func (ws *wsConn) Done() <-chan struct{} {
+	return ws.done
+}
+
+// WriteText sends a single text frame
+func (ws *wsConn) WriteText(data []byte) error {
+	return ws.writeFrame(wsOpText, data)
+}
+
+// Ping sends a ping; browsers answer automatically, which keeps proxies from idling out the connection
+func (ws *wsConn) Ping() error {
+	return ws.writeFrame(wsOpPing, nil)
+}
+
+// Close sends a normal-closure frame (best effort) and marks the connection done
+func (ws *wsConn) Close() {
+	ws.once.Do(func() {
+		payload := make([]byte, 2)
+		binary.BigEndian.PutUint16(payload, 1000)
+		_ = ws.writeFrame(wsOpClose, payload)
+		close(ws.done)
+	})
+}
+
+func (ws *wsConn) writeFrame(opcode byte, payload []byte) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	header := make([]byte, 0, 10)
+	header = append(header, 0x80|opcode) // FIN + opcode; server frames are never masked
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126, byte(n>>8), byte(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	ws.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if _, err := ws.conn.Write(header); err != nil {
+		return err
+	}
+	if len(payload) > 0 {
+		if _, err := ws.conn.Write(payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readLoop consumes client frames, answering pings and stopping on close or error
+func (ws *wsConn) readLoop() {
+	defer ws.Close()
+
+	for {
+		opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return
+		}
+		switch opcode {
+		case wsOpClose:
+			return
+		case wsOpPing:
+			if err := ws.writeFrame(wsOpPong, payload); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (ws *wsConn) readFrame() (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(ws.reader, head[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := head[0] & 0x0F
+	masked := head[1]&0x80 != 0
+	length := uint64(head[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > wsMaxInbound || (opcode >= wsOpClose && length > wsMaxControl) {
+		return 0, nil, errors.New("websocket frame too large")
+	}
+	if !masked {
+		return 0, nil, errors.New("unmasked client frame")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.reader, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
@@ -1,10 +1,18 @@
 package handlers
 
 import (
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/services"
+	"kg-proxy-web-gui/backend/system"
+	"net/http"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // WireGuardStatus represents WireGuard interface status
@@ -24,6 +32,12 @@ type WireGuardPeer struct {
 	LatestHandshake string `json:"latest_handshake"`
 	TransferRx      string `json:"transfer_rx"`
 	TransferTx      string `json:"transfer_tx"`
+
+	// From the stored peer record (refreshed every 30s from "wg show wg0 dump")
+	OriginID        uint       `json:"origin_id,omitempty"`
+	LastHandshakeAt *time.Time `json:"last_handshake_at,omitempty"`
+	RxBytes         int64      `json:"rx_bytes"`
+	TxBytes         int64      `json:"tx_bytes"`
 }
 
 // GetWireGuardStatus returns WireGuard interface status
@@ -64,6 +78,21 @@ func (h *Handler) GetWireGuardStatus(c *fiber.Ctx) error {
 
 	status := parseWgShow(output)
 	status.MockMode = false
+
+	var stored []models.WireGuardPeer
+	h.DB.Find(&stored)
+	byKey := make(map[string]models.WireGuardPeer, len(stored))
+	for _, p := range stored {
+		byKey[p.PublicKey] = p
+	}
+	for i := range status.Peers {
+		if p, ok := byKey[status.Peers[i].PublicKey]; ok {
+			status.Peers[i].OriginID = p.OriginID
+			status.Peers[i].LastHandshakeAt = p.LastHandshake
+			status.Peers[i].RxBytes = p.RxBytes
+			status.Peers[i].TxBytes = p.TxBytes
+		}
+	}
 	return c.JSON(status)
 }
 
@@ -141,3 +170,114 @@ func parseWgShow(output string) WireGuardStatus {
 
 	return status
 }
+
+// GetWireGuardServerKey returns the wg0 server public key and when it was last generated
+// GET /api/wireguard/server-key
+func (h *Handler) GetWireGuardServerKey(c *fiber.Ctx) error {
+	var modTime *time.Time
+	if t := h.WG.ServerKeyModTime(); !t.IsZero() {
+		modTime = &t
+	}
+	return c.JSON(fiber.Map{
+		"public_key": h.WG.GetServerPublicKey(),
+		"updated_at": modTime,
+	})
+}
+
+// RotateWireGuardServerKey replaces the wg0 server keypair and answers with every origin's
+// client config regenerated for the new key.
+// Every origin loses its tunnel until its [Peer] PublicKey is updated, so the caller must
+// re-enter their password and send confirm="ROTATE".
+// POST /api/wireguard/rotate-key (alias: /api/wireguard/rotate-server-key)
+func (h *Handler) RotateWireGuardServerKey(c *fiber.Ctx) error {
+	var req struct {
+		Password string `json:"password"`
+		Confirm  string `json:"confirm"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	if req.Confirm != "ROTATE" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Rotating the server key disconnects every origin until its config is updated; send confirm=\"ROTATE\" to proceed",
+		})
+	}
+
+	user := c.Locals("user").(*jwt.Token)
+	username := user.Claims.(jwt.MapClaims)["user"].(string)
+	var admin models.Admin
+	if err := h.DB.Where("username = ?", username).First(&admin).Error; err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Password verification failed"})
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(admin.Password), []byte(req.Password)); err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Password verification failed"})
+	}
+
+	oldKey := h.WG.GetServerPublicKey()
+	newKey, err := h.WG.RotateServerKey()
+	if err != nil {
+		system.Error("WireGuard server key rotation by %s failed: %v", username, err)
+		if newKey == "" {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		// Key is live but not persisted; surface it so origins can still be updated
+		AddEvent("warning", "WireGuard server key rotated but not saved: "+err.Error())
+	}
+
+	var affected int64
+	h.DB.Model(&models.Origin{}).Count(&affected)
+
+	system.Warn("WireGuard server key rotated by %s (%d origins must be reconfigured)", username, affected)
+	AddEvent("warning", fmt.Sprintf("WireGuard server key rotated: %d origin configs must be redistributed", affected))
+	if h.Webhook != nil {
+		h.Webhook.SendSystemAlert("WireGuard Server Key Rotated",
+			fmt.Sprintf("Rotated by %s. %d origins will fail to handshake until their [Peer] PublicKey is updated to `%s`.", username, affected, newKey),
+			services.ColorOrange)
+	}
+
+	resp := fiber.Map{
+		"message":                  "Server key rotated",
+		"old_public_key":           oldKey,
+		"public_key":               newKey,
+		"redistribute_configs":     true,
+		"affected_origins":         affected,
+		"warning":                  "Existing tunnels stop working until every origin's [Peer] PublicKey is replaced with the new server public key",
+		"previous_key_backup_file": "wg_private.key.prev",
+	}
+	if err != nil {
+		resp["save_error"] = err.Error()
+	}
+	resp["configs"] = h.regenerateClientConfigs()
+	c.Set("Cache-Control", "no-store") // Configs contain the peer private keys
+	return c.JSON(resp)
+}
+
+// regenerateClientConfigs builds the client config of every origin with a peer and a tunnel IP
+// against the current server key, for redistribution after a rotation
+func (h *Handler) regenerateClientConfigs() []fiber.Map {
+	configs := []fiber.Map{}
+	var origins []models.Origin
+	h.DB.Preload("Peer").Where("wg_ip <> ''").Find(&origins)
+	if len(origins) == 0 {
+		return configs
+	}
+
+	endpoint, allowedIPs, err := h.clientConfigRoute()
+	if err != nil {
+		system.Warn("Client configs not regenerated: %v", err)
+		return configs
+	}
+	dns := h.wgClientDNS()
+	for _, origin := range origins {
+		if origin.Peer == nil {
+			continue
+		}
+		config, err := h.WG.GenerateClientConfig(origin.Peer, origin.WgIP, endpoint, allowedIPs, dns)
+		if err != nil {
+			system.Warn("Client config for origin %s not regenerated: %v", origin.Name, err)
+			continue
+		}
+		configs = append(configs, fiber.Map{"origin_id": origin.ID, "name": origin.Name, "config": config})
+	}
+	return configs
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/services"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// recordingExecutor accepts every command and remembers it
+type recordingExecutor struct {
+	commands []string
+}
+
+func (e *recordingExecutor) Execute(command string, args ...string) (string, error) {
+	e.commands = append(e.commands, strings.Join(append([]string{command}, args...), " "))
+	return "", nil
+}
+
+func (e *recordingExecutor) GetOS() string { return runtime.GOOS }
+
+func TestRotateKeyResyncsPeersAndRegeneratesConfigs(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("server key rotation is only supported on Linux")
+	}
+	h := newTestHandler(t)
+	exec := &recordingExecutor{}
+	h.WG = services.NewWireGuardService(exec, nil, t.TempDir())
+	h.WG.SetDB(h.DB)
+
+	oldPriv, _, _ := h.WG.GenerateKeys()
+	if err := os.WriteFile(h.WG.ServerKeyPath(), []byte(oldPriv), 0600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	h.DB.Create(&models.Admin{Username: "admin", Password: string(hashed), Role: RoleAdmin})
+
+	peerPriv, peerPub, _ := h.WG.GenerateKeys()
+	origin := models.Origin{Name: "game-1", WgIP: "10.200.0.2", Peer: &models.WireGuardPeer{PublicKey: peerPub, PrivateKey: peerPriv}}
+	if err := h.DB.Create(&origin).Error; err != nil {
+		t.Fatalf("create origin: %v", err)
+	}
+
+	app := newTestApp()
+	app.Post("/api/wireguard/rotate-key", h.RotateWireGuardServerKey)
+
+	var resp struct {
+		OldPublicKey string `json:"old_public_key"`
+		PublicKey    string `json:"public_key"`
+		Configs      []struct {
+			OriginID uint   `json:"origin_id"`
+			Config   string `json:"config"`
+		} `json:"configs"`
+	}
+	body := map[string]string{"password": "secret", "confirm": "ROTATE"}
+	if status := doJSON(t, app, http.MethodPost, "/api/wireguard/rotate-key", body, &resp); status != http.StatusOK {
+		t.Fatalf("rotate status %d", status)
+	}
+	if resp.PublicKey == "" || resp.PublicKey == resp.OldPublicKey {
+		t.Fatalf("public key not rotated: old %q new %q", resp.OldPublicKey, resp.PublicKey)
+	}
+
+	var keyApplied, peerSynced bool
+	for _, cmd := range exec.commands {
+		if strings.HasPrefix(cmd, "wg set wg0 private-key ") {
+			keyApplied = true
+		}
+		if strings.HasPrefix(cmd, "wg set wg0 peer "+peerPub+" allowed-ips 10.200.0.2/32") {
+			if !keyApplied {
+				t.Errorf("peer synced before the new key was applied")
+			}
+			peerSynced = true
+		}
+	}
+	if !keyApplied || !peerSynced {
+		t.Fatalf("key applied %v, peer synced %v; commands %q", keyApplied, peerSynced, exec.commands)
+	}
+
+	if len(resp.Configs) != 1 || resp.Configs[0].OriginID != origin.ID {
+		t.Fatalf("configs = %+v, want one for origin %d", resp.Configs, origin.ID)
+	}
+	if !strings.Contains(resp.Configs[0].Config, "PublicKey = "+resp.PublicKey+"\n") {
+		t.Errorf("config does not use the new server key:\n%s", resp.Configs[0].Config)
+	}
+}
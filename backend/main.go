@@ -1,23 +1,29 @@
 package main
 
 import (
+	"crypto/tls"
 	"fmt"
 	"kg-proxy-web-gui/backend/handlers"
 	"kg-proxy-web-gui/backend/models"
 	"kg-proxy-web-gui/backend/services"
 	"kg-proxy-web-gui/backend/system"
 	"log"
+	"net"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"runtime/debug"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/glebarez/sqlite"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/compress"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
+	"golang.org/x/crypto/acme/autocert"
 	"gorm.io/gorm"
 )
 
@@ -61,29 +67,12 @@ func main() {
 	debug.SetGCPercent(500)
 	system.Info("GC Optimization enabled (GOGC=500)")
 
-	// Migrate
 	// Migrate
 	// CRITICAL: Ensure schema is up to date. Panic if migration fails.
-	if err := db.AutoMigrate(
-		&models.Origin{},
-		&models.Service{},
-		&models.ServicePort{},
-		&models.AllowForeign{},
-		&models.BanIP{},
-		&models.AllowIP{},
-		&models.WireGuardPeer{},
-		&models.Admin{},
-		&models.SecuritySettings{},
-		&models.TrafficSnapshot{},
-		&models.AttackEvent{},
-		&models.AttackEvent{},
-		&models.AttackSignature{},
-		&models.CountryGroup{},
-	); err != nil {
+	if err := services.MigrateDatabase(db, dbPath); err != nil {
 		system.Error("Database migration failed: %v", err)
 		log.Fatalf("CRITICAL: Database migration failed. Application cannot start: %v", err)
 	}
-	system.Info("Database migration completed successfully")
 
 	// Seed default attack signatures if empty
 	var sigCount int64
@@ -99,11 +88,19 @@ func main() {
 
 	// 2. Setup Services
 	executor := system.NewExecutor()
-	sysConfig := &models.SystemConfig{}
+	sysConfig := &models.SystemConfig{WGSubnet: os.Getenv("KG_WG_SUBNET")}
+
+	// Without ipset/iptables nothing is enforced; say so instead of looking protected
+	if caps := system.DetectCapabilities(); caps.Degraded {
+		system.Error("DEGRADED MODE: required binaries missing (%s), firewall rules will NOT be enforced", strings.Join(caps.Missing, ", "))
+		if os.Getenv("KG_REQUIRE_FIREWALL") == "true" {
+			log.Fatalf("CRITICAL: Required firewall binaries missing: %s", strings.Join(caps.Missing, ", "))
+		}
+	}
 
 	// Initialize GeoIP service
 	geoipService := services.NewGeoIPService()
-	geoipService.StartAutoUpdateScheduler() // Start weekly auto-refresh
+	geoipService.StartAutoUpdateScheduler() // Weekly database / daily feed refresh with retry
 	system.Info("GeoIP service initialized")
 
 	// Initialize Flood Protection
@@ -112,7 +109,34 @@ func main() {
 	if err := db.First(&settings, 1).Error; err == nil {
 		protectionLevel = settings.ProtectionLevel
 	}
+	// Apply explicit WAN interface before any service detects it
+	if settings.WANInterface != "" {
+		system.SetWANInterface(settings.WANInterface)
+		if err := system.ValidateInterface(settings.WANInterface); err != nil {
+			system.Warn("Configured WAN interface: %v", err)
+		} else {
+			system.Info("Using configured WAN interface: %s", settings.WANInterface)
+		}
+	}
+	if settings.AdditionalInterfaces != "" {
+		system.SetAdditionalInterfaces(system.ParseInterfaceList(settings.AdditionalInterfaces))
+		system.Info("Protected interfaces: %v", system.GetProtectedInterfaces())
+	}
+
 	floodProtect := services.NewFloodProtection(protectionLevel)
+	if settings.ID != 0 { // Zero grace periods of unsaved settings would disable grace
+		floodProtect.ApplyGraceSettings(&settings)
+	}
+	floodProtect.ApplyBlockDurations(&settings)
+	floodProtect.SetGeoResolveWorkers(settings.GeoResolveWorkers)
+	services.SetAttackEventCap(settings.AttackEventsPerIPCap)
+	services.SetAutoCapture(settings.PCAPAutoCapture, settings.PCAPAutoCaptureMinPPS, settings.PCAPAutoCaptureSeconds)
+	services.SetCaptureRetention(settings.PCAPManualRetentionDays, settings.PCAPAutoRetentionDays)
+	if err := services.ApplyInternalExclusion(settings.ExcludeInternalTraffic, settings.InternalExcludeCIDRs); err != nil {
+		system.Warn("Invalid internal_exclude_cidrs, using default private ranges only: %v", err)
+		services.ApplyInternalExclusion(settings.ExcludeInternalTraffic, "")
+	}
+	floodProtect.RestoreBlocks(db) // Before the initial ApplyRules fills flood_blocked
 	system.Info("Flood protection initialized (level: %d)", protectionLevel)
 
 	// Determine Data Directory
@@ -125,12 +149,29 @@ func main() {
 	}
 
 	wgService := services.NewWireGuardService(executor, sysConfig, dataDir)
+	wgService.SetDB(db)
 	// Initialize WireGuard Interface (Create wg0, assign IP, set key)
 	if err := wgService.Init(); err != nil {
 		system.Error("Failed to initialize WireGuard service: %v", err)
 		// We continue, but warn heavily. Connectivity will likely fail.
 	}
 
+	// Management listen address (resolved after wg0 exists so "wg0:8080" works)
+	listenAddr, err := system.ResolveListenAddr(os.Getenv("KG_LISTEN_ADDR"))
+	if err != nil {
+		log.Fatalf("CRITICAL: Invalid KG_LISTEN_ADDR: %v", err)
+	}
+	system.SetListenAddr(listenAddr)
+	if !system.IsListenPublic() {
+		system.Info("Management interface restricted to %s (not exposed on WAN)", listenAddr)
+	}
+
+	// Optional double-submit CSRF protection for mutating API calls
+	if os.Getenv("KG_CSRF_PROTECTION") == "true" {
+		handlers.SetCSRFEnabled(true)
+		system.Info("CSRF protection enabled for state-changing requests")
+	}
+
 	// Sync Peers (Restore connectivity for existing Origins)
 	var origins []models.Origin
 	if err := db.Preload("Peer").Find(&origins).Error; err != nil {
@@ -143,6 +184,12 @@ func main() {
 
 	fwService := services.NewFirewallService(db, executor, geoipService, floodProtect)
 	fwService.StartMaintenanceWatcher()
+	fwService.StartSignatureHitCounter()
+	fwService.StartGeoScheduleWatcher()
+	fwService.StartDrainWatcher(wgService)
+
+	geoipService.SetCountryCIDRSource(settings.CountryCIDRSource)
+	geoipService.SetUpdatePolicy(time.Duration(settings.GeoIPUpdateIntervalHours)*time.Hour, time.Duration(settings.GeoIPMaxAgeHours)*time.Hour)
 
 	// Load MaxMind license key from DB if available (using settings fetched above)
 	if settings.MaxMindLicenseKey != "" {
@@ -157,15 +204,32 @@ func main() {
 		}()
 	}
 
-	// Set IP Intelligence API Key
+	// Set IP Intelligence provider and API key
 	if settings.IPIntelligenceAPIKey != "" {
-		geoipService.SetIPInfoAPIKey(settings.IPIntelligenceAPIKey)
-		system.Info("IP Intelligence API Key configured")
+		if err := geoipService.SetIPIntelligenceProvider(settings.IPIntelligenceProvider, settings.IPIntelligenceAPIKey); err != nil {
+			system.Warn("IP Intelligence disabled: %v", err)
+		} else {
+			system.Info("IP Intelligence API Key configured (provider: %s)", settings.IPIntelligenceProvider)
+		}
+	}
+
+	// Initialize Webhook Service
+	webhookService := services.NewWebhookService()
+	if settings.DiscordWebhookURL != "" {
+		webhookService.SetWebhookURL(settings.DiscordWebhookURL)
+		system.Info("Discord webhook configured")
 	}
+	fwService.StartBanExpiryWatcher(webhookService)   // Auto-unban bans with an expiry
+	fwService.StartProtectionReminder(webhookService) // Nag while protection is off or in maintenance
 
 	ebpfService := services.NewEBPFService()
-	ebpfService.SetGeoIPService(geoipService) // Connect GeoIP to eBPF
-	ebpfService.SetDatabase(db)               // Connect DB for traffic snapshots
+	ebpfService.SetWebhookService(webhookService) // Alerts for XDP generic-mode fallback
+	ebpfService.SetGeoIPService(geoipService)     // Connect GeoIP to eBPF
+	ebpfService.SetDatabase(db)                   // Connect DB for traffic snapshots
+	ebpfService.SetAggregatorInterval(settings.EventBatchSeconds)
+	ebpfService.SetAggregatorLimits(settings.EventAggregatorMaxKeys, settings.EventQueueSize)
+	ebpfService.SetCountryWatch(settings.NewCountryAlert, settings.CountrySpikeFactor)
+	ebpfService.SetIPStatsSampling(settings.IPStatsTopK, settings.IPStatsPollSeconds)
 
 	// Connect Firewall to eBPF for coordinated maintenance mode
 	fwService.SetEBPF(ebpfService)
@@ -176,6 +240,7 @@ func main() {
 	system.Info("Applying initial firewall rules...")
 	if err := fwService.ApplyRules(); err != nil {
 		system.Error("Failed to apply initial firewall rules: %v", err)
+		handlers.AddEvent("warning", "Firewall rules not applied: "+err.Error())
 	}
 
 	// Always try to enable eBPF XDP monitoring
@@ -193,14 +258,15 @@ func main() {
 
 	// Apply saved eBPF configuration
 	if ebpfService.IsEnabled() {
-		ebpfService.UpdateConfig(settings.XDPHardBlocking, settings.XDPRateLimitPPS)
-	}
+		ebpfService.UpdateConfig(settings.XDPHardBlocking, settings.XDPRateLimitPPS, settings.XDPRateLimitBurst)
+		ebpfService.SetRateLimitBlockTTL(floodProtect.BlockDurationFor(services.BlockReasonRateLimit))
 
-	// Initialize Webhook Service
-	webhookService := services.NewWebhookService()
-	if settings.DiscordWebhookURL != "" {
-		webhookService.SetWebhookURL(settings.DiscordWebhookURL)
-		system.Info("Discord webhook configured")
+		// Re-apply flood blocks restored from the previous run with their remaining time
+		for ip, until := range floodProtect.GetBlockedExpiries() {
+			if err := ebpfService.AddBlockedIP(ip, services.BlockReasonFlood, time.Until(until)); err != nil {
+				system.Warn("Failed to restore flood block for %s in XDP: %v", ip, err)
+			}
+		}
 	}
 
 	// Initialize System Monitor
@@ -215,14 +281,45 @@ func main() {
 	healthMonitor := services.NewHealthMonitor(db, webhookService)
 	healthMonitor.Start()
 
+	// Persist WireGuard peer stats and alert on stale handshakes
+	wgService.SetWebhookService(webhookService)
+	wgService.SetHandshakeAlertMinutes(settings.WGHandshakeAlertMinutes)
+	wgService.StartPeerStatsLoop()
+
+	// Remove packet captures past their retention
+	services.StartCaptureRetention(db)
+
 	// Set Webhook for GeoIP Alerts
 	geoipService.SetWebhookService(webhookService)
 
 	// Connect dependencies for Flood Protection (Logging & Alerts)
 	floodProtect.SetServices(db, webhookService, geoipService)
 
+	// Initialize Repeat Offender Tracker (promotes repeat auto-blocks to permanent bans)
+	offenseTracker := services.NewOffenseTracker(db, executor)
+	offenseTracker.SetServices(ebpfService, webhookService, geoipService)
+	offenseTracker.SetConfig(settings.AutoPromoteThreshold, settings.AutoPromoteWindowHours)
+	offenseTracker.SetRecurrenceConfig(settings.RecurrencePromoteThreshold, settings.RecurrencePromoteDays)
+	offenseTracker.SetIntelligenceBan(settings.IPIntelligenceEnabled, settings.AbuseScoreBlockThreshold)
+	ebpfService.SetOffenseTracker(offenseTracker)
+	floodProtect.SetOffenseTracker(offenseTracker)
+
 	// 3. Setup Handlers
-	h := handlers.NewHandler(db, wgService, fwService, ebpfService, webhookService)
+	h := handlers.NewHandler(db, wgService, fwService, ebpfService, webhookService, offenseTracker)
+
+	// Per-install JWT signing key, persisted in the data dir
+	jwtSecret, err := system.LoadOrCreateJWTSecret(dataDir)
+	if err != nil {
+		log.Fatalf("CRITICAL: Failed to load JWT signing key: %v", err)
+	}
+	h.SetJWTSecret(jwtSecret)
+
+	// TOTP secrets are encrypted with a separate key so rotating the JWT key keeps 2FA intact
+	totpKey, err := system.LoadOrCreateSecretKey(dataDir, "totp.key")
+	if err != nil {
+		log.Fatalf("CRITICAL: Failed to load TOTP encryption key: %v", err)
+	}
+	h.SetTOTPKey(totpKey)
 
 	app := fiber.New(fiber.Config{
 		DisableStartupMessage: false,
@@ -237,48 +334,104 @@ func main() {
 
 	app.Use(cors.New())
 
+	// Gzip/brotli for API responses and frontend assets (helps when the panel is reached over a slow link)
+	app.Use(compress.New(compress.Config{
+		Level: compress.LevelBestSpeed,
+		Next: func(c *fiber.Ctx) bool {
+			// Streams must flush per event and captures are already binary
+			return strings.EqualFold(c.Get("Upgrade"), "websocket") ||
+				strings.HasSuffix(c.Path(), "/stream") ||
+				strings.HasPrefix(c.Path(), "/api/pcap/files/") ||
+				c.Path() == "/api/reports/incident"
+		},
+	}))
+
 	api := app.Group("/api")
 
 	// ===== Public Routes (No Auth Required) =====
 	api.Post("/login", h.Login)
+	api.Get("/public/status", h.GetPublicStatus) // Opt-in via public_status_enabled
 
-	// ===== Protected Routes (JWT Required) =====
-	protected := api.Group("", handlers.JWTAuthMiddleware())
+	// ===== Protected Routes (JWT or X-API-Key Required) =====
+	// Viewer accounts and read-scoped API keys are read-only; admin-only reads add handlers.RequireRole(handlers.RoleAdmin)
+	// Every state-changing request is recorded in the audit log, including rejected ones
+	protected := api.Group("", h.AuthMiddleware(jwtSecret), h.AuditMiddleware(), handlers.CSRFMiddleware(), handlers.ReadOnlyForViewers())
+	adminOnly := handlers.RequireRole(handlers.RoleAdmin)
 
 	// Auth
 	protected.Put("/auth/password", h.ChangePassword)
+	protected.Post("/auth/totp/enroll", h.EnrollTOTP)
+	protected.Post("/auth/totp/verify", h.VerifyTOTP)
+	protected.Post("/auth/totp/disable", h.DisableTOTP)
 
 	// Origins
 	protected.Get("/origins", h.GetOrigins)
 	protected.Post("/origins", h.CreateOrigin)
 	protected.Put("/origins/:id", h.UpdateOrigin)
 	protected.Delete("/origins/:id", h.DeleteOrigin)
+	protected.Get("/origins/:id/config", adminOnly, h.GetOriginConfig)
+	protected.Get("/origins/:id/config/qr", adminOnly, h.GetOriginConfigQR)
+	protected.Post("/origins/:id/drain", h.DrainOrigin)
+	protected.Get("/origins/:id/drain", h.GetOriginDrain)
+	protected.Delete("/origins/:id/drain", h.CancelOriginDrain)
 
 	// Firewall
 	protected.Post("/firewall/apply", h.ApplyFirewall)
+	protected.Post("/firewall/confirm", h.ConfirmFirewall)
+	protected.Get("/firewall/apply-status", h.GetFirewallApplyStatus)
+	protected.Get("/firewall/preview", adminOnly, h.PreviewFirewall)
 	protected.Get("/firewall/status", h.GetFirewallStatus)
+	protected.Get("/firewall/custom-rules", h.GetCustomRules)
+	protected.Post("/firewall/custom-rules", h.CreateCustomRule)
+	protected.Put("/firewall/custom-rules/:id", h.UpdateCustomRule)
+	protected.Delete("/firewall/custom-rules/:id", h.DeleteCustomRule)
+	protected.Get("/firewall/egress-policies", h.GetEgressPolicies)
+	protected.Post("/firewall/egress-policies", h.CreateEgressPolicy)
+	protected.Put("/firewall/egress-policies/:id", h.UpdateEgressPolicy)
+	protected.Delete("/firewall/egress-policies/:id", h.DeleteEgressPolicy)
 
 	// System Status
 	protected.Get("/status", h.GetSystemStatus)
 	protected.Get("/events", h.GetEvents)
+	protected.Get("/system/schema", h.GetSchemaVersion)
+	protected.Get("/system/capabilities", h.GetSystemCapabilities)
+	protected.Post("/system/reload", adminOnly, h.ReloadConfig)
 
 	// WireGuard
 	protected.Get("/wireguard/status", h.GetWireGuardStatus)
+	protected.Get("/wireguard/server-key", h.GetWireGuardServerKey)
+	protected.Post("/wireguard/rotate-key", h.RotateWireGuardServerKey)
+	protected.Post("/wireguard/rotate-server-key", h.RotateWireGuardServerKey)
 
 	// User Management
-	protected.Get("/users", h.GetUsers)
+	protected.Get("/users", adminOnly, h.GetUsers)
 	protected.Post("/users", h.CreateUser)
+	protected.Put("/users/:id/role", h.UpdateUserRole)
 	protected.Delete("/users/:id", h.DeleteUser)
 
+	// API Keys (automation access via X-API-Key)
+	protected.Get("/api-keys", adminOnly, h.GetAPIKeys)
+	protected.Post("/api-keys", h.CreateAPIKey)
+	protected.Delete("/api-keys/:id", h.RevokeAPIKey)
+
 	// Services
 	protected.Get("/services", h.GetServices)
-	api.Post("/services", h.CreateService)
-	api.Put("/services/:id", h.UpdateService)
-	api.Delete("/services/:id", h.DeleteService)
+	protected.Get("/services/stats", h.GetServiceStats)
+	protected.Post("/services", h.CreateService)
+	protected.Put("/services/:id", h.UpdateService)
+	protected.Delete("/services/:id", h.DeleteService)
+	protected.Post("/services/:id/test", h.TestService)
 
 	// Security Settings
 	protected.Get("/security/settings", h.GetSecuritySettings)
+	protected.Get("/security/summary", h.GetSecuritySummary)
 	protected.Put("/security/settings", h.UpdateSecuritySettings)
+	protected.Post("/security/impact", h.SimulateSecurityImpact)
+	protected.Post("/security/simulate-chain", h.SimulateGeoGuardChain)
+	protected.Get("/flood/thresholds", h.GetFloodThresholds)
+	protected.Get("/flood/queue", h.GetFloodQueueStats)
+	protected.Get("/flood/block-durations", h.GetBlockDurations)
+	protected.Put("/flood/block-durations", h.UpdateBlockDurations)
 
 	// IP Rules (Custom Whitelist/Blacklist)
 	protected.Get("/security/rules", h.GetIPRules)
@@ -287,23 +440,64 @@ func main() {
 	protected.Post("/security/rules/block", h.AddBanIP)
 	protected.Delete("/security/rules/block/:id", h.DeleteBanIP)
 	protected.Get("/security/check/:ip", h.CheckIPStatus)
+	protected.Get("/security/offenders", h.GetOffenders)
+	protected.Delete("/security/offenders", h.ClearOffenders)
+	protected.Get("/security/upstream-blocklist", h.ExportUpstreamBlocklist)
+	protected.Get("/security/consistency", h.GetSecurityConsistency)
+	protected.Post("/security/reconcile", h.ReconcileSecurityLayers)
+	protected.Get("/security/report", h.GetSecurityReport)
 	// IP Intelligence
 	protected.Get("/ip/info/:ip", h.GetIPInfo)
+	protected.Get("/ip/intelligence/cache", h.GetIPIntelligenceCache)
+	protected.Delete("/ip/intelligence/cache", h.ClearIPIntelligenceCache)
+	protected.Delete("/ip/intelligence/cache/:ip", h.ClearIPIntelligenceCache)
+	protected.Get("/ip/:ip/block-history", h.GetBlockHistory)
 
 	// Country Groups
 	protected.Get("/security/countries/groups", h.GetCountryGroups)
+	protected.Get("/security/countries/groups/:id/cidrs", h.GetCountryGroupCIDRs)
 	protected.Post("/security/countries/groups", h.CreateCountryGroup)
 	protected.Put("/security/countries/groups/:id", h.UpdateCountryGroup)
 	protected.Delete("/security/countries/groups/:id", h.DeleteCountryGroup)
+	// Geo schedules (time-based allowed countries)
+	protected.Get("/security/geo-schedules", h.GetGeoSchedules)
+	protected.Post("/security/geo-schedules", h.CreateGeoSchedule)
+	protected.Put("/security/geo-schedules/:id", h.UpdateGeoSchedule)
+	protected.Delete("/security/geo-schedules/:id", h.DeleteGeoSchedule)
+	// Country display names (traffic map)
+	protected.Get("/security/countries/names", h.GetCountryNames)
+	protected.Put("/security/countries/names/:code", h.SetCountryNameOverride)
+	protected.Delete("/security/countries/names/:code", h.DeleteCountryNameOverride)
+	// GeoIP
+	protected.Get("/geoip/effective", h.GetEffectiveGeoIP)
+	protected.Post("/geoip/import-maxmind-csv", h.ImportMaxMindCSV)
+	protected.Get("/geoip/feeds", h.GetGeoIPFeeds)
+	protected.Get("/geoip/status", h.GetGeoIPUpdateStatus)
+	protected.Get("/geoip/unknown-country", h.GetUnknownCountryStatus)
+	protected.Post("/geoip/check-update", h.CheckGeoIPUpdate)
 
 	// Traffic Data (eBPF)
 	protected.Get("/traffic/data", h.GetTrafficData)
+	protected.Get("/traffic/ws", h.StreamTraffic)
 	protected.Post("/traffic/reset", h.ResetTrafficStats)
 	protected.Get("/traffic/history", h.GetTrafficHistory)
 	protected.Get("/traffic/ports", h.GetPortStats)
+	protected.Get("/traffic/countries/seen", h.GetSeenCountries)
 	// Blocked IP Management
 	protected.Get("/traffic/blocked", h.GetBlockedIPList)
+	protected.Get("/traffic/connections", h.GetActiveConnections)
 	protected.Delete("/traffic/blocked", h.UnblockIP)
+	// Event Aggregator
+	protected.Get("/ebpf/aggregator", h.GetAggregatorStats)
+	protected.Post("/ebpf/benchmark", h.BenchmarkEBPFMap)
+	protected.Get("/ebpf/counters", h.GetEBPFCounters)
+	protected.Get("/ebpf/maps", adminOnly, h.GetBPFMaps)
+	protected.Get("/ebpf/maps/:name", adminOnly, h.DumpBPFMap)
+	protected.Get("/ebpf/sampling", h.GetIPStatsSampling)
+	protected.Get("/ebpf/rate-limit", h.GetXDPRateLimit)
+	protected.Put("/ebpf/rate-limit", h.UpdateXDPRateLimit)
+	protected.Get("/ebpf/capabilities", h.GetEBPFCapabilities)
+	protected.Get("/ebpf/tc-status", h.GetTCStatus)
 
 	// Diagnostics / Tools
 	protected.Post("/tools/ping", h.RunPing)
@@ -313,6 +507,13 @@ func main() {
 	// Attack History
 	protected.Get("/attacks", h.GetAttackHistory)
 	protected.Get("/attacks/stats", h.GetAttackStats)
+	protected.Get("/attacks/stream", h.StreamAttacks)
+	protected.Patch("/attacks/:id", h.UpdateAttackEvent)
+	protected.Get("/attacks/:id/captures", h.GetAttackCaptures)
+	protected.Get("/threats/current", h.GetCurrentThreats)
+
+	// Logs
+	protected.Get("/logs/stream", h.StreamLogs)
 
 	// Attack Signatures
 	protected.Get("/signatures", h.GetSignatures)
@@ -320,13 +521,18 @@ func main() {
 	protected.Put("/signatures/:id", h.UpdateSignature)
 	protected.Delete("/signatures/:id", h.DeleteSignature)
 	protected.Post("/signatures/reset-stats", h.ResetSignatureStats)
+	protected.Post("/signatures/:id/test-against-capture", h.TestSignatureAgainstCapture)
 
 	// Webhook
 	protected.Post("/webhook/test", h.TestWebhook)
 
 	// Backup & Restore
-	protected.Get("/backup/export", h.ExportConfig)
+	protected.Get("/backup/export", adminOnly, h.ExportConfig)
 	protected.Post("/backup/import", h.ImportConfig)
+	protected.Post("/reports/incident", adminOnly, h.CreateIncidentReport)
+
+	// Audit Log
+	protected.Get("/audit", adminOnly, h.GetAuditLog)
 
 	// Server Info (Public IP, etc.)
 	protected.Get("/server/info", h.GetServerInfo)
@@ -342,20 +548,72 @@ func main() {
 		frontendPath = "/opt/kg-proxy/frontend"
 	}
 
+	// Cache time for unhashed files (favicon, public/), KG_STATIC_MAX_AGE in seconds
+	staticMaxAge := 3600
+	if v := os.Getenv("KG_STATIC_MAX_AGE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			staticMaxAge = n
+		} else {
+			system.Warn("Invalid KG_STATIC_MAX_AGE %q, using %ds", v, staticMaxAge)
+		}
+	}
+	// index.html must be revalidated so a new deploy's asset hashes are picked up
+	noCache := func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+		return nil
+	}
+
+	// Vite fingerprints everything under /assets, so those files never change in place
+	app.Static("/assets", filepath.Join(frontendPath, "assets"), fiber.Static{
+		ByteRange: true,
+		MaxAge:    365 * 24 * 3600,
+		ModifyResponse: func(c *fiber.Ctx) error {
+			c.Set(fiber.HeaderCacheControl, "public, max-age=31536000, immutable")
+			return nil
+		},
+	})
 	app.Static("/", frontendPath, fiber.Static{
 		ByteRange: true,
 		Browse:    false,
-		MaxAge:    3600, // Cache for 1 hour to reduce reload strain
+		MaxAge:    staticMaxAge,
+		ModifyResponse: func(c *fiber.Ctx) error {
+			if c.Path() == "/" || strings.HasSuffix(c.Path(), ".html") {
+				return noCache(c)
+			}
+			return nil
+		},
 	})
 
 	// 6. SPA Fallback: Serve index.html for all other routes
 	app.Get("/*", func(c *fiber.Ctx) error {
+		noCache(c)
 		return c.SendFile(filepath.Join(frontendPath, "index.html"))
 	})
 
+	// Optional HTTPS for the management interface: a Let's Encrypt certificate for
+	// TLSAutocertDomain, or the configured files (falls back to HTTP if they can't load)
+	var tlsConfig *tls.Config
+	var acmeManager *autocert.Manager
+	if settings.TLSEnabled && settings.TLSAutocertDomain != "" {
+		acmeManager = system.NewAutocertManager(settings.TLSAutocertDomain, settings.TLSAutocertEmail, filepath.Join(dataDir, "autocert"))
+		tlsConfig = system.AutocertTLSConfig(acmeManager)
+		system.Info("HTTPS certificate for %s is obtained from Let's Encrypt", settings.TLSAutocertDomain)
+	} else if settings.TLSEnabled {
+		certReloader, err := system.NewCertReloader(settings.TLSCertFile, settings.TLSKeyFile)
+		if err != nil {
+			system.Error("HTTPS disabled, serving plain HTTP: %v", err)
+		} else {
+			tlsConfig = certReloader.TLSConfig()
+		}
+	}
+
 	// Start
-	system.Info("Server starting on :8080 (Mode: %s)", executor.GetOS())
-	log.Println("Server starting on :8080 (Mode: " + executor.GetOS() + ")")
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+	system.Info("Server starting on %s://%s (Mode: %s)", scheme, listenAddr, executor.GetOS())
+	log.Println("Server starting on " + scheme + "://" + listenAddr + " (Mode: " + executor.GetOS() + ")")
 
 	// Send Startup Alert
 	go func() {
@@ -393,7 +651,22 @@ func main() {
 		_ = app.Shutdown()
 	}()
 
-	if err := app.Listen(":8080"); err != nil {
+	if tlsConfig != nil {
+		// Let's Encrypt validates the domain over port 80, so autocert needs the listener too
+		if settings.TLSRedirectHTTP || acmeManager != nil {
+			system.StartHTTPSRedirect(net.JoinHostPort(system.GetListenHost(), "80"), system.GetListenPort(), acmeManager)
+		}
+		ln, err := tls.Listen("tcp", listenAddr, tlsConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := app.Listener(ln); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if err := app.Listen(listenAddr); err != nil {
 		log.Fatal(err)
 	}
 }
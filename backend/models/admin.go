@@ -7,11 +7,16 @@ import (
 type Admin struct {
 	ID                uint       `gorm:"primaryKey" json:"id"`
 	Username          string     `gorm:"unique;not null" json:"username"`
-	Password          string     `gorm:"not null" json:"-"` // Stored hashed
+	Password          string     `gorm:"not null" json:"-"`           // Stored hashed
+	Role              string     `gorm:"default:'admin'" json:"role"` // "admin" (full control) or "viewer" (read-only)
 	CreatedAt         time.Time  `json:"created_at"`
 	FailedAttempts    int        `gorm:"default:0" json:"-"`
 	LastFailedAttempt *time.Time `json:"-"`
 	LockedUntil       *time.Time `json:"-"`
+	TOTPSecret        string     `json:"-"`                                 // Encrypted at rest (data dir totp.key)
+	TOTPEnabled       bool       `gorm:"default:false" json:"totp_enabled"` // Login requires a TOTP code
+	LastSeenAt        *time.Time `json:"last_seen_at"`                      // Most recent successful login
+	PreviousSeenAt    *time.Time `json:"previous_seen_at"`                  // Login before that: the "since last login" cutoff
 }
 
 // SecuritySettings for Policy/Firewall configuration
@@ -21,33 +26,74 @@ type SecuritySettings struct {
 	BlockVPN                  bool       `gorm:"default:false" json:"block_vpn"`
 	BlockTOR                  bool       `gorm:"default:false" json:"block_tor"`
 	SYNCookies                bool       `gorm:"default:true" json:"syn_cookies"`
-	ProtectionLevel           int        `gorm:"default:2" json:"protection_level"`       // 0=low, 1=standard, 2=high
-	GeoAllowCountries         string     `gorm:"default:'KR'" json:"geo_allow_countries"` // Comma-separated country codes
+	ProtectionLevel           int        `gorm:"default:2" json:"protection_level"`             // 0=low, 1=standard, 2=high
+	GeoAllowCountries         string     `gorm:"default:'KR'" json:"geo_allow_countries"`       // Comma-separated country codes
+	UnknownCountryPolicy      string     `gorm:"default:'block'" json:"unknown_country_policy"` // "block", "allow" or "allow_if_whitelisted" for sources GeoIP places in no country (XX)
+	GeoMode                   string     `gorm:"default:'allow'" json:"geo_mode"`               // "allow" (only GeoAllowCountries pass) or "block" (all pass except GeoBlockCountries)
+	GeoBlockCountries         string     `json:"geo_block_countries"`                           // Comma-separated country codes dropped in block mode
 	SmartBanning              bool       `gorm:"default:false" json:"smart_banning"`
-	SteamQueryBypass          bool       `gorm:"default:true" json:"steam_query_bypass"` // Allow Steam A2S queries globally
+	SteamQueryBypass          bool       `gorm:"default:true" json:"steam_query_bypass"`    // Allow Steam A2S queries globally
+	SteamQueryPorts           string     `json:"steam_query_ports"`                         // Comma-separated ports the bypass applies to (empty = all UDP)
+	SteamQueryScope           string     `gorm:"default:'global'" json:"steam_query_scope"` // "global" (all UDP / steam_query_ports) or "services" (ports flagged is_query_port)
 	EBPFEnabled               bool       `gorm:"default:false" json:"ebpf_enabled"`
 	TrafficStatsResetInterval int        `gorm:"default:0" json:"traffic_stats_reset_interval"` // Hours, 0=disabled
 	LastTrafficStatsReset     *time.Time `json:"last_traffic_stats_reset"`
-	MaxMindLicenseKey         string     `json:"maxmind_license_key,omitempty"` // MaxMind GeoLite2 license key
+	MaxMindLicenseKey         string     `json:"maxmind_license_key,omitempty"`                  // MaxMind GeoLite2 license key
+	CountryCIDRSource         string     `gorm:"default:'ipverse'" json:"country_cidr_source"`   // "ipverse" or "maxmind_csv" (needs license key)
+	GeoIPUpdateIntervalHours  int        `gorm:"default:168" json:"geoip_update_interval_hours"` // How often the GeoLite2 refresh runs
+	GeoIPMaxAgeHours          int        `gorm:"default:168" json:"geoip_max_age_hours"`         // Local build age before MaxMind is checked for a newer one
+
+	// Management HTTPS (applied on restart; served on KG_LISTEN_ADDR)
+	TLSEnabled        bool   `gorm:"default:false" json:"tls_enabled"`
+	TLSCertFile       string `json:"tls_cert_file"`                         // PEM certificate (full chain)
+	TLSKeyFile        string `json:"tls_key_file"`                          // PEM private key
+	TLSRedirectHTTP   bool   `gorm:"default:true" json:"tls_redirect_http"` // Redirect port 80 to HTTPS
+	TLSAutocertDomain string `json:"tls_autocert_domain"`                   // Let's Encrypt certificate for this domain instead of the files (needs port 80)
+	TLSAutocertEmail  string `json:"tls_autocert_email"`                    // Optional ACME account contact
+
+	// Login lockout
+	LoginMaxAttempts     int `gorm:"default:5" json:"login_max_attempts"`       // Failed logins before an account is locked
+	LoginLockoutMinutes  int `gorm:"default:5" json:"login_lockout_minutes"`    // How long a locked account stays locked
+	LoginIPMaxFailures   int `gorm:"default:20" json:"login_ip_max_failures"`   // Failed logins from one IP (any user) before it gets 429
+	LoginIPWindowSeconds int `gorm:"default:60" json:"login_ip_window_seconds"` // Sliding window for LoginIPMaxFailures
+
+	// WireGuard client config
+	WGClientDNS             string `gorm:"default:'168.126.63.1'" json:"wg_client_dns"` // DNS line of generated origin configs (comma-separated, empty = none)
+	WGHandshakeAlertMinutes int    `gorm:"default:5" json:"wg_handshake_alert_minutes"` // Alert when an origin's last handshake is older (0 = off)
+
+	// Network Interface
+	WANInterface         string `json:"wan_interface"`                    // Explicit WAN interface (empty = auto-detect)
+	AdditionalInterfaces string `json:"additional_interfaces"`            // Comma-separated extra public interfaces to protect
+	EnableIPv6           bool   `gorm:"default:false" json:"enable_ipv6"` // Also filter IPv6 (ip6tables, ban6/white_list6 ipsets)
 
 	// XDP Advanced Settings
-	XDPHardBlocking bool `gorm:"default:false" json:"xdp_hard_blocking"` // Drop packets at XDP level instead of passing to iptables
-	XDPRateLimitPPS int  `gorm:"default:0" json:"xdp_rate_limit_pps"`    // Per-IP PPS limit, 0=disabled
+	XDPHardBlocking   bool `gorm:"default:false" json:"xdp_hard_blocking"` // Drop packets at XDP level instead of passing to iptables
+	XDPRateLimitPPS   int  `gorm:"default:0" json:"xdp_rate_limit_pps"`    // Per-IP PPS limit, 0=disabled
+	XDPRateLimitBurst int  `gorm:"default:0" json:"xdp_rate_limit_burst"`  // Per-IP token bucket size (packets), 0 = same as the PPS limit
 
 	// Discord Webhook Notifications
-	DiscordWebhookURL string `json:"discord_webhook_url,omitempty"`
-	AlertOnAttack     bool   `gorm:"default:true" json:"alert_on_attack"` // Send alert when attack detected
-	AlertOnBlock      bool   `gorm:"default:false" json:"alert_on_block"` // Send alert when IP blocked
+	DiscordWebhookURL  string `json:"discord_webhook_url,omitempty"`
+	AlertOnAttack      bool   `gorm:"default:true" json:"alert_on_attack"`    // Send alert when attack detected
+	AlertOnBlock       bool   `gorm:"default:false" json:"alert_on_block"`    // Send alert when IP blocked
+	NewCountryAlert    bool   `gorm:"default:false" json:"new_country_alert"` // Alert when traffic arrives from a never-seen country
+	CountrySpikeFactor int    `gorm:"default:0" json:"country_spike_factor"`  // Alert when a non-allowed country exceeds N x its usual PPS, 0 = off
 
 	// IP Intelligence (VPN/Proxy Detection)
-	IPIntelligenceEnabled bool   `gorm:"default:false" json:"ip_intelligence_enabled"`
-	IPIntelligenceAPIKey  string `json:"ip_intelligence_api_key,omitempty"` // IPinfo.io API key
+	IPIntelligenceEnabled    bool   `gorm:"default:false" json:"ip_intelligence_enabled"`
+	IPIntelligenceProvider   string `gorm:"default:'ipinfo'" json:"ip_intelligence_provider"` // "ipinfo", "abuseipdb", "ipqualityscore" or "proxycheck"
+	IPIntelligenceAPIKey     string `json:"ip_intelligence_api_key,omitempty"`                // API key of the selected provider
+	AbuseScoreBlockThreshold int    `gorm:"default:0" json:"abuse_score_block_threshold"`     // Auto-ban top talkers scoring >= this (1-100), 0 = off
 
 	// Data Retention
 	AttackHistoryDays int `gorm:"default:30" json:"attack_history_days"` // Days to keep attack history
 
 	// Maintenance Mode (Temporarily disable all blocking)
-	MaintenanceUntil *time.Time `json:"maintenance_until,omitempty"` // If set and not expired, all blocking is disabled
+	MaintenanceUntil          *time.Time `json:"maintenance_until,omitempty"`                   // If set and not expired, all blocking is disabled
+	ProtectionReminderMinutes int        `gorm:"default:60" json:"protection_reminder_minutes"` // Grace period before webhook reminders while protection is disabled or in maintenance; cadence then escalates (0 = off)
+
+	// Fingerprint of a ruleset whose confirmed apply was rolled back; automatic applies keep the
+	// previous rules instead of restoring it (see services/firewall_confirm.go)
+	RevertedRulesHash string `json:"-"`
 
 	// === NEW FEATURE FLAGS (v1.15.0) ===
 	// Block Map TTL: Auto-expire rate-limited IPs
@@ -62,5 +108,57 @@ type SecuritySettings struct {
 	// Packet Validation: Drop invalid packets at XDP level
 	EnablePacketValidation bool `gorm:"default:false" json:"enable_packet_validation"`
 
+	// Dangerous Ports (comma-separated, dropped in mangle PREROUTING)
+	BlockedDestPorts             string `gorm:"default:'1433,1521,3306,5432'" json:"blocked_dest_ports"`     // Database ports never exposed publicly
+	BlockedReflectionSourcePorts string `gorm:"default:'1900,11211'" json:"blocked_reflection_source_ports"` // UDP amplification sources
+
+	// Event Aggregation
+	EventBatchSeconds      int `gorm:"default:3" json:"event_batch_seconds"`           // eBPF attack event batch window
+	EventQueueSize         int `gorm:"default:10000" json:"event_queue_size"`          // Ring buffer -> aggregator queue (applies on next eBPF load)
+	EventAggregatorMaxKeys int `gorm:"default:50000" json:"event_aggregator_max_keys"` // Unique IPs per batch before events are dropped
+	GeoResolveWorkers      int `gorm:"default:2" json:"geo_resolve_workers"`           // Goroutines resolving flood event countries (1-16)
+	AttackEventsPerIPCap   int `gorm:"default:500" json:"attack_events_per_ip_cap"`    // Stored events per IP in the 7-day retention; more are merged into its newest (0 = unlimited)
+
+	// Packet Capture: auto-capture the top source of a large attack, retention per trigger (0 = keep forever)
+	PCAPAutoCapture         bool `gorm:"default:false" json:"pcap_auto_capture"`
+	PCAPAutoCaptureMinPPS   int  `gorm:"default:50000" json:"pcap_auto_capture_min_pps"` // Attack event PPS that starts an auto-capture
+	PCAPAutoCaptureSeconds  int  `gorm:"default:30" json:"pcap_auto_capture_seconds"`
+	PCAPManualRetentionDays int  `gorm:"default:0" json:"pcap_manual_retention_days"` // Manual captures are evidence; kept unless set
+	PCAPAutoRetentionDays   int  `gorm:"default:30" json:"pcap_auto_retention_days"`
+
+	// Per-IP Stats Sampling (traffic table): keep only the top-K talkers, poll interval backs off under large attacks
+	IPStatsTopK        int `gorm:"default:1000" json:"ip_stats_top_k"`
+	IPStatsPollSeconds int `gorm:"default:5" json:"ip_stats_poll_seconds"`
+
+	// Flood Warmup: grace period before a new IP can be blocked (-1 = level default, 0 = none)
+	// and minimum samples (0 = level default)
+	FloodGraceSecLow        int `gorm:"default:-1" json:"flood_grace_sec_low"`
+	FloodGraceSecStandard   int `gorm:"default:-1" json:"flood_grace_sec_standard"`
+	FloodGraceSecHigh       int `gorm:"default:-1" json:"flood_grace_sec_high"`
+	FloodMinSamplesLow      int `gorm:"default:0" json:"flood_min_samples_low"`
+	FloodMinSamplesStandard int `gorm:"default:0" json:"flood_min_samples_standard"`
+	FloodMinSamplesHigh     int `gorm:"default:0" json:"flood_min_samples_high"`
+
+	// Block Durations per reason in seconds (0 = protection level duration; manual 0 = permanent)
+	BlockDurationManualSec    int `gorm:"default:0" json:"block_duration_manual_sec"`
+	BlockDurationRateLimitSec int `gorm:"default:0" json:"block_duration_rate_limit_sec"`
+	BlockDurationGeoIPSec     int `gorm:"default:0" json:"block_duration_geoip_sec"`
+	BlockDurationFloodSec     int `gorm:"default:0" json:"block_duration_flood_sec"`
+
+	// Repeat Offender Promotion: Permanently ban IPs auto-blocked more than N times
+	AutoPromoteThreshold   int `gorm:"default:0" json:"auto_promote_threshold"`     // 0=disabled
+	AutoPromoteWindowHours int `gorm:"default:24" json:"auto_promote_window_hours"` // Window for counting blocks
+	// Recurrence Promotion: Permanently ban IPs auto-blocked on N separate occasions over several days
+	RecurrencePromoteThreshold int `gorm:"default:0" json:"recurrence_promote_threshold"` // 0=disabled
+	RecurrencePromoteDays      int `gorm:"default:7" json:"recurrence_promote_days"`      // Lookback in days
+	// Internal Traffic: skip private ranges and the WireGuard subnet in flood tracking and attack events
+	ExcludeInternalTraffic bool   `gorm:"default:true" json:"exclude_internal_traffic"`
+	InternalExcludeCIDRs   string `json:"internal_exclude_cidrs"` // Extra comma-separated CIDRs treated as internal
+	// Origin Egress Filtering: restrict new outbound connections from origins to EgressPolicy entries
+	EgressFilterEnabled bool   `gorm:"default:false" json:"egress_filter_enabled"`
+	EgressFilterMode    string `gorm:"default:'drop'" json:"egress_filter_mode"` // "drop" or "log" (log only, allow everything)
+	// Public Status Badge: unauthenticated GET /api/public/status with aggregate numbers only
+	PublicStatusEnabled bool `gorm:"default:false" json:"public_status_enabled"`
+
 	UpdatedAt time.Time `json:"updated_at"`
 }
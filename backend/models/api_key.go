@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// APIKey lets automation scripts authenticate with an X-API-Key header instead of a login session.
+// Only a SHA-256 hash of the key is stored; the key itself is shown once at creation.
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Name       string     `gorm:"not null" json:"name"`
+	KeyHash    string     `gorm:"uniqueIndex;not null" json:"-"`
+	Prefix     string     `json:"prefix"`                      // Leading characters of the key, to tell keys apart
+	Scope      string     `gorm:"default:'read'" json:"scope"` // "read" (viewer rights) or "full" (admin rights)
+	CreatedBy  string     `json:"created_by"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"` // nil = never expires
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
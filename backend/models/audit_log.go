@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// AuditLog records one state-changing API request, so changes made by operators sharing
+// the panel can be traced back to an account. Request bodies are never stored.
+type AuditLog struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Timestamp time.Time `gorm:"index" json:"timestamp"`
+	Username  string    `gorm:"index" json:"username"` // JWT user, or "apikey:<name>"
+	Role      string    `json:"role"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"` // HTTP status of the response
+	Summary   string    `json:"summary"`
+	IP        string    `json:"ip"`
+}
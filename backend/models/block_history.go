@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// BlockHistory records every block/unblock decision for an IP.
+// Unlike XDP map entries, these rows survive expiry so automated decisions stay accountable.
+type BlockHistory struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	Timestamp     time.Time  `gorm:"index" json:"timestamp"`
+	IP            string     `gorm:"index;not null" json:"ip"`
+	Action        string     `json:"action"`                    // "blocked", "unblocked"
+	Reason        string     `json:"reason"`                    // "manual", "flood", "geoip", "rate_limit", "repeat_offender"
+	Source        string     `json:"source"`                    // "manual", "ebpf", "flood", "auto_promote"
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`      // nil = permanent or unknown
+	AttackEventID *uint      `json:"attack_event_id,omitempty"` // Triggering AttackEvent, if any
+	Details       string     `json:"details"`
+}
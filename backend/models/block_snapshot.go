@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// BlockSnapshot holds an XDP blocklist entry saved before the eBPF program is detached.
+// Pinned maps are removed on detach, so these rows are replayed into blocked_ips on the next load.
+type BlockSnapshot struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	IP        string    `gorm:"uniqueIndex;not null" json:"ip"`
+	Reason    uint32    `json:"reason"`     // block_entry reason code (1=manual, 2=rate_limit, 3=geoip, 4=flood)
+	ExpiresAt time.Time `json:"expires_at"` // Zero = permanent
+	CreatedAt time.Time `json:"created_at"`
+}
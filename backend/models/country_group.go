@@ -12,3 +12,11 @@ type CountryGroup struct {
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
+
+// CountryNameOverride replaces the built-in display name of a country on the traffic map
+type CountryNameOverride struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Code      string    `gorm:"uniqueIndex;size:2;not null" json:"code"` // ISO 3166-1 alpha-2
+	Name      string    `gorm:"not null" json:"name"`                    // Must match the map GeoJSON name to be highlighted
+	UpdatedAt time.Time `json:"updated_at"`
+}
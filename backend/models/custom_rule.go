@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// CustomRule is an operator-supplied iptables rule spliced into the generated ruleset
+type CustomRule struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Table       string    `gorm:"column:rule_table;not null" json:"table"`      // raw, mangle, nat, filter
+	Chain       string    `gorm:"not null" json:"chain"`                        // e.g. PREROUTING, GEO_GUARD, INPUT
+	Rule        string    `gorm:"not null" json:"rule"`                         // Rule spec without "-A <chain>", e.g. "-s 1.2.3.4 -p udp --dport 7777 -j RETURN"
+	Description string    `json:"description"`                                  // Why this rule exists
+	Enabled     bool      `json:"enabled"`                                      // Disabled rules are kept but not applied
+	Order       int       `gorm:"column:position;default:0;index" json:"order"` // Lower first within the same chain
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// EgressPolicy allows origins to open outbound connections to a destination while egress filtering is on.
+// With filtering enabled, new connections from the WireGuard subnet that match no policy are dropped (or only logged).
+type EgressPolicy struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	OriginID    uint      `gorm:"default:0;index" json:"origin_id"` // 0 = applies to every origin
+	Destination string    `json:"destination"`                      // IP or CIDR; empty = any destination
+	Protocol    string    `gorm:"default:'any'" json:"protocol"`    // tcp, udp, icmp or any
+	Ports       string    `json:"ports"`                            // Destination ports, e.g. "443,27015:27030"; empty = all
+	Description string    `json:"description"`                      // e.g. "Steam Workshop", "Game API"
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// FloodBlock is an active FloodProtection block, persisted so it is reloaded after a restart.
+// Rows are removed when the block expires or the IP is unblocked.
+type FloodBlock struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	IP           string    `gorm:"uniqueIndex;not null" json:"ip"`
+	AttackType   string    `json:"attack_type"` // "Connection Flood", "PPS Flood", "Bandwidth Flood"
+	BlockedUntil time.Time `gorm:"index" json:"blocked_until"`
+	CreatedAt    time.Time `json:"created_at"`
+}
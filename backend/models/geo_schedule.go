@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// GeoSchedule changes the allowed countries during recurring time windows (server local time).
+// While a schedule is active its countries are added to GeoAllowCountries ("add") or replace them ("replace").
+type GeoSchedule struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"not null" json:"name"`
+	Days      string    `json:"days"`                        // Comma-separated weekdays "mon,tue,..."; empty = every day
+	StartHour int       `gorm:"default:0" json:"start_hour"` // 0-23, window start
+	EndHour   int       `gorm:"default:24" json:"end_hour"`  // 1-24, window end (exclusive); <= start wraps past midnight
+	Countries string    `gorm:"type:text" json:"countries"`  // Comma-separated ISO codes
+	Mode      string    `gorm:"default:'add'" json:"mode"`   // "add" or "replace"
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
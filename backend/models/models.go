@@ -5,13 +5,16 @@ import (
 )
 
 type Origin struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	Name      string         `gorm:"unique;not null" json:"name"`
-	WgIP      string         `gorm:"not null" json:"wg_ip"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	Services  []Service      `gorm:"foreignKey:OriginID" json:"services,omitempty"`
-	Peer      *WireGuardPeer `gorm:"foreignKey:OriginID" json:"peer,omitempty"`
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"unique;not null" json:"name"`
+	WgIP      string    `gorm:"not null" json:"wg_ip"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Connection draining: no new connections are forwarded; the peer is removed at DrainUntil
+	DrainState string         `gorm:"default:''" json:"drain_state"` // "", draining, drained
+	DrainUntil *time.Time     `json:"drain_until,omitempty"`
+	Services   []Service      `gorm:"foreignKey:OriginID" json:"services,omitempty"`
+	Peer       *WireGuardPeer `gorm:"foreignKey:OriginID" json:"peer,omitempty"`
 }
 
 type Service struct {
@@ -34,6 +37,8 @@ type ServicePort struct {
 	PublicPortEnd  int `gorm:"default:0" json:"public_port_end"`
 	PrivatePort    int `gorm:"not null" json:"private_port"`
 	PrivatePortEnd int `gorm:"default:0" json:"private_port_end"`
+	// Steam A2S query port: scopes the Steam query bypass when SteamQueryScope is "services"
+	IsQueryPort bool `gorm:"default:false" json:"is_query_port"`
 }
 
 type AllowForeign struct {
@@ -49,6 +54,7 @@ type BanIP struct {
 	IP        string     `gorm:"unique;not null" json:"ip"`
 	Reason    string     `json:"reason"`
 	IsAuto    bool       `gorm:"default:false" json:"is_auto"`
+	Upstream  bool       `gorm:"default:false" json:"upstream"` // Included in the upstream block list export
 	ExpiresAt *time.Time `json:"expires_at"`
 	CreatedAt time.Time  `json:"created_at"`
 }
@@ -66,6 +72,7 @@ type WireGuardPeer struct {
 	OriginID      uint       `gorm:"unique;not null" json:"origin_id"`
 	PublicKey     string     `gorm:"unique;not null" json:"public_key"`
 	PrivateKey    string     `gorm:"not null" json:"-"` // Never expose private key JSON
+	PresharedKey  string     `json:"-"`                 // Optional symmetric key mixed into the handshake; empty = none
 	LastHandshake *time.Time `json:"last_handshake"`
 	RxBytes       int64      `gorm:"default:0" json:"rx_bytes"`
 	TxBytes       int64      `gorm:"default:0" json:"tx_bytes"`
@@ -76,6 +83,7 @@ type WireGuardPeer struct {
 type SystemConfig struct {
 	AllowKREnabled  bool        `json:"allow_kr_enabled"`
 	FloodProtection FloodConfig `json:"flood_protection"`
+	WGSubnet        string      `json:"wg_subnet"` // WireGuard origin pool, e.g. "10.200.0.0/23"; empty = 10.200.0.0/24
 }
 
 type FloodConfig struct {
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// SchemaMigration records each schema change applied at startup.
+// The highest Version is the current schema; Fingerprint identifies the model set it was migrated to.
+type SchemaMigration struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Version     int       `gorm:"uniqueIndex;not null" json:"version"`
+	Fingerprint string    `gorm:"not null" json:"fingerprint"`
+	Tables      int       `json:"tables"`
+	BackupPath  string    `json:"backup_path"` // DB copy taken before migrating (empty for a fresh database)
+	DurationMs  int64     `json:"duration_ms"`
+	AppliedAt   time.Time `json:"applied_at"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// SeenCountry is a source country observed in traffic. The set persists so a restart
+// doesn't re-announce every country as new.
+type SeenCountry struct {
+	CountryCode string    `gorm:"primaryKey;size:2" json:"country_code"`
+	FirstIP     string    `json:"first_ip"` // Source IP that first brought the country in
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+}
@@ -36,6 +36,19 @@ type AttackEvent struct {
 	Duration    int       `json:"duration"`    // Attack duration in seconds (if known)
 	Action      string    `json:"action"`      // "blocked", "rate_limited", "warned"
 	Details     string    `json:"details"`     // Additional details (JSON or text)
+
+	// Per-IP event cap: later events of this IP merged into this row
+	Collapsed int64      `gorm:"default:0" json:"collapsed"` // Number of merged events
+	LastSeen  *time.Time `json:"last_seen,omitempty"`        // Newest merged event
+
+	// Packet sample auto-captured for this event (file under /api/pcap/files, cleared when pruned)
+	CaptureFile string `json:"capture_file,omitempty"`
+
+	// Operator annotations
+	Label      string     `gorm:"index" json:"label"`     // Campaign / classification tag, e.g. "false_positive"
+	Notes      string     `gorm:"type:text" json:"notes"` // Free-form investigation notes
+	Reviewed   bool       `gorm:"index;default:false" json:"reviewed"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
 }
 
 // AttackStats provides aggregated attack statistics
@@ -47,4 +60,6 @@ type AttackStats struct {
 	TopCountry    string `json:"top_country"`
 	TopAttackerIP string `json:"top_attacker_ip"`
 	TotalBlocked  int64  `json:"total_blocked"`
+
+	CollapsedEvents int64 `json:"collapsed_events"` // Events merged into existing rows by the per-IP cap
 }
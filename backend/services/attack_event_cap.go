@@ -0,0 +1,141 @@
+package services
+
+import (
+	"kg-proxy-web-gui/backend/models"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AttackEventRetention is how long attack events are kept
+const AttackEventRetention = 7 * 24 * time.Hour
+
+// attackEventIPChunk bounds the source IPs per IN (...) query
+const attackEventIPChunk = 500
+
+// attackEventCap is the number of events stored per source IP within AttackEventRetention
+// (0 = unlimited). Further events are merged into the newest stored event of that IP.
+var attackEventCap atomic.Int64
+
+// SetAttackEventCap sets the per-IP event cap used by the flood and eBPF event writers
+func SetAttackEventCap(perIP int) {
+	if perIP < 0 {
+		perIP = 0
+	}
+	attackEventCap.Store(int64(perIP))
+}
+
+// storeAttackEvents saves a batch of attack events and lets auto-capture sample the biggest one
+func storeAttackEvents(db *gorm.DB, batch []models.AttackEvent, batchSize int) error {
+	if err := insertAttackEvents(db, batch, batchSize); err != nil {
+		return err
+	}
+	autoCaptureAttack(db, batch)
+	return nil
+}
+
+// insertAttackEvents stores a batch of attack events. Events of an IP that already has the
+// capped number of stored events are merged into its newest event instead of inserted: the
+// count and collapsed counter grow, PPS keeps the peak, LastSeen moves forward. Afterwards
+// every event's ID is the row it was stored in or merged into.
+func insertAttackEvents(db *gorm.DB, batch []models.AttackEvent, batchSize int) error {
+	limit := attackEventCap.Load()
+	if limit <= 0 || len(batch) == 0 {
+		return db.CreateInBatches(batch, batchSize).Error
+	}
+
+	cutoff := time.Now().Add(-AttackEventRetention)
+	stored := storedAttackEventCounts(db, batch, cutoff)
+
+	var insert []models.AttackEvent
+	var insertIdx []int
+	overflow := make(map[string][]int)
+	for i := range batch {
+		ip := batch[i].SourceIP
+		if stored[ip] < limit {
+			stored[ip]++
+			insert = append(insert, batch[i])
+			insertIdx = append(insertIdx, i)
+			continue
+		}
+		overflow[ip] = append(overflow[ip], i)
+	}
+
+	if len(insert) > 0 {
+		if err := db.CreateInBatches(insert, batchSize).Error; err != nil {
+			return err
+		}
+		for j, i := range insertIdx {
+			batch[i].ID = insert[j].ID
+		}
+	}
+	for ip, idxs := range overflow {
+		mergeAttackEvents(db, ip, batch, idxs, cutoff)
+	}
+	return nil
+}
+
+// storedAttackEventCounts counts the stored events since cutoff per source IP of the batch
+func storedAttackEventCounts(db *gorm.DB, batch []models.AttackEvent, cutoff time.Time) map[string]int64 {
+	seen := make(map[string]bool)
+	var ips []string
+	for i := range batch {
+		if !seen[batch[i].SourceIP] {
+			seen[batch[i].SourceIP] = true
+			ips = append(ips, batch[i].SourceIP)
+		}
+	}
+
+	counts := make(map[string]int64, len(ips))
+	for start := 0; start < len(ips); start += attackEventIPChunk {
+		end := start + attackEventIPChunk
+		if end > len(ips) {
+			end = len(ips)
+		}
+		var rows []struct {
+			SourceIP string
+			Count    int64
+		}
+		db.Model(&models.AttackEvent{}).
+			Select("source_ip, COUNT(*) as count").
+			Where("timestamp >= ? AND source_ip IN ?", cutoff, ips[start:end]).
+			Group("source_ip").
+			Scan(&rows)
+		for _, row := range rows {
+			counts[row.SourceIP] = row.Count
+		}
+	}
+	return counts
+}
+
+// mergeAttackEvents folds batch[idxs] into the newest stored event of ip
+func mergeAttackEvents(db *gorm.DB, ip string, batch []models.AttackEvent, idxs []int, cutoff time.Time) {
+	var target models.AttackEvent
+	if err := db.Where("source_ip = ? AND timestamp >= ?", ip, cutoff).Order("id DESC").First(&target).Error; err != nil {
+		return
+	}
+
+	var count, peakPPS int64
+	lastSeen := batch[idxs[0]].Timestamp
+	for _, i := range idxs {
+		count += batch[i].Count
+		if batch[i].PPS > peakPPS {
+			peakPPS = batch[i].PPS
+		}
+		if batch[i].Timestamp.After(lastSeen) {
+			lastSeen = batch[i].Timestamp
+		}
+		batch[i].ID = target.ID
+	}
+	if target.LastSeen != nil && target.LastSeen.After(lastSeen) {
+		lastSeen = *target.LastSeen
+	}
+
+	db.Model(&models.AttackEvent{}).Where("id = ?", target.ID).Updates(map[string]interface{}{
+		"count":     gorm.Expr("count + ?", count),
+		"collapsed": gorm.Expr("collapsed + ?", len(idxs)),
+		"pps":       gorm.Expr("MAX(pps, ?)", peakPPS),
+		"last_seen": lastSeen,
+	})
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"kg-proxy-web-gui/backend/models"
+	"sync"
+)
+
+// attackStreamBuffer is the per-subscriber queue size; slow clients drop events instead of stalling the pipeline
+const attackStreamBuffer = 256
+
+// attackBroadcaster fans out freshly detected attack events to live subscribers (SSE clients)
+type attackBroadcaster struct {
+	mu          sync.RWMutex
+	subscribers map[uint64]chan models.AttackEvent
+	nextID      uint64
+}
+
+var attackStream = &attackBroadcaster{
+	subscribers: make(map[uint64]chan models.AttackEvent),
+}
+
+// SubscribeAttacks registers a live attack event listener.
+// The returned cancel func must be called when the listener goes away; it closes the channel.
+func SubscribeAttacks() (<-chan models.AttackEvent, func()) {
+	ch := make(chan models.AttackEvent, attackStreamBuffer)
+
+	attackStream.mu.Lock()
+	attackStream.nextID++
+	id := attackStream.nextID
+	attackStream.subscribers[id] = ch
+	attackStream.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			attackStream.mu.Lock()
+			delete(attackStream.subscribers, id)
+			attackStream.mu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
+
+// PublishAttacks pushes events to every subscriber without blocking the caller
+func PublishAttacks(events []models.AttackEvent) {
+	attackStream.mu.RLock()
+	defer attackStream.mu.RUnlock()
+
+	if len(attackStream.subscribers) == 0 {
+		return
+	}
+	for _, ch := range attackStream.subscribers {
+		for i := range events {
+			select {
+			case ch <- events[i]:
+			default:
+				// Subscriber is behind; skip rather than block detection
+			}
+		}
+	}
+}
+
+// AttackStreamSubscribers returns the number of connected live listeners
+func AttackStreamSubscribers() int {
+	attackStream.mu.RLock()
+	defer attackStream.mu.RUnlock()
+	return len(attackStream.subscribers)
+}
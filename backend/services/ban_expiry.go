@@ -0,0 +1,67 @@
+package services
+
+import (
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"time"
+)
+
+// banExpiryInterval is how often expired bans are looked for
+const banExpiryInterval = time.Minute
+
+// StartBanExpiryWatcher removes bans whose ExpiresAt has passed, re-applies the firewall
+// and sends an auto-unban notification
+func (s *FirewallService) StartBanExpiryWatcher(webhook *WebhookService) {
+	go func() {
+		ticker := time.NewTicker(banExpiryInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if expired := s.ExpireBans(webhook); expired > 0 {
+				if err := s.ApplyRules(); err != nil {
+					system.Warn("Failed to re-apply firewall after ban expiry: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// ExpireBans deletes expired bans and returns how many were removed. The caller re-applies rules.
+func (s *FirewallService) ExpireBans(webhook *WebhookService) int {
+	var bans []models.BanIP
+	if err := s.DB.Where("expires_at IS NOT NULL AND expires_at <= ?", time.Now()).Find(&bans).Error; err != nil {
+		return 0
+	}
+
+	removed := 0
+	for _, ban := range bans {
+		if err := s.DB.Delete(&ban).Error; err != nil {
+			system.Warn("Failed to remove expired ban %s: %v", ban.IP, err)
+			continue
+		}
+		removed++
+
+		// Promoted or reconciled bans also live in the XDP blocklist
+		if s.EBPF != nil && s.EBPF.IsEnabled() {
+			if err := s.EBPF.UnblockCIDRs([]string{ban.IP}); err != nil {
+				system.Debug("Failed to remove expired ban %s from eBPF: %v", ban.IP, err)
+			}
+		}
+
+		system.Info("🔓 Ban expired: %s (%s)", ban.IP, ban.Reason)
+		LogBlockHistory(s.DB, models.BlockHistory{
+			IP:      ban.IP,
+			Action:  BlockActionUnblocked,
+			Reason:  "manual",
+			Source:  "expiry",
+			Details: "Ban expired (was: " + ban.Reason + ")",
+		})
+
+		if webhook != nil && webhook.IsEnabled() {
+			msg := fmt.Sprintf("**IP:** `%s`\n**Reason:** %s\n**Banned since:** %s", ban.IP, ban.Reason, ban.CreatedAt.Format("2006-01-02 15:04"))
+			go webhook.SendSystemAlert("🔓 Ban Expired", msg, ColorGreen)
+		}
+	}
+	return removed
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"time"
+)
+
+// Block reason codes stored in blocked_ips entries (block_entry.reason in xdp_filter.c)
+const (
+	BlockReasonManual    uint32 = 1
+	BlockReasonRateLimit uint32 = 2
+	BlockReasonGeoIP     uint32 = 3
+	BlockReasonFlood     uint32 = 4
+)
+
+// blockReasonNames maps reason codes to the names used in settings and block history
+var blockReasonNames = map[uint32]string{
+	BlockReasonManual:    "manual",
+	BlockReasonRateLimit: "rate_limit",
+	BlockReasonGeoIP:     "geoip",
+	BlockReasonFlood:     "flood",
+}
+
+// MaxBlockDuration caps configurable block durations (well under the ipset timeout limit of ~24 days)
+const MaxBlockDuration = 7 * 24 * time.Hour
+
+// BlockDuration is the effective duration of one block reason
+type BlockDuration struct {
+	Reason         string `json:"reason"`
+	Seconds        int    `json:"seconds"`         // 0 = permanent
+	DefaultSeconds int    `json:"default_seconds"` // Duration without an override at the current level
+	Customized     bool   `json:"customized"`
+}
+
+// ApplyBlockDurations loads the per-reason block duration overrides from security settings
+func (fp *FloodProtection) ApplyBlockDurations(settings *models.SecuritySettings) {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	fp.blockDurations[BlockReasonManual] = time.Duration(settings.BlockDurationManualSec) * time.Second
+	fp.blockDurations[BlockReasonRateLimit] = time.Duration(settings.BlockDurationRateLimitSec) * time.Second
+	fp.blockDurations[BlockReasonGeoIP] = time.Duration(settings.BlockDurationGeoIPSec) * time.Second
+	fp.blockDurations[BlockReasonFlood] = time.Duration(settings.BlockDurationFloodSec) * time.Second
+}
+
+// BlockDurationFor returns how long a block of the given reason lasts (0 = permanent)
+func (fp *FloodProtection) BlockDurationFor(reason uint32) time.Duration {
+	fp.mu.RLock()
+	defer fp.mu.RUnlock()
+	return fp.reasonDuration(reason)
+}
+
+// reasonDuration is BlockDurationFor without locking. Caller holds fp.mu.
+func (fp *FloodProtection) reasonDuration(reason uint32) time.Duration {
+	if reason < uint32(len(fp.blockDurations)) && fp.blockDurations[reason] > 0 {
+		return fp.blockDurations[reason]
+	}
+	return fp.defaultReasonDuration(reason)
+}
+
+// defaultReasonDuration is the duration used without an override: manual blocks are permanent,
+// automatic ones last the protection level's block duration
+func (fp *FloodProtection) defaultReasonDuration(reason uint32) time.Duration {
+	if reason == BlockReasonManual {
+		return 0
+	}
+	return fp.getThresholds().BlockDuration
+}
+
+// GetBlockDurations returns the effective duration of every block reason
+func (fp *FloodProtection) GetBlockDurations() []BlockDuration {
+	fp.mu.RLock()
+	defer fp.mu.RUnlock()
+
+	out := make([]BlockDuration, 0, len(blockReasonNames))
+	for _, reason := range []uint32{BlockReasonManual, BlockReasonRateLimit, BlockReasonGeoIP, BlockReasonFlood} {
+		out = append(out, BlockDuration{
+			Reason:         blockReasonNames[reason],
+			Seconds:        int(fp.reasonDuration(reason).Seconds()),
+			DefaultSeconds: int(fp.defaultReasonDuration(reason).Seconds()),
+			Customized:     fp.blockDurations[reason] > 0,
+		})
+	}
+	return out
+}
+
+// ValidateBlockDurationSec checks a configured duration in seconds (0 = default)
+func ValidateBlockDurationSec(reason string, seconds int) error {
+	if seconds < 0 || time.Duration(seconds)*time.Second > MaxBlockDuration {
+		return fmt.Errorf("%s block duration must be between 0 and %d seconds", reason, int(MaxBlockDuration.Seconds()))
+	}
+	return nil
+}
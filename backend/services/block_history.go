@@ -0,0 +1,59 @@
+package services
+
+import (
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Block history actions
+const (
+	BlockActionBlocked   = "blocked"
+	BlockActionUnblocked = "unblocked"
+)
+
+// LogBlockHistory persists a block/unblock decision. Failures are logged, never returned,
+// so history writes can't break the blocking path itself.
+func LogBlockHistory(db *gorm.DB, entry models.BlockHistory) {
+	if db == nil || entry.IP == "" {
+		return
+	}
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	if err := db.Create(&entry).Error; err != nil {
+		system.Warn("Failed to record block history for %s: %v", entry.IP, err)
+	}
+}
+
+// LogBlockHistoryBatch persists several entries in one insert (used by the event aggregators)
+func LogBlockHistoryBatch(db *gorm.DB, entries []models.BlockHistory) {
+	if db == nil || len(entries) == 0 {
+		return
+	}
+	now := time.Now()
+	for i := range entries {
+		if entries[i].Timestamp.IsZero() {
+			entries[i].Timestamp = now
+		}
+	}
+	if err := db.CreateInBatches(entries, 100).Error; err != nil {
+		system.Warn("Failed to record %d block history entries: %v", len(entries), err)
+	}
+}
+
+// blockHistoryReason maps AttackEvent attack types to BlockHistory reasons
+func blockHistoryReason(attackType string) string {
+	switch attackType {
+	case "geoip_violation":
+		return "geoip"
+	case "blacklist":
+		return "manual"
+	case "rate_limit", "flood":
+		return attackType
+	default:
+		return "flood" // FloodProtection types: "PPS Flood", "Connection Flood", ...
+	}
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"net"
+	"strings"
+)
+
+// ChainStep is one GEO_GUARD rule group evaluated for a simulated packet
+type ChainStep struct {
+	Step    string `json:"step"`
+	Matched bool   `json:"matched"`
+	Action  string `json:"action,omitempty"` // RETURN (continue to routing) or DROP when matched
+	Note    string `json:"note,omitempty"`
+}
+
+// ChainResult is the simulated GEO_GUARD outcome for one IP
+type ChainResult struct {
+	IP          string      `json:"ip"`
+	CountryCode string      `json:"country_code,omitempty"`
+	Decision    string      `json:"decision"`   // accept, drop or invalid
+	MatchedStep string      `json:"matched_by"` // Step that decided, e.g. "ban" or "final_drop"
+	Path        []ChainStep `json:"path"`
+}
+
+// chainSnapshot holds the set contents GEO_GUARD matches against, loaded once per simulation
+type chainSnapshot struct {
+	settings     models.SecuritySettings
+	whitelist    []*net.IPNet
+	ban          []*net.IPNet
+	vpn          []*net.IPNet
+	tor          []*net.IPNet
+	geoAllowed   []*net.IPNet
+	geoBlocked   []*net.IPNet // Block mode only
+	allowForeign []*net.IPNet
+	gamePorts    [][2]int // UDP service port ranges
+	customRules  int      // Enabled custom GEO_GUARD rules (not evaluated)
+}
+
+// privateRanges are RETURNed by GEO_GUARD before any set lookup
+var privateRanges = mustParseCIDRs([]string{"10.0.0.0/8", "192.168.0.0/16", "172.16.0.0/12", "127.0.0.0/8"})
+
+// SimulateGeoGuard evaluates GEO_GUARD for a NEW packet from each IP to protocol/port, mirroring
+// the rule order of generateIPTablesRules. Rate limits are assumed not exceeded, payload matches
+// (Steam query bypass) and custom rules are reported but not evaluated.
+func (s *FirewallService) SimulateGeoGuard(ips []string, protocol string, port int) []ChainResult {
+	snap := s.loadChainSnapshot()
+	results := make([]ChainResult, 0, len(ips))
+	for _, raw := range ips {
+		results = append(results, s.simulateIP(snap, strings.TrimSpace(raw), protocol, port))
+	}
+	return results
+}
+
+func (s *FirewallService) loadChainSnapshot() *chainSnapshot {
+	snap := &chainSnapshot{}
+	if err := s.DB.First(&snap.settings, 1).Error; err != nil {
+		system.Warn("Chain simulation: no security settings found, using defaults")
+	}
+	settings := &snap.settings
+
+	parse := func(entries []string) []*net.IPNet {
+		nets, err := ParseCIDRList(strings.Join(entries, ","))
+		if err != nil {
+			// One bad entry shouldn't hide the rest; ipset would reject only that line too
+			nets = nets[:0]
+			for _, entry := range entries {
+				if n, err := ParseCIDRList(entry); err == nil {
+					nets = append(nets, n...)
+				}
+			}
+		}
+		return nets
+	}
+
+	var allowIPs []models.AllowIP
+	s.DB.Find(&allowIPs)
+	entries := append([]string{}, CriticalDNS...)
+	for _, a := range allowIPs {
+		entries = append(entries, a.IP)
+	}
+	snap.whitelist = parse(entries)
+
+	var bans []models.BanIP
+	s.DB.Find(&bans)
+	entries = entries[:0]
+	for _, b := range bans {
+		entries = append(entries, b.IP)
+	}
+	snap.ban = parse(entries)
+
+	var foreign []models.AllowForeign
+	s.DB.Find(&foreign)
+	entries = entries[:0]
+	for _, a := range foreign {
+		entries = append(entries, a.IP)
+	}
+	snap.allowForeign = parse(entries)
+
+	if s.GeoIP != nil {
+		if settings.BlockVPN {
+			for _, r := range s.GeoIP.GetVPNRanges() {
+				r := r
+				snap.vpn = append(snap.vpn, &r)
+			}
+		}
+		if settings.BlockTOR {
+			for _, ip := range s.GeoIP.GetTORExitNodes() {
+				snap.tor = append(snap.tor, &net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)})
+			}
+		}
+		var cidrs []string
+		if GeoBlockModeActive(settings) {
+			for _, country := range GeoBlockCountries(settings) {
+				cidrs = append(cidrs, s.GeoIP.GetBlockedCountryCIDRs(country)...)
+			}
+			snap.geoBlocked = parse(cidrs)
+		} else {
+			for _, country := range strings.Split(settings.GeoAllowCountries, ",") {
+				if country = strings.TrimSpace(country); country != "" {
+					cidrs = append(cidrs, s.GeoIP.GetCountryCIDRs(country)...)
+				}
+			}
+			snap.geoAllowed = parse(cidrs)
+		}
+	}
+
+	var services []models.Service
+	s.DB.Preload("Ports").Find(&services)
+	for _, svc := range services {
+		for _, p := range svc.Ports {
+			if strings.ToLower(p.Protocol) != "udp" {
+				continue
+			}
+			end := p.PublicPortEnd
+			if end <= p.PublicPort {
+				end = p.PublicPort
+			}
+			snap.gamePorts = append(snap.gamePorts, [2]int{p.PublicPort, end})
+		}
+	}
+
+	for _, rule := range s.loadCustomRules() {
+		if rule.Table == "mangle" && (rule.Chain == "GEO_GUARD" || rule.Chain == "PREROUTING") {
+			snap.customRules++
+		}
+	}
+	return snap
+}
+
+func (s *FirewallService) simulateIP(snap *chainSnapshot, ipStr, protocol string, port int) ChainResult {
+	result := ChainResult{IP: ipStr, Path: make([]ChainStep, 0, 16)}
+	ip := net.ParseIP(ipStr)
+	if ip == nil || ip.To4() == nil {
+		result.Decision = "invalid"
+		result.MatchedStep = "invalid_ip"
+		return result
+	}
+	if s.GeoIP != nil {
+		_, result.CountryCode = s.GeoIP.GetCountry(ipStr)
+	}
+	settings := &snap.settings
+
+	// step records a rule group; a match ends the walk
+	step := func(name string, matched bool, action, note string) bool {
+		st := ChainStep{Step: name, Matched: matched, Note: note}
+		if matched {
+			st.Action = action
+			result.MatchedStep = name
+			result.Decision = "accept"
+			if action == "DROP" {
+				result.Decision = "drop"
+			}
+		}
+		result.Path = append(result.Path, st)
+		return matched
+	}
+
+	mgmtPorts := []int{22, 80, 443}
+	if system.IsListenPublic() {
+		mgmtPorts = append(mgmtPorts, system.GetListenPort())
+	}
+	if step("management_port", protocol == "tcp" && containsInt(mgmtPorts, port), "RETURN", "") {
+		return result
+	}
+	if step("wireguard", protocol == "udp" && port == 51820, "RETURN", "") {
+		return result
+	}
+	if settings.SteamQueryBypass && protocol == "udp" {
+		step("steam_query_bypass", false, "", "Matches A2S query payloads only; not evaluated")
+	}
+	if snap.customRules > 0 {
+		step("custom_rules", false, "", fmt.Sprintf("%d custom mangle rule(s) not evaluated", snap.customRules))
+	}
+	if step("private_range", ipInNets(ip, privateRanges), "RETURN", "") {
+		return result
+	}
+	if step("whitelist", ipInNets(ip, snap.whitelist), "RETURN", "") {
+		return result
+	}
+	if step("ban", ipInNets(ip, snap.ban), "DROP", "") {
+		return result
+	}
+	if step("vpn", ipInNets(ip, snap.vpn), "DROP", "") {
+		return result
+	}
+	if step("tor", ipInNets(ip, snap.tor), "DROP", "") {
+		return result
+	}
+	blockMode := GeoBlockModeActive(settings)
+	if blockMode {
+		if step("allow_foreign", ipInNets(ip, snap.allowForeign), "RETURN", "") {
+			return result
+		}
+		if step("geo_blocked", ipInNets(ip, snap.geoBlocked), "DROP", "") {
+			return result
+		}
+	}
+
+	gamePort := false
+	for _, r := range snap.gamePorts {
+		if port >= r[0] && port <= r[1] {
+			gamePort = true
+			break
+		}
+	}
+	if step("game_port", protocol == "udp" && gamePort, "RETURN", "") {
+		return result
+	}
+
+	// With global protection every remaining UDP packet is decided by the per-IP hashlimit, before geo_allowed
+	if settings.GlobalProtection && protocol == "udp" {
+		limit := "90000/sec"
+		if settings.EnableTwoStageUDP {
+			newLimit := settings.UDPNewPPSLimit
+			if newLimit <= 0 {
+				newLimit = 1000
+			}
+			limit = fmt.Sprintf("%d/sec for new flows", newLimit)
+		}
+		step("udp_rate_limit", true, "RETURN", "Accepted while under "+limit+" per IP, dropped above")
+		return result
+	}
+
+	if blockMode {
+		step("final_return", true, "RETURN", "Country block mode: sources outside blocked countries pass")
+		return result
+	}
+	if step("geo_allowed", ipInNets(ip, snap.geoAllowed), "RETURN", "") {
+		return result
+	}
+	if step("allow_foreign", ipInNets(ip, snap.allowForeign), "RETURN", "") {
+		return result
+	}
+	step("final_drop", true, "DROP", "")
+	return result
+}
+
+func containsInt(list []int, v int) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
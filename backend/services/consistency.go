@@ -0,0 +1,328 @@
+package services
+
+import (
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Enforcement layers compared by the consistency check
+const (
+	LayerDatabase = "database"
+	LayerIPSet    = "ipset"
+	LayerEBPF     = "ebpf"
+)
+
+// consistencyMismatchLimit caps the entries listed per list; counts stay exact
+const consistencyMismatchLimit = 500
+
+// LayerCount is the number of entries one layer holds for a list
+type LayerCount struct {
+	Layer     string `json:"layer"`
+	Available bool   `json:"available"`
+	Count     int    `json:"count"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ConsistencyMismatch is an entry not present in every available layer
+type ConsistencyMismatch struct {
+	Entry     string   `json:"entry"`
+	PresentIn []string `json:"present_in"`
+	MissingIn []string `json:"missing_in"`
+}
+
+// ListConsistency compares one list (ban or allow) across layers
+type ListConsistency struct {
+	List       string                `json:"list"`
+	Layers     []LayerCount          `json:"layers"`
+	Mismatched int                   `json:"mismatched"`
+	Mismatches []ConsistencyMismatch `json:"mismatches"`
+}
+
+// ConsistencyReport compares the DB ban/allow lists with the ipsets and eBPF maps
+type ConsistencyReport struct {
+	CheckedAt  time.Time         `json:"checked_at"`
+	Consistent bool              `json:"consistent"`
+	Lists      []ListConsistency `json:"lists"`
+}
+
+// layerEntries is one layer's view of a list; nil entries means the layer is unavailable
+type layerEntries struct {
+	layer   string
+	entries map[string]bool
+	err     error
+}
+
+// normalizeEntry renders IPs and CIDRs in one form ("1.2.3.4" for /32) so layers compare equal
+func normalizeEntry(entry string) (string, bool) {
+	nets, err := ParseCIDRList(entry)
+	if err != nil || len(nets) != 1 {
+		return "", false
+	}
+	if ones, bits := nets[0].Mask.Size(); ones == bits {
+		return nets[0].IP.String(), true
+	}
+	return nets[0].String(), true
+}
+
+func entrySet(list []string) map[string]bool {
+	set := make(map[string]bool, len(list))
+	for _, entry := range list {
+		if n, ok := normalizeEntry(entry); ok {
+			set[n] = true
+		}
+	}
+	return set
+}
+
+// ListIPSetMembers returns the members of an ipset, without timeout/comment options
+func (s *FirewallService) ListIPSetMembers(name string) ([]string, error) {
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("ipset is only available on Linux")
+	}
+	out, err := s.Executor.Execute("ipset", "list", name)
+	if err != nil {
+		return nil, err
+	}
+	var members []string
+	inMembers := false
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "Members:" {
+			inMembers = true
+			continue
+		}
+		if !inMembers || line == "" {
+			continue
+		}
+		members = append(members, strings.Fields(line)[0])
+	}
+	return members, nil
+}
+
+// dbBanEntries returns active (unexpired) bans
+func (s *FirewallService) dbBanEntries() []string {
+	var bans []models.BanIP
+	s.DB.Where("expires_at IS NULL OR expires_at > ?", time.Now()).Find(&bans)
+	entries := make([]string, 0, len(bans))
+	for _, b := range bans {
+		entries = append(entries, b.IP)
+	}
+	return entries
+}
+
+// dbAllowEntries returns everything the whitelist layers should hold: allow rules, allow_foreign and critical DNS
+func (s *FirewallService) dbAllowEntries() []string {
+	var allowed []models.AllowIP
+	s.DB.Find(&allowed)
+	var foreign []models.AllowForeign
+	s.DB.Find(&foreign)
+
+	entries := make([]string, 0, len(allowed)+len(foreign)+len(CriticalDNS))
+	for _, a := range allowed {
+		entries = append(entries, a.IP)
+	}
+	for _, f := range foreign {
+		entries = append(entries, f.IP)
+	}
+	return append(entries, CriticalDNS...)
+}
+
+func (s *FirewallService) ipsetLayer(sets ...string) layerEntries {
+	var all []string
+	for _, set := range sets {
+		members, err := s.ListIPSetMembers(set)
+		if err != nil {
+			return layerEntries{layer: LayerIPSet, err: err}
+		}
+		all = append(all, members...)
+	}
+	return layerEntries{layer: LayerIPSet, entries: entrySet(all)}
+}
+
+func (s *FirewallService) ebpfLayer(list func() ([]string, error)) layerEntries {
+	if s.EBPF == nil || !s.EBPF.IsEnabled() {
+		return layerEntries{layer: LayerEBPF, err: fmt.Errorf("eBPF is disabled")}
+	}
+	entries, err := list()
+	if err != nil {
+		return layerEntries{layer: LayerEBPF, err: err}
+	}
+	return layerEntries{layer: LayerEBPF, entries: entrySet(entries)}
+}
+
+// compareLayers lists entries missing from at least one available layer
+func compareLayers(list string, layers ...layerEntries) ListConsistency {
+	result := ListConsistency{List: list, Mismatches: []ConsistencyMismatch{}}
+	union := make(map[string]bool)
+	for _, l := range layers {
+		count := LayerCount{Layer: l.layer, Available: l.err == nil, Count: len(l.entries)}
+		if l.err != nil {
+			count.Error = l.err.Error()
+		}
+		result.Layers = append(result.Layers, count)
+		for entry := range l.entries {
+			union[entry] = true
+		}
+	}
+
+	entries := make([]string, 0, len(union))
+	for entry := range union {
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+
+	for _, entry := range entries {
+		var present, missing []string
+		for _, l := range layers {
+			if l.err != nil {
+				continue
+			}
+			if l.entries[entry] {
+				present = append(present, l.layer)
+			} else {
+				missing = append(missing, l.layer)
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+		result.Mismatched++
+		if len(result.Mismatches) < consistencyMismatchLimit {
+			result.Mismatches = append(result.Mismatches, ConsistencyMismatch{Entry: entry, PresentIn: present, MissingIn: missing})
+		}
+	}
+	return result
+}
+
+// CheckConsistency compares the database ban/allow lists with the ipsets and eBPF maps.
+// The database is the source of truth; ipsets are rebuilt from it on every apply, while
+// the eBPF maps are only ever added to, so drift shows up there first.
+func (s *FirewallService) CheckConsistency() ConsistencyReport {
+	report := ConsistencyReport{CheckedAt: time.Now()}
+
+	var ebpfBans, ebpfAllows func() ([]string, error)
+	if s.EBPF != nil {
+		ebpfBans, ebpfAllows = s.EBPF.ListManualBlocks, s.EBPF.ListWhitelist
+	}
+
+	report.Lists = append(report.Lists,
+		compareLayers("ban",
+			layerEntries{layer: LayerDatabase, entries: entrySet(s.dbBanEntries())},
+			s.ipsetLayer("ban"),
+			s.ebpfLayer(ebpfBans),
+		),
+		compareLayers("allow",
+			layerEntries{layer: LayerDatabase, entries: entrySet(s.dbAllowEntries())},
+			s.ipsetLayer("white_list", "allow_foreign"),
+			s.ebpfLayer(ebpfAllows),
+		),
+	)
+
+	report.Consistent = true
+	for _, l := range report.Lists {
+		if l.Mismatched > 0 {
+			report.Consistent = false
+		}
+	}
+	return report
+}
+
+// Reconcile forces the ipsets and eBPF maps back in line with the database and returns the
+// resulting report. ipsets are rebuilt by re-applying the firewall; eBPF entries are added
+// or removed individually so active rate-limit/flood blocks are left alone.
+func (s *FirewallService) Reconcile() (ConsistencyReport, error) {
+	if err := s.ApplyRules(); err != nil {
+		return ConsistencyReport{}, fmt.Errorf("failed to re-apply firewall: %v", err)
+	}
+	if err := s.reconcileEBPFLists(); err != nil {
+		return ConsistencyReport{}, err
+	}
+	return s.CheckConsistency(), nil
+}
+
+// reconcileEBPFLists adds missing database entries to the eBPF ban/allow maps and removes
+// ones the database no longer has
+func (s *FirewallService) reconcileEBPFLists() error {
+	// Mismatch listings are capped, so large drifts take several passes
+	for pass := 0; pass < 10 && s.EBPF != nil && s.EBPF.IsEnabled(); pass++ {
+		changed := 0
+		for _, list := range s.CheckConsistency().Lists {
+			var add, remove []string
+			for _, m := range list.Mismatches {
+				inDB := containsString(m.PresentIn, LayerDatabase)
+				switch {
+				case inDB && containsString(m.MissingIn, LayerEBPF):
+					add = append(add, m.Entry)
+				case !inDB && containsString(m.PresentIn, LayerEBPF):
+					remove = append(remove, m.Entry)
+				}
+			}
+
+			var err error
+			switch list.List {
+			case "ban":
+				if err = s.EBPF.BlockCIDRs(add); err == nil {
+					err = s.EBPF.UnblockCIDRs(remove)
+				}
+			case "allow":
+				if err = s.EBPF.UpdateAllowIPs(add); err == nil {
+					err = s.EBPF.RemoveWhitelistCIDRs(remove)
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("failed to reconcile eBPF %s list: %v", list.List, err)
+			}
+			if len(add)+len(remove) > 0 {
+				system.Info("Reconciled eBPF %s list: %d added, %d removed", list.List, len(add), len(remove))
+			}
+			changed += len(add) + len(remove)
+		}
+		if changed == 0 {
+			break
+		}
+	}
+	return nil
+}
+
+// reconcileAfterMaintenance runs once the normal rules are back after maintenance mode.
+// Re-enabling XDP replays the blocklist snapshot taken when maintenance started, so bans
+// removed or expired in the meantime would come back; the maps are brought in line with
+// the database instead. Auto-blocks (rate limit, flood) keep their remaining TTL.
+func (s *FirewallService) reconcileAfterMaintenance() {
+	if s.EBPF == nil || !s.EBPF.IsEnabled() {
+		return
+	}
+	// The whitelist was just re-synced by ApplyRules; only the block list needs pruning
+	if n, err := s.EBPF.PruneExpiredBlocks(); err != nil {
+		system.Warn("Post-maintenance cleanup of expired eBPF blocks failed: %v", err)
+	} else if n > 0 {
+		system.Info("Removed %d eBPF blocks that expired during maintenance", n)
+	}
+	if err := s.reconcileEBPFLists(); err != nil {
+		system.Warn("Post-maintenance eBPF reconciliation failed: %v", err)
+		return
+	}
+	if report := s.CheckConsistency(); report.Consistent {
+		system.Info("Firewall layers consistent after maintenance")
+	} else {
+		for _, l := range report.Lists {
+			if l.Mismatched > 0 {
+				system.Warn("After maintenance, %d %s entries still differ between layers", l.Mismatched, l.List)
+			}
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
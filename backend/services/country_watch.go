@@ -0,0 +1,161 @@
+package services
+
+import (
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// countrySpikeMinPPS keeps tiny absolute volumes from triggering spike alerts
+const countrySpikeMinPPS = 100
+
+// countrySpikeWarmup is how many snapshots a country's baseline needs before spikes are judged
+const countrySpikeWarmup = 10
+
+// countryAlertCooldown limits repeated spike alerts for the same country
+const countryAlertCooldown = 30 * time.Minute
+
+// countryWatch flags traffic from never-seen countries and volume spikes from non-allowed ones.
+// It is fed from the per-minute traffic snapshot with the current top talkers.
+type countryWatch struct {
+	mu          sync.Mutex
+	enabled     bool
+	spikeFactor int             // Alert when a non-allowed country exceeds this multiple of its baseline, 0 = off
+	seen        map[string]bool // nil until loaded from the database
+
+	prevPackets map[string]int64   // Per-country packet totals at the previous snapshot
+	baseline    map[string]float64 // Moving average PPS per country
+	samples     map[string]int
+	lastAlert   map[string]time.Time
+}
+
+// observe checks a snapshot's traffic entries; elapsed is the time since the previous snapshot in seconds
+func (w *countryWatch) observe(db *gorm.DB, webhook *WebhookService, entries []TrafficEntry, elapsed float64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.enabled || db == nil {
+		return
+	}
+
+	now := time.Now()
+	packets := make(map[string]int64)
+	firstIP := make(map[string]string)
+	for _, entry := range entries {
+		cc := strings.ToUpper(entry.CountryCode)
+		if cc == "" || cc == "XX" {
+			continue
+		}
+		packets[cc] += int64(entry.PacketCount)
+		if _, ok := firstIP[cc]; !ok {
+			firstIP[cc] = entry.SourceIP
+		}
+	}
+
+	if w.seen == nil && !w.loadSeen(db, packets, firstIP, now) {
+		return
+	}
+
+	// New countries
+	var fresh []string
+	for cc := range packets {
+		if !w.seen[cc] {
+			fresh = append(fresh, cc)
+		}
+	}
+	sort.Strings(fresh)
+	for _, cc := range fresh {
+		w.seen[cc] = true
+		db.Create(&models.SeenCountry{CountryCode: cc, FirstIP: firstIP[cc], FirstSeen: now, LastSeen: now})
+		msg := fmt.Sprintf("Traffic from a new country: %s (first IP %s)", cc, firstIP[cc])
+		system.Warn("%s", msg)
+		if webhook != nil && webhook.IsEnabled() {
+			go webhook.SendSystemAlert("🌐 New Country in Traffic", msg, ColorOrange)
+		}
+	}
+	if len(packets) > 0 {
+		codes := make([]string, 0, len(packets))
+		for cc := range packets {
+			codes = append(codes, cc)
+		}
+		db.Model(&models.SeenCountry{}).Where("country_code IN ?", codes).Update("last_seen", now)
+	}
+
+	w.checkSpikes(db, webhook, packets, elapsed, now)
+	w.prevPackets = packets
+}
+
+// loadSeen reads the persisted seen-set. On the very first run the current countries are
+// recorded silently so an existing install doesn't alert on its normal audience.
+func (w *countryWatch) loadSeen(db *gorm.DB, packets map[string]int64, firstIP map[string]string, now time.Time) bool {
+	var rows []models.SeenCountry
+	if err := db.Find(&rows).Error; err != nil {
+		system.Warn("Failed to load seen countries: %v", err)
+		return false
+	}
+	w.seen = make(map[string]bool, len(rows))
+	for _, row := range rows {
+		w.seen[row.CountryCode] = true
+	}
+	if len(rows) > 0 {
+		return true
+	}
+
+	for cc := range packets {
+		w.seen[cc] = true
+		db.Create(&models.SeenCountry{CountryCode: cc, FirstIP: firstIP[cc], FirstSeen: now, LastSeen: now})
+	}
+	w.prevPackets = packets
+	system.Info("Country watch: recorded %d countries as the initial baseline", len(packets))
+	return false
+}
+
+// checkSpikes alerts when a non-allowed country's PPS jumps well above its moving average
+func (w *countryWatch) checkSpikes(db *gorm.DB, webhook *WebhookService, packets map[string]int64, elapsed float64, now time.Time) {
+	if w.spikeFactor <= 0 || elapsed <= 0 || w.prevPackets == nil {
+		return
+	}
+	if w.baseline == nil {
+		w.baseline = make(map[string]float64)
+		w.samples = make(map[string]int)
+		w.lastAlert = make(map[string]time.Time)
+	}
+
+	var settings models.SecuritySettings
+	allowed := make(map[string]bool)
+	if err := db.First(&settings, 1).Error; err == nil {
+		for _, cc := range strings.Split(settings.GeoAllowCountries, ",") {
+			allowed[strings.ToUpper(strings.TrimSpace(cc))] = true
+		}
+	}
+
+	for cc, total := range packets {
+		if allowed[cc] {
+			continue
+		}
+		delta := total - w.prevPackets[cc]
+		if delta < 0 {
+			delta = 0 // Counters were reset or the top talkers changed
+		}
+		pps := float64(delta) / elapsed
+
+		avg := w.baseline[cc]
+		if w.samples[cc] >= countrySpikeWarmup && pps >= countrySpikeMinPPS && pps > avg*float64(w.spikeFactor) &&
+			now.Sub(w.lastAlert[cc]) >= countryAlertCooldown {
+			w.lastAlert[cc] = now
+			msg := fmt.Sprintf("Traffic spike from non-allowed country %s: %.0f pps (baseline %.0f pps)", cc, pps, avg)
+			system.Warn("%s", msg)
+			if webhook != nil && webhook.IsEnabled() {
+				go webhook.SendSystemAlert("📈 Country Traffic Spike", msg, ColorOrange)
+			}
+		}
+
+		w.baseline[cc] = avg*0.9 + pps*0.1
+		w.samples[cc]++
+	}
+}
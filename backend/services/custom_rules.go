@@ -0,0 +1,202 @@
+package services
+
+import (
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// customRuleChains lists the chains operator rules may target, per table.
+// Each chain has one insertion point in generateIPTablesRules / generateRawTableRules:
+// mangle PREROUTING goes right before the GEO_GUARD jump, GEO_GUARD after the
+// management/WireGuard exemptions, every other chain after the generated rules.
+// Rules for a built-in chain end up in its KG_ chain (see intoKGChains).
+var customRuleChains = map[string][]string{
+	"raw":    {"PREROUTING", "OUTPUT"},
+	"mangle": {"PREROUTING", "GEO_GUARD", "INPUT", "FORWARD", "OUTPUT", "POSTROUTING"},
+	"nat":    {"PREROUTING", "INPUT", "OUTPUT", "POSTROUTING"},
+	"filter": {"INPUT", "FORWARD", "OUTPUT"},
+}
+
+// customRuleForbiddenFlags would let a rule escape its single "-A <chain>" line
+var customRuleForbiddenFlags = map[string]bool{
+	"-A": true, "--append": true, "-I": true, "--insert": true, "-D": true, "--delete": true,
+	"-R": true, "--replace": true, "-P": true, "--policy": true, "-F": true, "--flush": true,
+	"-X": true, "--delete-chain": true, "-N": true, "--new-chain": true, "-E": true,
+	"--rename-chain": true, "-Z": true, "--zero": true, "-t": true, "--table": true,
+}
+
+// customRuleTag is the iptables comment attached to every custom rule so it can be traced in iptables -L
+func customRuleTag(id uint) string {
+	return fmt.Sprintf("kg_custom_%d", id)
+}
+
+// ValidateCustomRule normalizes table/chain and rejects rules that cannot be spliced safely
+// or that would drop everyone's traffic to the management ports (SSH, HTTP/S, GUI, WireGuard).
+func ValidateCustomRule(rule *models.CustomRule) error {
+	rule.Table = strings.ToLower(strings.TrimSpace(rule.Table))
+	rule.Chain = strings.ToUpper(strings.TrimSpace(rule.Chain))
+	rule.Rule = strings.TrimSpace(rule.Rule)
+
+	chains, ok := customRuleChains[rule.Table]
+	if !ok {
+		return fmt.Errorf("unsupported table %q (raw, mangle, nat, filter)", rule.Table)
+	}
+	chainOK := false
+	for _, chain := range chains {
+		if chain == rule.Chain {
+			chainOK = true
+			break
+		}
+	}
+	if !chainOK {
+		return fmt.Errorf("chain %q is not available in table %s (allowed: %s)", rule.Chain, rule.Table, strings.Join(chains, ", "))
+	}
+
+	if rule.Rule == "" {
+		return fmt.Errorf("rule is empty")
+	}
+	if strings.ContainsAny(rule.Rule, "\r\n") {
+		return fmt.Errorf("rule must be a single line")
+	}
+
+	tokens := strings.Fields(rule.Rule)
+	var target string
+	var ports []string
+	hasSource := false
+	for i, tok := range tokens {
+		if customRuleForbiddenFlags[tok] {
+			return fmt.Errorf("%s is not allowed; give only the rule spec that follows \"-A %s\"", tok, rule.Chain)
+		}
+		next := ""
+		if i+1 < len(tokens) {
+			next = tokens[i+1]
+		}
+		switch tok {
+		case "-j", "--jump", "-g", "--goto":
+			target = strings.ToUpper(next)
+		case "--dport", "--dports", "--destination-port", "--destination-ports":
+			if i > 0 && tokens[i-1] == "!" {
+				next = "0:65535" // A negated port match covers everything else, management ports included
+			}
+			ports = append(ports, next)
+		case "-s", "--source", "--src-range", "--match-set":
+			hasSource = true
+		}
+	}
+
+	// Drops scoped to a source only affect that source; anything else must stay clear of the management ports
+	if (target == "DROP" || target == "REJECT") && !hasSource {
+		if len(ports) == 0 {
+			return fmt.Errorf("%s rules must match a source or destination port; a blanket drop would cut off management access", target)
+		}
+		mgmt := managementPorts()
+		for _, spec := range ports {
+			for _, p := range mgmt {
+				if portSpecContains(spec, p) {
+					return fmt.Errorf("rule would %s traffic to management port %d", strings.ToLower(target), p)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// managementPorts are always exempted by the generated ruleset and must stay reachable
+func managementPorts() []int {
+	return []int{22, 80, 443, system.GetListenPort(), 51820}
+}
+
+// portSpecContains reports whether an iptables port spec ("22", "1000:2000", "22,80") covers port
+func portSpecContains(spec string, port int) bool {
+	for _, part := range strings.Split(strings.TrimPrefix(spec, "!"), ",") {
+		lo, hi, isRange := strings.Cut(part, ":")
+		start, err := strconv.Atoi(lo)
+		if err != nil {
+			start = 0 // ":1024" means from 0
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(hi); err != nil {
+				end = 65535 // "1024:" means to 65535
+			}
+		}
+		if port >= start && port <= end {
+			return true
+		}
+	}
+	return false
+}
+
+// customRuleLine renders the iptables-restore line for a rule
+func customRuleLine(rule models.CustomRule) string {
+	return fmt.Sprintf("-A %s -m comment --comment %s %s\n", rule.Chain, customRuleTag(rule.ID), rule.Rule)
+}
+
+// TestCustomRule dry-runs a rule with iptables-restore --test so syntax errors
+// and missing match modules surface before the live ruleset is touched.
+func (s *FirewallService) TestCustomRule(rule *models.CustomRule) error {
+	if runtime.GOOS != "linux" {
+		return nil // No iptables on Windows/Dev
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("*%s\n", rule.Table))
+	if rule.Chain == "GEO_GUARD" {
+		sb.WriteString(":GEO_GUARD - [0:0]\n")
+	}
+	sb.WriteString(customRuleLine(*rule))
+	sb.WriteString("COMMIT\n")
+
+	path := "/tmp/iptables.custom-test.rules"
+	if err := s.saveRulesToFile(path, sb.String()); err != nil {
+		return fmt.Errorf("failed to write test ruleset: %w", err)
+	}
+	if out, err := s.Executor.Execute("iptables-restore", "--test", "--noflush", path); err != nil {
+		if out = strings.TrimSpace(out); out != "" {
+			return fmt.Errorf("iptables rejected rule: %s", out)
+		}
+		return fmt.Errorf("iptables rejected rule: %v", err)
+	}
+	return nil
+}
+
+// loadCustomRules returns enabled custom rules in application order
+func (s *FirewallService) loadCustomRules() []models.CustomRule {
+	var rules []models.CustomRule
+	if err := s.DB.Where("enabled = ?", true).Order("position, id").Find(&rules).Error; err != nil {
+		system.Warn("Failed to load custom firewall rules: %v", err)
+		return nil
+	}
+	return rules
+}
+
+// writeCustomRules splices the custom rules for the given chains, delimited for auditability.
+// Rules that no longer validate (e.g. the GUI port changed) are skipped rather than applied.
+func writeCustomRules(sb *strings.Builder, rules []models.CustomRule, table string, chains ...string) {
+	for _, chain := range chains {
+		var lines []string
+		for _, rule := range rules {
+			if rule.Table != table || rule.Chain != chain {
+				continue
+			}
+			if err := ValidateCustomRule(&rule); err != nil {
+				system.Warn("Skipping custom firewall rule #%d: %v", rule.ID, err)
+				continue
+			}
+			lines = append(lines, customRuleLine(rule))
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("# ---- BEGIN CUSTOM RULES (%s %s) ----\n", table, chain))
+		for _, line := range lines {
+			sb.WriteString(line)
+		}
+		sb.WriteString(fmt.Sprintf("# ---- END CUSTOM RULES (%s %s) ----\n", table, chain))
+	}
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Origin drain states
+const (
+	OriginDrainDraining = "draining" // No new connections; existing sessions continue
+	OriginDrainDrained  = "drained"  // Timeout reached, WireGuard peer removed
+)
+
+// StartDrainWatcher removes the WireGuard peer of origins whose drain timeout has passed
+func (s *FirewallService) StartDrainWatcher(wg *WireGuardService) {
+	go func() {
+		ticker := time.NewTicker(15 * time.Second)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			var origins []models.Origin
+			if err := s.DB.Preload("Peer").
+				Where("drain_state = ? AND drain_until <= ?", OriginDrainDraining, time.Now()).
+				Find(&origins).Error; err != nil {
+				continue
+			}
+
+			for _, origin := range origins {
+				if origin.Peer != nil && wg != nil {
+					if err := wg.RemovePeer(origin.Peer); err != nil {
+						system.Warn("Failed to remove WireGuard peer of drained origin %s: %v", origin.Name, err)
+						continue
+					}
+				}
+				s.DB.Model(&models.Origin{}).Where("id = ?", origin.ID).Update("drain_state", OriginDrainDrained)
+				system.Info("Origin %s drained: remaining sessions cut, WireGuard peer removed", origin.Name)
+			}
+		}
+	}()
+}
+
+// CountOriginSessions returns the number of conntrack entries still forwarded to an origin (-1 if unknown)
+func (s *FirewallService) CountOriginSessions(wgIP string) int {
+	if runtime.GOOS != "linux" || wgIP == "" {
+		return -1
+	}
+
+	// Forwarded flows reply from the origin's WireGuard IP
+	out, err := s.Executor.Execute("conntrack", "-L", "--reply-src", wgIP)
+	if err != nil {
+		return -1
+	}
+	count := 0
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "tcp") || strings.HasPrefix(line, "udp") || strings.HasPrefix(line, "icmp") {
+			count++
+		}
+	}
+	return count
+}
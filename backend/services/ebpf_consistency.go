@@ -0,0 +1,170 @@
+//go:build linux
+
+package services
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// consistencyMaxEntries bounds map iteration for consistency checks
+const consistencyMaxEntries = 200000
+
+// lpmKeyCIDR renders an LPM trie key as "a.b.c.d" (/32) or "a.b.c.d/n"
+func lpmKeyCIDR(key LpmKey) string {
+	ip := net.IP(key.Data[:]).String()
+	if key.PrefixLen >= 32 {
+		return ip
+	}
+	return fmt.Sprintf("%s/%d", ip, key.PrefixLen)
+}
+
+// lpmKeyFromCIDR parses an IPv4 address or CIDR into an LPM trie key
+func lpmKeyFromCIDR(entry string) (LpmKey, error) {
+	nets, err := ParseCIDRList(entry)
+	if err != nil || len(nets) != 1 || nets[0].IP.To4() == nil {
+		return LpmKey{}, fmt.Errorf("invalid IPv4 entry: %s", entry)
+	}
+	ones, _ := nets[0].Mask.Size()
+	key := LpmKey{PrefixLen: uint32(ones)}
+	copy(key.Data[:], nets[0].IP.To4())
+	return key, nil
+}
+
+// ListManualBlocks returns blocked_ips entries with the manual reason (bans pushed from the ban list)
+func (e *EBPFService) ListManualBlocks() ([]string, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	objs, ok := e.objs.(*xdpObjects)
+	if !ok {
+		return nil, fmt.Errorf("eBPF is not loaded")
+	}
+
+	var entries []string
+	var key LpmKey
+	var value BlockEntry
+	iter := objs.BlockedIps.Iterate()
+	for iter.Next(&key, &value) && len(entries) < consistencyMaxEntries {
+		if value.Reason == 1 {
+			entries = append(entries, lpmKeyCIDR(key))
+		}
+	}
+	return entries, iter.Err()
+}
+
+// ListWhitelist returns every white_list entry
+func (e *EBPFService) ListWhitelist() ([]string, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	objs, ok := e.objs.(*xdpObjects)
+	if !ok {
+		return nil, fmt.Errorf("eBPF is not loaded")
+	}
+
+	var entries []string
+	var key LpmKey
+	var value uint32
+	iter := objs.WhiteList.Iterate()
+	for iter.Next(&key, &value) && len(entries) < consistencyMaxEntries {
+		entries = append(entries, lpmKeyCIDR(key))
+	}
+	return entries, iter.Err()
+}
+
+// BlockCIDRs adds permanent manual blocks for IPs or CIDRs
+func (e *EBPFService) BlockCIDRs(entries []string) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	objs, ok := e.objs.(*xdpObjects)
+	if !ok {
+		return fmt.Errorf("eBPF is not loaded")
+	}
+	for _, entry := range entries {
+		key, err := lpmKeyFromCIDR(entry)
+		if err != nil {
+			return err
+		}
+		if err := objs.BlockedIps.Put(key, BlockEntry{Reason: 1}); err != nil {
+			return fmt.Errorf("failed to block %s: %w", entry, err)
+		}
+	}
+	return nil
+}
+
+// UnblockCIDRs removes blocked_ips entries
+func (e *EBPFService) UnblockCIDRs(entries []string) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	objs, ok := e.objs.(*xdpObjects)
+	if !ok {
+		return fmt.Errorf("eBPF is not loaded")
+	}
+	for _, entry := range entries {
+		key, err := lpmKeyFromCIDR(entry)
+		if err != nil {
+			return err
+		}
+		if err := objs.BlockedIps.Delete(key); err != nil {
+			return fmt.Errorf("failed to unblock %s: %w", entry, err)
+		}
+	}
+	return nil
+}
+
+// RemoveWhitelistCIDRs deletes white_list entries that are no longer allowed
+func (e *EBPFService) RemoveWhitelistCIDRs(entries []string) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	objs, ok := e.objs.(*xdpObjects)
+	if !ok {
+		return fmt.Errorf("eBPF is not loaded")
+	}
+	for _, entry := range entries {
+		key, err := lpmKeyFromCIDR(entry)
+		if err != nil {
+			return err
+		}
+		if err := objs.WhiteList.Delete(key); err != nil {
+			return fmt.Errorf("failed to remove whitelist entry %s: %w", entry, err)
+		}
+	}
+	return nil
+}
+
+// PruneExpiredBlocks deletes blocked_ips entries whose TTL has passed. XDP ignores them, but
+// they would otherwise linger in listings and snapshots; returns the number removed.
+func (e *EBPFService) PruneExpiredBlocks() (int, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	objs, ok := e.objs.(*xdpObjects)
+	if !ok {
+		return 0, fmt.Errorf("eBPF is not loaded")
+	}
+
+	now := uint64(time.Since(e.bootTime).Nanoseconds())
+	var expired []LpmKey
+	var key LpmKey
+	var value BlockEntry
+	iter := objs.BlockedIps.Iterate()
+	for iter.Next(&key, &value) && len(expired) < consistencyMaxEntries {
+		if value.ExpiresAt > 0 && value.ExpiresAt <= now {
+			expired = append(expired, key)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return 0, err
+	}
+	for _, k := range expired {
+		if err := objs.BlockedIps.Delete(k); err != nil {
+			return 0, fmt.Errorf("failed to remove expired block %s: %w", lpmKeyCIDR(k), err)
+		}
+	}
+	return len(expired), nil
+}
@@ -0,0 +1,127 @@
+//go:build linux
+
+package services
+
+import (
+	"net"
+	"strings"
+
+	"kg-proxy-web-gui/backend/system"
+)
+
+// geoBlockedLimit matches max_entries of geo_blocked in xdp_filter.c
+const geoBlockedLimit = 300000
+
+// configGeoBlockMode is CONFIG_GEO_BLOCK_MODE in xdp_filter.c
+const configGeoBlockMode = uint32(5)
+
+// SetGeoBlockMode switches the XDP geo filter between the allowlist (geo_allowed) and the
+// country blacklist (geo_blocked), and refills geo_blocked with the blocked countries' ranges
+func (e *EBPFService) SetGeoBlockMode(blockMode bool, countries []string) error {
+	e.mu.RLock()
+	objs, ok := e.objs.(*xdpObjects)
+	e.mu.RUnlock()
+	if !ok || objs == nil {
+		return nil
+	}
+
+	e.geoMapMu.Lock()
+	e.geoBlockMode = blockMode
+	e.geoBlockCountries = countries
+	e.geoMapMu.Unlock()
+
+	// Fill geo_blocked before enabling block mode, so listed countries never slip through
+	e.syncGeoBlocked(objs)
+
+	val := uint32(0)
+	if blockMode {
+		val = 1
+	}
+	if err := objs.Config.Put(configGeoBlockMode, val); err != nil {
+		system.Warn("Failed to update geo block mode config: %v", err)
+		return err
+	}
+	return nil
+}
+
+// syncGeoBlocked makes geo_blocked hold exactly the ranges of the blocked countries
+// (nothing outside block mode). Stale entries are removed only after the new ones are in.
+func (e *EBPFService) syncGeoBlocked(objs *xdpObjects) {
+	if objs.GeoBlocked == nil {
+		return
+	}
+
+	e.geoMapMu.Lock()
+	blockMode := e.geoBlockMode
+	countries := e.geoBlockCountries
+	e.geoMapMu.Unlock()
+
+	want := make(map[LpmKey]uint32)
+	perCountry := make(map[string]int)
+	truncated := false
+	if blockMode && e.geoIPService != nil {
+	countries:
+		for _, cc := range countries {
+			cc = strings.ToUpper(cc)
+			if len(cc) != 2 {
+				continue
+			}
+			value := uint32(cc[0])<<8 | uint32(cc[1])
+			for _, cidr := range e.geoIPService.GetBlockedCountryCIDRs(cc) {
+				_, ipNet, err := net.ParseCIDR(cidr)
+				if err != nil || ipNet.IP.To4() == nil {
+					continue
+				}
+				if len(want) >= geoBlockedLimit {
+					truncated = true
+					break countries
+				}
+				ones, _ := ipNet.Mask.Size()
+				key := LpmKey{PrefixLen: uint32(ones)}
+				copy(key.Data[:], ipNet.IP.To4())
+				if _, dup := want[key]; !dup {
+					perCountry[cc]++
+				}
+				want[key] = value
+			}
+		}
+	}
+	if truncated {
+		system.Warn("geo_blocked map limit reached, some blocked country ranges not added")
+	}
+
+	count := 0
+	for key, value := range want {
+		if err := objs.GeoBlocked.Put(key, value); err != nil {
+			system.Warn("Failed to add range to geo_blocked map: %v", err)
+			continue
+		}
+		count++
+	}
+
+	// Collect first: deleting from an LPM trie while iterating it restarts the walk
+	var stale []LpmKey
+	var key LpmKey
+	var value uint32
+	iter := objs.GeoBlocked.Iterate()
+	for iter.Next(&key, &value) {
+		if _, ok := want[key]; !ok {
+			stale = append(stale, key)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		system.Warn("Failed to iterate geo_blocked map: %v", err)
+	}
+	for _, k := range stale {
+		objs.GeoBlocked.Delete(k)
+	}
+
+	e.geoMapMu.Lock()
+	e.geoBlockedCounts = perCountry
+	e.geoBlockedTotal = count
+	e.geoMapMu.Unlock()
+
+	if blockMode {
+		system.Info("geo_blocked map update: %d ranges from %d countries", count, len(perCountry))
+	}
+}
@@ -0,0 +1,158 @@
+//go:build linux
+
+package services
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/cilium/ebpf"
+)
+
+// defaultBPFMapSample is how many geo_allowed entries a dump returns when no limit is given
+const defaultBPFMapSample = 100
+
+// configIndexNames labels the config map indices (CONFIG_* in xdp_filter.c)
+var configIndexNames = []struct {
+	Name        string
+	Description string
+}{
+	{"hard_blocking", "1 = drop blocked/non-allowed traffic in XDP"},
+	{"rate_limit_pps", "Per-IP packets per second limit, 0 = disabled"},
+	{"maintenance_mode", "1 = all blocking bypassed"},
+	{"block_ttl_seconds", "Lifetime of rate-limit blocks created by XDP, 0 = permanent"},
+	{"packet_validation", "1 = drop malformed packets early"},
+	{"geo_block_mode", "1 = drop geo_blocked countries and pass the rest, 0 = pass geo_allowed only"},
+	{"rate_limit_burst", "Per-IP token bucket size, 0 = same as rate_limit_pps"},
+}
+
+// debugMaps returns the inspectable maps by name. Caller holds e.mu.
+func (e *EBPFService) debugMaps() (map[string]*ebpf.Map, error) {
+	objs, ok := e.objs.(*xdpObjects)
+	if !ok || objs == nil {
+		return nil, fmt.Errorf("eBPF is not loaded")
+	}
+	return map[string]*ebpf.Map{
+		BPFMapGeoAllowed:  objs.GeoAllowed,
+		BPFMapGeoBlocked:  objs.GeoBlocked,
+		BPFMapBlockedIPs:  objs.BlockedIps,
+		BPFMapWhiteList:   objs.WhiteList,
+		BPFMapConfig:      objs.Config,
+		BPFMapGlobalStats: objs.GlobalStats,
+	}, nil
+}
+
+// ListBPFMaps describes the inspectable maps without reading their contents
+func (e *EBPFService) ListBPFMaps() ([]BPFMapInfo, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	maps, err := e.debugMaps()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]BPFMapInfo, 0, len(maps))
+	for name, m := range maps {
+		info := BPFMapInfo{Name: name, PinPath: e.bpfPinPath}
+		if m != nil {
+			info.Type = m.Type().String()
+			info.MaxEntries = m.MaxEntries()
+			info.Available = true
+		}
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// DumpBPFMap reads one map into a structured form. limit only applies to geo_allowed and geo_blocked,
+// which are sampled (the count always covers the whole map); the other maps are returned in full.
+func (e *EBPFService) DumpBPFMap(name string, limit int) (*BPFMapDump, error) {
+	if limit <= 0 {
+		limit = defaultBPFMapSample
+	}
+
+	// blocked_ips and global_stats reuse the existing readers, which take e.mu themselves
+	switch name {
+	case BPFMapBlockedIPs:
+		blocked, err := e.IterateBlockedIPs()
+		if err != nil {
+			return nil, err
+		}
+		dump := &BPFMapDump{Name: name, Count: len(blocked)}
+		for _, b := range blocked {
+			dump.Entries = append(dump.Entries, BPFMapEntry{Key: b.IP, Value: b})
+		}
+		return dump, nil
+	case BPFMapGlobalStats:
+		counters, err := e.GetRawCounters()
+		if err != nil {
+			return nil, err
+		}
+		dump := &BPFMapDump{Name: name, Count: len(counters)}
+		for _, counter := range counters {
+			dump.Entries = append(dump.Entries, BPFMapEntry{Key: counter.Name, Value: counter})
+		}
+		return dump, nil
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	maps, err := e.debugMaps()
+	if err != nil {
+		return nil, err
+	}
+	m, ok := maps[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown map %q", name)
+	}
+	if m == nil {
+		return nil, fmt.Errorf("map %s not available", name)
+	}
+	dump := &BPFMapDump{Name: name}
+
+	switch name {
+	case BPFMapGeoAllowed, BPFMapGeoBlocked:
+		var key LpmKey
+		var value uint32
+		iter := m.Iterate()
+		for iter.Next(&key, &value) {
+			dump.Count++
+			if len(dump.Entries) < limit {
+				cc := string([]byte{byte(value >> 8), byte(value)})
+				dump.Entries = append(dump.Entries, BPFMapEntry{Key: lpmKeyCIDR(key), Value: cc})
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return nil, err
+		}
+		dump.Truncated = dump.Count > len(dump.Entries)
+
+	case BPFMapWhiteList:
+		var key LpmKey
+		var value uint32
+		iter := m.Iterate()
+		for iter.Next(&key, &value) {
+			dump.Entries = append(dump.Entries, BPFMapEntry{Key: lpmKeyCIDR(key), Value: value})
+		}
+		if err := iter.Err(); err != nil {
+			return nil, err
+		}
+		dump.Count = len(dump.Entries)
+
+	case BPFMapConfig:
+		for i, cfg := range configIndexNames {
+			entry := BPFMapEntry{Key: cfg.Name, Description: cfg.Description}
+			var value uint32
+			if err := m.Lookup(uint32(i), &value); err != nil {
+				entry.Error = err.Error()
+			} else {
+				entry.Value = value
+			}
+			dump.Entries = append(dump.Entries, entry)
+		}
+		dump.Count = len(dump.Entries)
+	}
+	return dump, nil
+}
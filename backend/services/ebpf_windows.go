@@ -3,6 +3,7 @@
 package services
 
 import (
+	"fmt"
 	"time"
 
 	"gorm.io/gorm"
@@ -18,26 +19,78 @@ func NewEBPFService() *EBPFService {
 	return &EBPFService{enabled: false}
 }
 
-func (e *EBPFService) SetGeoIPService(g *GeoIPService)                        {}
-func (e *EBPFService) SetDatabase(db *gorm.DB)                                {}
-func (e *EBPFService) Enable() error                                          { return nil }
-func (e *EBPFService) Disable()                                               {}
-func (e *EBPFService) IsEnabled() bool                                        { return false }
-func (e *EBPFService) GetTrafficData() []TrafficEntry                         { return nil }
-func (e *EBPFService) GetStats() DetailedTrafficStats                         { return DetailedTrafficStats{} }
-func (e *EBPFService) LookupBlockedIP(ip string) *BlockedIPInfo               { return nil }
-func (e *EBPFService) IterateBlockedIPs() ([]BlockedIPInfo, error)            { return nil, nil }
-func (e *EBPFService) AddBlockedIP(ip string, duration time.Duration) error   { return nil }
-func (e *EBPFService) RemoveBlockedIP(ip string) error                        { return nil }
-func (e *EBPFService) UpdateGeoIPData()                                       {}
-func (e *EBPFService) StartAutoResetLoop(db *gorm.DB)                         {}
-func (e *EBPFService) UpdateConfig(hardBlocking bool, rateLimitPPS int) error { return nil }
-func (e *EBPFService) GetPortStats() []PortStats                              { return nil }
-func (e *EBPFService) ResetTrafficStats() error                               { return nil }
-func (e *EBPFService) UpdateAllowIPs(ips []string) error                      { return nil }
-func (e *EBPFService) SyncWhitelist() error                                   { return nil }
-func (e *EBPFService) SyncAllowedPorts() error                                { return nil }
-func (e *EBPFService) UpdateMaintenanceMode(enabled bool) error               { return nil }
+func (e *EBPFService) SetGeoIPService(g *GeoIPService)     {}
+func (e *EBPFService) SetDatabase(db *gorm.DB)             {}
+func (e *EBPFService) SetOffenseTracker(t *OffenseTracker) {}
+func (e *EBPFService) SetWebhookService(w *WebhookService) {}
+func (e *EBPFService) GetXDPStatus() XDPStatus             { return XDPStatus{} }
+func (e *EBPFService) GetTCStatus() TCStatus               { return TCStatus{} }
+func (e *EBPFService) GetGeoMapStatus() GeoMapStatus {
+	return GeoMapStatus{Countries: map[string]int{}}
+}
+func (e *EBPFService) Enable() error                               { return nil }
+func (e *EBPFService) Disable()                                    {}
+func (e *EBPFService) IsEnabled() bool                             { return false }
+func (e *EBPFService) GetTrafficData() []TrafficEntry              { return nil }
+func (e *EBPFService) GetStats() DetailedTrafficStats              { return DetailedTrafficStats{} }
+func (e *EBPFService) LookupBlockedIP(ip string) *BlockedIPInfo    { return nil }
+func (e *EBPFService) IterateBlockedIPs() ([]BlockedIPInfo, error) { return nil, nil }
+func (e *EBPFService) IterateActiveConnections() ([]ConnectionInfo, bool, error) {
+	return nil, false, nil
+}
+func (e *EBPFService) AddBlockedIP(ip string, reason uint32, duration time.Duration) error {
+	return nil
+}
+func (e *EBPFService) RemoveBlockedIP(ip string) error { return nil }
+func (e *EBPFService) UpdateGeoIPData()                {}
+func (e *EBPFService) StartAutoResetLoop(db *gorm.DB)  {}
+func (e *EBPFService) UpdateConfig(hardBlocking bool, rateLimitPPS, rateLimitBurst int) error {
+	return nil
+}
+func (e *EBPFService) GetPortStats() []PortStats         { return nil }
+func (e *EBPFService) GetAllPortStats() []PortStats      { return nil }
+func (e *EBPFService) ResetTrafficStats() error          { return nil }
+func (e *EBPFService) UpdateAllowIPs(ips []string) error { return nil }
+func (e *EBPFService) ListManualBlocks() ([]string, error) {
+	return nil, fmt.Errorf("eBPF is not supported on Windows")
+}
+func (e *EBPFService) ListWhitelist() ([]string, error) {
+	return nil, fmt.Errorf("eBPF is not supported on Windows")
+}
+func (e *EBPFService) PruneExpiredBlocks() (int, error) { return 0, nil }
+func (e *EBPFService) SetGeoBlockMode(blockMode bool, countries []string) error {
+	return nil
+}
+func (e *EBPFService) BlockCIDRs(entries []string) error             { return nil }
+func (e *EBPFService) UnblockCIDRs(entries []string) error           { return nil }
+func (e *EBPFService) RemoveWhitelistCIDRs(entries []string) error   { return nil }
+func (e *EBPFService) SyncWhitelist() error                          { return nil }
+func (e *EBPFService) SyncAllowedPorts() error                       { return nil }
+func (e *EBPFService) UpdateMaintenanceMode(enabled bool) error      { return nil }
+func (e *EBPFService) SetRateLimitBlockTTL(ttl time.Duration) error  { return nil }
+func (e *EBPFService) GetAttachedInterfaces() []string               { return nil }
+func (e *EBPFService) SetAggregatorInterval(seconds int)             {}
+func (e *EBPFService) GetAggregatorStats() AggregatorStats           { return AggregatorStats{} }
+func (e *EBPFService) SetAggregatorLimits(maxKeys, queueSize int)    {}
+func (e *EBPFService) SetCountryWatch(enabled bool, spikeFactor int) {}
+func (e *EBPFService) BenchmarkBlockedMap(n int) (*MapBenchmarkResult, error) {
+	return nil, fmt.Errorf("eBPF is only supported on Linux")
+}
+
+func (e *EBPFService) SetIPStatsSampling(topK int, pollSeconds int) {}
+func (e *EBPFService) GetIPStatsSampling() IPStatsSampling          { return IPStatsSampling{} }
+func (e *EBPFService) GetRawCounters() ([]EBPFCounter, error) {
+	return nil, fmt.Errorf("eBPF is only supported on Linux")
+}
+func (e *EBPFService) ListBPFMaps() ([]BPFMapInfo, error) {
+	return nil, fmt.Errorf("eBPF is only supported on Linux")
+}
+func (e *EBPFService) DumpBPFMap(name string, limit int) (*BPFMapDump, error) {
+	return nil, fmt.Errorf("eBPF is only supported on Linux")
+}
+
+// ErrBenchmarkRefused mirrors the Linux error so handlers can match it
+var ErrBenchmarkRefused = fmt.Errorf("benchmark refused")
 
 // PortStats dummy struct for method signature
 type PortStats struct {
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Egress filter modes
+const (
+	EgressModeDrop = "drop" // Unlisted destinations are logged and dropped
+	EgressModeLog  = "log"  // Unlisted destinations are only logged (dry run before enforcing)
+)
+
+// egressLogPrefix tags kernel log lines for connections outside the egress policy
+const egressLogPrefix = "KG_EGRESS_DENY: "
+
+// ValidateEgressPolicy normalizes a policy and rejects malformed destinations or ports
+func ValidateEgressPolicy(policy *models.EgressPolicy) error {
+	policy.Protocol = strings.ToLower(strings.TrimSpace(policy.Protocol))
+	if policy.Protocol == "" {
+		policy.Protocol = "any"
+	}
+	switch policy.Protocol {
+	case "tcp", "udp", "icmp", "any":
+	default:
+		return fmt.Errorf("protocol must be tcp, udp, icmp or any")
+	}
+
+	policy.Destination = strings.TrimSpace(policy.Destination)
+	if policy.Destination != "" {
+		nets, err := ParseCIDRList(policy.Destination)
+		if err != nil {
+			return err
+		}
+		if len(nets) != 1 {
+			return fmt.Errorf("destination must be a single IP or CIDR")
+		}
+		policy.Destination = nets[0].String()
+	}
+
+	specs, err := parseEgressPorts(policy.Ports)
+	if err != nil {
+		return err
+	}
+	if len(specs) > 0 && policy.Protocol == "icmp" {
+		return fmt.Errorf("ports cannot be combined with icmp")
+	}
+	policy.Ports = strings.Join(specs, ",")
+	return nil
+}
+
+// parseEgressPorts parses "443,27015:27030" into multiport specs
+func parseEgressPorts(list string) ([]string, error) {
+	specs := make([]string, 0)
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(strings.ReplaceAll(field, "-", ":"))
+		if field == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(field, ":")
+		start, err := strconv.Atoi(lo)
+		if err != nil || start < 1 || start > 65535 {
+			return nil, fmt.Errorf("invalid port: %s", field)
+		}
+		if !isRange {
+			specs = append(specs, strconv.Itoa(start))
+			continue
+		}
+		end, err := strconv.Atoi(hi)
+		if err != nil || end < start || end > 65535 {
+			return nil, fmt.Errorf("invalid port range: %s", field)
+		}
+		specs = append(specs, fmt.Sprintf("%d:%d", start, end))
+	}
+	return specs, nil
+}
+
+// loadEgressPolicies returns enabled egress policies with the WireGuard IP of their origin
+func (s *FirewallService) loadEgressPolicies() ([]models.EgressPolicy, map[uint]string) {
+	var policies []models.EgressPolicy
+	if err := s.DB.Where("enabled = ?", true).Order("origin_id, id").Find(&policies).Error; err != nil {
+		system.Warn("Failed to load egress policies: %v", err)
+		return nil, nil
+	}
+	var origins []models.Origin
+	s.DB.Select("id", "wg_ip").Find(&origins)
+	wgIPs := make(map[uint]string, len(origins))
+	for _, o := range origins {
+		wgIPs[o.ID] = o.WgIP
+	}
+	return policies, wgIPs
+}
+
+// writeEgressRules fills the EGRESS_GUARD filter chain, entered for NEW connections origins open.
+// Allowed destinations RETURN (and are accepted by the FORWARD rules that follow); anything else
+// is logged and, in drop mode, dropped.
+func writeEgressRules(sb *strings.Builder, settings *models.SecuritySettings, policies []models.EgressPolicy, wgIPs map[uint]string) {
+	// Origin-to-origin and origin-to-proxy tunnel traffic is never filtered
+	sb.WriteString(fmt.Sprintf("-A EGRESS_GUARD -d %s -j RETURN\n", WGSubnet()))
+
+	for _, policy := range policies {
+		if err := ValidateEgressPolicy(&policy); err != nil {
+			system.Warn("Skipping egress policy #%d: %v", policy.ID, err)
+			continue
+		}
+
+		match := fmt.Sprintf("-A EGRESS_GUARD -m comment --comment kg_egress_%d", policy.ID)
+		if policy.OriginID != 0 {
+			wgIP := wgIPs[policy.OriginID]
+			if net.ParseIP(wgIP) == nil {
+				system.Warn("Skipping egress policy #%d: origin %d has no WireGuard IP", policy.ID, policy.OriginID)
+				continue
+			}
+			match += " -s " + wgIP
+		}
+		if policy.Destination != "" {
+			match += " -d " + policy.Destination
+		}
+
+		protocols := []string{policy.Protocol}
+		if policy.Protocol == "any" {
+			protocols = []string{""}
+			if policy.Ports != "" {
+				// Ports need a concrete protocol
+				protocols = []string{"tcp", "udp"}
+			}
+		}
+		for _, proto := range protocols {
+			line := match
+			if proto != "" {
+				line += " -p " + proto
+			}
+			if policy.Ports == "" {
+				sb.WriteString(line + " -j RETURN\n")
+				continue
+			}
+			for _, chunk := range multiportSpecChunks(strings.Split(policy.Ports, ",")) {
+				sb.WriteString(fmt.Sprintf("%s -m multiport --dports %s -j RETURN\n", line, chunk))
+			}
+		}
+	}
+
+	sb.WriteString(fmt.Sprintf("-A EGRESS_GUARD -m limit --limit 10/min --limit-burst 20 -j LOG --log-prefix \"%s\" --log-level 4\n", egressLogPrefix))
+	if settings.EgressFilterMode != EgressModeLog {
+		sb.WriteString("-A EGRESS_GUARD -j DROP\n")
+	}
+}
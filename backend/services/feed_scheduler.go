@@ -0,0 +1,210 @@
+package services
+
+import (
+	"errors"
+	"kg-proxy-web-gui/backend/system"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// feedRetryDelays is the backoff after a failed refresh; once exhausted the feed waits for its next interval
+var feedRetryDelays = []time.Duration{2 * time.Minute, 5 * time.Minute, 15 * time.Minute, 30 * time.Minute}
+
+// feedJitter spreads scheduled refreshes so many installs don't hit MaxMind/ipverse at the same instant
+const feedJitter = 30 * time.Minute
+
+// errFeedSkipped means the feed is not configured (e.g. no license key); it is not retried
+var errFeedSkipped = errors.New("feed not configured")
+
+// FeedStatus reports the schedule and outcome of one data feed
+type FeedStatus struct {
+	Name                string     `json:"name"`
+	IntervalHours       float64    `json:"interval_hours"`
+	NextScheduled       time.Time  `json:"next_scheduled"`
+	LastAttempt         *time.Time `json:"last_attempt"`
+	LastSuccess         *time.Time `json:"last_success"`
+	LastError           string     `json:"last_error,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Skipped             bool       `json:"skipped"` // Last run skipped because the feed is not configured
+}
+
+// feedJob is one periodically refreshed data source
+type feedJob struct {
+	interval time.Duration
+	refresh  func() error
+	wake     chan struct{} // Signals run to re-read NextScheduled
+
+	mu     sync.Mutex
+	status FeedStatus
+}
+
+// feedScheduler runs feed refreshes with jitter and retry
+type feedScheduler struct {
+	mu    sync.Mutex
+	feeds []*feedJob
+}
+
+// add registers a feed. lastSuccess (zero if unknown) anchors the first run.
+func (s *feedScheduler) add(name string, interval time.Duration, lastSuccess time.Time, refresh func() error) {
+	job := &feedJob{
+		interval: interval,
+		refresh:  refresh,
+		wake:     make(chan struct{}, 1),
+		status: FeedStatus{
+			Name:          name,
+			IntervalHours: interval.Hours(),
+		},
+	}
+	next := lastSuccess.Add(interval)
+	if !lastSuccess.IsZero() {
+		t := lastSuccess
+		job.status.LastSuccess = &t
+	} else {
+		next = time.Now().Add(interval)
+	}
+	if earliest := time.Now().Add(5 * time.Minute); next.Before(earliest) {
+		// Overdue at startup: run soon, but not in the middle of boot
+		next = earliest
+	}
+	job.status.NextScheduled = next.Add(randomJitter(feedJitter))
+
+	s.mu.Lock()
+	s.feeds = append(s.feeds, job)
+	s.mu.Unlock()
+
+	go job.run()
+}
+
+// setInterval changes a feed's refresh interval and reschedules its next run from the last success
+func (s *feedScheduler) setInterval(name string, interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.feeds {
+		job.mu.Lock()
+		if job.status.Name != name || job.interval == interval {
+			job.mu.Unlock()
+			continue
+		}
+		job.interval = interval
+		job.status.IntervalHours = interval.Hours()
+		// A pending retry keeps its schedule; otherwise count the new interval from the last success
+		if job.status.ConsecutiveFailures == 0 {
+			anchor := time.Now()
+			if job.status.LastSuccess != nil {
+				anchor = *job.status.LastSuccess
+			}
+			next := anchor.Add(interval)
+			if earliest := time.Now().Add(time.Minute); next.Before(earliest) {
+				next = earliest
+			}
+			job.status.NextScheduled = next.Add(randomJitter(feedJitter))
+		}
+		job.mu.Unlock()
+		select {
+		case job.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// statuses returns a snapshot of every feed
+func (s *feedScheduler) statuses() []FeedStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]FeedStatus, 0, len(s.feeds))
+	for _, job := range s.feeds {
+		job.mu.Lock()
+		out = append(out, job.status)
+		job.mu.Unlock()
+	}
+	return out
+}
+
+func (j *feedJob) run() {
+	for {
+		j.mu.Lock()
+		wait := time.Until(j.status.NextScheduled)
+		name := j.status.Name
+		j.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-j.wake:
+			timer.Stop()
+			continue // Rescheduled
+		}
+
+		err := j.refresh()
+		now := time.Now()
+
+		j.mu.Lock()
+		j.status.Skipped = errors.Is(err, errFeedSkipped)
+		switch {
+		case j.status.Skipped:
+			j.status.NextScheduled = now.Add(j.interval).Add(randomJitter(feedJitter))
+		case err != nil:
+			j.status.LastAttempt = &now
+			j.status.LastError = err.Error()
+			j.status.ConsecutiveFailures++
+			if j.status.ConsecutiveFailures <= len(feedRetryDelays) {
+				delay := feedRetryDelays[j.status.ConsecutiveFailures-1]
+				j.status.NextScheduled = now.Add(delay)
+				system.Warn("Feed %s refresh failed (attempt %d), retrying in %v: %v", name, j.status.ConsecutiveFailures, delay, err)
+			} else {
+				j.status.NextScheduled = now.Add(j.interval).Add(randomJitter(feedJitter))
+				system.Error("Feed %s refresh failed %d times, next try %s: %v", name, j.status.ConsecutiveFailures, j.status.NextScheduled.Format("2006-01-02 15:04"), err)
+			}
+		default:
+			j.status.LastAttempt = &now
+			j.status.LastSuccess = &now
+			j.status.LastError = ""
+			j.status.ConsecutiveFailures = 0
+			j.status.NextScheduled = now.Add(j.interval).Add(randomJitter(feedJitter))
+		}
+		j.mu.Unlock()
+	}
+}
+
+// randomJitter returns a random offset in [0, span)
+func randomJitter(span time.Duration) time.Duration {
+	return time.Duration(rand.Int64N(int64(span)))
+}
+
+// fileModTime returns the modification time of path (zero if missing)
+func fileModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// StartAutoUpdateScheduler schedules the GeoIP database and threat feeds.
+// The database refresh interval follows SetUpdatePolicy (weekly by default). Each feed refreshes on its interval plus up to 30 minutes of jitter, and a failed refresh
+// is retried after 2, 5, 15 and 30 minutes before waiting for the next interval.
+func (g *GeoIPService) StartAutoUpdateScheduler() {
+	interval, _ := g.updatePolicy()
+	g.feeds.add("geolite2", interval, fileModTime(filepath.Join(g.dbPath, "GeoLite2-Country.mmdb")), g.scheduledGeoIPRefresh)
+
+	// Exit nodes churn daily; Initialize already fetched them at startup
+	g.feeds.add("tor_exits", 24*time.Hour, time.Now(), g.downloadTORExitNodes)
+
+	g.feeds.add("maxmind_country_csv", maxmindCSVMaxAge, fileModTime(g.maxmindCSVCachePath()), func() error {
+		if g.GetCountryCIDRSource() != CountryCIDRSourceMaxMindCSV {
+			return errFeedSkipped
+		}
+		_, err := g.ImportMaxMindCSV(true)
+		return err
+	})
+
+	system.Info("GeoIP auto-update scheduler started (GeoLite2 weekly, threat feeds daily, with jitter and retry)")
+}
+
+// GetFeedStatus returns schedule and last outcome of each auto-refreshed feed
+func (g *GeoIPService) GetFeedStatus() []FeedStatus {
+	return g.feeds.statuses()
+}
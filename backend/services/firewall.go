@@ -4,8 +4,12 @@ import (
 	"fmt"
 	"kg-proxy-web-gui/backend/models"
 	"kg-proxy-web-gui/backend/system"
+	"net"
 	"os"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"gorm.io/gorm"
@@ -19,6 +23,32 @@ type FirewallService struct {
 	EBPF         *EBPFService
 
 	inMaintenance bool // internal state to track if we're currently in maintenance mode
+
+	applyMu     sync.Mutex
+	applyStatus FirewallApplyStatus
+
+	// Serializes applies and rollbacks: they share the rule files under /tmp
+	rulesMu sync.Mutex
+
+	// Pending rollback of an unconfirmed apply, see firewall_confirm.go
+	confirmMu    sync.Mutex
+	confirmTimer *time.Timer
+	confirmSeq   int    // Incremented per confirmed apply so stale timers do nothing
+	confirmHash  string // rulesFingerprint of the latest confirmed apply, guarded by rulesMu
+
+	// Last seen packet counters of the signature rules, see signature_rules.go
+	sigHitMu   sync.Mutex
+	sigHitSeen map[uint]int64
+
+	geoScheduleMu  sync.Mutex
+	geoScheduleKey string // Active geo schedules the last ApplyRules used
+
+	// Unprotected state tracking for the banner and reminders, see protection_state.go
+	protectionMu           sync.Mutex
+	unprotectedState       string
+	unprotectedSince       time.Time
+	lastProtectionReminder time.Time
+	protectionReminders    int // Reminders sent since protection was last restored
 }
 
 func NewFirewallService(db *gorm.DB, exec system.CommandExecutor, geoip *GeoIPService, flood *FloodProtection) *FirewallService {
@@ -54,16 +84,16 @@ func (s *FirewallService) StartMaintenanceWatcher() {
 				// Clear the expiration time in DB so we don't repeat this
 				s.DB.Model(&settings).Update("maintenance_until", nil)
 
-				// Re-apply normal rules
-				s.inMaintenance = false
+				// Re-apply normal rules (ApplyRules notices the transition and reconciles eBPF)
 				s.ApplyRules()
 			}
 		}
 	}()
 }
 
-func (s *FirewallService) ApplyRules() error {
-	// Get security settings
+// loadRuleSettings returns the settings the rules are generated from: the saved settings (or
+// defaults) with GeoAllowCountries replaced by the countries geo schedules allow right now
+func (s *FirewallService) loadRuleSettings() (models.SecuritySettings, []models.GeoSchedule) {
 	var settings models.SecuritySettings
 	if err := s.DB.First(&settings, 1).Error; err != nil {
 		system.Warn("No security settings found, using defaults")
@@ -72,9 +102,35 @@ func (s *FirewallService) ApplyRules() error {
 			ProtectionLevel:   2,
 			GeoAllowCountries: "KR",
 			SYNCookies:        true,
+
+			BlockedDestPorts:             DefaultBlockedDestPorts,
+			BlockedReflectionSourcePorts: DefaultBlockedReflectionSourcePorts,
 		}
 	}
 
+	activeSchedules := s.ActiveGeoSchedules(time.Now())
+	settings.GeoAllowCountries = strings.Join(effectiveGeoCountries(settings.GeoAllowCountries, activeSchedules), ",")
+	return settings, activeSchedules
+}
+
+// ApplyRules generates the rules from the saved settings and applies them. This is the apply of
+// automatic callers (startup, schedules, ban expiry, ...): a ruleset an unconfirmed apply was
+// rolled back from is not restored, see ApplyRulesConfirmed.
+func (s *FirewallService) ApplyRules() error {
+	s.rulesMu.Lock()
+	defer s.rulesMu.Unlock()
+	return s.applyRules(false)
+}
+
+// applyRules applies the rules; the caller holds rulesMu. interactive applies (ApplyRulesConfirmed)
+// apply a previously rolled back ruleset again and record its fingerprint for a rollback.
+func (s *FirewallService) applyRules(interactive bool) error {
+	// Get security settings, with the allowed countries geo schedules put in effect right now
+	settings, activeSchedules := s.loadRuleSettings()
+	s.geoScheduleMu.Lock()
+	s.geoScheduleKey = geoScheduleKey(activeSchedules)
+	s.geoScheduleMu.Unlock()
+
 	// Check Maintenance Mode: If active, bypass all blocking
 	// Check Maintenance Mode: If active, bypass all blocking
 	if settings.MaintenanceUntil != nil && settings.MaintenanceUntil.After(time.Now()) {
@@ -87,6 +143,7 @@ func (s *FirewallService) ApplyRules() error {
 		// Apply minimal rules (ACCEPT all)
 		return s.applyMaintenanceMode()
 	}
+	leavingMaintenance := s.inMaintenance
 	s.inMaintenance = false
 	if s.EBPF != nil && settings.EBPFEnabled {
 		// Re-enable XDP if it was disabled by maintenance
@@ -94,6 +151,19 @@ func (s *FirewallService) ApplyRules() error {
 		s.EBPF.UpdateMaintenanceMode(false) // Reset bypass just in case
 	}
 
+	// Unknown country (XX) policy, shared by the geo_allowed ipset and the eBPF geo map
+	if s.GeoIP != nil {
+		allowUnknown := UnknownCountryAllowed(settings.UnknownCountryPolicy, strings.Split(settings.GeoAllowCountries, ","))
+		if s.GeoIP.SetUnknownCountryAllowed(allowUnknown) && s.EBPF != nil && s.EBPF.IsEnabled() {
+			go s.EBPF.UpdateGeoIPData()
+		}
+	}
+
+	// Country blacklist mode for the XDP geo filter (the ipsets follow from generateIPSetRules)
+	if s.EBPF != nil && s.EBPF.IsEnabled() {
+		go s.EBPF.SetGeoBlockMode(GeoBlockModeActive(&settings), GeoBlockCountries(&settings))
+	}
+
 	// Update flood protection level
 	if s.FloodProtect != nil {
 		s.FloodProtect.SetLevel(settings.ProtectionLevel)
@@ -105,7 +175,7 @@ func (s *FirewallService) ApplyRules() error {
 	}
 
 	// 2. Generate ipset.rules
-	ipsetRules, err := s.generateIPSetRules(&settings)
+	ipsetRules, err := s.generateIPSetRules(&settings, true)
 	if err != nil {
 		return err
 	}
@@ -122,40 +192,79 @@ func (s *FirewallService) ApplyRules() error {
 		return err
 	}
 
+	fingerprint := rulesFingerprint(ipsetRules, iptablesRules, rawRules)
+	if interactive {
+		s.confirmHash = fingerprint
+	} else if settings.RevertedRulesHash != "" && settings.RevertedRulesHash == fingerprint {
+		return s.applyHeldBack(ipsetRules)
+	}
+
 	// 4. Apply via Executor (Linux only)
 	system.Info("Applying firewall rules...")
 
+	// Versions before the KG_ chains wrote straight into the built-in chains; remove those rules once
+	if s.kgChainsMissing() {
+		s.removeLegacyBuiltinRules(iptablesRulesPath)
+		s.removeLegacyBuiltinRules(rawRulesPath)
+	}
+
 	// Save rules to files (mock path for Windows, real logic would write to file)
-	if err := s.saveRulesToFile("/tmp/ipset.rules", ipsetRules); err != nil {
+	if err := s.saveRulesToFile(ipsetRulesPath, ipsetRules); err != nil {
 		system.Warn("Failed to save ipset rules: %v", err)
 	}
 
-	if err := s.saveRulesToFile("/tmp/iptables.rules.v4", iptablesRules); err != nil {
+	if err := s.saveRulesToFile(iptablesRulesPath, iptablesRules); err != nil {
 		system.Warn("Failed to save iptables rules: %v", err)
 	}
 
-	if err := s.saveRulesToFile("/tmp/iptables.rules.raw", rawRules); err != nil {
+	if err := s.saveRulesToFile(rawRulesPath, rawRules); err != nil {
 		system.Warn("Failed to save raw rules: %v", err)
 	}
 
-	// Apply ipset
-	if _, err := s.Executor.Execute("ipset", "restore", "-f", "/tmp/ipset.rules"); err != nil {
-		system.Warn("Error applying ipset (may not be on Linux): %v", err)
+	// A missing tool is not a rule problem: nothing below would be enforced
+	if missing := system.MissingBinaries("ipset", "iptables-restore"); len(missing) > 0 {
+		err := fmt.Errorf("firewall NOT applied, required binaries missing: %s", strings.Join(missing, ", "))
+		system.Error("%v", err)
+		s.setApplyStatus(FirewallErrorMissingBinary, err)
+		return err
+	}
+
+	var rejected []string
+
+	// Apply ipset (sets created before entry comments existed are upgraded first)
+	s.ensureCommentSets()
+	if out, err := s.Executor.Execute("ipset", "restore", "-f", ipsetRulesPath); err != nil {
+		system.Error("ipset rejected rules: %v: %s", err, strings.TrimSpace(out))
+		rejected = append(rejected, fmt.Sprintf("ipset: %s", commandError(out, err)))
 	} else {
 		system.Info("IPSet rules applied successfully")
 	}
 
-	// Apply iptables
-	if _, err := s.Executor.Execute("iptables-restore", "/tmp/iptables.rules.v4"); err != nil {
-		system.Warn("Error applying iptables (may not be on Linux): %v", err)
+	// Apply iptables: --noflush only replaces the KG_ chains, then the built-in chains are hooked.
+	// Signature counters restart with the chain, so count the hits up to now first.
+	s.collectSignatureHits()
+	if out, err := s.Executor.Execute("iptables-restore", "--noflush", iptablesRulesPath); err != nil {
+		system.Error("iptables-restore rejected rules: %v: %s", err, strings.TrimSpace(out))
+		rejected = append(rejected, fmt.Sprintf("iptables: %s", commandError(out, err)))
 	} else {
+		s.resetSignatureHits()
+		for _, table := range []string{"mangle", "nat", "filter"} {
+			s.ensureKGChains(table)
+		}
 		system.Info("IPTables rules applied successfully")
 	}
 
+	// Apply ip6tables (or clear KG-Proxy's IPv6 chains when IPv6 is off)
+	if msg := s.applyIPv6Rules(&settings); msg != "" {
+		rejected = append(rejected, msg)
+	}
+
 	// Apply iptables (raw table)
-	if _, err := s.Executor.Execute("iptables-restore", "/tmp/iptables.rules.raw"); err != nil {
-		system.Warn("Error applying iptables raw table: %v", err)
+	if out, err := s.Executor.Execute("iptables-restore", "--noflush", rawRulesPath); err != nil {
+		system.Error("iptables-restore rejected raw table rules: %v: %s", err, strings.TrimSpace(out))
+		rejected = append(rejected, fmt.Sprintf("iptables raw: %s", commandError(out, err)))
 	} else {
+		s.ensureKGChains("raw")
 		system.Info("IPTables raw rules (NOTRACK) applied successfully")
 	}
 
@@ -169,41 +278,145 @@ func (s *FirewallService) ApplyRules() error {
 	if s.EBPF != nil {
 		s.EBPF.SyncWhitelist()
 	}
+	if leavingMaintenance {
+		s.reconcileAfterMaintenance()
+	}
 
+	if len(rejected) > 0 {
+		err := fmt.Errorf("firewall rules rejected: %s", strings.Join(rejected, "; "))
+		s.setApplyStatus(FirewallErrorRuleRejected, err)
+		return err
+	}
+	s.setApplyStatus("", nil)
 	return nil
 }
 
-func (s *FirewallService) generateIPSetRules(settings *models.SecuritySettings) (string, error) {
+// Files ApplyRules writes the generated rules to before restoring them
+const (
+	ipsetRulesPath    = "/tmp/ipset.rules"
+	iptablesRulesPath = "/tmp/iptables.rules.v4"
+	rawRulesPath      = "/tmp/iptables.rules.raw"
+)
+
+// Firewall apply error kinds
+const (
+	FirewallErrorMissingBinary = "missing_binary" // ipset/iptables-restore not installed
+	FirewallErrorRuleRejected  = "rule_rejected"  // A restore command refused the generated rules
+)
+
+// setApplyStatus records the outcome of an ApplyRules run
+func (s *FirewallService) setApplyStatus(kind string, err error) {
+	s.applyMu.Lock()
+	defer s.applyMu.Unlock()
+	now := time.Now()
+	s.applyStatus.LastAttempt = &now
+	s.applyStatus.ErrorKind = kind
+	s.applyStatus.Error = ""
+	if err != nil {
+		s.applyStatus.Error = err.Error()
+		return
+	}
+	s.applyStatus.LastSuccess = &now
+}
+
+// GetApplyStatus returns the outcome of the last ApplyRules run
+func (s *FirewallService) GetApplyStatus() FirewallApplyStatus {
+	s.applyMu.Lock()
+	defer s.applyMu.Unlock()
+	return s.applyStatus
+}
+
+// commandError prefers the tool's own message (e.g. "Error in line 12: ...") over the exit status
+func commandError(out string, err error) string {
+	if msg := strings.TrimSpace(out); msg != "" {
+		return msg
+	}
+	return err.Error()
+}
+
+// CriticalDNS list - always allowed (ipset white_list and eBPF white_list)
+var CriticalDNS = []string{
+	"108.61.10.10", "9.9.9.9", "8.8.8.8", "8.8.4.4", "1.1.1.1", "1.0.0.1",
+}
+
+// IsWhitelisted reports whether ip falls in the white_list ipset: CriticalDNS and every
+// AllowIP entry, single IPs or CIDRs
+func IsWhitelisted(db *gorm.DB, ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	var allowIPs []models.AllowIP
+	db.Find(&allowIPs)
+	entries := append([]string{}, CriticalDNS...)
+	for _, a := range allowIPs {
+		entries = append(entries, a.IP)
+	}
+	for _, entry := range entries {
+		nets, err := ParseCIDRList(entry)
+		if err != nil {
+			continue
+		}
+		for _, n := range nets {
+			if n.Contains(parsed) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// generateIPSetRules renders the ipset restore file. With fetch, missing country ranges are
+// downloaded first; otherwise only what is already cached is used (previews must not change state).
+func (s *FirewallService) generateIPSetRules(settings *models.SecuritySettings, fetch bool) (string, error) {
 	var sb strings.Builder
 
-	// Create ipsets
-	sb.WriteString("create geo_allowed hash:net family inet hashsize 131072 maxelem 2000000 -exist\n")
-	sb.WriteString("create vpn_proxy hash:net family inet hashsize 1024 maxelem 100000 -exist\n")
-	sb.WriteString("create tor_exits hash:ip family inet hashsize 1024 maxelem 10000 -exist\n")
-	sb.WriteString("create allow_foreign hash:net family inet maxelem 100000 -exist\n")
-	sb.WriteString("create ban hash:net family inet maxelem 100000 -exist\n")
-	sb.WriteString("create flood_blocked hash:ip family inet timeout 1800 -exist\n")
-	sb.WriteString("create white_list hash:net family inet maxelem 100000 -exist\n")
-
-	// Flush existing entries
-	sb.WriteString("flush geo_allowed\n")
-	sb.WriteString("flush vpn_proxy\n")
-	sb.WriteString("flush tor_exits\n")
-	sb.WriteString("flush allow_foreign\n")
-	sb.WriteString("flush ban\n")
-	sb.WriteString("flush flood_blocked\n")
-	sb.WriteString("flush white_list\n")
-
-	// Add GeoIP allowed countries
-	if s.GeoIP != nil {
+	// Create ipsets, then flush existing entries
+	for _, def := range managedIPSets {
+		sb.WriteString(fmt.Sprintf("create %s %s -exist\n", def.name, def.options))
+	}
+	for _, def := range managedIPSets {
+		sb.WriteString(fmt.Sprintf("flush %s\n", def.name))
+	}
+	if settings.EnableIPv6 {
+		for _, def := range managedIPSets6 {
+			sb.WriteString(fmt.Sprintf("create %s %s -exist\nflush %s\n", def.name, def.options, def.name))
+		}
+	}
+
+	// Add GeoIP blocked countries (block mode) or allowed countries (allow mode)
+	if s.GeoIP != nil && GeoBlockModeActive(settings) {
+		blockedCountries := GeoBlockCountries(settings)
+		if fetch {
+			s.GeoIP.DownloadCountryCIDRs(blockedCountries)
+		}
+		for _, country := range blockedCountries {
+			for _, cidr := range s.GeoIP.GetBlockedCountryCIDRs(country) {
+				sb.WriteString(fmt.Sprintf("add geo_blocked %s\n", cidr))
+			}
+		}
+	} else if s.GeoIP != nil {
 		allowedCountries := strings.Split(settings.GeoAllowCountries, ",")
 
 		// Download country CIDRs if needed
-		s.GeoIP.DownloadCountryCIDRs(allowedCountries)
+		if fetch {
+			s.GeoIP.DownloadCountryCIDRs(allowedCountries)
+		}
+
+		// Unclassified sources (country XX) are added when the unknown country policy allows them
+		if UnknownCountryAllowed(settings.UnknownCountryPolicy, allowedCountries) {
+			if cidrs, err := s.GeoIP.UnclassifiedCIDRs(); err == nil {
+				for _, cidr := range cidrs {
+					sb.WriteString(fmt.Sprintf("add geo_allowed %s\n", cidr))
+				}
+			} else {
+				system.Warn("Unknown country sources allowed, but their ranges are unavailable: %v", err)
+			}
+		}
 
 		for _, country := range allowedCountries {
 			country = strings.TrimSpace(country)
-			if country == "" {
+			if country == "" || strings.EqualFold(country, UnknownCountryCode) {
 				continue
 			}
 
@@ -233,36 +446,40 @@ func (s *FirewallService) generateIPSetRules(settings *models.SecuritySettings)
 	var allowIPs []models.AllowIP
 	s.DB.Find(&allowIPs)
 	for _, a := range allowIPs {
-		sb.WriteString(fmt.Sprintf("add white_list %s\n", a.IP))
+		if set, ok := ipsetFor("white_list", a.IP, settings.EnableIPv6); ok {
+			sb.WriteString(ipsetAddLine(set, a.IP, labelComment("allow", a.Label)))
+		}
 	}
 
 	// Add Critical DNS (Always Allowed)
-	criticalDNS := []string{
-		"108.61.10.10", "9.9.9.9", "8.8.8.8", "8.8.4.4", "1.1.1.1", "1.0.0.1",
-	}
-	for _, dns := range criticalDNS {
-		sb.WriteString(fmt.Sprintf("add white_list %s\n", dns))
+	for _, dns := range CriticalDNS {
+		sb.WriteString(ipsetAddLine("white_list", dns, "critical DNS"))
 	}
 
 	// Add manually allowed foreign IPs
 	var allowed []models.AllowForeign
 	s.DB.Find(&allowed)
 	for _, a := range allowed {
-		sb.WriteString(fmt.Sprintf("add allow_foreign %s\n", a.IP))
+		// IPv6 sources are not geo filtered, so they need no exception
+		if !isIPv6Entry(a.IP) {
+			sb.WriteString(ipsetAddLine("allow_foreign", a.IP, labelComment("allow foreign", a.Label)))
+		}
 	}
 
-	// Add manually banned IPs
+	// Add manually banned IPs (expired ones are removed by the ban expiry watcher)
 	var banned []models.BanIP
-	s.DB.Find(&banned)
+	s.DB.Where("expires_at IS NULL OR expires_at > ?", time.Now()).Find(&banned)
 	for _, b := range banned {
-		sb.WriteString(fmt.Sprintf("add ban %s\n", b.IP))
+		if set, ok := ipsetFor("ban", b.IP, settings.EnableIPv6); ok {
+			sb.WriteString(ipsetAddLine(set, b.IP, banComment(b)))
+		}
 	}
 
 	// Add flood-blocked IPs
 	if s.FloodProtect != nil {
-		blockedIPs := s.FloodProtect.GetBlockedIPs()
-		for _, ip := range blockedIPs {
-			sb.WriteString(fmt.Sprintf("add flood_blocked %s\n", ip))
+		// Each entry keeps the remainder of its flood block instead of the set default
+		for ip, until := range s.FloodProtect.GetBlockedExpiries() {
+			sb.WriteString(fmt.Sprintf("add flood_blocked %s timeout %d\n", ip, int(time.Until(until).Seconds())+1))
 		}
 	}
 
@@ -272,13 +489,16 @@ func (s *FirewallService) generateIPSetRules(settings *models.SecuritySettings)
 func (s *FirewallService) generateIPTablesRules(settings *models.SecuritySettings) (string, error) {
 	var sb strings.Builder
 
-	// Detect primary interface
-	eth := system.GetDefaultInterface()
+	// Detect WAN interfaces (primary first, then any additional protected interfaces)
+	wanIfaces := system.GetProtectedInterfaces()
 
 	// Pre-fetch services for both mangle and nat tables
 	var services []models.Service
 	s.DB.Preload("Origin").Preload("Ports").Find(&services)
 
+	// Operator-supplied rules, spliced at fixed insertion points below
+	customRules := s.loadCustomRules()
+
 	// ==========================================
 	// 1. Mangle Table (Advanced Packet Filter)
 	// ==========================================
@@ -290,6 +510,7 @@ func (s *FirewallService) generateIPTablesRules(settings *models.SecuritySetting
 	sb.WriteString(":POSTROUTING ACCEPT [0:0]\n")
 	sb.WriteString(":DDOS_PRE - [0:0]\n")
 	sb.WriteString(":GEO_GUARD - [0:0]\n")
+	sb.WriteString(":" + signatureChain + " - [0:0]\n")
 
 	if settings.GlobalProtection {
 		// 0. Unconditional Bypass for WireGuard (Internal & External)
@@ -321,17 +542,25 @@ func (s *FirewallService) generateIPTablesRules(settings *models.SecuritySetting
 		// 1-4. Block Abnormal MSS
 		sb.WriteString("-A PREROUTING -p tcp -m conntrack --ctstate NEW -m tcpmss ! --mss 536:65535 -j DROP\n")
 
-		// 1-5a. Block UDP Reflection Attacks
-		sb.WriteString("-A PREROUTING -p udp -m multiport --sports 1900,11211 -j DROP\n")
+		// 1-5a. Block UDP Reflection Attacks (amplification source ports)
+		reflectionPorts, _ := ParsePortList(settings.BlockedReflectionSourcePorts)
+		for _, ports := range multiportChunks(reflectionPorts) {
+			sb.WriteString(fmt.Sprintf("-A PREROUTING -p udp -m multiport --sports %s -j DROP\n", ports))
+		}
 
-		// 1-5b. Block Bogon IPs (Spoofed IPs from local/reserved ranges) on WAN interface
-		sb.WriteString(fmt.Sprintf("-A PREROUTING -i %s -s 127.0.0.0/8 -j DROP\n", eth))
-		sb.WriteString(fmt.Sprintf("-A PREROUTING -i %s -s 169.254.0.0/16 -j DROP\n", eth))
-		sb.WriteString(fmt.Sprintf("-A PREROUTING -i %s -s 224.0.0.0/4 -j DROP\n", eth))
+		// 1-5b. Block Bogon IPs (Spoofed IPs from local/reserved ranges) on WAN interfaces
+		for _, eth := range wanIfaces {
+			sb.WriteString(fmt.Sprintf("-A PREROUTING -i %s -s 127.0.0.0/8 -j DROP\n", eth))
+			sb.WriteString(fmt.Sprintf("-A PREROUTING -i %s -s 169.254.0.0/16 -j DROP\n", eth))
+			sb.WriteString(fmt.Sprintf("-A PREROUTING -i %s -s 224.0.0.0/4 -j DROP\n", eth))
+		}
 
 		// 1-5g. Block Database Ports (No reason for external access)
-		sb.WriteString("-A PREROUTING -p tcp -m multiport --dports 1433,1521,3306,5432 -j DROP\n")
-		sb.WriteString("-A PREROUTING -p udp -m multiport --dports 1433,1521,3306,5432 -j DROP\n")
+		destPorts, _ := ParsePortList(settings.BlockedDestPorts)
+		for _, ports := range multiportChunks(destPorts) {
+			sb.WriteString(fmt.Sprintf("-A PREROUTING -p tcp -m multiport --dports %s -j DROP\n", ports))
+			sb.WriteString(fmt.Sprintf("-A PREROUTING -p udp -m multiport --dports %s -j DROP\n", ports))
+		}
 
 		// 1-5c. Limit ICMP (Ping) to prevent flood
 		// REMOVED: Global limit of 2/second causes high ping for legit users.
@@ -349,6 +578,10 @@ func (s *FirewallService) generateIPTablesRules(settings *models.SecuritySetting
 		// 1-5i. ICMP Flood Protection (Per-IP)
 		sb.WriteString("-A PREROUTING -p icmp --icmp-type echo-request -m hashlimit --hashlimit-name icmp_flood --hashlimit-mode srcip --hashlimit-upto 5/sec --hashlimit-burst 10 -j ACCEPT\n")
 		sb.WriteString("-A PREROUTING -p icmp --icmp-type echo-request -j DROP\n")
+
+		// 1-5j. Attack signatures (log / rate_limit / block)
+		sb.WriteString("-A PREROUTING -j " + signatureChain + "\n")
+		s.writeSignatureRules(&sb)
 	}
 
 	// 1-6. Apply GEO_GUARD logic (Drop if not allowed)
@@ -361,27 +594,53 @@ func (s *FirewallService) generateIPTablesRules(settings *models.SecuritySetting
 	// 3. GeoIP & Blacklist filtering below
 	// 4. eBPF/Application level monitoring (Traffic Analysis)
 
+	writeCustomRules(&sb, customRules, "mangle", "PREROUTING")
+
 	sb.WriteString("-A PREROUTING -j GEO_GUARD\n")
 	sb.WriteString("-A GEO_GUARD -m conntrack --ctstate RELATED,ESTABLISHED -j RETURN\n")
 
 	// Exempt management ports and WireGuard from GEO_GUARD to prevent lockout and allow VPN entry
-	sb.WriteString("-A GEO_GUARD -p tcp -m multiport --dports 22,80,443,8080 -j RETURN\n")
+	// The GUI port is only exempted when the panel listens on all interfaces (KG_LISTEN_ADDR)
+	if system.IsListenPublic() {
+		sb.WriteString(fmt.Sprintf("-A GEO_GUARD -p tcp -m multiport --dports 22,80,443,%d -j RETURN\n", system.GetListenPort()))
+	} else {
+		sb.WriteString("-A GEO_GUARD -p tcp -m multiport --dports 22,80,443 -j RETURN\n")
+	}
 	sb.WriteString("-A GEO_GUARD -p udp --dport 51820 -j RETURN\n")
 
 	// Steam Query Bypass (A2S_INFO, A2S_PLAYER, A2S_RULES)
 	// Signatures: T (54), U (55), V (56). Payload start around byte 28 (20 IP + 8 UDP).
 	// We use direct hex matching for safety.
+	// Rules are tagged with a comment so their packet counters can be audited (GetSteamBypassStats).
 	if settings.SteamQueryBypass {
-		// A2S_INFO (Source Engine Query) - 'T'
-		sb.WriteString("-A GEO_GUARD -p udp -m string --algo bm --hex-string \"|ffffffff54|\" --from 28 --to 40 -j RETURN\n")
-		// A2S_PLAYER - 'U'
-		sb.WriteString("-A GEO_GUARD -p udp -m string --algo bm --hex-string \"|ffffffff55|\" --from 28 --to 40 -j RETURN\n")
-		// A2S_RULES - 'V'
-		sb.WriteString("-A GEO_GUARD -p udp -m string --algo bm --hex-string \"|ffffffff56|\" --from 28 --to 40 -j RETURN\n")
-		// Challenge Response (Simple 'q' or legacy A2S_PLAYER challenge) - 'W' (57)
-		sb.WriteString("-A GEO_GUARD -p udp -m string --algo bm --hex-string \"|ffffffff57|\" --from 28 --to 40 -j RETURN\n")
+		// Optionally restrict the bypass to the query ports; otherwise any UDP packet with a signature passes
+		portMatches := []string{""}
+		if specs := steamQueryPortSpecs(settings, services); specs != nil {
+			portMatches = portMatches[:0]
+			for _, ports := range multiportSpecChunks(specs) {
+				portMatches = append(portMatches, fmt.Sprintf(" -m multiport --dports %s", ports))
+			}
+			if len(specs) == 0 {
+				system.Warn("Steam query bypass is scoped to service query ports, but no port is flagged as a query port")
+			}
+		}
+		signatures := []string{
+			"ffffffff54", // A2S_INFO (Source Engine Query) - 'T'
+			"ffffffff55", // A2S_PLAYER - 'U'
+			"ffffffff56", // A2S_RULES - 'V'
+			"ffffffff57", // Challenge Response (Simple 'q' or legacy A2S_PLAYER challenge) - 'W' (57)
+		}
+		for _, ports := range portMatches {
+			for _, sig := range signatures {
+				sb.WriteString(fmt.Sprintf("-A GEO_GUARD -p udp%s -m string --algo bm --hex-string \"|%s|\" --from 28 --to 40 -m comment --comment %s -j RETURN\n",
+					ports, sig, steamBypassComment))
+			}
+		}
 	}
 
+	// Custom GEO_GUARD rules run after the management exemptions, so they cannot lock the panel out
+	writeCustomRules(&sb, customRules, "mangle", "GEO_GUARD")
+
 	// Always allow private ranges (SSH, Internal Network)
 	sb.WriteString("-A GEO_GUARD -s 10.0.0.0/8 -j RETURN\n")
 	sb.WriteString("-A GEO_GUARD -s 192.168.0.0/16 -j RETURN\n")
@@ -393,6 +652,13 @@ func (s *FirewallService) generateIPTablesRules(settings *models.SecuritySetting
 	sb.WriteString("-A GEO_GUARD -m set --match-set vpn_proxy src -j DROP\n")
 	sb.WriteString("-A GEO_GUARD -m set --match-set tor_exits src -j DROP\n")
 
+	// Block mode: blocked countries are dropped before the game port bypass, allow_foreign entries excepted
+	blockMode := GeoBlockModeActive(settings)
+	if blockMode {
+		sb.WriteString("-A GEO_GUARD -m set --match-set allow_foreign src -j RETURN\n")
+		sb.WriteString("-A GEO_GUARD -m set --match-set geo_blocked src -j DROP\n")
+	}
+
 	// DYNAMIC PORT ALLOW (Game Ports) - Bypasses generic GeoIP blocking
 	// Match logic in eBPF: If valid game port + passed earlier checks -> ALLOW
 	// We iterate through known services to add explicit RETURN rules for UDP ports
@@ -436,11 +702,17 @@ func (s *FirewallService) generateIPTablesRules(settings *models.SecuritySetting
 			sb.WriteString("-A GEO_GUARD -p udp -j DROP\n")
 		}
 	}
-	sb.WriteString("-A GEO_GUARD -m set --match-set geo_allowed src -j RETURN\n")
-	sb.WriteString("-A GEO_GUARD -m set --match-set allow_foreign src -j RETURN\n")
-	// Drop everything else that didn't match ALLOW sets
-	sb.WriteString("-A GEO_GUARD -j DROP\n")
+	if blockMode {
+		// Everything not in a blocked country passes
+		sb.WriteString("-A GEO_GUARD -j RETURN\n")
+	} else {
+		sb.WriteString("-A GEO_GUARD -m set --match-set geo_allowed src -j RETURN\n")
+		sb.WriteString("-A GEO_GUARD -m set --match-set allow_foreign src -j RETURN\n")
+		// Drop everything else that didn't match ALLOW sets
+		sb.WriteString("-A GEO_GUARD -j DROP\n")
+	}
 
+	writeCustomRules(&sb, customRules, "mangle", "INPUT", "FORWARD", "OUTPUT", "POSTROUTING")
 	sb.WriteString("COMMIT\n")
 
 	// ==========================================
@@ -458,33 +730,17 @@ func (s *FirewallService) generateIPTablesRules(settings *models.SecuritySetting
 		if svc.Origin.WgIP == "" {
 			continue
 		}
+		// Draining origins get no DNAT for new connections. The nat table only sees the first
+		// packet of a flow, so sessions already in conntrack keep their translation until they end.
+		if svc.Origin.DrainState != "" {
+			sb.WriteString(fmt.Sprintf("# origin %q draining: new connections to %s are not forwarded\n", svc.Origin.Name, svc.Name))
+			continue
+		}
 
 		for _, port := range svc.Ports {
 			protocol := strings.ToLower(port.Protocol)
 
-			// Logic for Port Ranges
-			var dport, toDest string
-			if port.PublicPortEnd > port.PublicPort {
-				// Range (e.g. 27015:27030)
-				dport = fmt.Sprintf("%d:%d", port.PublicPort, port.PublicPortEnd)
-				// Target range matches source range if PrivatePortEnd is set,
-				// or we map to a starting private port?
-				// Usually user wants 27015-27030 -> 27015-27030
-				// iptables handles range mapping automatically if size matches.
-				toDest = fmt.Sprintf("%s:%d-%d", svc.Origin.WgIP, port.PrivatePort, port.PrivatePortEnd)
-
-				// Fallback if PrivatePortEnd is 0 (should prevent this in validation but handle here safe)
-				if port.PrivatePortEnd == 0 {
-					// Map range to single port? No, map range to range starting at PrivatePort
-					// Calculate end: PrivatePort + (PublicEnd - PublicStart)
-					diff := port.PublicPortEnd - port.PublicPort
-					toDest = fmt.Sprintf("%s:%d-%d", svc.Origin.WgIP, port.PrivatePort, port.PrivatePort+diff)
-				}
-			} else {
-				// Single Port
-				dport = fmt.Sprintf("%d", port.PublicPort)
-				toDest = fmt.Sprintf("%s:%d", svc.Origin.WgIP, port.PrivatePort)
-			}
+			dport, toDest := dnatSpec(svc.Origin.WgIP, port)
 
 			// DNAT Rule
 			// -p udp --dport 2302 -j DNAT --to-destination 10.200.0.2:2302
@@ -492,9 +748,17 @@ func (s *FirewallService) generateIPTablesRules(settings *models.SecuritySetting
 		}
 	}
 
-	// Masquerade for WireGuard outbound (Interface Agnostic)
-	// Allow any traffic from WireGuard subnet to be masqueraded when leaving ANY interface
-	sb.WriteString("-A POSTROUTING -s 10.200.0.0/24 -j MASQUERADE\n")
+	// Masquerade for WireGuard outbound
+	if system.GetWANInterface() != "" {
+		// Explicit WAN interface: only masquerade traffic leaving through the protected interfaces
+		for _, wan := range wanIfaces {
+			sb.WriteString(fmt.Sprintf("-A POSTROUTING -s %s -o %s -j MASQUERADE\n", WGSubnet(), wan))
+		}
+	} else {
+		// Interface Agnostic: masquerade traffic from WireGuard subnet leaving ANY interface
+		sb.WriteString(fmt.Sprintf("-A POSTROUTING -s %s -j MASQUERADE\n", WGSubnet()))
+	}
+	writeCustomRules(&sb, customRules, "nat", "PREROUTING", "INPUT", "OUTPUT", "POSTROUTING")
 	sb.WriteString("COMMIT\n")
 
 	// ==========================================
@@ -504,6 +768,9 @@ func (s *FirewallService) generateIPTablesRules(settings *models.SecuritySetting
 	sb.WriteString(":INPUT DROP [0:0]\n")
 	sb.WriteString(":FORWARD DROP [0:0]\n")
 	sb.WriteString(":OUTPUT ACCEPT [0:0]\n")
+	if settings.EgressFilterEnabled {
+		sb.WriteString(":EGRESS_GUARD - [0:0]\n")
+	}
 
 	// Allow loopback
 	sb.WriteString("-A INPUT -i lo -j ACCEPT\n")
@@ -535,19 +802,32 @@ func (s *FirewallService) generateIPTablesRules(settings *models.SecuritySetting
 	// Allow HTTP/HTTPS for Web GUI
 	sb.WriteString("-A INPUT -p tcp --dport 80 -j ACCEPT\n")
 	sb.WriteString("-A INPUT -p tcp --dport 443 -j ACCEPT\n")
-	sb.WriteString("-A INPUT -p tcp --dport 8080 -j ACCEPT\n")
+	if guiHost := system.GetListenHost(); guiHost == "" {
+		sb.WriteString(fmt.Sprintf("-A INPUT -p tcp --dport %d -j ACCEPT\n", system.GetListenPort()))
+	} else if ip := net.ParseIP(guiHost); ip != nil && !ip.IsLoopback() {
+		// Bound to a specific address (e.g. wg0): only accept connections to that address
+		sb.WriteString(fmt.Sprintf("-A INPUT -d %s -p tcp --dport %d -j ACCEPT\n", guiHost, system.GetListenPort()))
+	}
+
+	// Origin egress filtering: new outbound connections from origins must match an EgressPolicy
+	if settings.EgressFilterEnabled {
+		policies, wgIPs := s.loadEgressPolicies()
+		sb.WriteString(fmt.Sprintf("-A FORWARD -i wg+ -s %s -m conntrack --ctstate NEW -j EGRESS_GUARD\n", WGSubnet()))
+		writeEgressRules(&sb, settings, policies, wgIPs)
+	}
 
 	// Forwarding rules (Critical for NAT and Origin Outbound)
 	// Allow forwarded traffic that passed Mangle checks
 	// Use wg+ wildcard to match all WireGuard interfaces (wg0, wg1, etc.)
 	sb.WriteString("-A FORWARD -o wg+ -m conntrack --ctstate NEW,ESTABLISHED,RELATED -j ACCEPT\n")
 	sb.WriteString("-A FORWARD -i wg+ -m conntrack --ctstate NEW,ESTABLISHED,RELATED -j ACCEPT\n")
-	// CRITICAL: Allow Origin servers (10.200.0.0/24) to initiate NEW outbound connections (Steam API, Workshop, etc.)
-	sb.WriteString("-A FORWARD -s 10.200.0.0/24 -j ACCEPT\n")
+	// CRITICAL: Allow Origin servers (WireGuard subnet) to initiate NEW outbound connections (Steam API, Workshop, etc.)
+	sb.WriteString(fmt.Sprintf("-A FORWARD -s %s -j ACCEPT\n", WGSubnet()))
 
+	writeCustomRules(&sb, customRules, "filter", "INPUT", "FORWARD", "OUTPUT")
 	sb.WriteString("COMMIT\n")
 
-	return sb.String(), nil
+	return intoKGChains(sb.String()), nil
 }
 
 func (s *FirewallService) saveRulesToFile(path, content string) error {
@@ -558,14 +838,21 @@ func (s *FirewallService) saveRulesToFile(path, content string) error {
 func (s *FirewallService) applyMaintenanceMode() error {
 	system.Info("Applying Maintenance Mode - All blocking disabled")
 
-	// Flush Filter and Mangle tables (Blocking happens here)
-	s.Executor.Execute("iptables", "-F")
-	s.Executor.Execute("iptables", "-t", "mangle", "-F")
-	s.Executor.Execute("iptables", "-t", "raw", "-F")
+	// Flush our own filter, mangle and raw chains (blocking happens here); other tools' rules stay
+	for _, table := range []string{"filter", "mangle", "raw"} {
+		s.flushKGChains(table)
+	}
+	if len(system.MissingBinaries("ip6tables")) == 0 {
+		s.flushKGChainsWith("ip6tables", "mangle")
+	}
 
-	// DO NOT flush NAT table completely as it contains game port forwarding
+	// DO NOT flush the NAT chain as it contains game port forwarding
 	// Just ensure the base NAT for WireGuard is there (Interface Agnostic)
-	s.Executor.Execute("iptables", "-t", "nat", "-A", "POSTROUTING", "-s", "10.200.0.0/24", "-j", "MASQUERADE")
+	s.ensureKGChains("nat")
+	masquerade := []string{"-s", WGSubnet(), "-j", "MASQUERADE"}
+	if _, err := s.Executor.Execute("iptables", append([]string{"-t", "nat", "-C", KGChain("POSTROUTING")}, masquerade...)...); err != nil {
+		s.Executor.Execute("iptables", append([]string{"-t", "nat", "-A", KGChain("POSTROUTING")}, masquerade...)...)
+	}
 
 	// Set default ACCEPT policies
 	s.Executor.Execute("iptables", "-P", "INPUT", "ACCEPT")
@@ -596,6 +883,178 @@ func (s *FirewallService) generateRawTableRules(settings *models.SecuritySetting
 	// NAT relies on Conntrack. If we NOTRACK them, players cannot connect.
 	// Instead, we rely on aggressive UDP timeouts in hardening.go to clear the table quickly.
 
+	writeCustomRules(&sb, s.loadCustomRules(), "raw", "PREROUTING", "OUTPUT")
 	sb.WriteString("COMMIT\n")
-	return sb.String(), nil
+	return intoKGChains(sb.String()), nil
+}
+
+// Default port lists for the "dangerous ports" mangle rules
+const (
+	DefaultBlockedDestPorts             = "1433,1521,3306,5432" // MSSQL, Oracle, MySQL, PostgreSQL
+	DefaultBlockedReflectionSourcePorts = "1900,11211"          // SSDP, memcached
+)
+
+// multiportMaxPorts is the iptables multiport match limit per rule
+const multiportMaxPorts = 15
+
+// ParsePortList parses a comma-separated port list, rejecting anything outside 1-65535.
+// Duplicates are removed and order is preserved.
+func ParsePortList(list string) ([]int, error) {
+	seen := make(map[int]bool)
+	ports := make([]int, 0)
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		port, err := strconv.Atoi(field)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid port: %s", field)
+		}
+		if seen[port] {
+			continue
+		}
+		seen[port] = true
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+// FormatPortList joins ports back into the comma-separated form stored in settings
+func FormatPortList(ports []int) string {
+	parts := make([]string, len(ports))
+	for i, p := range ports {
+		parts[i] = strconv.Itoa(p)
+	}
+	return strings.Join(parts, ",")
+}
+
+// multiportChunks splits ports into groups small enough for a single multiport match
+func multiportChunks(ports []int) []string {
+	specs := make([]string, len(ports))
+	for i, p := range ports {
+		specs[i] = strconv.Itoa(p)
+	}
+	return multiportSpecChunks(specs)
+}
+
+// multiportSpecChunks groups port specs ("27016" or "27016:27020") into multiport-sized lists.
+// iptables counts a range as two ports.
+func multiportSpecChunks(specs []string) []string {
+	var chunks []string
+	var current []string
+	weight := 0
+	for _, spec := range specs {
+		w := 1
+		if strings.Contains(spec, ":") {
+			w = 2
+		}
+		if weight+w > multiportMaxPorts {
+			chunks = append(chunks, strings.Join(current, ","))
+			current, weight = nil, 0
+		}
+		current = append(current, spec)
+		weight += w
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, strings.Join(current, ","))
+	}
+	return chunks
+}
+
+// Steam query bypass scopes
+const (
+	SteamQueryScopeGlobal   = "global"   // Any UDP port, or steam_query_ports when set
+	SteamQueryScopeServices = "services" // Only public ports of service ports flagged IsQueryPort
+)
+
+// steamQueryPortSpecs returns the destination ports the Steam query bypass is limited to.
+// nil means unrestricted (all UDP); an empty non-nil slice means no port qualifies.
+func steamQueryPortSpecs(settings *models.SecuritySettings, services []models.Service) []string {
+	if settings.SteamQueryScope == SteamQueryScopeServices {
+		specs := make([]string, 0)
+		for _, svc := range services {
+			for _, port := range svc.Ports {
+				if !port.IsQueryPort || strings.ToLower(port.Protocol) != "udp" {
+					continue
+				}
+				if port.PublicPortEnd > port.PublicPort {
+					specs = append(specs, fmt.Sprintf("%d:%d", port.PublicPort, port.PublicPortEnd))
+				} else {
+					specs = append(specs, strconv.Itoa(port.PublicPort))
+				}
+			}
+		}
+		return specs
+	}
+
+	ports, _ := ParsePortList(settings.SteamQueryPorts)
+	if len(ports) == 0 {
+		return nil
+	}
+	specs := make([]string, len(ports))
+	for i, p := range ports {
+		specs[i] = strconv.Itoa(p)
+	}
+	return specs
+}
+
+// steamBypassComment tags the Steam query bypass rules in GEO_GUARD
+const steamBypassComment = "steam_bypass"
+
+// SteamBypassStats reports how much traffic skipped GeoIP filtering via the Steam query bypass
+type SteamBypassStats struct {
+	Enabled bool   `json:"enabled"`
+	Ports   string `json:"ports"` // Empty = all UDP ports
+	Packets int64  `json:"packets"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// GetSteamBypassStats sums the packet/byte counters of the Steam query bypass rules
+func (s *FirewallService) GetSteamBypassStats(settings *models.SecuritySettings) SteamBypassStats {
+	stats := SteamBypassStats{
+		Enabled: settings.SteamQueryBypass,
+		Ports:   settings.SteamQueryPorts,
+	}
+	if !settings.SteamQueryBypass {
+		return stats
+	}
+
+	output, err := s.Executor.Execute("iptables", "-t", "mangle", "-L", "GEO_GUARD", "-v", "-n", "-x")
+	if err != nil {
+		return stats
+	}
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.Contains(line, "/* "+steamBypassComment+" */") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		pkts, _ := strconv.ParseInt(fields[0], 10, 64)
+		bytes, _ := strconv.ParseInt(fields[1], 10, 64)
+		stats.Packets += pkts
+		stats.Bytes += bytes
+	}
+	return stats
+}
+
+// IPSetEntryCount returns the number of entries in an ipset (-1 if unknown)
+func (s *FirewallService) IPSetEntryCount(name string) int {
+	if runtime.GOOS != "linux" {
+		return -1
+	}
+	out, err := s.Executor.Execute("ipset", "list", name, "-terse")
+	if err != nil {
+		return -1
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(line), "Number of entries:"); ok {
+			if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+				return n
+			}
+		}
+	}
+	return -1
 }
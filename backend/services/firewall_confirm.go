@@ -0,0 +1,228 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"os"
+	"strings"
+	"time"
+)
+
+// FirewallConfirmTimeout is how long an apply waits for ConfirmRules before it is rolled back
+const FirewallConfirmTimeout = 60 * time.Second
+
+// Snapshots of the rules in place before a confirmed apply
+const (
+	iptablesSnapshotPath  = "/tmp/iptables.rules.snapshot"
+	ip6tablesSnapshotPath = "/tmp/ip6tables.rules.snapshot"
+	ipsetSnapshotPath     = "/tmp/ipset.rules.snapshot"
+)
+
+// dynamicIPSets change between applies (offense promotion, flood blocks) and are rebuilt from
+// the database by every apply, so a rollback keeps their current entries instead of old ones
+var dynamicIPSets = map[string]bool{"ban": true, "ban6": true, "flood_blocked": true}
+
+// rollbackIPSets are the managed ipsets a rollback restores
+func rollbackIPSets() []ipsetDef {
+	var sets []ipsetDef
+	for _, def := range append(managedIPSets, managedIPSets6...) {
+		if !dynamicIPSets[def.name] {
+			sets = append(sets, def)
+		}
+	}
+	return sets
+}
+
+// Apply error kinds of the confirmation
+const (
+	FirewallErrorReverted = "reverted" // An unconfirmed apply was rolled back
+	FirewallErrorHeld     = "held"     // An automatic apply kept the rules a rollback restored
+)
+
+// ApplyRulesConfirmed is the apply of interactive callers (the admin UI and API). It applies the
+// rules like ApplyRules, after saving the current KG_ chains and rollbackIPSets. Unless
+// ConfirmRules is called within FirewallConfirmTimeout the saved rules are restored ("commit
+// confirmed"), so an apply that cuts off the management port undoes itself, and the ruleset is
+// marked so automatic applies don't bring it back while the settings still produce it.
+// Returns the confirmation deadline, or nil when no snapshot could be taken and the rules
+// were applied without a rollback.
+func (s *FirewallService) ApplyRulesConfirmed() (*time.Time, error) {
+	s.confirmMu.Lock()
+	defer s.confirmMu.Unlock()
+	s.rulesMu.Lock()
+	defer s.rulesMu.Unlock()
+
+	// A second apply before confirming keeps the first snapshot: that is the last known-good state
+	if s.confirmTimer == nil {
+		if err := s.snapshotRules(); err != nil {
+			system.Warn("Failed to save current firewall rules, applying without rollback: %v", err)
+			return nil, s.applyRules(true)
+		}
+	} else {
+		s.confirmTimer.Stop()
+	}
+
+	applyErr := s.applyRules(true)
+
+	deadline := time.Now().Add(FirewallConfirmTimeout)
+	s.confirmSeq++
+	seq := s.confirmSeq
+	s.confirmTimer = time.AfterFunc(FirewallConfirmTimeout, func() { s.revertUnconfirmed(seq) })
+	s.setConfirmDeadline(&deadline)
+	system.Info("Firewall rules applied, rolling back at %s unless confirmed", deadline.Format("15:04:05"))
+	return &deadline, applyErr
+}
+
+// ConfirmRules keeps the rules of a pending ApplyRulesConfirmed; false if none was pending
+func (s *FirewallService) ConfirmRules() bool {
+	s.confirmMu.Lock()
+	defer s.confirmMu.Unlock()
+	if s.confirmTimer == nil {
+		return false
+	}
+	s.confirmTimer.Stop()
+	s.confirmTimer = nil
+	s.setConfirmDeadline(nil)
+	os.Remove(iptablesSnapshotPath)
+	os.Remove(ip6tablesSnapshotPath)
+	os.Remove(ipsetSnapshotPath)
+	// The confirmed rules work, so a ruleset rolled back earlier may be retried by anyone again
+	s.setRevertedRulesHash("")
+	system.Info("Firewall rules confirmed")
+	return true
+}
+
+// snapshotRules saves KG-Proxy's iptables and ip6tables chains (see kgRulesOnly) and the
+// rollbackIPSets
+func (s *FirewallService) snapshotRules() error {
+	if missing := system.MissingBinaries("iptables-save", "ipset"); len(missing) > 0 {
+		return fmt.Errorf("missing %s", strings.Join(missing, ", "))
+	}
+	rules, err := s.Executor.Execute("iptables-save")
+	if err != nil {
+		return fmt.Errorf("iptables-save: %s", commandError(rules, err))
+	}
+	// IPv6 rules are saved whenever ip6tables is installed: the apply may switch IPv6 on or off
+	os.Remove(ip6tablesSnapshotPath)
+	if len(system.MissingBinaries("ip6tables-save")) == 0 {
+		if rules6, err := s.Executor.Execute("ip6tables-save"); err == nil {
+			if err := s.saveRulesToFile(ip6tablesSnapshotPath, kgRulesOnly(rules6)); err != nil {
+				return err
+			}
+		}
+	}
+	var sets strings.Builder
+	for _, def := range rollbackIPSets() {
+		// Sets that do not exist yet have nothing to restore
+		if out, err := s.Executor.Execute("ipset", "save", def.name); err == nil {
+			sets.WriteString(out)
+		}
+	}
+	if err := s.saveRulesToFile(iptablesSnapshotPath, kgRulesOnly(rules)); err != nil {
+		return err
+	}
+	return s.saveRulesToFile(ipsetSnapshotPath, sets.String())
+}
+
+// revertUnconfirmed restores the snapshot when the deadline of apply seq passes. A timer that
+// fired while a confirmation or newer apply held the lock finds a different seq and does nothing.
+func (s *FirewallService) revertUnconfirmed(seq int) {
+	s.confirmMu.Lock()
+	defer s.confirmMu.Unlock()
+	if s.confirmTimer == nil || s.confirmSeq != seq {
+		return
+	}
+	s.confirmTimer = nil
+	s.setConfirmDeadline(nil)
+
+	s.rulesMu.Lock()
+	defer s.rulesMu.Unlock()
+
+	system.Warn("Firewall apply was not confirmed within %s, restoring the previous rules", FirewallConfirmTimeout)
+
+	var failed []string
+	// Entries added by the apply must go, not just the old ones come back
+	for _, def := range rollbackIPSets() {
+		s.Executor.Execute("ipset", "flush", def.name)
+	}
+	if out, err := s.Executor.Execute("ipset", "restore", "-exist", "-f", ipsetSnapshotPath); err != nil {
+		failed = append(failed, fmt.Sprintf("ipset: %s", commandError(out, err)))
+	}
+	// Like ApplyRules, --noflush only replaces the KG_ chains; other tools' rules stay as they are now
+	if out, err := s.Executor.Execute("iptables-restore", "--noflush", iptablesSnapshotPath); err != nil {
+		failed = append(failed, fmt.Sprintf("iptables: %s", commandError(out, err)))
+	}
+	if _, err := os.Stat(ip6tablesSnapshotPath); err == nil {
+		if out, err := s.Executor.Execute("ip6tables-restore", "--noflush", ip6tablesSnapshotPath); err != nil {
+			failed = append(failed, fmt.Sprintf("ip6tables: %s", commandError(out, err)))
+		}
+	}
+
+	// The settings still produce the rolled back rules; automatic applies must not restore them
+	s.setRevertedRulesHash(s.confirmHash)
+
+	if len(failed) > 0 {
+		err := fmt.Errorf("unconfirmed firewall apply could not be rolled back: %s", strings.Join(failed, "; "))
+		system.Error("%v", err)
+		s.setApplyStatus(FirewallErrorReverted, err)
+		return
+	}
+	system.Warn("Previous firewall rules restored")
+	s.setApplyStatus(FirewallErrorReverted, fmt.Errorf("firewall apply was not confirmed within %s and was rolled back", FirewallConfirmTimeout))
+}
+
+func (s *FirewallService) setConfirmDeadline(deadline *time.Time) {
+	s.applyMu.Lock()
+	defer s.applyMu.Unlock()
+	s.applyStatus.ConfirmDeadline = deadline
+}
+
+func (s *FirewallService) setRevertedRulesHash(hash string) {
+	if err := s.DB.Model(&models.SecuritySettings{}).Where("id = ?", 1).UpdateColumn("reverted_rules_hash", hash).Error; err != nil {
+		system.Warn("Failed to record the rolled back firewall rules: %v", err)
+	}
+}
+
+// rulesFingerprint identifies a generated ruleset. The dynamicIPSets are left out: they change
+// between applies without the settings changing.
+func rulesFingerprint(ipsetRules, iptablesRules, rawRules string) string {
+	h := sha256.New()
+	for _, part := range []string{ipsetRulesFor(ipsetRules, false), iptablesRules, rawRules} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ipsetRulesFor keeps the lines of an ipset restore file that belong to the dynamicIPSets
+// (dynamic true) or to the other sets (dynamic false)
+func ipsetRulesFor(rules string, dynamic bool) string {
+	var sb strings.Builder
+	for _, line := range strings.Split(rules, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || dynamicIPSets[fields[1]] != dynamic {
+			continue
+		}
+		sb.WriteString(line)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// applyHeldBack is what an automatic apply does when the settings produce the ruleset a
+// rollback removed: only the dynamicIPSets are brought up to date, the rest of the rules stay
+// as the rollback left them until an interactive apply is confirmed.
+func (s *FirewallService) applyHeldBack(ipsetRules string) error {
+	if err := s.saveRulesToFile(ipsetRulesPath, ipsetRulesFor(ipsetRules, true)); err != nil {
+		system.Warn("Failed to save ipset rules: %v", err)
+	} else if out, err := s.Executor.Execute("ipset", "restore", "-f", ipsetRulesPath); err != nil {
+		system.Warn("ipset rejected ban list update: %s", commandError(out, err))
+	}
+	err := fmt.Errorf("firewall rules held back: the current settings produce the rules of an apply that was not confirmed and was rolled back; apply them again and confirm to retry")
+	system.Warn("%v", err)
+	s.setApplyStatus(FirewallErrorHeld, err)
+	return err
+}
@@ -0,0 +1,62 @@
+package services
+
+import "testing"
+
+func TestKGRulesOnly(t *testing.T) {
+	saved := `# Generated by iptables-save v1.8.7
+*security
+:INPUT ACCEPT [0:0]
+COMMIT
+*filter
+:INPUT DROP [10:600]
+:FORWARD DROP [0:0]
+:OUTPUT ACCEPT [0:0]
+:DOCKER - [0:0]
+:KG_INPUT - [0:0]
+:f2b-sshd - [0:0]
+-A INPUT -j KG_INPUT
+-A INPUT -p tcp -m multiport --dports 22 -j f2b-sshd
+-A DOCKER -d 172.17.0.2/32 -j ACCEPT
+-A KG_INPUT -p tcp --dport 22 -j ACCEPT
+-A f2b-sshd -s 192.0.2.1/32 -j REJECT
+COMMIT
+*mangle
+:PREROUTING ACCEPT [0:0]
+:GEO_GUARD - [0:0]
+-A GEO_GUARD -j DROP
+COMMIT
+`
+	want := `*filter
+:INPUT DROP [10:600]
+:FORWARD DROP [0:0]
+:OUTPUT ACCEPT [0:0]
+:KG_INPUT - [0:0]
+-A KG_INPUT -p tcp --dport 22 -j ACCEPT
+COMMIT
+*mangle
+:PREROUTING ACCEPT [0:0]
+:GEO_GUARD - [0:0]
+-A GEO_GUARD -j DROP
+COMMIT
+`
+	if got := kgRulesOnly(saved); got != want {
+		t.Errorf("kgRulesOnly() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRulesFingerprintIgnoresDynamicSets(t *testing.T) {
+	ipset := "create geo_allowed hash:net -exist\ncreate ban hash:ip -exist\nflush geo_allowed\nflush ban\nadd geo_allowed 1.0.0.0/24\n"
+	base := rulesFingerprint(ipset, "*filter\nCOMMIT\n", "*raw\nCOMMIT\n")
+
+	if got := rulesFingerprint(ipset+"add ban 192.0.2.1\n", "*filter\nCOMMIT\n", "*raw\nCOMMIT\n"); got != base {
+		t.Error("a new ban changed the fingerprint")
+	}
+	if got := rulesFingerprint(ipset+"add geo_allowed 2.0.0.0/24\n", "*filter\nCOMMIT\n", "*raw\nCOMMIT\n"); got == base {
+		t.Error("a geo_allowed change kept the fingerprint")
+	}
+
+	want := "create ban hash:ip -exist\nflush ban\nadd ban 192.0.2.1\n"
+	if got := ipsetRulesFor(ipset+"add ban 192.0.2.1\n", true); got != want {
+		t.Errorf("ipsetRulesFor(dynamic) = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"net"
+	"strings"
+)
+
+// IPv6 is filtered by a smaller ruleset than IPv4: game traffic is forwarded to origins over
+// the IPv4 WireGuard subnet and the GeoIP data is IPv4 only, so over IPv6 the host only serves
+// management and WireGuard. Allow and ban entries with IPv6 addresses go to their own sets.
+
+// ip6tablesRulesPath is where ApplyRules writes the generated IPv6 rules before restoring them
+const ip6tablesRulesPath = "/tmp/ip6tables.rules.v6"
+
+// managedIPSets6 hold the IPv6 entries of white_list and ban while IPv6 is enabled
+var managedIPSets6 = []ipsetDef{
+	{"white_list6", "hash:net family inet6 maxelem 100000 comment", true},
+	{"ban6", "hash:net family inet6 maxelem 100000 comment", true},
+}
+
+// isIPv6Entry reports whether an IP or CIDR list entry is an IPv6 address
+func isIPv6Entry(entry string) bool {
+	addr := strings.SplitN(strings.TrimSpace(entry), "/", 2)[0]
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.To4() == nil
+}
+
+// ipsetFor returns the set an entry belongs in: set itself for IPv4, its IPv6 twin (e.g.
+// ban6) for IPv6. ok is false for an IPv6 entry while IPv6 is disabled, or without a twin.
+func ipsetFor(set, entry string, ipv6 bool) (name string, ok bool) {
+	if !isIPv6Entry(entry) {
+		return set, true
+	}
+	if !ipv6 {
+		return "", false
+	}
+	for _, def := range managedIPSets6 {
+		if def.name == set+"6" {
+			return def.name, true
+		}
+	}
+	return "", false
+}
+
+// generateIP6TablesRules generates the IPv6 mangle rules: WireGuard and the management ports
+// are always let through, banned sources dropped, and the protocol sanity checks of the IPv4
+// ruleset applied while global protection is on. Other sources are not geo filtered.
+func (s *FirewallService) generateIP6TablesRules(settings *models.SecuritySettings) (string, error) {
+	var sb strings.Builder
+
+	sb.WriteString("*mangle\n")
+	sb.WriteString(":PREROUTING ACCEPT [0:0]\n")
+	sb.WriteString(":INPUT ACCEPT [0:0]\n")
+	sb.WriteString(":FORWARD ACCEPT [0:0]\n")
+	sb.WriteString(":OUTPUT ACCEPT [0:0]\n")
+	sb.WriteString(":POSTROUTING ACCEPT [0:0]\n")
+	sb.WriteString(":GEO_GUARD - [0:0]\n")
+
+	// WireGuard over IPv6
+	sb.WriteString("-A PREROUTING -i wg+ -j ACCEPT\n")
+	sb.WriteString("-A PREROUTING -p udp --dport 51820 -j ACCEPT\n")
+
+	if settings.GlobalProtection {
+		sb.WriteString("-A PREROUTING -m conntrack --ctstate INVALID -j DROP\n")
+		sb.WriteString("-A PREROUTING -p tcp --tcp-flags SYN,FIN SYN,FIN -j DROP\n")
+		sb.WriteString("-A PREROUTING -p tcp --tcp-flags SYN,RST SYN,RST -j DROP\n")
+		sb.WriteString("-A PREROUTING -p tcp --tcp-flags FIN,RST FIN,RST -j DROP\n")
+		sb.WriteString("-A PREROUTING -p tcp --tcp-flags ALL NONE -j DROP\n")
+		sb.WriteString("-A PREROUTING -p tcp --tcp-flags FIN,PSH,URG FIN,PSH,URG -j DROP\n")
+		sb.WriteString("-A PREROUTING -p tcp ! --syn -m conntrack --ctstate NEW -j DROP\n")
+	}
+
+	sb.WriteString("-A PREROUTING -j GEO_GUARD\n")
+	sb.WriteString("-A GEO_GUARD -m conntrack --ctstate RELATED,ESTABLISHED -j RETURN\n")
+
+	// Neighbor discovery and path MTU discovery cannot be filtered without breaking IPv6
+	sb.WriteString("-A GEO_GUARD -p ipv6-icmp -j RETURN\n")
+
+	// Management ports and WireGuard, as in the IPv4 GEO_GUARD
+	if system.IsListenPublic() {
+		sb.WriteString(fmt.Sprintf("-A GEO_GUARD -p tcp -m multiport --dports 22,80,443,%d -j RETURN\n", system.GetListenPort()))
+	} else {
+		sb.WriteString("-A GEO_GUARD -p tcp -m multiport --dports 22,80,443 -j RETURN\n")
+	}
+	sb.WriteString("-A GEO_GUARD -p udp --dport 51820 -j RETURN\n")
+
+	// Loopback, link-local and unique local addresses
+	sb.WriteString("-A GEO_GUARD -s ::1/128 -j RETURN\n")
+	sb.WriteString("-A GEO_GUARD -s fe80::/10 -j RETURN\n")
+	sb.WriteString("-A GEO_GUARD -s fc00::/7 -j RETURN\n")
+
+	sb.WriteString("-A GEO_GUARD -m set --match-set white_list6 src -j RETURN\n")
+	sb.WriteString("-A GEO_GUARD -m set --match-set ban6 src -j DROP\n")
+
+	sb.WriteString("COMMIT\n")
+	return intoKGChains(sb.String()), nil
+}
+
+// applyIPv6Rules restores the IPv6 ruleset when IPv6 is enabled, and empties KG-Proxy's IPv6
+// chains otherwise. Returns the rejection message, if any.
+func (s *FirewallService) applyIPv6Rules(settings *models.SecuritySettings) string {
+	if !settings.EnableIPv6 {
+		if len(system.MissingBinaries("ip6tables")) == 0 {
+			s.flushKGChainsWith("ip6tables", "mangle")
+		}
+		return ""
+	}
+
+	rules, err := s.generateIP6TablesRules(settings)
+	if err != nil {
+		return fmt.Sprintf("ip6tables: %v", err)
+	}
+	if err := s.saveRulesToFile(ip6tablesRulesPath, rules); err != nil {
+		system.Warn("Failed to save ip6tables rules: %v", err)
+	}
+	if missing := system.MissingBinaries("ip6tables-restore"); len(missing) > 0 {
+		system.Error("IPv6 enabled, but %s is not installed", strings.Join(missing, ", "))
+		return "ip6tables: missing " + strings.Join(missing, ", ")
+	}
+	if out, err := s.Executor.Execute("ip6tables-restore", "--noflush", ip6tablesRulesPath); err != nil {
+		system.Error("ip6tables-restore rejected rules: %v: %s", err, strings.TrimSpace(out))
+		return fmt.Sprintf("ip6tables: %s", commandError(out, err))
+	}
+	s.ensureKGChainsWith("ip6tables", "mangle")
+	system.Info("IP6Tables rules applied successfully")
+	return ""
+}
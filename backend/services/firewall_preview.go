@@ -0,0 +1,75 @@
+package services
+
+import (
+	"kg-proxy-web-gui/backend/system"
+	"strings"
+	"time"
+)
+
+// FirewallPreview is the ruleset ApplyRules would write, generated without applying anything
+type FirewallPreview struct {
+	IPSetRules       string   `json:"ipset_rules"`               // Contents of /tmp/ipset.rules
+	IPTablesRules    string   `json:"iptables_rules"`            // Contents of /tmp/iptables.rules.v4
+	RawRules         string   `json:"raw_rules"`                 // Contents of /tmp/iptables.rules.raw
+	IP6TablesRules   string   `json:"ip6tables_rules,omitempty"` // Contents of /tmp/ip6tables.rules.v6 (IPv6 enabled only)
+	PrimaryInterface string   `json:"primary_interface"`
+	Interfaces       []string `json:"interfaces"` // Primary first, then additional protected interfaces
+	GeoMode          string   `json:"geo_mode"`
+	Countries        []string `json:"countries"`         // Allowed countries after geo schedules (blocked countries in block mode)
+	MissingCountries []string `json:"missing_countries"` // No ranges cached yet: downloaded on apply, absent from this preview
+	Maintenance      bool     `json:"maintenance"`       // Apply would install the maintenance bypass instead of these rules
+}
+
+// PreviewRules generates the ipset and iptables rulesets ApplyRules would restore, using the
+// current settings and cached country ranges. Nothing is downloaded, written or executed.
+func (s *FirewallService) PreviewRules() (*FirewallPreview, error) {
+	settings, _ := s.loadRuleSettings()
+
+	ipsetRules, err := s.generateIPSetRules(&settings, false)
+	if err != nil {
+		return nil, err
+	}
+	iptablesRules, err := s.generateIPTablesRules(&settings)
+	if err != nil {
+		return nil, err
+	}
+	rawRules, err := s.generateRawTableRules(&settings)
+	if err != nil {
+		return nil, err
+	}
+
+	var ip6tablesRules string
+	if settings.EnableIPv6 {
+		if ip6tablesRules, err = s.generateIP6TablesRules(&settings); err != nil {
+			return nil, err
+		}
+	}
+
+	preview := &FirewallPreview{
+		IPSetRules:       ipsetRules,
+		IPTablesRules:    iptablesRules,
+		RawRules:         rawRules,
+		IP6TablesRules:   ip6tablesRules,
+		PrimaryInterface: system.GetDefaultInterface(),
+		Interfaces:       system.GetProtectedInterfaces(),
+		GeoMode:          GeoModeAllow,
+		Maintenance:      settings.MaintenanceUntil != nil && settings.MaintenanceUntil.After(time.Now()),
+	}
+
+	countries := strings.Split(settings.GeoAllowCountries, ",")
+	if GeoBlockModeActive(&settings) {
+		preview.GeoMode = GeoModeBlock
+		countries = GeoBlockCountries(&settings)
+	}
+	for _, cc := range countries {
+		cc = strings.ToUpper(strings.TrimSpace(cc))
+		if cc == "" {
+			continue
+		}
+		preview.Countries = append(preview.Countries, cc)
+		if s.GeoIP != nil && cc != UnknownCountryCode && len(s.GeoIP.GetCountryCIDRs(cc)) == 0 {
+			preview.MissingCountries = append(preview.MissingCountries, cc)
+		}
+	}
+	return preview, nil
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"kg-proxy-web-gui/backend/models"
 	"kg-proxy-web-gui/backend/system"
+	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"gorm.io/gorm"
@@ -23,8 +25,39 @@ type FloodProtection struct {
 	webhook *WebhookService
 	geoip   *GeoIPService
 
+	// Repeat offender tracking
+	offenses *OffenseTracker
+
+	// Per-level warmup overrides (index = protection level); see FloodGraceConfig for the defaults
+	graceOverrides [3]FloodGraceConfig
+
+	// Per-reason block duration overrides (index = block reason code), zero values use the level duration
+	blockDurations [5]time.Duration
+
 	// Optimization: Buffered channel for attack events to prevent goroutine explosion
 	attackQueue chan models.AttackEvent
+
+	// Flood block writes, applied in order by one worker (see flood_persist.go)
+	persistQueue chan floodPersistOp
+
+	// Country resolution pool between attackQueue and the batching consumer (see flood_resolve.go)
+	resolvedQueue     chan models.AttackEvent
+	geoWorkers        atomic.Int32 // Target pool size
+	geoWorkersRunning atomic.Int32
+	geoResolved       atomic.Uint64
+	geoResolveNanos   atomic.Uint64
+	attackDropped     atomic.Uint64
+	resolveSample     geoResolveSample
+}
+
+// FloodGraceDefault as a grace period keeps the protection level's built-in one; 0 disables grace
+const FloodGraceDefault = -1
+
+// FloodGraceConfig controls how long a newly-seen IP is observed before it can be blocked.
+// A negative GracePeriod or zero MinSamples keeps the level default.
+type FloodGraceConfig struct {
+	GracePeriod time.Duration
+	MinSamples  int
 }
 
 type ConnectionTracker struct {
@@ -44,14 +77,21 @@ func NewFloodProtection(level int) *FloodProtection {
 		ipConnections: make(map[string]*ConnectionTracker),
 		stopChan:      make(chan struct{}),
 		attackQueue:   make(chan models.AttackEvent, 1000), // Buffer 1000 events
+		resolvedQueue: make(chan models.AttackEvent, 1000),
+		persistQueue:  make(chan floodPersistOp, floodPersistQueueSize),
+	}
+	for i := range fp.graceOverrides {
+		fp.graceOverrides[i].GracePeriod = FloodGraceDefault
 	}
 
 	// Start cleanup goroutine
 	fp.cleanupTicker = time.NewTicker(1 * time.Minute)
 	go fp.cleanupRoutine()
 
-	// Start attack event worker
+	// Start attack event workers: country lookups in a pool, DB batching in one consumer
+	fp.SetGeoResolveWorkers(defaultGeoResolveWorkers)
 	go fp.processAttackQueue()
+	go fp.processPersistQueue()
 
 	return fp
 }
@@ -65,8 +105,20 @@ func (fp *FloodProtection) SetServices(db *gorm.DB, webhook *WebhookService, geo
 	fp.geoip = geoip
 }
 
+// SetOffenseTracker sets the tracker notified when an IP gets blocked
+func (fp *FloodProtection) SetOffenseTracker(t *OffenseTracker) {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	fp.offenses = t
+}
+
 // CheckIP returns true if IP should be blocked
 func (fp *FloodProtection) CheckIP(ip string, packetCount int, byteCount int64) bool {
+	// Internal health checks and origin traffic are never flood candidates
+	if IsInternalIP(net.ParseIP(ip)) {
+		return false
+	}
+
 	fp.mu.Lock()
 	defer fp.mu.Unlock()
 
@@ -94,6 +146,13 @@ func (fp *FloodProtection) CheckIP(ip string, packetCount int, byteCount int64)
 
 	// Get thresholds based on protection level
 	thresholds := fp.getThresholds()
+	blockFor := fp.reasonDuration(BlockReasonFlood)
+
+	// Warmup: bursty game clients (map downloads, initial connection floods) look like floods
+	// on the first measurement. Don't count violations until the IP has been observed long enough.
+	if time.Since(tracker.FirstSeen) < thresholds.GracePeriod || tracker.Count < thresholds.MinSamples {
+		return false
+	}
 
 	// Check connection rate
 	duration := time.Since(tracker.FirstSeen).Seconds()
@@ -105,8 +164,10 @@ func (fp *FloodProtection) CheckIP(ip string, packetCount int, byteCount int64)
 
 			if tracker.Violations >= thresholds.MaxViolations {
 				tracker.Blocked = true
-				tracker.BlockedUntil = time.Now().Add(thresholds.BlockDuration)
+				tracker.BlockedUntil = time.Now().Add(blockFor)
+				fp.persistBlock(ip, "Connection Flood", tracker.BlockedUntil)
 				fp.recordAttack(ip, "Connection Flood", int64(tracker.PacketsPerSec))
+				fp.recordOffense(ip, "Connection Flood")
 				return true
 			}
 		}
@@ -118,8 +179,10 @@ func (fp *FloodProtection) CheckIP(ip string, packetCount int, byteCount int64)
 
 		if tracker.Violations >= thresholds.MaxViolations {
 			tracker.Blocked = true
-			tracker.BlockedUntil = time.Now().Add(thresholds.BlockDuration)
+			tracker.BlockedUntil = time.Now().Add(blockFor)
+			fp.persistBlock(ip, "PPS Flood", tracker.BlockedUntil)
 			fp.recordAttack(ip, "PPS Flood", int64(tracker.PacketsPerSec))
+			fp.recordOffense(ip, "PPS Flood")
 			return true
 		}
 	}
@@ -130,8 +193,10 @@ func (fp *FloodProtection) CheckIP(ip string, packetCount int, byteCount int64)
 
 		if tracker.Violations >= thresholds.MaxViolations {
 			tracker.Blocked = true
-			tracker.BlockedUntil = time.Now().Add(thresholds.BlockDuration)
+			tracker.BlockedUntil = time.Now().Add(blockFor)
+			fp.persistBlock(ip, "Bandwidth Flood", tracker.BlockedUntil)
 			fp.recordAttack(ip, "Bandwidth Flood", int64(tracker.PacketsPerSec))
+			fp.recordOffense(ip, "Bandwidth Flood")
 			return true
 		}
 	}
@@ -145,37 +210,151 @@ type ProtectionThresholds struct {
 	MaxBytesPerSec   int64
 	MaxViolations    int
 	BlockDuration    time.Duration
+	GracePeriod      time.Duration // New IPs can't be blocked until observed this long
+	MinSamples       int           // ...and measured at least this many times
 }
 
 func (fp *FloodProtection) getThresholds() ProtectionThresholds {
-	switch fp.level {
+	return fp.levelThresholds(fp.level)
+}
+
+// levelThresholds returns the thresholds of a protection level, including operator overrides
+func (fp *FloodProtection) levelThresholds(level int) ProtectionThresholds {
+	var t ProtectionThresholds
+
+	switch level {
 	case 0: // Low
-		return ProtectionThresholds{
+		t = ProtectionThresholds{
 			MaxConnPerSec:    100,
 			MaxPacketsPerSec: 50000,             // Increased for Arma Reforger
 			MaxBytesPerSec:   100 * 1024 * 1024, // 100 MB/s
 			MaxViolations:    10,
 			BlockDuration:    5 * time.Minute,
-		}
-	case 1: // Standard
-		return ProtectionThresholds{
-			MaxConnPerSec:    50,
-			MaxPacketsPerSec: 30000,            // Increased for Arma Reforger
-			MaxBytesPerSec:   50 * 1024 * 1024, // 50 MB/s
-			MaxViolations:    5,
-			BlockDuration:    10 * time.Minute,
+			GracePeriod:      30 * time.Second,
+			MinSamples:       5,
 		}
 	case 2: // High
-		return ProtectionThresholds{
+		t = ProtectionThresholds{
 			MaxConnPerSec:    20,
 			MaxPacketsPerSec: 20000,            // Increased for Arma Reforger
 			MaxBytesPerSec:   20 * 1024 * 1024, // 20 MB/s
 			MaxViolations:    3,
 			BlockDuration:    30 * time.Minute,
+			GracePeriod:      5 * time.Second,
+			MinSamples:       2,
 		}
-	default:
-		return fp.getThresholds() // Default to standard
+	default: // Standard (also used for unknown levels)
+		level = 1
+		t = ProtectionThresholds{
+			MaxConnPerSec:    50,
+			MaxPacketsPerSec: 30000,            // Increased for Arma Reforger
+			MaxBytesPerSec:   50 * 1024 * 1024, // 50 MB/s
+			MaxViolations:    5,
+			BlockDuration:    10 * time.Minute,
+			GracePeriod:      15 * time.Second,
+			MinSamples:       3,
+		}
+	}
+
+	// Operator overrides for this level
+	if o := fp.graceOverrides[level]; o.customized() {
+		if o.GracePeriod >= 0 {
+			t.GracePeriod = o.GracePeriod
+		}
+		if o.MinSamples > 0 {
+			t.MinSamples = o.MinSamples
+		}
+	}
+
+	return t
+}
+
+// customized reports whether the override changes any level default
+func (o FloodGraceConfig) customized() bool {
+	return o.GracePeriod >= 0 || o.MinSamples > 0
+}
+
+// SetGraceConfig overrides the warmup settings of one protection level. A negative
+// gracePeriod or zero minSamples keeps the default; a zero gracePeriod disables grace.
+func (fp *FloodProtection) SetGraceConfig(level int, gracePeriod time.Duration, minSamples int) {
+	if level < 0 || level >= len(fp.graceOverrides) {
+		return
+	}
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	fp.graceOverrides[level] = FloodGraceConfig{GracePeriod: gracePeriod, MinSamples: minSamples}
+}
+
+// ApplyGraceSettings loads the per-level warmup overrides from security settings
+func (fp *FloodProtection) ApplyGraceSettings(settings *models.SecuritySettings) {
+	fp.SetGraceConfig(0, graceSeconds(settings.FloodGraceSecLow), settings.FloodMinSamplesLow)
+	fp.SetGraceConfig(1, graceSeconds(settings.FloodGraceSecStandard), settings.FloodMinSamplesStandard)
+	fp.SetGraceConfig(2, graceSeconds(settings.FloodGraceSecHigh), settings.FloodMinSamplesHigh)
+}
+
+// graceSeconds converts a grace period setting, keeping negative values as FloodGraceDefault
+func graceSeconds(sec int) time.Duration {
+	if sec < 0 {
+		return FloodGraceDefault
+	}
+	return time.Duration(sec) * time.Second
+}
+
+// FloodThresholds is the JSON view of one protection level's effective thresholds
+type FloodThresholds struct {
+	Level            int     `json:"level"`
+	Name             string  `json:"name"`
+	MaxConnPerSec    float64 `json:"max_conn_per_sec"`
+	MaxPacketsPerSec int     `json:"max_packets_per_sec"`
+	MaxBytesPerSec   int64   `json:"max_bytes_per_sec"`
+	MaxViolations    int     `json:"max_violations"`
+	BlockDurationSec int     `json:"block_duration_sec"`
+	GracePeriodSec   int     `json:"grace_period_sec"`
+	MinSamples       int     `json:"min_samples"`
+	Customized       bool    `json:"customized"` // Grace period or min samples overridden in settings
+}
+
+// protectionLevelNames maps levels to the names shown in the UI
+var protectionLevelNames = [3]string{"Low", "Standard", "High"}
+
+// GetThresholds returns the effective thresholds of the current level and of every level
+func (fp *FloodProtection) GetThresholds() (FloodThresholds, []FloodThresholds) {
+	fp.mu.RLock()
+	defer fp.mu.RUnlock()
+
+	levels := make([]FloodThresholds, 0, len(protectionLevelNames))
+	for level := range protectionLevelNames {
+		levels = append(levels, fp.thresholdsForLevel(level))
 	}
+	current := fp.level
+	if current < 0 || current >= len(levels) {
+		current = 1 // getThresholds treats unknown levels as Standard
+	}
+	return levels[current], levels
+}
+
+// thresholdsForLevel builds the JSON view of a level. Caller holds fp.mu.
+func (fp *FloodProtection) thresholdsForLevel(level int) FloodThresholds {
+	t := fp.levelThresholds(level)
+
+	o := fp.graceOverrides[level]
+	return FloodThresholds{
+		Level:            level,
+		Name:             protectionLevelNames[level],
+		MaxConnPerSec:    t.MaxConnPerSec,
+		MaxPacketsPerSec: t.MaxPacketsPerSec,
+		MaxBytesPerSec:   t.MaxBytesPerSec,
+		MaxViolations:    t.MaxViolations,
+		BlockDurationSec: int(t.BlockDuration.Seconds()),
+		GracePeriodSec:   int(t.GracePeriod.Seconds()),
+		MinSamples:       t.MinSamples,
+		Customized:       o.customized(),
+	}
+}
+
+// blockDuration returns the block duration of flood blocks
+func (fp *FloodProtection) blockDuration() time.Duration {
+	return fp.BlockDurationFor(BlockReasonFlood)
 }
 
 // SetLevel updates protection level
@@ -202,6 +381,60 @@ func (fp *FloodProtection) GetBlockedIPs() []string {
 	return blocked
 }
 
+// GetBlockedExpiries returns currently blocked IPs with the time their block ends
+func (fp *FloodProtection) GetBlockedExpiries() map[string]time.Time {
+	fp.mu.RLock()
+	defer fp.mu.RUnlock()
+
+	blocked := make(map[string]time.Time)
+	now := time.Now()
+	for ip, tracker := range fp.ipConnections {
+		if tracker.Blocked && now.Before(tracker.BlockedUntil) {
+			blocked[ip] = tracker.BlockedUntil
+		}
+	}
+	return blocked
+}
+
+// FloodTrackerInfo is a snapshot of a tracked source that is currently misbehaving
+type FloodTrackerInfo struct {
+	IP            string    `json:"ip"`
+	PacketsPerSec int       `json:"pps"`
+	BytesPerSec   int64     `json:"bps"`
+	Violations    int       `json:"violations"`
+	Blocked       bool      `json:"blocked"`
+	BlockedUntil  time.Time `json:"blocked_until,omitempty"`
+	LastSeen      time.Time `json:"last_seen"`
+}
+
+// GetActiveTrackers returns sources that are blocked or have open violations
+func (fp *FloodProtection) GetActiveTrackers() []FloodTrackerInfo {
+	fp.mu.RLock()
+	defer fp.mu.RUnlock()
+
+	now := time.Now()
+	active := make([]FloodTrackerInfo, 0)
+	for ip, tracker := range fp.ipConnections {
+		blocked := tracker.Blocked && now.Before(tracker.BlockedUntil)
+		if !blocked && tracker.Violations == 0 {
+			continue
+		}
+		info := FloodTrackerInfo{
+			IP:            ip,
+			PacketsPerSec: tracker.PacketsPerSec,
+			BytesPerSec:   tracker.BytesPerSec,
+			Violations:    tracker.Violations,
+			Blocked:       blocked,
+			LastSeen:      tracker.LastSeen,
+		}
+		if blocked {
+			info.BlockedUntil = tracker.BlockedUntil
+		}
+		active = append(active, info)
+	}
+	return active
+}
+
 // UnblockIP manually unblocks an IP
 func (fp *FloodProtection) UnblockIP(ip string) {
 	fp.mu.Lock()
@@ -210,18 +443,21 @@ func (fp *FloodProtection) UnblockIP(ip string) {
 	if tracker, exists := fp.ipConnections[ip]; exists {
 		tracker.Blocked = false
 		tracker.Violations = 0
+		fp.forgetBlock(ip)
+	}
+}
+
+// recordOffense reports a new block to the repeat offender tracker
+func (fp *FloodProtection) recordOffense(ip string, attackType string) {
+	if fp.offenses != nil {
+		fp.offenses.RecordBlock(ip, attackType)
 	}
 }
 
 // recordAttack queues an attack event for processing
 // Non-blocking: If queue is full, event is dropped to protect system stability
 func (fp *FloodProtection) recordAttack(ip string, attackType string, pps int64) {
-	// 1. Resolve Country (Fast enough to do here, or move to worker if needed)
-	// Moving to worker is better to avoid holding lock/cpu here,
-	// but CheckIP holds lock, so we already have lock contention.
-	// Actually CheckIP calls this inside a goroutine in the old code.
-	// In new code, we want this to be instant.
-
+	// Country is resolved later by the worker pool; CheckIP holds the lock, so this must be instant
 	select {
 	case fp.attackQueue <- models.AttackEvent{
 		Timestamp:  time.Now(),
@@ -233,6 +469,7 @@ func (fp *FloodProtection) recordAttack(ip string, attackType string, pps int64)
 		// Queued successfully
 	default:
 		// Queue full - dropping event to save system
+		fp.attackDropped.Add(1)
 		system.Warn("FloodProtection queue full, dropping alert for %s", ip)
 	}
 }
@@ -260,11 +497,31 @@ func (fp *FloodProtection) processAttackQueue() {
 		// Bulk Insert into DB
 		if fp.db != nil {
 			// CreateInBatches is more efficient than single inserts
-			if err := fp.db.CreateInBatches(batch, batchSize).Error; err != nil {
+			if err := storeAttackEvents(fp.db, batch, batchSize); err != nil {
 				system.Warn("Failed to batch insert attack events: %v", err)
+			} else {
+				// Every flood event is a block decision: keep a history entry tied to it
+				expiresAt := time.Now().Add(fp.blockDuration())
+				history := make([]models.BlockHistory, 0, len(batch))
+				for i := range batch {
+					history = append(history, models.BlockHistory{
+						Timestamp:     batch[i].Timestamp,
+						IP:            batch[i].SourceIP,
+						Action:        BlockActionBlocked,
+						Reason:        "flood",
+						Source:        "flood",
+						ExpiresAt:     &expiresAt,
+						AttackEventID: &batch[i].ID,
+						Details:       batch[i].AttackType,
+					})
+				}
+				LogBlockHistoryBatch(fp.db, history)
 			}
 		}
 
+		// Live feed (IDs are populated when the insert succeeded)
+		PublishAttacks(batch)
+
 		// Reset batch
 		batch = make([]models.AttackEvent, 0, batchSize)
 	}
@@ -304,13 +561,8 @@ func (fp *FloodProtection) processAttackQueue() {
 			flushWebhook()
 			return
 
-		case event := <-fp.attackQueue:
-			// 1. Resolve Country (CPU work done here)
-			if fp.geoip != nil {
-				countryName, countryCode := fp.geoip.GetCountry(event.SourceIP)
-				event.CountryName = countryName
-				event.CountryCode = countryCode
-			}
+		case event := <-fp.resolvedQueue:
+			// 1. Country already resolved by the worker pool
 
 			// 2. Add to Webhook Buffer (aggregated, not immediate)
 			if len(webhookBuffer) < 50 {
@@ -365,6 +617,7 @@ func (fp *FloodProtection) GetStats() map[string]interface{} {
 		"total_tracked_ips": totalIPs,
 		"blocked_ips":       blockedCount,
 		"protection_level":  fp.level,
+		"geo_resolve":       fp.GetGeoResolveStats(),
 	}
 }
 
@@ -399,8 +652,9 @@ func (fp *FloodProtection) cleanup() {
 
 	// Optimization: Clean old attack logs from DB (Retention: 7 days)
 	if fp.db != nil {
-		cutoff := now.AddDate(0, 0, -7)
+		cutoff := now.Add(-AttackEventRetention)
 		fp.db.Where("timestamp < ?", cutoff).Delete(&models.AttackEvent{})
+		fp.db.Where("blocked_until <= ?", now).Delete(&models.FloodBlock{})
 	}
 }
 
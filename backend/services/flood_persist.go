@@ -0,0 +1,112 @@
+package services
+
+import (
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RestoreBlocks reloads unexpired flood blocks saved by a previous run and drops expired rows.
+// Call before the first ApplyRules so flood_blocked is populated with the remaining TTLs.
+func (fp *FloodProtection) RestoreBlocks(db *gorm.DB) int {
+	if db == nil {
+		return 0
+	}
+
+	now := time.Now()
+	db.Where("blocked_until <= ?", now).Delete(&models.FloodBlock{})
+
+	var rows []models.FloodBlock
+	if err := db.Find(&rows).Error; err != nil {
+		system.Warn("Failed to load persisted flood blocks: %v", err)
+		return 0
+	}
+
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	for _, row := range rows {
+		tracker, exists := fp.ipConnections[row.IP]
+		if !exists {
+			tracker = &ConnectionTracker{FirstSeen: row.CreatedAt, LastSeen: now}
+			fp.ipConnections[row.IP] = tracker
+		}
+		tracker.Blocked = true
+		tracker.BlockedUntil = row.BlockedUntil
+	}
+	if len(rows) > 0 {
+		system.Info("Restored %d flood blocks from previous run", len(rows))
+	}
+	return len(rows)
+}
+
+// floodPersistQueueSize bounds the flood block writes waiting for the database
+const floodPersistQueueSize = 1000
+
+// floodPersistOp is a flood block write; forget deletes the IP's row instead of saving it
+type floodPersistOp struct {
+	db         *gorm.DB
+	ip         string
+	attackType string
+	until      time.Time
+	forget     bool
+}
+
+// persistBlock saves a new flood block (caller holds lock; the write is queued)
+func (fp *FloodProtection) persistBlock(ip string, attackType string, until time.Time) {
+	fp.queuePersist(floodPersistOp{db: fp.db, ip: ip, attackType: attackType, until: until})
+}
+
+// forgetBlock removes the persisted block of an unblocked IP (caller holds lock; the write is queued)
+func (fp *FloodProtection) forgetBlock(ip string) {
+	fp.queuePersist(floodPersistOp{db: fp.db, ip: ip, forget: true})
+}
+
+// queuePersist hands a write to processPersistQueue. One worker keeps a block and its removal
+// in order; CheckIP holds the lock, so a full queue drops the write instead of waiting.
+func (fp *FloodProtection) queuePersist(op floodPersistOp) {
+	if op.db == nil {
+		return
+	}
+	select {
+	case fp.persistQueue <- op:
+	default:
+		system.Warn("Flood block persist queue full, not saving %s", op.ip)
+	}
+}
+
+// processPersistQueue applies the queued flood block writes one at a time, and what is left
+// in the queue on Stop
+func (fp *FloodProtection) processPersistQueue() {
+	for {
+		select {
+		case op := <-fp.persistQueue:
+			op.apply()
+		case <-fp.stopChan:
+			for {
+				select {
+				case op := <-fp.persistQueue:
+					op.apply()
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (op floodPersistOp) apply() {
+	if op.forget {
+		op.db.Where("ip = ?", op.ip).Delete(&models.FloodBlock{})
+		return
+	}
+	row := models.FloodBlock{IP: op.ip, AttackType: op.attackType, BlockedUntil: op.until}
+	if err := op.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "ip"}},
+		DoUpdates: clause.AssignmentColumns([]string{"attack_type", "blocked_until"}),
+	}).Create(&row).Error; err != nil {
+		system.Warn("Failed to persist flood block for %s: %v", op.ip, err)
+	}
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"kg-proxy-web-gui/backend/models"
+	"sync"
+	"time"
+)
+
+// defaultGeoResolveWorkers is how many goroutines resolve attack event countries when none is configured
+const defaultGeoResolveWorkers = 2
+
+// maxGeoResolveWorkers bounds the pool; lookups share the GeoIP RLock so more workers stop helping
+const maxGeoResolveWorkers = 16
+
+// GeoResolveStats reports the attack-event country resolution pool
+type GeoResolveStats struct {
+	Workers        int     `json:"workers"`
+	QueueDepth     int     `json:"queue_depth"` // Events waiting for a country lookup
+	QueueCapacity  int     `json:"queue_capacity"`
+	Resolved       uint64  `json:"resolved"`
+	RatePerSec     float64 `json:"rate_per_sec"` // Lookups per second since the previous request
+	AvgLookupMicro float64 `json:"avg_lookup_us"`
+	Dropped        uint64  `json:"dropped"` // Events lost because the queue was full
+}
+
+// SetGeoResolveWorkers resizes the country resolution pool (<= 0 restores the default).
+// Extra workers start immediately; surplus ones exit after finishing their current event.
+func (fp *FloodProtection) SetGeoResolveWorkers(n int) {
+	if n <= 0 {
+		n = defaultGeoResolveWorkers
+	}
+	if n > maxGeoResolveWorkers {
+		n = maxGeoResolveWorkers
+	}
+	fp.geoWorkers.Store(int32(n))
+	for {
+		running := fp.geoWorkersRunning.Load()
+		if running >= int32(n) {
+			return
+		}
+		if fp.geoWorkersRunning.CompareAndSwap(running, running+1) {
+			go fp.resolveWorker()
+		}
+	}
+}
+
+// resolveWorker fills in country fields and hands events to the batching consumer
+func (fp *FloodProtection) resolveWorker() {
+	retire := time.NewTicker(time.Second)
+	defer retire.Stop()
+
+	for {
+		select {
+		case <-fp.stopChan:
+			fp.geoWorkersRunning.Add(-1)
+			return
+		case <-retire.C:
+			if fp.retireWorker() {
+				return
+			}
+		case event := <-fp.attackQueue:
+			fp.resolveCountry(&event)
+			select {
+			case fp.resolvedQueue <- event:
+			case <-fp.stopChan:
+				fp.geoWorkersRunning.Add(-1)
+				return
+			}
+			if fp.retireWorker() {
+				return
+			}
+		}
+	}
+}
+
+// retireWorker lets one surplus worker exit after the pool was shrunk
+func (fp *FloodProtection) retireWorker() bool {
+	for {
+		running := fp.geoWorkersRunning.Load()
+		if running <= fp.geoWorkers.Load() {
+			return false
+		}
+		if fp.geoWorkersRunning.CompareAndSwap(running, running-1) {
+			return true
+		}
+	}
+}
+
+// resolveCountry looks up the event's country and records the lookup time
+func (fp *FloodProtection) resolveCountry(event *models.AttackEvent) {
+	fp.mu.RLock()
+	geoip := fp.geoip
+	fp.mu.RUnlock()
+	if geoip == nil {
+		return
+	}
+
+	start := time.Now()
+	event.CountryName, event.CountryCode = geoip.GetCountry(event.SourceIP)
+	fp.geoResolveNanos.Add(uint64(time.Since(start).Nanoseconds()))
+	fp.geoResolved.Add(1)
+}
+
+// geoResolveSample remembers the last reading so GetGeoResolveStats can report a rate
+type geoResolveSample struct {
+	mu       sync.Mutex
+	at       time.Time
+	resolved uint64
+}
+
+// GetGeoResolveStats returns pool size, backlog, lookup rate and latency
+func (fp *FloodProtection) GetGeoResolveStats() GeoResolveStats {
+	stats := GeoResolveStats{
+		Workers:       int(fp.geoWorkersRunning.Load()),
+		QueueDepth:    len(fp.attackQueue),
+		QueueCapacity: cap(fp.attackQueue),
+		Resolved:      fp.geoResolved.Load(),
+		Dropped:       fp.attackDropped.Load(),
+	}
+	if stats.Resolved > 0 {
+		stats.AvgLookupMicro = float64(fp.geoResolveNanos.Load()) / float64(stats.Resolved) / 1000
+	}
+
+	fp.resolveSample.mu.Lock()
+	now := time.Now()
+	if elapsed := now.Sub(fp.resolveSample.at).Seconds(); !fp.resolveSample.at.IsZero() && elapsed > 0 {
+		stats.RatePerSec = float64(stats.Resolved-fp.resolveSample.resolved) / elapsed
+	}
+	fp.resolveSample.at = now
+	fp.resolveSample.resolved = stats.Resolved
+	fp.resolveSample.mu.Unlock()
+
+	return stats
+}
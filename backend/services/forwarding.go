@@ -0,0 +1,158 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"net"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// PortTestResult describes the forwarding check for a single service port
+type PortTestResult struct {
+	Name        string `json:"name"`
+	Protocol    string `json:"protocol"`
+	PublicPort  string `json:"public_port"`
+	Destination string `json:"destination"`
+	DNATPresent bool   `json:"dnat_present"`
+	Reachable   bool   `json:"reachable"`
+	State       string `json:"state"` // open, closed, no_response, unreachable, skipped
+	LatencyMs   int64  `json:"latency_ms"`
+	Error       string `json:"error,omitempty"`
+}
+
+// forwardProbeTimeout bounds each per-port probe so a dead origin can't stall the request
+const forwardProbeTimeout = 2 * time.Second
+
+// dnatSpec returns the iptables --dport value and --to-destination target for a service port
+func dnatSpec(wgIP string, port models.ServicePort) (string, string) {
+	if port.PublicPortEnd > port.PublicPort {
+		// Range (e.g. 27015:27030)
+		dport := fmt.Sprintf("%d:%d", port.PublicPort, port.PublicPortEnd)
+		// iptables handles range mapping automatically if size matches.
+		toDest := fmt.Sprintf("%s:%d-%d", wgIP, port.PrivatePort, port.PrivatePortEnd)
+
+		// Fallback if PrivatePortEnd is 0: map range to range starting at PrivatePort
+		if port.PrivatePortEnd == 0 {
+			diff := port.PublicPortEnd - port.PublicPort
+			toDest = fmt.Sprintf("%s:%d-%d", wgIP, port.PrivatePort, port.PrivatePort+diff)
+		}
+		return dport, toDest
+	}
+
+	// Single Port
+	return fmt.Sprintf("%d", port.PublicPort), fmt.Sprintf("%s:%d", wgIP, port.PrivatePort)
+}
+
+// TestServiceForwarding checks every port of a service end-to-end:
+// the DNAT rule must exist in the NAT table and the origin must answer on WgIP:PrivatePort over wg0.
+// The service must be loaded with its Origin and Ports.
+func (s *FirewallService) TestServiceForwarding(svc *models.Service) []PortTestResult {
+	results := make([]PortTestResult, 0, len(svc.Ports))
+
+	for _, port := range svc.Ports {
+		protocol := strings.ToLower(port.Protocol)
+		dport, toDest := dnatSpec(svc.Origin.WgIP, port)
+
+		result := PortTestResult{
+			Name:        port.Name,
+			Protocol:    protocol,
+			PublicPort:  dport,
+			Destination: toDest,
+		}
+
+		if svc.Origin.WgIP == "" {
+			result.State = "skipped"
+			result.Error = "origin has no WireGuard IP"
+			results = append(results, result)
+			continue
+		}
+
+		result.DNATPresent = s.hasDNATRule(protocol, dport, toDest)
+
+		// Probe the first private port of the mapping; ranges share the same origin host
+		target := net.JoinHostPort(svc.Origin.WgIP, fmt.Sprintf("%d", port.PrivatePort))
+		start := time.Now()
+		var err error
+		switch protocol {
+		case "tcp":
+			result.State, err = probeTCP(target)
+		case "udp":
+			result.State, err = probeUDP(target)
+		default:
+			result.State = "skipped"
+			err = fmt.Errorf("unsupported protocol: %s", port.Protocol)
+		}
+		result.LatencyMs = time.Since(start).Milliseconds()
+		if err != nil {
+			result.Error = err.Error()
+		}
+		if result.State == "no_response" && !system.Ping(svc.Origin.WgIP) {
+			// Silence from a host that also ignores ping means the tunnel itself is down
+			result.State = "unreachable"
+			result.Error = "origin does not respond over WireGuard"
+		}
+		result.Reachable = result.State == "open" || result.State == "no_response"
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// hasDNATRule checks the live NAT table for the exact rule generateIPTablesRules would emit
+func (s *FirewallService) hasDNATRule(protocol, dport, toDest string) bool {
+	if runtime.GOOS != "linux" {
+		return true // No NAT table on Windows/Dev
+	}
+	_, err := s.Executor.Execute("iptables", "-t", "nat", "-C", KGChain("PREROUTING"),
+		"-p", protocol, "--dport", dport, "-j", "DNAT", "--to-destination", toDest)
+	return err == nil
+}
+
+// probeTCP attempts a full TCP handshake with the origin
+func probeTCP(target string) (string, error) {
+	conn, err := net.DialTimeout("tcp", target, forwardProbeTimeout)
+	if err == nil {
+		conn.Close()
+		return "open", nil
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		// Origin host answered with RST: tunnel works but nothing listens on the port
+		return "closed", err
+	}
+	return "unreachable", err
+}
+
+// probeUDP sends a one-byte datagram and waits briefly for a reply.
+// Game servers rarely answer unknown payloads, so silence is reported as "no_response"
+// while an ICMP port-unreachable (surfaced as ECONNREFUSED) means the port is closed.
+func probeUDP(target string) (string, error) {
+	conn, err := net.DialTimeout("udp", target, forwardProbeTimeout)
+	if err != nil {
+		return "unreachable", err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte{0x00}); err != nil {
+		return "unreachable", err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(forwardProbeTimeout))
+	buf := make([]byte, 512)
+	if _, err := conn.Read(buf); err != nil {
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return "closed", err
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return "no_response", nil
+		}
+		return "unreachable", err
+	}
+	return "open", nil
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"kg-proxy-web-gui/backend/models"
+	"strings"
+)
+
+// Geo filter modes (SecuritySettings.GeoMode)
+const (
+	GeoModeAllow = "allow" // Only GeoAllowCountries pass GEO_GUARD (default)
+	GeoModeBlock = "block" // Everyone passes except GeoBlockCountries
+)
+
+// ValidGeoMode reports whether m is a known geo filter mode
+func ValidGeoMode(m string) bool {
+	return m == GeoModeAllow || m == GeoModeBlock
+}
+
+// GeoBlockModeActive reports whether the settings select the country blacklist
+func GeoBlockModeActive(settings *models.SecuritySettings) bool {
+	return settings.GeoMode == GeoModeBlock
+}
+
+// GeoBlockCountries returns the upper-case blocked country codes from the settings
+func GeoBlockCountries(settings *models.SecuritySettings) []string {
+	var countries []string
+	for _, cc := range strings.Split(settings.GeoBlockCountries, ",") {
+		if cc = strings.ToUpper(strings.TrimSpace(cc)); cc != "" {
+			countries = append(countries, cc)
+		}
+	}
+	return countries
+}
+
+// GetBlockedCountryCIDRs returns the ranges to block for a country in block mode.
+// "XX" blocks the ranges the GeoIP database places in no country, regardless of the
+// unknown country policy (which only applies to the allowlist).
+func (g *GeoIPService) GetBlockedCountryCIDRs(countryCode string) []string {
+	if strings.EqualFold(countryCode, UnknownCountryCode) {
+		cidrs, err := g.UnclassifiedCIDRs()
+		if err != nil {
+			return nil
+		}
+		return cidrs
+	}
+	return g.GetCountryCIDRs(countryCode)
+}
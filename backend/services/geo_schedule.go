@@ -0,0 +1,210 @@
+package services
+
+import (
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Geo schedule modes
+const (
+	GeoScheduleModeAdd     = "add"     // Countries are allowed in addition to GeoAllowCountries
+	GeoScheduleModeReplace = "replace" // Countries are allowed instead of GeoAllowCountries
+)
+
+// geoScheduleCheckInterval is how often the watcher looks for schedule boundaries
+const geoScheduleCheckInterval = 30 * time.Second
+
+// scheduleWeekdays maps the accepted day names to weekdays
+var scheduleWeekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// NormalizeGeoSchedule validates a schedule and normalizes its days and countries in place
+func NormalizeGeoSchedule(sch *models.GeoSchedule) error {
+	sch.Name = strings.TrimSpace(sch.Name)
+	if sch.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if sch.StartHour < 0 || sch.StartHour > 23 {
+		return fmt.Errorf("start_hour must be between 0 and 23")
+	}
+	if sch.EndHour < 1 || sch.EndHour > 24 {
+		return fmt.Errorf("end_hour must be between 1 and 24")
+	}
+
+	switch sch.Mode {
+	case "":
+		sch.Mode = GeoScheduleModeAdd
+	case GeoScheduleModeAdd, GeoScheduleModeReplace:
+	default:
+		return fmt.Errorf("mode must be %q or %q", GeoScheduleModeAdd, GeoScheduleModeReplace)
+	}
+
+	var days []string
+	seen := make(map[string]bool)
+	for _, d := range strings.Split(sch.Days, ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d == "" || seen[d] {
+			continue
+		}
+		if len(d) > 3 {
+			d = d[:3] // "monday" -> "mon"
+		}
+		if _, ok := scheduleWeekdays[d]; !ok {
+			return fmt.Errorf("invalid day %q (use mon,tue,wed,thu,fri,sat,sun)", d)
+		}
+		seen[d] = true
+		days = append(days, d)
+	}
+	sch.Days = strings.Join(days, ",")
+
+	var countries []string
+	for _, cc := range strings.Split(sch.Countries, ",") {
+		cc = strings.ToUpper(strings.TrimSpace(cc))
+		if cc == "" {
+			continue
+		}
+		if len(cc) != 2 {
+			return fmt.Errorf("invalid country code %q", cc)
+		}
+		countries = append(countries, cc)
+	}
+	if len(countries) == 0 {
+		return fmt.Errorf("at least one country is required")
+	}
+	sch.Countries = strings.Join(countries, ",")
+	return nil
+}
+
+// GeoScheduleActive reports whether a schedule's window covers t.
+// A window ending at or before its start hour runs past midnight and belongs to the day it started.
+func GeoScheduleActive(sch models.GeoSchedule, t time.Time) bool {
+	if !sch.Enabled {
+		return false
+	}
+	onDay := func(day time.Weekday) bool {
+		if sch.Days == "" {
+			return true
+		}
+		for _, d := range strings.Split(sch.Days, ",") {
+			if wd, ok := scheduleWeekdays[d]; ok && wd == day {
+				return true
+			}
+		}
+		return false
+	}
+
+	hour := t.Hour()
+	if sch.StartHour < sch.EndHour {
+		return onDay(t.Weekday()) && hour >= sch.StartHour && hour < sch.EndHour
+	}
+	if hour >= sch.StartHour {
+		return onDay(t.Weekday())
+	}
+	return hour < sch.EndHour && onDay(t.AddDate(0, 0, -1).Weekday())
+}
+
+// ActiveGeoSchedules returns the enabled schedules whose window covers t
+func (s *FirewallService) ActiveGeoSchedules(t time.Time) []models.GeoSchedule {
+	var schedules []models.GeoSchedule
+	if err := s.DB.Where("enabled = ?", true).Order("id ASC").Find(&schedules).Error; err != nil {
+		return nil
+	}
+	active := schedules[:0]
+	for _, sch := range schedules {
+		if GeoScheduleActive(sch, t) {
+			active = append(active, sch)
+		}
+	}
+	return active
+}
+
+// EffectiveGeoCountries returns the allowed countries in force at t: GeoAllowCountries, replaced by the
+// active "replace" schedules if any, plus the countries of active "add" schedules
+func (s *FirewallService) EffectiveGeoCountries(settings *models.SecuritySettings, t time.Time) []string {
+	return effectiveGeoCountries(settings.GeoAllowCountries, s.ActiveGeoSchedules(t))
+}
+
+func effectiveGeoCountries(base string, active []models.GeoSchedule) []string {
+	set := make(map[string]bool)
+	replaced := false
+	for _, sch := range active {
+		if sch.Mode != GeoScheduleModeReplace {
+			continue
+		}
+		replaced = true
+		for _, cc := range strings.Split(sch.Countries, ",") {
+			set[cc] = true
+		}
+	}
+	if !replaced {
+		for _, cc := range strings.Split(base, ",") {
+			if cc = strings.ToUpper(strings.TrimSpace(cc)); cc != "" {
+				set[cc] = true
+			}
+		}
+	}
+	for _, sch := range active {
+		if sch.Mode == GeoScheduleModeReplace {
+			continue
+		}
+		for _, cc := range strings.Split(sch.Countries, ",") {
+			set[cc] = true
+		}
+	}
+
+	countries := make([]string, 0, len(set))
+	for cc := range set {
+		countries = append(countries, cc)
+	}
+	sort.Strings(countries)
+	return countries
+}
+
+// geoScheduleKey identifies a set of active schedules, so the watcher only re-applies on a change
+func geoScheduleKey(active []models.GeoSchedule) string {
+	ids := make([]string, 0, len(active))
+	for _, sch := range active {
+		ids = append(ids, strconv.FormatUint(uint64(sch.ID), 10)+"@"+strconv.FormatInt(sch.UpdatedAt.Unix(), 10))
+	}
+	return strings.Join(ids, ",")
+}
+
+// StartGeoScheduleWatcher re-applies the firewall whenever a schedule window opens or closes
+func (s *FirewallService) StartGeoScheduleWatcher() {
+	go func() {
+		ticker := time.NewTicker(geoScheduleCheckInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			active := s.ActiveGeoSchedules(time.Now())
+			key := geoScheduleKey(active)
+
+			s.geoScheduleMu.Lock()
+			changed := key != s.geoScheduleKey
+			s.geoScheduleMu.Unlock()
+			if !changed {
+				continue
+			}
+
+			names := make([]string, 0, len(active))
+			for _, sch := range active {
+				names = append(names, sch.Name)
+			}
+			if len(names) == 0 {
+				system.Info("🕒 Geo schedule ended, restoring base allowed countries")
+			} else {
+				system.Info("🕒 Geo schedule active: %s", strings.Join(names, ", "))
+			}
+			if err := s.ApplyRules(); err != nil {
+				system.Warn("Failed to apply geo schedule: %v", err)
+			}
+		}
+	}()
+}
@@ -3,7 +3,6 @@ package services
 import (
 	"archive/tar"
 	"compress/gzip"
-	"encoding/json"
 	"fmt"
 	"io"
 	"net"
@@ -12,6 +11,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"kg-proxy-web-gui/backend/system"
@@ -21,20 +21,36 @@ import (
 
 // GeoIPService provides IP geolocation using MaxMind GeoLite2
 type GeoIPService struct {
-	dbPath       string
-	db           *geoip2.Reader
-	vpnRanges    []net.IPNet
-	torExitNodes []net.IP
-	countryCIDRs map[string][]string // country code -> CIDR strings
-	mu           sync.RWMutex
-	lastUpdate   time.Time
-	licenseKey   string
-
-	// IP Intelligence (IPinfo.io)
-	ipInfoAPIKey string
-	ipInfoCache  map[string]*IPIntelligenceResult // Cache for 24h
-	cacheExpiry  map[string]time.Time
-	webhook      *WebhookService
+	dbPath         string
+	db             *geoip2.Reader
+	vpnRanges      []net.IPNet
+	torExitNodes   []net.IP
+	countryCIDRs   map[string][]string // country code -> CIDR strings
+	cidrSource     string              // CountryCIDRSource* (default ipverse)
+	csvMu          sync.Mutex          // Serializes MaxMind CSV imports
+	maxmindCSV     *maxmindCSVCache    // Parsed MaxMind CSV import, loaded on demand
+	feeds          feedScheduler       // Auto-refresh of the database and threat feeds
+	updateInterval time.Duration       // GeoLite2 refresh interval (0 = weekly)
+	maxAge         time.Duration       // Local build age before checking MaxMind (0 = one week)
+	lastCheck      *GeoIPUpdateCheck   // Last comparison with MaxMind's published build
+	mu             sync.RWMutex
+	lastUpdate     time.Time
+	licenseKey     string
+
+	// Unknown country (XX) handling, see geoip_unknown.go
+	allowUnknown   bool      // Include the unclassified ranges as country "xx"
+	unclassified   []string  // Ranges the database assigns no country
+	unclassifiedAt time.Time // lastUpdate the unclassified ranges were computed for
+
+	// IP Intelligence (ipinfo.io by default, see NewIPIntelligenceProvider)
+	intelProvider IPIntelligenceProvider // nil until an API key is configured
+	intelKey      string
+	intelInflight map[string]*intelCall            // One provider request per IP at a time
+	ipInfoCache   map[string]*IPIntelligenceResult // Cache for 24h
+	cacheExpiry   map[string]time.Time
+	intelHits     atomic.Uint64 // Lookups answered from ipInfoCache
+	intelMisses   atomic.Uint64 // Lookups that needed an API request
+	webhook       *WebhookService
 }
 
 // IPIntelligenceResult represents the result of an IP intelligence check
@@ -46,6 +62,16 @@ type IPIntelligenceResult struct {
 	IsHosting bool   `json:"is_hosting"`
 	Threat    bool   `json:"threat"`
 	Country   string `json:"country"`
+
+	Score    *int   `json:"score"` // 0-100 abuse/fraud/risk score, nil if the provider doesn't score IPs
+	Provider string `json:"provider"`
+}
+
+// intelCall is an in-flight provider lookup shared by concurrent callers
+type intelCall struct {
+	done   chan struct{}
+	result *IPIntelligenceResult
+	err    error
 }
 
 func NewGeoIPService() *GeoIPService {
@@ -58,12 +84,13 @@ func NewGeoIPService() *GeoIPService {
 	}
 
 	service := &GeoIPService{
-		dbPath:       dbDir,
-		vpnRanges:    make([]net.IPNet, 0),
-		torExitNodes: make([]net.IP, 0),
-		licenseKey:   licenseKey,
-		ipInfoCache:  make(map[string]*IPIntelligenceResult),
-		cacheExpiry:  make(map[string]time.Time),
+		dbPath:        dbDir,
+		vpnRanges:     make([]net.IPNet, 0),
+		torExitNodes:  make([]net.IP, 0),
+		licenseKey:    licenseKey,
+		ipInfoCache:   make(map[string]*IPIntelligenceResult),
+		intelInflight: make(map[string]*intelCall),
+		cacheExpiry:   make(map[string]time.Time),
 	}
 
 	// Create directory if not exists
@@ -102,7 +129,7 @@ func (g *GeoIPService) RefreshGeoIP() error {
 		return fmt.Errorf("no MaxMind license key configured")
 	}
 
-	if err := g.downloadGeoLite2(); err != nil {
+	if err := g.downloadGeoLite2(false); err != nil {
 		return err
 	}
 
@@ -123,7 +150,7 @@ func (g *GeoIPService) Initialize() error {
 		system.Warn("GeoIP database not found or failed to load: %v", err)
 		// Try to download if license key is available
 		if g.licenseKey != "" {
-			if err := g.downloadGeoLite2(); err != nil {
+			if err := g.downloadGeoLite2(false); err != nil {
 				system.Error("Failed to download GeoLite2: %v", err)
 			} else {
 				g.loadDB(dbFile)
@@ -175,41 +202,6 @@ func (g *GeoIPService) Close() {
 	}
 }
 
-// StartAutoUpdateScheduler starts a background goroutine that refreshes GeoIP data periodically
-func (g *GeoIPService) StartAutoUpdateScheduler() {
-	go func() {
-		// Check every 24 hours
-		ticker := time.NewTicker(24 * time.Hour)
-		defer ticker.Stop()
-
-		for range ticker.C {
-			g.mu.RLock()
-			lastUpdate := g.lastUpdate
-			hasLicense := g.licenseKey != ""
-			g.mu.RUnlock()
-
-			// Refresh if older than 7 days and we have a license key
-			if hasLicense && time.Since(lastUpdate) > 7*24*time.Hour {
-				system.Info("Auto-refreshing GeoIP database (last update: %s)", lastUpdate.Format("2006-01-02"))
-				if err := g.RefreshGeoIP(); err != nil {
-					system.Warn("Auto-refresh GeoIP failed: %v", err)
-				} else {
-					system.Info("GeoIP database auto-refreshed successfully")
-					if g.webhook != nil && g.webhook.IsEnabled() {
-						g.webhook.SendSystemAlert("🌍 GeoIP Database Updated", "The MaxMind GeoLite2 database has been successfully updated.", ColorBlue)
-					}
-				}
-
-				// Also refresh TOR exit nodes
-				if err := g.downloadTORExitNodes(); err != nil {
-					system.Warn("Auto-refresh TOR exit nodes failed: %v", err)
-				}
-			}
-		}
-	}()
-	system.Info("GeoIP auto-update scheduler started (checks daily, refreshes weekly)")
-}
-
 // GetLastUpdate returns the last update time
 func (g *GeoIPService) GetLastUpdate() time.Time {
 	g.mu.RLock()
@@ -217,6 +209,13 @@ func (g *GeoIPService) GetLastUpdate() time.Time {
 	return g.lastUpdate
 }
 
+// HasDatabase reports whether a MaxMind database is loaded (country lookups return "XX" otherwise)
+func (g *GeoIPService) HasDatabase() bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.db != nil
+}
+
 // GetCountryCode returns the ISO country code for an IP
 func (g *GeoIPService) GetCountryCode(ipStr string) string {
 	ip := net.ParseIP(ipStr)
@@ -232,7 +231,7 @@ func (g *GeoIPService) GetCountryCode(ipStr string) string {
 	}
 
 	record, err := g.db.Country(ip)
-	if err != nil {
+	if err != nil || record.Country.IsoCode == "" {
 		return "XX"
 	}
 
@@ -270,11 +269,12 @@ func (g *GeoIPService) GetCountry(ipStr string) (string, string) {
 	return name, code
 }
 
-// IsCountryAllowed checks if an IP is from an allowed country
+// IsCountryAllowed checks if an IP is from an allowed country.
+// Unknown sources (XX) follow the unknown country policy applied with the firewall rules.
 func (g *GeoIPService) IsCountryAllowed(ipStr string, allowedCountries []string) bool {
 	countryCode := g.GetCountryCode(ipStr)
-	if countryCode == "XX" {
-		return false // Unknown = not allowed
+	if countryCode == UnknownCountryCode {
+		return g.UnknownCountryAllowedNow()
 	}
 
 	for _, allowed := range allowedCountries {
@@ -339,14 +339,15 @@ func (g *GeoIPService) GetTORExitNodes() []net.IP {
 }
 
 // downloadGeoLite2 downloads the GeoLite2-Country database
-func (g *GeoIPService) downloadGeoLite2() error {
+// force skips the 24h freshness check (used once MaxMind is known to have a newer build)
+func (g *GeoIPService) downloadGeoLite2(force bool) error {
 	if g.licenseKey == "" {
 		return fmt.Errorf("no MaxMind license key configured")
 	}
 
 	// Rate limit check: Don't download if we have a recent file (< 24h)
 	dbPath := filepath.Join(g.dbPath, "GeoLite2-Country.mmdb")
-	if info, err := os.Stat(dbPath); err == nil {
+	if info, err := os.Stat(dbPath); err == nil && !force {
 		if time.Since(info.ModTime()) < 24*time.Hour {
 			system.Info("Skipping GeoIP download: existing database is fresh (%v old)", time.Since(info.ModTime()).Round(time.Minute))
 			return nil
@@ -390,16 +391,21 @@ func (g *GeoIPService) downloadGeoLite2() error {
 
 		// Look for the .mmdb file
 		if strings.HasSuffix(header.Name, ".mmdb") {
+			// The loaded database is memory-mapped: extract aside and swap it in with a rename
 			outPath := filepath.Join(g.dbPath, "GeoLite2-Country.mmdb")
-			outFile, err := os.Create(outPath)
+			outFile, err := os.Create(outPath + ".tmp")
 			if err != nil {
 				return fmt.Errorf("failed to create output file: %v", err)
 			}
-			defer outFile.Close()
-
-			if _, err := io.Copy(outFile, tr); err != nil {
+			_, err = io.Copy(outFile, tr)
+			outFile.Close()
+			if err != nil {
+				os.Remove(outPath + ".tmp")
 				return fmt.Errorf("failed to extract mmdb: %v", err)
 			}
+			if err := os.Rename(outPath+".tmp", outPath); err != nil {
+				return fmt.Errorf("failed to replace mmdb: %v", err)
+			}
 
 			system.Info("GeoLite2-Country database downloaded successfully")
 			return nil
@@ -486,8 +492,13 @@ func (g *GeoIPService) loadFallbackRanges() {
 	// Users should configure MAXMIND_LICENSE_KEY for proper functionality.
 }
 
-// GetCountryCIDRs returns CIDR ranges for a country (for ipset)
+// GetCountryCIDRs returns CIDR ranges for a country (for ipset).
+// "XX" yields the unclassified ranges while unknown sources are allowed.
 func (g *GeoIPService) GetCountryCIDRs(countryCode string) []string {
+	if strings.EqualFold(countryCode, UnknownCountryCode) {
+		return g.allowedUnclassifiedCIDRs()
+	}
+
 	g.mu.RLock()
 	defer g.mu.RUnlock()
 
@@ -500,15 +511,31 @@ func (g *GeoIPService) GetCountryCIDRs(countryCode string) []string {
 // GetAllCountryCIDRs returns all loaded country CIDRs
 func (g *GeoIPService) GetAllCountryCIDRs() map[string][]string {
 	g.mu.RLock()
-	defer g.mu.RUnlock()
-
 	copy := make(map[string][]string)
 	for k, v := range g.countryCIDRs {
 		copy[k] = v
 	}
+	g.mu.RUnlock()
+
+	if cidrs := g.allowedUnclassifiedCIDRs(); len(cidrs) > 0 {
+		copy[strings.ToLower(UnknownCountryCode)] = cidrs
+	}
 	return copy
 }
 
+// allowedUnclassifiedCIDRs returns the unclassified ranges if unknown sources are allowed, else nil
+func (g *GeoIPService) allowedUnclassifiedCIDRs() []string {
+	if !g.UnknownCountryAllowedNow() {
+		return nil
+	}
+	cidrs, err := g.UnclassifiedCIDRs()
+	if err != nil {
+		system.Warn("Unknown country sources allowed, but their ranges are unavailable: %v", err)
+		return nil
+	}
+	return cidrs
+}
+
 // DownloadCountryCIDRs downloads CIDR lists for specified countries
 func (g *GeoIPService) DownloadCountryCIDRs(countries []string) error {
 	g.mu.Lock()
@@ -517,10 +544,19 @@ func (g *GeoIPService) DownloadCountryCIDRs(countries []string) error {
 	}
 	g.mu.Unlock()
 
+	// MaxMind CSV keeps firewall ranges consistent with per-packet mmdb lookups
+	if g.GetCountryCIDRSource() == CountryCIDRSourceMaxMindCSV {
+		err := g.loadCountryCIDRsFromCSV(countries)
+		if err == nil {
+			return nil
+		}
+		system.Warn("MaxMind CSV country source unavailable, falling back to ipverse: %v", err)
+	}
+
 	for _, country := range countries {
 		country = strings.ToLower(strings.TrimSpace(country))
-		if country == "" {
-			continue
+		if country == "" || strings.EqualFold(country, UnknownCountryCode) {
+			continue // XX ranges come from the database itself
 		}
 
 		// Download from ipverse GitHub (RIR-sourced data)
@@ -568,81 +604,99 @@ func (g *GeoIPService) DownloadCountryCIDRs(countries []string) error {
 	return nil
 }
 
-// SetIPInfoAPIKey sets the IPinfo.io API key
-func (g *GeoIPService) SetIPInfoAPIKey(key string) {
-	g.mu.Lock()
-	defer g.mu.Unlock()
-	g.ipInfoAPIKey = key
-}
+// loadCountryCIDRsFromCSV fills countryCIDRs for the given countries from the MaxMind CSV import
+func (g *GeoIPService) loadCountryCIDRsFromCSV(countries []string) error {
+	if _, err := g.ImportMaxMindCSV(false); err != nil {
+		return err
+	}
 
-// CheckIPIntelligence checks an IP against IPinfo.io for VPN/proxy detection
-func (g *GeoIPService) CheckIPIntelligence(ipStr string) (*IPIntelligenceResult, error) {
-	g.mu.RLock()
-	apiKey := g.ipInfoAPIKey
+	g.csvMu.Lock()
+	cache := g.maxmindCSV
+	g.csvMu.Unlock()
 
-	// Check cache first
-	if cached, exists := g.ipInfoCache[ipStr]; exists {
-		if expiry, hasExpiry := g.cacheExpiry[ipStr]; hasExpiry && time.Now().Before(expiry) {
-			g.mu.RUnlock()
-			return cached, nil
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, country := range countries {
+		country = strings.ToLower(strings.TrimSpace(country))
+		if country == "" || strings.EqualFold(country, UnknownCountryCode) {
+			continue
+		}
+		cidrs := cache.Countries[country]
+		g.countryCIDRs[country] = cidrs
+		if len(cidrs) == 0 {
+			system.Warn("MaxMind CSV has no IPv4 ranges for country %s", strings.ToUpper(country))
 		}
 	}
-	g.mu.RUnlock()
+	return nil
+}
 
+// SetIPIntelligenceProvider selects the IP intelligence provider and its API key.
+// An empty key disables lookups; changing provider or key clears cached results.
+func (g *GeoIPService) SetIPIntelligenceProvider(name, apiKey string) error {
+	provider, err := NewIPIntelligenceProvider(name, apiKey)
+	if err != nil {
+		return err
+	}
 	if apiKey == "" {
-		return nil, fmt.Errorf("IPinfo.io API key not configured")
+		provider = nil
 	}
 
-	// Make API request
-	url := fmt.Sprintf("https://ipinfo.io/%s?token=%s", ipStr, apiKey)
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("IPinfo.io request failed: %w", err)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.intelProvider != nil && (provider == nil || provider.Name() != g.intelProvider.Name() || apiKey != g.intelKey) {
+		// Results from the previous provider or account may differ; re-check on next lookup
+		g.ipInfoCache = make(map[string]*IPIntelligenceResult)
+		g.cacheExpiry = make(map[string]time.Time)
 	}
-	defer resp.Body.Close()
+	g.intelProvider = provider
+	g.intelKey = apiKey
+	return nil
+}
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("IPinfo.io returned status %d", resp.StatusCode)
-	}
+// CheckIPIntelligence checks an IP for VPN/proxy/TOR use with the configured provider.
+// Results are cached for 24h and concurrent lookups of the same IP share one request.
+func (g *GeoIPService) CheckIPIntelligence(ipStr string) (*IPIntelligenceResult, error) {
+	g.mu.Lock()
+	provider := g.intelProvider
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+	// Check cache first
+	if cached, exists := g.ipInfoCache[ipStr]; exists {
+		if expiry, hasExpiry := g.cacheExpiry[ipStr]; hasExpiry && time.Now().Before(expiry) {
+			g.mu.Unlock()
+			g.intelHits.Add(1)
+			return cached, nil
+		}
 	}
-
-	// Parse response (IPinfo.io basic format)
-	var data struct {
-		IP      string `json:"ip"`
-		Country string `json:"country"`
-		Privacy struct {
-			VPN     bool `json:"vpn"`
-			Proxy   bool `json:"proxy"`
-			Tor     bool `json:"tor"`
-			Hosting bool `json:"hosting"`
-		} `json:"privacy"`
+	if provider == nil {
+		g.mu.Unlock()
+		return nil, fmt.Errorf("IP intelligence API key not configured")
 	}
-
-	if err := json.Unmarshal(body, &data); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+	if call, ok := g.intelInflight[ipStr]; ok {
+		g.mu.Unlock()
+		<-call.done
+		return call.result, call.err
 	}
+	call := &intelCall{done: make(chan struct{})}
+	g.intelInflight[ipStr] = call
+	g.mu.Unlock()
+	g.intelMisses.Add(1)
 
-	result := &IPIntelligenceResult{
-		IP:        data.IP,
-		Country:   data.Country,
-		IsVPN:     data.Privacy.VPN,
-		IsProxy:   data.Privacy.Proxy,
-		IsTor:     data.Privacy.Tor,
-		IsHosting: data.Privacy.Hosting,
-		Threat:    data.Privacy.VPN || data.Privacy.Proxy || data.Privacy.Tor,
+	call.result, call.err = provider.Check(ipStr)
+	if call.result != nil {
+		call.result.Provider = provider.Name()
 	}
 
-	// Cache for 24 hours
 	g.mu.Lock()
-	g.ipInfoCache[ipStr] = result
-	g.cacheExpiry[ipStr] = time.Now().Add(24 * time.Hour)
+	delete(g.intelInflight, ipStr)
+	// Cache for 24 hours, unless the provider was switched meanwhile
+	if call.err == nil && g.intelProvider == provider {
+		g.ipInfoCache[ipStr] = call.result
+		g.cacheExpiry[ipStr] = time.Now().Add(ipIntelCacheTTL)
+	}
 	g.mu.Unlock()
+	close(call.done)
 
-	return result, nil
+	return call.result, call.err
 }
 
 // IsThreat checks if an IP is a VPN/proxy/TOR based on cached intelligence
@@ -651,6 +705,7 @@ func (g *GeoIPService) IsThreat(ipStr string) bool {
 	if cached, exists := g.ipInfoCache[ipStr]; exists {
 		if expiry, hasExpiry := g.cacheExpiry[ipStr]; hasExpiry && time.Now().Before(expiry) {
 			g.mu.RUnlock()
+			g.intelHits.Add(1)
 			return cached.Threat
 		}
 	}
@@ -658,7 +713,7 @@ func (g *GeoIPService) IsThreat(ipStr string) bool {
 
 	// Not in cache, check synchronously if API key is available
 	g.mu.RLock()
-	hasKey := g.ipInfoAPIKey != ""
+	hasKey := g.intelProvider != nil
 	g.mu.RUnlock()
 
 	if hasKey {
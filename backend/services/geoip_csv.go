@@ -0,0 +1,257 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"kg-proxy-web-gui/backend/system"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Country CIDR sources
+const (
+	CountryCIDRSourceIPVerse    = "ipverse"     // RIR delegation data from github.com/ipverse/rir-ip
+	CountryCIDRSourceMaxMindCSV = "maxmind_csv" // GeoLite2-Country CSV edition, consistent with the lookup DB
+)
+
+// maxmindCSVMaxAge is how long a parsed CSV import is reused before downloading again
+const maxmindCSVMaxAge = 24 * time.Hour
+
+// maxmindCSVCache is the parsed CSV import persisted next to the mmdb
+type maxmindCSVCache struct {
+	UpdatedAt time.Time           `json:"updated_at"`
+	Countries map[string][]string `json:"countries"` // Lower-case country code -> IPv4 CIDRs
+}
+
+// CountryCIDRImport summarizes a MaxMind CSV import
+type CountryCIDRImport struct {
+	Source     string         `json:"source"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	Countries  int            `json:"countries"`
+	TotalCIDRs int            `json:"total_cidrs"`
+	PerCountry map[string]int `json:"per_country"`
+	Cached     bool           `json:"cached"` // Served from the on-disk cache, no download
+}
+
+// SetCountryCIDRSource selects where DownloadCountryCIDRs gets country ranges from
+func (g *GeoIPService) SetCountryCIDRSource(source string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.cidrSource = source
+}
+
+// GetCountryCIDRSource returns the configured country CIDR source
+func (g *GeoIPService) GetCountryCIDRSource() string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.cidrSource == "" {
+		return CountryCIDRSourceIPVerse
+	}
+	return g.cidrSource
+}
+
+// maxmindCSVCachePath is where the parsed CSV import is stored
+func (g *GeoIPService) maxmindCSVCachePath() string {
+	return filepath.Join(g.dbPath, "country_cidrs_maxmind.json")
+}
+
+// ImportMaxMindCSV loads country CIDRs from the GeoLite2-Country CSV edition.
+// The parsed result is cached on disk and reused for 24h unless force is set.
+func (g *GeoIPService) ImportMaxMindCSV(force bool) (*CountryCIDRImport, error) {
+	g.csvMu.Lock()
+	defer g.csvMu.Unlock()
+
+	if !force {
+		if g.maxmindCSV == nil {
+			g.maxmindCSV = g.loadMaxMindCSVCache()
+		}
+		if g.maxmindCSV != nil && time.Since(g.maxmindCSV.UpdatedAt) < maxmindCSVMaxAge {
+			return summarizeCSVImport(g.maxmindCSV, true), nil
+		}
+	}
+
+	g.mu.RLock()
+	licenseKey := g.licenseKey
+	g.mu.RUnlock()
+
+	var countries map[string][]string
+	err := fmt.Errorf("no MaxMind license key configured")
+	if licenseKey != "" {
+		countries, err = g.downloadMaxMindCSV(licenseKey)
+	}
+	if err != nil {
+		// An outdated import is still more consistent with the mmdb than switching sources
+		if !force && g.maxmindCSV != nil {
+			system.Warn("MaxMind CSV refresh failed, keeping import from %s: %v", g.maxmindCSV.UpdatedAt.Format(time.RFC3339), err)
+			return summarizeCSVImport(g.maxmindCSV, true), nil
+		}
+		return nil, err
+	}
+	cache := &maxmindCSVCache{UpdatedAt: time.Now(), Countries: countries}
+	g.maxmindCSV = cache
+
+	if data, err := json.Marshal(cache); err == nil {
+		if err := os.WriteFile(g.maxmindCSVCachePath(), data, 0644); err != nil {
+			system.Warn("Failed to cache MaxMind country CIDRs: %v", err)
+		}
+	}
+
+	summary := summarizeCSVImport(cache, false)
+	system.Info("Imported MaxMind country CIDRs: %d ranges across %d countries", summary.TotalCIDRs, summary.Countries)
+	return summary, nil
+}
+
+// loadMaxMindCSVCache reads the on-disk cache (nil if missing or unreadable)
+func (g *GeoIPService) loadMaxMindCSVCache() *maxmindCSVCache {
+	data, err := os.ReadFile(g.maxmindCSVCachePath())
+	if err != nil {
+		return nil
+	}
+	var cache maxmindCSVCache
+	if err := json.Unmarshal(data, &cache); err != nil || len(cache.Countries) == 0 {
+		return nil
+	}
+	return &cache
+}
+
+func summarizeCSVImport(cache *maxmindCSVCache, cached bool) *CountryCIDRImport {
+	summary := &CountryCIDRImport{
+		Source:     CountryCIDRSourceMaxMindCSV,
+		UpdatedAt:  cache.UpdatedAt,
+		Countries:  len(cache.Countries),
+		PerCountry: make(map[string]int, len(cache.Countries)),
+		Cached:     cached,
+	}
+	for cc, cidrs := range cache.Countries {
+		summary.PerCountry[strings.ToUpper(cc)] = len(cidrs)
+		summary.TotalCIDRs += len(cidrs)
+	}
+	return summary
+}
+
+// downloadMaxMindCSV fetches the CSV zip and maps each IPv4 network to its country code
+func (g *GeoIPService) downloadMaxMindCSV(licenseKey string) (map[string][]string, error) {
+	url := fmt.Sprintf(
+		"https://download.maxmind.com/app/geoip_download?edition_id=GeoLite2-Country-CSV&license_key=%s&suffix=zip",
+		licenseKey,
+	)
+
+	system.Info("Downloading GeoLite2-Country CSV...")
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("download failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("download failed with status: %s", resp.Status)
+	}
+
+	// zip needs random access, so spool the archive to disk
+	tmp, err := os.CreateTemp(g.dbPath, "geolite2-csv-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("download failed: %v", err)
+	}
+
+	zr, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV archive: %v", err)
+	}
+
+	var blocksFile, locationsFile *zip.File
+	for _, f := range zr.File {
+		switch filepath.Base(f.Name) {
+		case "GeoLite2-Country-Blocks-IPv4.csv":
+			blocksFile = f
+		case "GeoLite2-Country-Locations-en.csv":
+			locationsFile = f
+		}
+	}
+	if blocksFile == nil || locationsFile == nil {
+		return nil, fmt.Errorf("CSV archive is missing the IPv4 blocks or English locations file")
+	}
+
+	// geoname_id -> country ISO code
+	geonames := make(map[string]string)
+	if err := readCSV(locationsFile, func(col map[string]int, row []string) {
+		iso := strings.ToLower(field(row, col, "country_iso_code"))
+		if iso != "" {
+			geonames[field(row, col, "geoname_id")] = iso
+		}
+	}); err != nil {
+		return nil, fmt.Errorf("failed to parse locations: %v", err)
+	}
+
+	countries := make(map[string][]string)
+	if err := readCSV(blocksFile, func(col map[string]int, row []string) {
+		network := field(row, col, "network")
+		if _, _, err := net.ParseCIDR(network); err != nil {
+			return
+		}
+		// Networks without a located country fall back to the registered country, as the mmdb lookup does
+		iso := geonames[field(row, col, "geoname_id")]
+		if iso == "" {
+			iso = geonames[field(row, col, "registered_country_geoname_id")]
+		}
+		if iso != "" {
+			countries[iso] = append(countries[iso], network)
+		}
+	}); err != nil {
+		return nil, fmt.Errorf("failed to parse IPv4 blocks: %v", err)
+	}
+
+	if len(countries) == 0 {
+		return nil, fmt.Errorf("CSV archive contained no country networks")
+	}
+	return countries, nil
+}
+
+// readCSV streams a CSV file from the archive, passing the header index and each row to fn
+func readCSV(f *zip.File, fn func(col map[string]int, row []string)) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	r := csv.NewReader(rc)
+	r.ReuseRecord = true
+	header, err := r.Read()
+	if err != nil {
+		return err
+	}
+	col := make(map[string]int, len(header))
+	for i, name := range header {
+		col[name] = i
+	}
+
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fn(col, row)
+	}
+}
+
+func field(row []string, col map[string]int, name string) string {
+	if i, ok := col[name]; ok && i < len(row) {
+		return row[i]
+	}
+	return ""
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Unknown country (XX) policies: what happens to sources GeoIP cannot place in a country
+const (
+	UnknownCountryBlock              = "block"                // Dropped like any non-allowed country (default)
+	UnknownCountryAllow              = "allow"                // Always pass the geo filter
+	UnknownCountryAllowIfWhitelisted = "allow_if_whitelisted" // Pass only while "XX" is in the allowed countries
+)
+
+// UnknownCountryCode is the pseudo country code of unclassified sources
+const UnknownCountryCode = "XX"
+
+// ValidUnknownCountryPolicy reports whether p is a known unknown-country policy
+func ValidUnknownCountryPolicy(p string) bool {
+	return p == UnknownCountryBlock || p == UnknownCountryAllow || p == UnknownCountryAllowIfWhitelisted
+}
+
+// UnknownCountryAllowed reports whether unclassified sources pass the geo filter under policy,
+// given the allowed countries in effect
+func UnknownCountryAllowed(policy string, allowedCountries []string) bool {
+	switch policy {
+	case UnknownCountryAllow:
+		return true
+	case UnknownCountryAllowIfWhitelisted:
+		for _, cc := range allowedCountries {
+			if strings.EqualFold(strings.TrimSpace(cc), UnknownCountryCode) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unclassifiedExcluded are never treated as unclassified: private, loopback, link-local,
+// CGNAT and multicast/reserved space have no country and must not be allowed by it
+var unclassifiedExcluded = []string{
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8",
+	"169.254.0.0/16", "172.16.0.0/12", "192.168.0.0/16", "224.0.0.0/3",
+}
+
+// SetUnknownCountryAllowed selects whether GetCountryCIDRs/GetAllCountryCIDRs include the
+// unclassified ranges under "xx"; returns true if the value changed
+func (g *GeoIPService) SetUnknownCountryAllowed(allow bool) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	changed := g.allowUnknown != allow
+	g.allowUnknown = allow
+	return changed
+}
+
+// UnknownCountryAllowedNow reports whether unclassified sources currently pass the geo filter
+func (g *GeoIPService) UnknownCountryAllowedNow() bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.allowUnknown
+}
+
+// UnclassifiedCIDRs returns the public IPv4 ranges the GeoLite2 database assigns no country,
+// i.e. the sources that look up as "XX". Computed once per loaded database.
+func (g *GeoIPService) UnclassifiedCIDRs() ([]string, error) {
+	g.mu.RLock()
+	if g.unclassified != nil && g.unclassifiedAt.Equal(g.lastUpdate) {
+		cidrs := g.unclassified
+		g.mu.RUnlock()
+		return cidrs, nil
+	}
+	loaded := g.db != nil
+	version := g.lastUpdate
+	g.mu.RUnlock()
+	if !loaded {
+		return nil, fmt.Errorf("no GeoIP database loaded")
+	}
+
+	cidrs, err := computeUnclassifiedCIDRs(filepath.Join(g.dbPath, "GeoLite2-Country.mmdb"))
+	if err != nil {
+		return nil, err
+	}
+
+	g.mu.Lock()
+	g.unclassified = cidrs
+	g.unclassifiedAt = version
+	g.mu.Unlock()
+	return cidrs, nil
+}
+
+// ipSpan is an inclusive IPv4 range
+type ipSpan struct{ lo, hi uint64 }
+
+func computeUnclassifiedCIDRs(path string) ([]string, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var covered []ipSpan
+	for _, cidr := range unclassifiedExcluded {
+		_, n, _ := net.ParseCIDR(cidr)
+		covered = append(covered, netSpan(n.IP.To4(), n.Mask))
+	}
+
+	_, ipv4, _ := net.ParseCIDR("0.0.0.0/0")
+	networks := reader.NetworksWithin(ipv4, maxminddb.SkipAliasedNetworks)
+	for networks.Next() {
+		var record struct {
+			Country struct {
+				ISOCode string `maxminddb:"iso_code"`
+			} `maxminddb:"country"`
+		}
+		subnet, err := networks.Network(&record)
+		if err != nil {
+			return nil, err
+		}
+		if record.Country.ISOCode == "" {
+			continue
+		}
+		ip, mask := subnet.IP, subnet.Mask
+		if ones, bits := mask.Size(); bits == 128 {
+			// IPv4 subtree of an IPv6 database: ::a.b.c.d/96+n
+			ip, mask = ip[12:], net.CIDRMask(ones-96, 32)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			covered = append(covered, netSpan(ip4, mask))
+		}
+	}
+	if err := networks.Err(); err != nil {
+		return nil, err
+	}
+
+	// Gaps between the merged covered spans are unclassified
+	sort.Slice(covered, func(i, j int) bool { return covered[i].lo < covered[j].lo })
+	var cidrs []string
+	next := uint64(0)
+	for _, s := range covered {
+		if s.lo > next {
+			cidrs = append(cidrs, spanCIDRs(next, s.lo-1)...)
+		}
+		if s.hi+1 > next {
+			next = s.hi + 1
+		}
+	}
+	if next <= 0xFFFFFFFF {
+		cidrs = append(cidrs, spanCIDRs(next, 0xFFFFFFFF)...)
+	}
+	return cidrs, nil
+}
+
+func netSpan(ip net.IP, mask net.IPMask) ipSpan {
+	ones, _ := mask.Size()
+	lo := uint64(ipToUint32(ip))
+	return ipSpan{lo: lo, hi: lo + (uint64(1) << uint(32-ones)) - 1}
+}
+
+// spanCIDRs splits an inclusive IPv4 range into the fewest CIDR blocks
+func spanCIDRs(lo, hi uint64) []string {
+	var cidrs []string
+	for lo <= hi {
+		size := uint(0)
+		for size < 32 {
+			block := uint64(1) << (size + 1)
+			if lo%block != 0 || lo+block-1 > hi {
+				break
+			}
+			size++
+		}
+		cidrs = append(cidrs, fmt.Sprintf("%s/%d", uint32ToIP(uint32(lo)), 32-size))
+		lo += uint64(1) << size
+	}
+	return cidrs
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"fmt"
+	"kg-proxy-web-gui/backend/system"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// GeoIP database update defaults: refresh weekly, and only if the local build is a week old
+const (
+	DefaultGeoIPUpdateInterval = 7 * 24 * time.Hour
+	DefaultGeoIPMaxAge         = 7 * 24 * time.Hour
+)
+
+// GeoIPUpdateCheck is the outcome of comparing the local database with MaxMind's published build
+type GeoIPUpdateCheck struct {
+	CheckedAt       time.Time  `json:"checked_at"`
+	LocalBuild      *time.Time `json:"local_build"`
+	RemoteBuild     *time.Time `json:"remote_build"`
+	UpdateAvailable bool       `json:"update_available"`
+	Downloaded      bool       `json:"downloaded"`
+	Error           string     `json:"error,omitempty"`
+}
+
+// GeoIPUpdateStatus describes the database update cycle
+type GeoIPUpdateStatus struct {
+	HasDatabase         bool              `json:"has_database"`
+	LicenseConfigured   bool              `json:"license_configured"`
+	LocalBuild          *time.Time        `json:"local_build"`
+	FileUpdatedAt       *time.Time        `json:"file_updated_at"`
+	UpdateIntervalHours float64           `json:"update_interval_hours"`
+	MaxAgeHours         float64           `json:"max_age_hours"`
+	NextRefreshDue      *time.Time        `json:"next_refresh_due"`
+	LastAttempt         *time.Time        `json:"last_attempt"`
+	LastSuccess         *time.Time        `json:"last_success"`
+	LastError           string            `json:"last_error,omitempty"`
+	LastCheck           *GeoIPUpdateCheck `json:"last_check"`
+}
+
+// mmdbDatePattern finds the build date in MaxMind's archive name, e.g. GeoLite2-Country_20240102.tar.gz
+var mmdbDatePattern = regexp.MustCompile(`_(\d{8})\.tar\.gz`)
+
+// SetUpdatePolicy sets how often the database refresh runs and how old the local build must be
+// before MaxMind is asked for a newer one (0 keeps the weekly defaults)
+func (g *GeoIPService) SetUpdatePolicy(interval, maxAge time.Duration) {
+	if interval <= 0 {
+		interval = DefaultGeoIPUpdateInterval
+	}
+	if maxAge <= 0 {
+		maxAge = DefaultGeoIPMaxAge
+	}
+	g.mu.Lock()
+	g.updateInterval = interval
+	g.maxAge = maxAge
+	g.mu.Unlock()
+	g.feeds.setInterval("geolite2", interval)
+}
+
+// updatePolicy returns the configured interval and max age
+func (g *GeoIPService) updatePolicy() (time.Duration, time.Duration) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	interval, maxAge := g.updateInterval, g.maxAge
+	if interval <= 0 {
+		interval = DefaultGeoIPUpdateInterval
+	}
+	if maxAge <= 0 {
+		maxAge = DefaultGeoIPMaxAge
+	}
+	return interval, maxAge
+}
+
+// localBuildDate returns the build date recorded in the loaded database (zero if none)
+func (g *GeoIPService) localBuildDate() time.Time {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.db == nil {
+		return time.Time{}
+	}
+	return time.Unix(int64(g.db.Metadata().BuildEpoch), 0)
+}
+
+// remoteBuildDate asks MaxMind for the date of the current GeoLite2-Country build without downloading it
+func (g *GeoIPService) remoteBuildDate(licenseKey string) (time.Time, error) {
+	url := fmt.Sprintf(
+		"https://download.maxmind.com/app/geoip_download?edition_id=GeoLite2-Country&license_key=%s&suffix=tar.gz",
+		licenseKey,
+	)
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Head(url)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("update check failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, fmt.Errorf("update check failed with status: %s", resp.Status)
+	}
+
+	// The archive name carries the build date; Last-Modified is the fallback
+	if m := mmdbDatePattern.FindStringSubmatch(resp.Header.Get("Content-Disposition")); m != nil {
+		if t, err := time.Parse("20060102", m[1]); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("MaxMind did not report a build date")
+}
+
+// CheckForUpdate compares the local build date with MaxMind's and, if download is set,
+// fetches and loads the database only when a newer build is published
+func (g *GeoIPService) CheckForUpdate(download bool) (*GeoIPUpdateCheck, error) {
+	g.mu.RLock()
+	licenseKey := g.licenseKey
+	g.mu.RUnlock()
+
+	check := &GeoIPUpdateCheck{CheckedAt: time.Now()}
+	defer func() {
+		g.mu.Lock()
+		g.lastCheck = check
+		g.mu.Unlock()
+	}()
+
+	if licenseKey == "" {
+		check.Error = "no MaxMind license key configured"
+		return check, fmt.Errorf("%s", check.Error)
+	}
+
+	local := g.localBuildDate()
+	if !local.IsZero() {
+		check.LocalBuild = &local
+	}
+	remote, err := g.remoteBuildDate(licenseKey)
+	if err != nil {
+		check.Error = err.Error()
+		return check, err
+	}
+	check.RemoteBuild = &remote
+	// Build dates are day-granular on MaxMind's side
+	check.UpdateAvailable = local.IsZero() || remote.After(local.Truncate(24*time.Hour))
+
+	if !check.UpdateAvailable || !download {
+		return check, nil
+	}
+
+	if err := g.downloadGeoLite2(true); err != nil {
+		check.Error = err.Error()
+		return check, err
+	}
+	if err := g.loadDB(filepath.Join(g.dbPath, "GeoLite2-Country.mmdb")); err != nil {
+		check.Error = err.Error()
+		return check, err
+	}
+	check.Downloaded = true
+	system.Info("GeoIP database updated to build %s", remote.Format("2006-01-02"))
+	return check, nil
+}
+
+// scheduledGeoIPRefresh is the geolite2 feed job: skip while the local build is younger than the max age,
+// otherwise download only if MaxMind has published a newer build
+func (g *GeoIPService) scheduledGeoIPRefresh() error {
+	g.mu.RLock()
+	hasLicense := g.licenseKey != ""
+	g.mu.RUnlock()
+	if !hasLicense {
+		return errFeedSkipped
+	}
+
+	_, maxAge := g.updatePolicy()
+	if local := g.localBuildDate(); !local.IsZero() && time.Since(local) < maxAge {
+		system.Info("GeoIP database build %s is within max age (%v), no update check needed", local.Format("2006-01-02"), maxAge)
+		return nil
+	}
+
+	check, err := g.CheckForUpdate(true)
+	if err != nil {
+		return err
+	}
+	if !check.Downloaded {
+		system.Info("GeoIP database is current (MaxMind build %s)", check.RemoteBuild.Format("2006-01-02"))
+		return nil
+	}
+	if g.webhook != nil && g.webhook.IsEnabled() {
+		g.webhook.SendSystemAlert("🌍 GeoIP Database Updated", "The MaxMind GeoLite2 database has been successfully updated.", ColorBlue)
+	}
+	return nil
+}
+
+// GetUpdateStatus returns the database build, update policy and the schedule of the next refresh
+func (g *GeoIPService) GetUpdateStatus() GeoIPUpdateStatus {
+	interval, maxAge := g.updatePolicy()
+	status := GeoIPUpdateStatus{
+		HasDatabase:         g.HasDatabase(),
+		UpdateIntervalHours: interval.Hours(),
+		MaxAgeHours:         maxAge.Hours(),
+	}
+
+	g.mu.RLock()
+	status.LicenseConfigured = g.licenseKey != ""
+	status.LastCheck = g.lastCheck
+	g.mu.RUnlock()
+
+	if local := g.localBuildDate(); !local.IsZero() {
+		status.LocalBuild = &local
+	}
+	if mod := fileModTime(filepath.Join(g.dbPath, "GeoLite2-Country.mmdb")); !mod.IsZero() {
+		status.FileUpdatedAt = &mod
+	}
+	for _, feed := range g.feeds.statuses() {
+		if feed.Name == "geolite2" {
+			next := feed.NextScheduled
+			status.NextRefreshDue = &next
+			status.LastAttempt = feed.LastAttempt
+			status.LastSuccess = feed.LastSuccess
+			status.LastError = feed.LastError
+		}
+	}
+	return status
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"kg-proxy-web-gui/backend/models"
+	"net"
+	"sort"
+	"strings"
+)
+
+// GeoPolicy is the subset of SecuritySettings that decides whether a source is geo-filtered
+type GeoPolicy struct {
+	AllowCountries []string `json:"geo_allow_countries"`
+	BlockVPN       bool     `json:"block_vpn"`
+	BlockTOR       bool     `json:"block_tor"`
+	UnknownCountry string   `json:"unknown_country_policy"`
+	Mode           string   `json:"geo_mode"`            // GeoModeAllow or GeoModeBlock
+	BlockCountries []string `json:"geo_block_countries"` // Used in block mode instead of AllowCountries
+}
+
+// GeoPolicyFromSettings extracts the geo policy currently configured
+func GeoPolicyFromSettings(settings *models.SecuritySettings) GeoPolicy {
+	policy := GeoPolicy{
+		BlockVPN:       settings.BlockVPN,
+		BlockTOR:       settings.BlockTOR,
+		UnknownCountry: settings.UnknownCountryPolicy,
+		Mode:           settings.GeoMode,
+		BlockCountries: GeoBlockCountries(settings),
+	}
+	for _, cc := range strings.Split(settings.GeoAllowCountries, ",") {
+		if cc = strings.ToUpper(strings.TrimSpace(cc)); cc != "" {
+			policy.AllowCountries = append(policy.AllowCountries, cc)
+		}
+	}
+	return policy
+}
+
+// ImpactedIP is an active source that would go from allowed to blocked
+type ImpactedIP struct {
+	IP          string `json:"ip"`
+	CountryCode string `json:"country_code"`
+	Reason      string `json:"reason"` // country, vpn or tor
+	PacketCount int    `json:"packet_count"`
+	Ports       []int  `json:"ports"`
+}
+
+// ImpactReport summarizes how a proposed geo policy affects current traffic
+type ImpactReport struct {
+	ActiveIPs       int            `json:"active_ips"`
+	Exempt          int            `json:"exempt"`             // Private, whitelisted or allow_foreign sources
+	AlreadyBlocked  int            `json:"already_blocked"`    // Blocked under the current policy too
+	NewlyBlocked    int            `json:"newly_blocked"`      // Allowed now, blocked under the proposal
+	NewlyAllowed    int            `json:"newly_allowed"`      // Blocked now, allowed under the proposal
+	ByCountry       map[string]int `json:"by_country"`         // Newly blocked per country
+	NewlyBlockedPkt int            `json:"newly_blocked_pkts"` // Packets in the sample window from newly blocked IPs
+	Samples         []ImpactedIP   `json:"samples"`            // Busiest newly blocked IPs
+}
+
+// geoPolicyBlocks reports whether the policy blocks ip, and why
+func (g *GeoIPService) geoPolicyBlocks(ip string, country string, policy GeoPolicy) (bool, string) {
+	if policy.BlockTOR && g.IsTOR(ip) {
+		return true, "tor"
+	}
+	if policy.BlockVPN && g.IsVPN(ip) {
+		return true, "vpn"
+	}
+	if policy.Mode == GeoModeBlock {
+		for _, cc := range policy.BlockCountries {
+			if strings.EqualFold(cc, country) {
+				return true, "country"
+			}
+		}
+		return false, ""
+	}
+	if len(policy.AllowCountries) > 0 {
+		if strings.EqualFold(country, UnknownCountryCode) {
+			if UnknownCountryAllowed(policy.UnknownCountry, policy.AllowCountries) {
+				return false, ""
+			}
+			return true, "country"
+		}
+		for _, cc := range policy.AllowCountries {
+			if strings.EqualFold(cc, country) {
+				return false, ""
+			}
+		}
+		return true, "country"
+	}
+	return false, ""
+}
+
+// EvaluateGeoImpact compares the current and proposed geo policies over live traffic.
+// exempt lists sources the geo filter never applies to (whitelist / allow_foreign entries).
+func (g *GeoIPService) EvaluateGeoImpact(traffic []TrafficEntry, current, proposed GeoPolicy, exempt []*net.IPNet, sampleLimit int) ImpactReport {
+	type activeIP struct {
+		packets int
+		ports   map[int]bool
+	}
+	active := make(map[string]*activeIP)
+	for _, entry := range traffic {
+		a, ok := active[entry.SourceIP]
+		if !ok {
+			a = &activeIP{ports: make(map[int]bool)}
+			active[entry.SourceIP] = a
+		}
+		a.packets += entry.PacketCount
+		if entry.DestPort > 0 {
+			a.ports[entry.DestPort] = true
+		}
+	}
+
+	report := ImpactReport{
+		ActiveIPs: len(active),
+		ByCountry: make(map[string]int),
+		Samples:   []ImpactedIP{},
+	}
+	var impacted []ImpactedIP
+
+	for ipStr, a := range active {
+		ip := net.ParseIP(ipStr)
+		if ip == nil {
+			continue
+		}
+		if ip.IsPrivate() || ip.IsLoopback() || ipInNets(ip, exempt) {
+			report.Exempt++
+			continue
+		}
+
+		country := g.GetCountryCode(ipStr)
+		blockedNow, _ := g.geoPolicyBlocks(ipStr, country, current)
+		blockedNext, reason := g.geoPolicyBlocks(ipStr, country, proposed)
+		switch {
+		case blockedNow && blockedNext:
+			report.AlreadyBlocked++
+		case blockedNow && !blockedNext:
+			report.NewlyAllowed++
+		case !blockedNow && blockedNext:
+			report.NewlyBlocked++
+			report.NewlyBlockedPkt += a.packets
+			report.ByCountry[country]++
+			ports := make([]int, 0, len(a.ports))
+			for p := range a.ports {
+				ports = append(ports, p)
+			}
+			sort.Ints(ports)
+			impacted = append(impacted, ImpactedIP{
+				IP:          ipStr,
+				CountryCode: country,
+				Reason:      reason,
+				PacketCount: a.packets,
+				Ports:       ports,
+			})
+		}
+	}
+
+	// Busiest sources first: those are most likely real players in a session
+	sort.Slice(impacted, func(i, j int) bool { return impacted[i].PacketCount > impacted[j].PacketCount })
+	if len(impacted) > sampleLimit {
+		impacted = impacted[:sampleLimit]
+	}
+	report.Samples = append(report.Samples, impacted...)
+	return report
+}
+
+func ipInNets(ip net.IP, nets []*net.IPNet) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"net"
+	"time"
+)
+
+// intelSweepInterval is how often the top talkers are checked against IP intelligence
+const intelSweepInterval = time.Minute
+
+// intelChecksPerSweep bounds provider API usage per sweep (cached results don't count)
+const intelChecksPerSweep = 20
+
+// SetIntelligenceBan enables auto-banning top talkers whose IP intelligence score reaches threshold (0 disables)
+func (t *OffenseTracker) SetIntelligenceBan(enabled bool, threshold int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.intelEnabled = enabled
+	t.intelThreshold = threshold
+}
+
+// IntelligenceBanVerdict decides whether a result warrants a ban at threshold.
+// Providers without a score fall back to the VPN/proxy/Tor threat flag.
+func IntelligenceBanVerdict(result *IPIntelligenceResult, threshold int) (bool, string) {
+	if result == nil || threshold <= 0 {
+		return false, ""
+	}
+	if result.Score != nil {
+		if *result.Score >= threshold {
+			return true, fmt.Sprintf("%s score %d >= %d", result.Provider, *result.Score, threshold)
+		}
+		return false, ""
+	}
+	if result.Threat {
+		return true, fmt.Sprintf("%s flagged as VPN/proxy/Tor", result.Provider)
+	}
+	return false, ""
+}
+
+// sweepIntelligence checks the current top talkers and bans those over the score threshold
+func (t *OffenseTracker) sweepIntelligence() {
+	t.mu.Lock()
+	enabled, threshold := t.intelEnabled, t.intelThreshold
+	ebpf, geoip := t.ebpf, t.geoip
+	now := time.Now()
+	for ip, at := range t.intelChecked {
+		if now.Sub(at) > ipIntelCacheTTL {
+			delete(t.intelChecked, ip)
+		}
+	}
+	t.mu.Unlock()
+
+	if !enabled || threshold <= 0 || ebpf == nil || geoip == nil || t.db == nil {
+		return
+	}
+
+	checks := 0
+	for _, entry := range ebpf.GetTrafficData() {
+		if checks >= intelChecksPerSweep {
+			break
+		}
+		ip := entry.SourceIP
+		if entry.Blocked || IsInternalIP(net.ParseIP(ip)) {
+			continue
+		}
+
+		t.mu.Lock()
+		_, seen := t.intelChecked[ip]
+		if !seen {
+			t.intelChecked[ip] = now
+		}
+		t.mu.Unlock()
+		if seen {
+			continue
+		}
+
+		var banned int64
+		t.db.Model(&models.BanIP{}).Where("ip = ?", ip).Count(&banned)
+		if banned > 0 {
+			continue
+		}
+
+		checks++
+		result, err := geoip.CheckIPIntelligence(ip)
+		if err != nil {
+			system.Debug("IP intelligence check for %s failed: %v", ip, err)
+			continue
+		}
+		if ban, why := IntelligenceBanVerdict(result, threshold); ban {
+			t.promote(ip, "ip_intelligence", "IP intelligence: "+why, "IP intelligence: "+why)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// defaultInternalCIDRs mirrors the private ranges GEO_GUARD RETURNs; the WireGuard tunnel
+// subnet (WGSubnet) is added to them
+var defaultInternalCIDRs = []string{
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"127.0.0.0/8",
+}
+
+// internalTraffic decides which sources the flood tracker and event recording ignore
+var internalTraffic = struct {
+	sync.RWMutex
+	enabled bool
+	extra   []*net.IPNet // Operator CIDRs
+	nets    []*net.IPNet // Defaults, WireGuard subnet and extra
+}{
+	enabled: true,
+	nets:    internalNets(nil),
+}
+
+// internalNets returns the default ranges, the current WireGuard subnet and extra
+func internalNets(extra []*net.IPNet) []*net.IPNet {
+	// The configured WireGuard subnet may lie outside the default private ranges
+	nets := mustParseCIDRs(append([]string{WGSubnet()}, defaultInternalCIDRs...))
+	return append(nets, extra...)
+}
+
+func mustParseCIDRs(cidrs []string) []*net.IPNet {
+	nets, err := ParseCIDRList(strings.Join(cidrs, ","))
+	if err != nil {
+		panic(err)
+	}
+	return nets
+}
+
+// ParseCIDRList parses a comma-separated list of CIDRs; bare IPs are treated as single hosts
+func ParseCIDRList(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP or CIDR %q", item)
+			}
+			if ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP or CIDR %q", item)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// ApplyInternalExclusion configures internal traffic exclusion: the default private/WireGuard
+// ranges plus the operator's extra CIDRs. Nothing is changed if extra fails to parse.
+func ApplyInternalExclusion(enabled bool, extra string) error {
+	nets, err := ParseCIDRList(extra)
+	if err != nil {
+		return err
+	}
+
+	internalTraffic.Lock()
+	defer internalTraffic.Unlock()
+	internalTraffic.enabled = enabled
+	internalTraffic.extra = nets
+	internalTraffic.nets = internalNets(nets)
+	return nil
+}
+
+// refreshInternalExclusion rebuilds the excluded ranges after the WireGuard subnet changed
+func refreshInternalExclusion() {
+	internalTraffic.Lock()
+	defer internalTraffic.Unlock()
+	internalTraffic.nets = internalNets(internalTraffic.extra)
+}
+
+// IsInternalIP reports whether ip is excluded from flood tracking and attack events
+func IsInternalIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	internalTraffic.RLock()
+	defer internalTraffic.RUnlock()
+	if !internalTraffic.enabled {
+		return false
+	}
+	for _, n := range internalTraffic.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isInternalAddr is IsInternalIP for the little-endian uint32 addresses carried in eBPF events
+func isInternalAddr(addr uint32) bool {
+	var ip [4]byte
+	binary.LittleEndian.PutUint32(ip[:], addr)
+	return IsInternalIP(net.IP(ip[:]))
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"net"
+	"testing"
+)
+
+func TestInternalExclusionFollowsWGSubnet(t *testing.T) {
+	if err := ApplyInternalExclusion(true, "203.0.113.0/24"); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	t.Cleanup(func() {
+		n, _ := ParseWGSubnet(DefaultWGSubnet)
+		setWGSubnet(n)
+		ApplyInternalExclusion(true, "")
+	})
+
+	tunnelIP := net.ParseIP("100.64.0.5")
+	if IsInternalIP(tunnelIP) {
+		t.Fatalf("%s internal before the subnet change", tunnelIP)
+	}
+	n, err := ParseWGSubnet("100.64.0.0/24")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	setWGSubnet(n)
+
+	if !IsInternalIP(tunnelIP) {
+		t.Errorf("%s in the new WireGuard subnet is not internal", tunnelIP)
+	}
+	if !IsInternalIP(net.ParseIP("203.0.113.9")) {
+		t.Errorf("operator CIDR lost on subnet change")
+	}
+}
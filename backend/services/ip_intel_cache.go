@@ -0,0 +1,88 @@
+package services
+
+import "time"
+
+// IPIntelCacheStats describes the IP intelligence cache for tuning
+type IPIntelCacheStats struct {
+	Entries  int     `json:"entries"`
+	Expired  int     `json:"expired"` // Still stored but re-checked on next lookup
+	Hits     uint64  `json:"hits"`
+	Misses   uint64  `json:"misses"`
+	HitRatio float64 `json:"hit_ratio"`
+	TTLHours float64 `json:"ttl_hours"`
+}
+
+// ipIntelCacheTTL is how long an IP intelligence result is reused
+const ipIntelCacheTTL = 24 * time.Hour
+
+// ClearIPIntelligenceCache drops cached intelligence for ip, or for every IP when ip is empty.
+// Returns the number of entries removed.
+func (g *GeoIPService) ClearIPIntelligenceCache(ip string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if ip != "" {
+		_, exists := g.ipInfoCache[ip]
+		delete(g.ipInfoCache, ip)
+		delete(g.cacheExpiry, ip)
+		if exists {
+			return 1
+		}
+		return 0
+	}
+
+	removed := len(g.ipInfoCache)
+	g.ipInfoCache = make(map[string]*IPIntelligenceResult)
+	g.cacheExpiry = make(map[string]time.Time)
+	return removed
+}
+
+// GetIPIntelligenceCacheStats returns cache size and hit/miss counts since startup
+func (g *GeoIPService) GetIPIntelligenceCacheStats() IPIntelCacheStats {
+	g.mu.RLock()
+	stats := IPIntelCacheStats{
+		Entries:  len(g.ipInfoCache),
+		TTLHours: ipIntelCacheTTL.Hours(),
+	}
+	now := time.Now()
+	for _, expiry := range g.cacheExpiry {
+		if !now.Before(expiry) {
+			stats.Expired++
+		}
+	}
+	g.mu.RUnlock()
+
+	stats.Hits = g.intelHits.Load()
+	stats.Misses = g.intelMisses.Load()
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+// flaggedIntelScore is the provider risk score at which an otherwise clean IP counts as a threat
+const flaggedIntelScore = 75
+
+// FlaggedIPIntelligence returns unexpired cached results that mark the IP as VPN, proxy, Tor,
+// a known threat or high risk. Hosting alone is not treated as a threat.
+func (g *GeoIPService) FlaggedIPIntelligence() []IPIntelligenceResult {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	now := time.Now()
+	flagged := make([]IPIntelligenceResult, 0)
+	for ip, result := range g.ipInfoCache {
+		if result == nil || !now.Before(g.cacheExpiry[ip]) {
+			continue
+		}
+		highRisk := result.Score != nil && *result.Score >= flaggedIntelScore
+		if result.IsVPN || result.IsProxy || result.IsTor || result.Threat || highRisk {
+			entry := *result
+			if entry.IP == "" {
+				entry.IP = ip
+			}
+			flagged = append(flagged, entry)
+		}
+	}
+	return flagged
+}
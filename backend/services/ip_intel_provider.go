@@ -0,0 +1,240 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// IP intelligence providers
+const (
+	IPIntelProviderIPInfo         = "ipinfo"         // ipinfo.io privacy detection (default)
+	IPIntelProviderAbuseIPDB      = "abuseipdb"      // AbuseIPDB confidence score
+	IPIntelProviderIPQualityScore = "ipqualityscore" // IPQualityScore proxy/VPN detection
+	IPIntelProviderProxyCheck     = "proxycheck"     // proxycheck.io
+)
+
+// abuseThreatScore is the AbuseIPDB confidence score from which an IP counts as a threat
+const abuseThreatScore = 75
+
+// ipIntelHTTPClient bounds provider requests so a slow API can't stall lookups
+var ipIntelHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// IPIntelligenceProvider looks up one IP and normalizes the provider's answer
+type IPIntelligenceProvider interface {
+	Name() string
+	Check(ip string) (*IPIntelligenceResult, error)
+}
+
+// NewIPIntelligenceProvider returns the provider for name ("" selects ipinfo.io)
+func NewIPIntelligenceProvider(name, apiKey string) (IPIntelligenceProvider, error) {
+	switch name {
+	case "", IPIntelProviderIPInfo:
+		return &ipInfoProvider{apiKey: apiKey}, nil
+	case IPIntelProviderAbuseIPDB:
+		return &abuseIPDBProvider{apiKey: apiKey}, nil
+	case IPIntelProviderIPQualityScore:
+		return &ipQualityScoreProvider{apiKey: apiKey}, nil
+	case IPIntelProviderProxyCheck:
+		return &proxyCheckProvider{apiKey: apiKey}, nil
+	}
+	return nil, fmt.Errorf("unknown IP intelligence provider %q", name)
+}
+
+// ValidIPIntelligenceProvider reports whether name selects a known provider
+func ValidIPIntelligenceProvider(name string) bool {
+	_, err := NewIPIntelligenceProvider(name, "")
+	return err == nil
+}
+
+// fetchIntelJSON performs a provider request and decodes the JSON body into out
+func fetchIntelJSON(provider string, req *http.Request, out interface{}) error {
+	resp, err := ipIntelHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", provider, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("%s returned status %d", provider, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// ipInfoProvider uses the ipinfo.io privacy detection fields
+type ipInfoProvider struct{ apiKey string }
+
+func (p *ipInfoProvider) Name() string { return IPIntelProviderIPInfo }
+
+func (p *ipInfoProvider) Check(ip string) (*IPIntelligenceResult, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("https://ipinfo.io/%s?token=%s", ip, url.QueryEscape(p.apiKey)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse response (IPinfo.io basic format)
+	var data struct {
+		IP      string `json:"ip"`
+		Country string `json:"country"`
+		Privacy struct {
+			VPN     bool `json:"vpn"`
+			Proxy   bool `json:"proxy"`
+			Tor     bool `json:"tor"`
+			Hosting bool `json:"hosting"`
+		} `json:"privacy"`
+	}
+	if err := fetchIntelJSON("IPinfo.io", req, &data); err != nil {
+		return nil, err
+	}
+
+	return &IPIntelligenceResult{
+		IP:        data.IP,
+		Country:   data.Country,
+		IsVPN:     data.Privacy.VPN,
+		IsProxy:   data.Privacy.Proxy,
+		IsTor:     data.Privacy.Tor,
+		IsHosting: data.Privacy.Hosting,
+		Threat:    data.Privacy.VPN || data.Privacy.Proxy || data.Privacy.Tor,
+	}, nil
+}
+
+// abuseIPDBProvider uses AbuseIPDB's abuse confidence score; it does not detect VPNs
+type abuseIPDBProvider struct{ apiKey string }
+
+func (p *abuseIPDBProvider) Name() string { return IPIntelProviderAbuseIPDB }
+
+func (p *abuseIPDBProvider) Check(ip string) (*IPIntelligenceResult, error) {
+	req, err := http.NewRequest("GET", "https://api.abuseipdb.com/api/v2/check?maxAgeInDays=90&ipAddress="+url.QueryEscape(ip), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Key", p.apiKey)
+	req.Header.Set("Accept", "application/json")
+
+	var data struct {
+		Data struct {
+			IPAddress            string `json:"ipAddress"`
+			AbuseConfidenceScore int    `json:"abuseConfidenceScore"`
+			CountryCode          string `json:"countryCode"`
+			UsageType            string `json:"usageType"` // e.g. "Data Center/Web Hosting/Transit"
+			IsTor                bool   `json:"isTor"`
+		} `json:"data"`
+	}
+	if err := fetchIntelJSON("AbuseIPDB", req, &data); err != nil {
+		return nil, err
+	}
+
+	d := data.Data
+	return &IPIntelligenceResult{
+		IP:        d.IPAddress,
+		Country:   d.CountryCode,
+		IsTor:     d.IsTor,
+		IsHosting: strings.Contains(d.UsageType, "Data Center"),
+		Score:     &d.AbuseConfidenceScore,
+		Threat:    d.IsTor || d.AbuseConfidenceScore >= abuseThreatScore,
+	}, nil
+}
+
+// ipQualityScoreProvider uses IPQualityScore's proxy/VPN detection and fraud score
+type ipQualityScoreProvider struct{ apiKey string }
+
+func (p *ipQualityScoreProvider) Name() string { return IPIntelProviderIPQualityScore }
+
+func (p *ipQualityScoreProvider) Check(ip string) (*IPIntelligenceResult, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("https://ipqualityscore.com/api/json/ip/%s/%s", url.PathEscape(p.apiKey), ip), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		Success        bool   `json:"success"`
+		Message        string `json:"message"`
+		FraudScore     int    `json:"fraud_score"`
+		CountryCode    string `json:"country_code"`
+		Proxy          bool   `json:"proxy"`
+		VPN            bool   `json:"vpn"`
+		Tor            bool   `json:"tor"`
+		ConnectionType string `json:"connection_type"` // e.g. "Data Center"
+	}
+	if err := fetchIntelJSON("IPQualityScore", req, &data); err != nil {
+		return nil, err
+	}
+	// Errors (bad key, quota) come back as 200 with success=false
+	if !data.Success {
+		return nil, fmt.Errorf("IPQualityScore: %s", data.Message)
+	}
+
+	return &IPIntelligenceResult{
+		IP:        ip,
+		Country:   data.CountryCode,
+		IsVPN:     data.VPN,
+		IsProxy:   data.Proxy,
+		IsTor:     data.Tor,
+		IsHosting: data.ConnectionType == "Data Center",
+		Score:     &data.FraudScore,
+		Threat:    data.VPN || data.Proxy || data.Tor,
+	}, nil
+}
+
+// proxyCheckProvider uses proxycheck.io's v2 API with VPN and risk detection
+type proxyCheckProvider struct{ apiKey string }
+
+func (p *proxyCheckProvider) Name() string { return IPIntelProviderProxyCheck }
+
+func (p *proxyCheckProvider) Check(ip string) (*IPIntelligenceResult, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("https://proxycheck.io/v2/%s?vpn=1&risk=1&key=%s", ip, url.QueryEscape(p.apiKey)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The per-IP object is keyed by the queried address next to "status"/"message"
+	var data map[string]json.RawMessage
+	if err := fetchIntelJSON("proxycheck.io", req, &data); err != nil {
+		return nil, err
+	}
+	var status, message string
+	json.Unmarshal(data["status"], &status)
+	json.Unmarshal(data["message"], &message)
+	if status != "ok" && status != "warning" {
+		return nil, fmt.Errorf("proxycheck.io: %s %s", status, message)
+	}
+
+	var entry struct {
+		Proxy   string `json:"proxy"` // "yes" / "no"
+		Type    string `json:"type"`  // "VPN", "TOR", "SOCKS5", "Hosting", ...
+		Risk    int    `json:"risk"`
+		IsoCode string `json:"isocode"`
+	}
+	raw, ok := data[ip]
+	if !ok {
+		return nil, fmt.Errorf("proxycheck.io: no result for %s", ip)
+	}
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	kind := strings.ToUpper(entry.Type)
+	result := &IPIntelligenceResult{
+		IP:        ip,
+		Country:   entry.IsoCode,
+		IsVPN:     kind == "VPN",
+		IsTor:     kind == "TOR",
+		IsHosting: kind == "HOSTING",
+		Score:     &entry.Risk,
+	}
+	result.IsProxy = entry.Proxy == "yes" && !result.IsVPN && !result.IsTor
+	result.Threat = entry.Proxy == "yes" || result.IsVPN || result.IsTor
+	return result, nil
+}
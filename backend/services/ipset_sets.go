@@ -0,0 +1,118 @@
+package services
+
+import (
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"runtime"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ipsetDef is one ipset the firewall creates and refills on every apply
+type ipsetDef struct {
+	name    string
+	options string // create arguments after the name
+	comment bool   // Entries carry a comment saying why they are in the set (shown by "ipset list")
+}
+
+// managedIPSets in creation order
+var managedIPSets = []ipsetDef{
+	{"geo_allowed", "hash:net family inet hashsize 131072 maxelem 2000000", false},
+	{"geo_blocked", "hash:net family inet hashsize 16384 maxelem 500000", false},
+	{"vpn_proxy", "hash:net family inet hashsize 1024 maxelem 100000", false},
+	{"tor_exits", "hash:ip family inet hashsize 1024 maxelem 10000", false},
+	{"allow_foreign", "hash:net family inet maxelem 100000 comment", true},
+	{"ban", "hash:net family inet maxelem 100000 comment", true},
+	{"flood_blocked", "hash:ip family inet timeout 1800", false},
+	{"white_list", "hash:net family inet maxelem 100000 comment", true},
+}
+
+// ipsetCommentMax keeps comments well below the kernel's 255 byte limit
+const ipsetCommentMax = 128
+
+// ipsetComment makes text safe for an ipset comment: single line, no quotes, bounded length
+func ipsetComment(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteRune('\'')
+		case unicode.IsControl(r):
+			b.WriteRune(' ')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	comment := strings.Join(strings.Fields(b.String()), " ")
+	for len(comment) > ipsetCommentMax {
+		_, size := utf8.DecodeLastRuneInString(comment)
+		comment = comment[:len(comment)-size]
+	}
+	return comment
+}
+
+// ipsetAddLine renders an ipset restore "add" line, with a comment when one is given
+func ipsetAddLine(set, entry, comment string) string {
+	if comment = ipsetComment(comment); comment != "" {
+		return fmt.Sprintf("add %s %s comment \"%s\"\n", set, entry, comment)
+	}
+	return fmt.Sprintf("add %s %s\n", set, entry)
+}
+
+// banComment explains a ban entry: who added it, why and until when
+func banComment(b models.BanIP) string {
+	source := "manual"
+	if b.IsAuto {
+		source = "auto"
+	}
+	comment := source + " ban"
+	if reason := strings.TrimSpace(b.Reason); reason != "" {
+		comment += ": " + reason
+	}
+	if b.ExpiresAt != nil {
+		comment += " (until " + b.ExpiresAt.Format("2006-01-02 15:04") + ")"
+	}
+	return comment
+}
+
+// labelComment explains an allow entry by its label
+func labelComment(kind, label string) string {
+	if label = strings.TrimSpace(label); label != "" {
+		return kind + ": " + label
+	}
+	return kind
+}
+
+// ensureCommentSets recreates managed sets that exist without the comment option,
+// since "create -exist" refuses to change options and "add ... comment" then fails.
+// The old set is swapped out so iptables rules referencing it stay valid; the following
+// restore refills it.
+func (s *FirewallService) ensureCommentSets() {
+	if runtime.GOOS != "linux" {
+		return
+	}
+	for _, def := range managedIPSets {
+		if !def.comment {
+			continue
+		}
+		out, err := s.Executor.Execute("ipset", "list", def.name, "-terse")
+		if err != nil || strings.Contains(out, " comment") {
+			continue // Missing (restore creates it) or already supports comments
+		}
+		tmp := def.name + "_cmt"
+		s.Executor.Execute("ipset", "destroy", tmp)
+		args := append([]string{"create", tmp}, strings.Fields(def.options)...)
+		if out, err := s.Executor.Execute("ipset", args...); err != nil {
+			system.Warn("Failed to upgrade ipset %s for comments: %v: %s", def.name, err, strings.TrimSpace(out))
+			continue
+		}
+		if out, err := s.Executor.Execute("ipset", "swap", tmp, def.name); err != nil {
+			system.Warn("Failed to upgrade ipset %s for comments: %v: %s", def.name, err, strings.TrimSpace(out))
+		} else {
+			system.Info("Upgraded ipset %s to store entry comments", def.name)
+		}
+		s.Executor.Execute("ipset", "destroy", tmp)
+	}
+}
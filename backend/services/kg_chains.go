@@ -0,0 +1,278 @@
+package services
+
+import (
+	"bufio"
+	"kg-proxy-web-gui/backend/system"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// KG-Proxy keeps its rules in its own chains (KG_PREROUTING, KG_INPUT, ...) that the built-in
+// chains jump to, and restores them with --noflush. Rules added by other tools (fail2ban,
+// docker, cloud agents) stay in the built-in chains and survive every apply.
+
+// kgChainPrefix names the chain that holds KG-Proxy's rules for a built-in chain
+const kgChainPrefix = "KG_"
+
+// kgOwnedChains are the built-in chains, per table, that jump into a KG_ chain
+var kgOwnedChains = map[string][]string{
+	"raw":    {"PREROUTING", "OUTPUT"},
+	"mangle": {"PREROUTING", "INPUT", "FORWARD", "OUTPUT", "POSTROUTING"},
+	"nat":    {"PREROUTING", "INPUT", "OUTPUT", "POSTROUTING"},
+	"filter": {"INPUT", "FORWARD", "OUTPUT"},
+}
+
+// kgTailHooks are the built-in chains that jump to their KG_ chain as the last rule instead of
+// the first. KG_INPUT accepts SSH, WireGuard and the panel, so hooked first it would hide
+// fail2ban's bans and docker's INPUT rules; hooked last it only sees what they let through,
+// ahead of the DROP policy.
+var kgTailHooks = map[string]map[string]bool{
+	"filter": {"INPUT": true},
+}
+
+// kgHelperChains are the other user chains the generated rules jump to
+var kgHelperChains = map[string][]string{
+	"mangle": {"DDOS_PRE", "GEO_GUARD", signatureChain},
+	"filter": {"EGRESS_GUARD"},
+}
+
+// KGChain returns the KG-Proxy chain for a built-in chain, e.g. KG_INPUT
+func KGChain(builtin string) string {
+	return kgChainPrefix + builtin
+}
+
+func isKGOwned(table, chain string) bool {
+	for _, c := range kgOwnedChains[table] {
+		if c == chain {
+			return true
+		}
+	}
+	return false
+}
+
+// intoKGChains moves a ruleset written against the built-in chains into the KG_ chains.
+// Every KG_ chain is declared right after the table header, so --noflush flushes and refills
+// it; built-in chain declarations only keep setting the policy.
+func intoKGChains(rules string) string {
+	var sb strings.Builder
+	table := ""
+	for _, line := range strings.SplitAfter(rules, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "*"):
+			table = strings.TrimPrefix(trimmed, "*")
+			sb.WriteString(line)
+			for _, chain := range kgOwnedChains[table] {
+				sb.WriteString(":" + KGChain(chain) + " - [0:0]\n")
+			}
+			continue
+		case strings.HasPrefix(trimmed, "-A "):
+			fields := strings.SplitN(trimmed, " ", 3)
+			if len(fields) == 3 && isKGOwned(table, fields[1]) {
+				sb.WriteString("-A " + KGChain(fields[1]) + " " + fields[2] + "\n")
+				continue
+			}
+		}
+		sb.WriteString(line)
+	}
+	return sb.String()
+}
+
+// isKGChain reports whether a chain of a table holds only KG-Proxy rules
+func isKGChain(table, chain string) bool {
+	if strings.HasPrefix(chain, kgChainPrefix) {
+		return true
+	}
+	for _, c := range kgHelperChains[table] {
+		if c == chain {
+			return true
+		}
+	}
+	return false
+}
+
+// kgRulesOnly reduces iptables-save output to a --noflush restore of KG-Proxy's chains: their
+// declarations and rules, plus the built-in chain policies. Other user chains are left out, as
+// declaring them would flush them.
+func kgRulesOnly(saved string) string {
+	var sb strings.Builder
+	table := ""
+	for _, line := range strings.SplitAfter(saved, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "*"):
+			table = strings.TrimPrefix(trimmed, "*")
+			if _, ok := kgOwnedChains[table]; !ok {
+				table = ""
+				continue
+			}
+		case table == "":
+			continue
+		case trimmed == "COMMIT":
+			table = ""
+		case strings.HasPrefix(trimmed, ":"):
+			fields := strings.Fields(strings.TrimPrefix(trimmed, ":"))
+			if len(fields) < 2 || (fields[1] == "-" && !isKGChain(table, fields[0])) {
+				continue
+			}
+		case strings.HasPrefix(trimmed, "-A "):
+			fields := strings.SplitN(trimmed, " ", 3)
+			if len(fields) < 3 || !isKGChain(table, fields[1]) {
+				continue
+			}
+		default:
+			continue
+		}
+		sb.WriteString(line)
+	}
+	return sb.String()
+}
+
+// ensureKGChains creates the KG_ chains of a table if needed and makes sure each built-in
+// chain jumps to its KG_ chain exactly once, as the first rule (the last for kgTailHooks)
+func (s *FirewallService) ensureKGChains(table string) {
+	s.ensureKGChainsWith("iptables", table)
+}
+
+// ensureKGChainsWith is ensureKGChains for iptables or ip6tables
+func (s *FirewallService) ensureKGChainsWith(cmd, table string) {
+	if runtime.GOOS != "linux" {
+		return
+	}
+	for _, chain := range kgOwnedChains[table] {
+		kg := KGChain(chain)
+		s.Executor.Execute(cmd, "-t", table, "-N", kg) // Fails harmlessly if it exists
+		if kgTailHooks[table][chain] {
+			s.hookKGChainLast(cmd, table, chain)
+			continue
+		}
+		if _, err := s.Executor.Execute(cmd, "-t", table, "-C", chain, "-j", kg); err == nil {
+			continue
+		}
+		if out, err := s.Executor.Execute(cmd, "-t", table, "-I", chain, "1", "-j", kg); err != nil {
+			system.Error("Failed to hook %s into %s/%s: %v: %s", kg, table, chain, err, strings.TrimSpace(out))
+		}
+	}
+}
+
+// hookKGChainLast makes the jump to the KG_ chain the last rule of a built-in chain. A hook
+// left elsewhere (e.g. first, by an earlier version) is removed after the new one is appended,
+// so the chain is never without it.
+func (s *FirewallService) hookKGChainLast(cmd, table, chain string) {
+	kg := KGChain(chain)
+	hook := "-A " + chain + " -j " + kg
+
+	out, err := s.Executor.Execute(cmd, "-t", table, "-S", chain)
+	if err != nil {
+		system.Error("Failed to list %s/%s: %v: %s", table, chain, err, strings.TrimSpace(out))
+		return
+	}
+	rules := strings.Split(strings.TrimSpace(out), "\n")
+	hooks := 0
+	for _, rule := range rules {
+		if strings.TrimSpace(rule) == hook {
+			hooks++
+		}
+	}
+	if hooks == 1 && strings.TrimSpace(rules[len(rules)-1]) == hook {
+		return
+	}
+
+	if out, err := s.Executor.Execute(cmd, "-t", table, "-A", chain, "-j", kg); err != nil {
+		system.Error("Failed to hook %s into %s/%s: %v: %s", kg, table, chain, err, strings.TrimSpace(out))
+		return
+	}
+	// -D removes the first match, so the hook just appended stays
+	for i := 0; i < hooks; i++ {
+		s.Executor.Execute(cmd, "-t", table, "-D", chain, "-j", kg)
+	}
+}
+
+// kgChainsMissing reports whether the KG_ chains have never been created on this host,
+// i.e. the running ruleset (if any) still comes from a version that owned the built-in chains
+func (s *FirewallService) kgChainsMissing() bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	_, err := s.Executor.Execute("iptables", "-t", "mangle", "-n", "-L", KGChain("PREROUTING"))
+	return err != nil
+}
+
+// removeLegacyBuiltinRules deletes the rules a previous version wrote straight into the
+// built-in chains, using the ruleset file it left behind. Rules from other tools are untouched.
+func (s *FirewallService) removeLegacyBuiltinRules(path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return // Nothing applied since boot
+	}
+	defer f.Close()
+
+	removed := 0
+	table := ""
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "*") {
+			table = strings.TrimPrefix(line, "*")
+			continue
+		}
+		if !strings.HasPrefix(line, "-A ") {
+			continue
+		}
+		args := splitRuleArgs(strings.TrimPrefix(line, "-A "))
+		if len(args) < 2 || !isKGOwned(table, args[0]) {
+			continue
+		}
+		cmd := append([]string{"-t", table, "-D"}, args...)
+		if _, err := s.Executor.Execute("iptables", cmd...); err == nil {
+			removed++
+		}
+	}
+	if removed > 0 {
+		system.Info("Moved firewall into KG_ chains: removed %d legacy rules from the built-in chains", removed)
+	}
+}
+
+// splitRuleArgs splits an iptables-restore rule into arguments, honouring double quotes
+func splitRuleArgs(rule string) []string {
+	var args []string
+	var cur strings.Builder
+	inQuotes, hasArg := false, false
+	for _, r := range rule {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			hasArg = true
+		case (r == ' ' || r == '\t') && !inQuotes:
+			if hasArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				hasArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			hasArg = true
+		}
+	}
+	if hasArg {
+		args = append(args, cur.String())
+	}
+	return args
+}
+
+// flushKGChains empties KG-Proxy's own chains in a table, leaving other tools' rules in place
+func (s *FirewallService) flushKGChains(table string) {
+	s.flushKGChainsWith("iptables", table)
+}
+
+// flushKGChainsWith is flushKGChains for iptables or ip6tables
+func (s *FirewallService) flushKGChainsWith(cmd, table string) {
+	for _, chain := range kgOwnedChains[table] {
+		s.Executor.Execute(cmd, "-t", table, "-F", KGChain(chain))
+	}
+	for _, chain := range kgHelperChains[table] {
+		s.Executor.Execute(cmd, "-t", table, "-F", chain)
+	}
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// chainExecutor is a CommandExecutor that keeps the rules of the built-in chains of one table
+// and applies -A/-I/-D/-S/-C to them like iptables does
+type chainExecutor struct {
+	chains map[string][]string // Chain -> rule specs, e.g. "-j KG_INPUT"
+}
+
+func (e *chainExecutor) GetOS() string { return "linux" }
+
+func (e *chainExecutor) Execute(command string, args ...string) (string, error) {
+	if len(args) < 4 || args[0] != "-t" {
+		return "", fmt.Errorf("unexpected command %s %v", command, args)
+	}
+	op, chain, spec := args[2], args[3], strings.Join(args[4:], " ")
+	rules := e.chains[chain]
+	switch op {
+	case "-N":
+		return "", nil
+	case "-S":
+		var sb strings.Builder
+		sb.WriteString("-P " + chain + " DROP\n")
+		for _, r := range rules {
+			sb.WriteString("-A " + chain + " " + r + "\n")
+		}
+		return sb.String(), nil
+	case "-C":
+		for _, r := range rules {
+			if r == spec {
+				return "", nil
+			}
+		}
+		return "", fmt.Errorf("no such rule")
+	case "-A":
+		e.chains[chain] = append(rules, spec)
+		return "", nil
+	case "-I":
+		// -I chain 1 spec
+		e.chains[chain] = append([]string{strings.Join(args[5:], " ")}, rules...)
+		return "", nil
+	case "-D":
+		for i, r := range rules {
+			if r == spec {
+				e.chains[chain] = append(rules[:i:i], rules[i+1:]...)
+				return "", nil
+			}
+		}
+		return "", fmt.Errorf("no such rule")
+	}
+	return "", fmt.Errorf("unexpected op %s", op)
+}
+
+func TestEnsureKGChainsHookOrder(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("KG_ chains are only hooked on Linux")
+	}
+
+	f2b := "-p tcp -m multiport --dports 22 -j f2b-sshd"
+	tests := []struct {
+		name  string
+		table string
+		chain string
+		rules []string
+		want  []string
+	}{
+		{
+			name:  "filter INPUT hooked after fail2ban",
+			table: "filter", chain: "INPUT",
+			rules: []string{f2b},
+			want:  []string{f2b, "-j KG_INPUT"},
+		},
+		{
+			name:  "filter INPUT hook moved from the top",
+			table: "filter", chain: "INPUT",
+			rules: []string{"-j KG_INPUT", f2b},
+			want:  []string{f2b, "-j KG_INPUT"},
+		},
+		{
+			name:  "filter INPUT hook already last",
+			table: "filter", chain: "INPUT",
+			rules: []string{f2b, "-j KG_INPUT"},
+			want:  []string{f2b, "-j KG_INPUT"},
+		},
+		{
+			name:  "mangle PREROUTING hooked first",
+			table: "mangle", chain: "PREROUTING",
+			rules: []string{"-j DOCKER_MANGLE"},
+			want:  []string{"-j KG_PREROUTING", "-j DOCKER_MANGLE"},
+		},
+	}
+	for _, tt := range tests {
+		exec := &chainExecutor{chains: map[string][]string{tt.chain: tt.rules}}
+		s := &FirewallService{Executor: exec}
+		s.ensureKGChains(tt.table)
+		s.ensureKGChains(tt.table) // Idempotent
+
+		if got := exec.chains[tt.chain]; strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%s: %s rules = %q, want %q", tt.name, tt.chain, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package services
+
+import (
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// offenseGap is the quiet period after which a new block event counts as a separate offense.
+// Events arriving while an IP is still being dropped belong to the same offense.
+const offenseGap = 60 * time.Second
+
+// OffenseRecord tracks how often an IP has been auto-blocked within the promotion window
+type OffenseRecord struct {
+	IP           string    `json:"ip"`
+	Count        int       `json:"count"`
+	FirstOffense time.Time `json:"first_offense"`
+	LastOffense  time.Time `json:"last_offense"`
+	LastSeen     time.Time `json:"last_seen"`
+	LastReason   string    `json:"last_reason"`
+}
+
+// OffenseTracker promotes IPs that keep getting auto-blocked to permanent bans
+type OffenseTracker struct {
+	mu        sync.Mutex
+	offenses  map[string]*OffenseRecord
+	threshold int           // 0 = disabled
+	window    time.Duration // Offenses older than this are forgotten
+
+	// Long-term recurrence, counted from persisted BlockHistory so it survives restarts
+	recurrenceThreshold int // Distinct auto-blocks within recurrenceWindow, 0 = disabled
+	recurrenceWindow    time.Duration
+	recurrenceCleared   map[string]time.Time // ClearOffenses per IP; blocks before it don't count
+	recurrenceClearedAt time.Time            // ClearOffenses of all IPs
+
+	// IP intelligence auto-ban of top talkers (see intel_ban.go)
+	intelEnabled   bool
+	intelThreshold int                  // Score from which an IP is banned, 0 = disabled
+	intelChecked   map[string]time.Time // Last evaluation per IP
+
+	db       *gorm.DB
+	executor system.CommandExecutor
+	ebpf     *EBPFService
+	webhook  *WebhookService
+	geoip    *GeoIPService
+}
+
+// NewOffenseTracker creates a tracker and starts its cleanup loop
+func NewOffenseTracker(db *gorm.DB, executor system.CommandExecutor) *OffenseTracker {
+	t := &OffenseTracker{
+		offenses:          make(map[string]*OffenseRecord),
+		window:            24 * time.Hour,
+		recurrenceWindow:  7 * 24 * time.Hour,
+		recurrenceCleared: make(map[string]time.Time),
+		intelChecked:      make(map[string]time.Time),
+		db:                db,
+		executor:          executor,
+	}
+
+	go func() {
+		ticker := time.NewTicker(10 * time.Minute)
+		defer ticker.Stop()
+		recurrenceTicker := time.NewTicker(time.Hour)
+		defer recurrenceTicker.Stop()
+		intelTicker := time.NewTicker(intelSweepInterval)
+		defer intelTicker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.cleanup()
+			case <-recurrenceTicker.C:
+				t.checkRecurrence()
+			case <-intelTicker.C:
+				t.sweepIntelligence()
+			}
+		}
+	}()
+
+	return t
+}
+
+// SetServices connects the services used when an IP gets promoted
+func (t *OffenseTracker) SetServices(ebpf *EBPFService, webhook *WebhookService, geoip *GeoIPService) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ebpf = ebpf
+	t.webhook = webhook
+	t.geoip = geoip
+}
+
+// SetConfig updates the promotion threshold (0 disables) and counting window
+func (t *OffenseTracker) SetConfig(threshold int, windowHours int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.threshold = threshold
+	if windowHours > 0 {
+		t.window = time.Duration(windowHours) * time.Hour
+	}
+}
+
+// SetRecurrenceConfig updates the multi-day recurrence threshold (0 disables) and window
+func (t *OffenseTracker) SetRecurrenceConfig(threshold int, windowDays int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.recurrenceThreshold = threshold
+	if windowDays > 0 {
+		t.recurrenceWindow = time.Duration(windowDays) * 24 * time.Hour
+	}
+}
+
+// checkRecurrence promotes IPs whose automatic blocks in BlockHistory exceed the recurrence threshold.
+// Only blocks after the IP's latest manual unblock or promotion count, so an IP an admin unbanned
+// starts over instead of being promoted again by the same history.
+func (t *OffenseTracker) checkRecurrence() {
+	t.mu.Lock()
+	threshold := t.recurrenceThreshold
+	window := t.recurrenceWindow
+	since := time.Now().Add(-window)
+	if t.recurrenceClearedAt.After(since) {
+		since = t.recurrenceClearedAt
+	}
+	cleared := make(map[string]time.Time, len(t.recurrenceCleared))
+	for ip, at := range t.recurrenceCleared {
+		cleared[ip] = at
+	}
+	t.mu.Unlock()
+
+	if threshold <= 0 || t.db == nil {
+		return
+	}
+
+	var rows []struct {
+		IP    string
+		Count int
+	}
+	// Rows after the IP's latest manual unblock or auto_promote entry
+	restart := t.db.Table("block_histories AS r").
+		Select("MAX(r.timestamp)").
+		Where("r.ip = block_histories.ip AND ((r.action = ? AND r.source = ?) OR r.source = ?)", BlockActionUnblocked, "manual", "auto_promote")
+	err := t.db.Model(&models.BlockHistory{}).
+		Select("ip, COUNT(*) as count").
+		Where("action = ? AND source IN ? AND timestamp > ?", BlockActionBlocked, []string{"ebpf", "flood"}, since).
+		Where("timestamp > COALESCE((?), ?)", restart, since).
+		Group("ip").
+		Having("COUNT(*) >= ?", threshold).
+		Scan(&rows).Error
+	if err != nil {
+		system.Warn("Failed to check block recurrence: %v", err)
+		return
+	}
+
+	days := int(window.Hours() / 24)
+	for _, row := range rows {
+		count := row.Count
+		if at, ok := cleared[row.IP]; ok {
+			if count = min(count, t.countBlocksSince(row.IP, at)); count < threshold {
+				continue
+			}
+		}
+		t.promote(row.IP, "recurring_attacker",
+			fmt.Sprintf("Auto-blocked %d times in %d days", count, days),
+			fmt.Sprintf("Recurring attacker: auto-blocked %d times in %d days, promoted to permanent ban", count, days))
+	}
+}
+
+// countBlocksSince counts the automatic blocks of ip after a ClearOffenses
+func (t *OffenseTracker) countBlocksSince(ip string, since time.Time) int {
+	var count int64
+	t.db.Model(&models.BlockHistory{}).
+		Where("ip = ? AND action = ? AND source IN ? AND timestamp > ?", ip, BlockActionBlocked, []string{"ebpf", "flood"}, since).
+		Count(&count)
+	return int(count)
+}
+
+// RecordBlock registers an automatic block for an IP.
+// Once the IP exceeds the threshold within the window it is promoted to a permanent ban.
+func (t *OffenseTracker) RecordBlock(ip string, reason string) {
+	t.mu.Lock()
+	if t.threshold <= 0 {
+		t.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	rec, exists := t.offenses[ip]
+	if !exists || now.Sub(rec.FirstOffense) > t.window {
+		rec = &OffenseRecord{IP: ip, FirstOffense: now}
+		t.offenses[ip] = rec
+	}
+
+	// Continuous drops from one block are a single offense
+	if rec.Count > 0 && now.Sub(rec.LastSeen) < offenseGap {
+		rec.LastSeen = now
+		t.mu.Unlock()
+		return
+	}
+
+	rec.Count++
+	rec.LastOffense = now
+	rec.LastSeen = now
+	rec.LastReason = reason
+
+	promote := rec.Count > t.threshold
+	count := rec.Count
+	if promote {
+		delete(t.offenses, ip)
+	}
+	t.mu.Unlock()
+
+	if promote {
+		go t.promote(ip, "repeat_offender",
+			fmt.Sprintf("Auto-blocked %d times within the promotion window", count),
+			fmt.Sprintf("Repeat offender: auto-blocked %d times, promoted to permanent ban", count))
+	}
+}
+
+// promote inserts a permanent BanIP (exported upstream) and pushes it to ipset and the XDP blocklist
+func (t *OffenseTracker) promote(ip, reason, details, alert string) {
+	if t.db == nil {
+		return
+	}
+
+	// Never ban whitelisted IPs, including ones inside a whitelisted CIDR
+	if IsWhitelisted(t.db, ip) {
+		return
+	}
+
+	var existing models.BanIP
+	if err := t.db.Where("ip = ?", ip).First(&existing).Error; err == nil {
+		return // Already banned
+	}
+
+	ban := models.BanIP{
+		IP:       ip,
+		Reason:   strings.ReplaceAll(reason, "_", " "),
+		IsAuto:   true,
+		Upstream: true,
+	}
+	if err := t.db.Create(&ban).Error; err != nil {
+		system.Warn("Failed to promote repeat offender %s: %v", ip, err)
+		return
+	}
+
+	if t.executor != nil {
+		set := "ban"
+		if isIPv6Entry(ip) {
+			set = "ban6"
+		}
+		if _, err := t.executor.Execute("ipset", "add", set, ip, "comment", ipsetComment(banComment(ban)), "-exist"); err != nil {
+			system.Debug("Failed to add %s to ban ipset: %v", ip, err)
+		}
+	}
+	if t.ebpf != nil {
+		if err := t.ebpf.AddBlockedIP(ip, BlockReasonManual, 0); err != nil {
+			system.Warn("Failed to add repeat offender %s to eBPF blocklist: %v", ip, err)
+		}
+	}
+
+	system.Warn("Promoted %s to permanent ban: %s", ip, details)
+	LogBlockHistory(t.db, models.BlockHistory{
+		IP:      ip,
+		Action:  BlockActionBlocked,
+		Reason:  reason,
+		Source:  "auto_promote",
+		Details: details,
+	})
+
+	if t.webhook != nil && t.webhook.IsEnabled() {
+		countryCode := "XX"
+		if t.geoip != nil {
+			countryCode = t.geoip.GetCountryCode(ip)
+		}
+		t.webhook.SendBlockAlert(ip, countryCode, alert)
+	}
+}
+
+// GetOffenses returns the current offense counters, highest count first
+func (t *OffenseTracker) GetOffenses() []OffenseRecord {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	list := make([]OffenseRecord, 0, len(t.offenses))
+	for _, rec := range t.offenses {
+		list = append(list, *rec)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Count > list[j].Count
+	})
+	return list
+}
+
+// ClearOffenses resets the counter for one IP, or all counters when ip is empty. Blocks recorded
+// before the reset no longer count towards recurrence either.
+func (t *OffenseTracker) ClearOffenses(ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if ip == "" {
+		t.offenses = make(map[string]*OffenseRecord)
+		t.recurrenceCleared = make(map[string]time.Time)
+		t.recurrenceClearedAt = now
+		return
+	}
+	delete(t.offenses, ip)
+	t.recurrenceCleared[ip] = now
+}
+
+// cleanup drops counters that fell out of the window
+func (t *OffenseTracker) cleanup() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for ip, rec := range t.offenses {
+		if now.Sub(rec.FirstOffense) > t.window {
+			delete(t.offenses, ip)
+		}
+	}
+	for ip, at := range t.recurrenceCleared {
+		if now.Sub(at) > t.recurrenceWindow {
+			delete(t.recurrenceCleared, ip)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"kg-proxy-web-gui/backend/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestPromoteSkipsWhitelistedCIDR(t *testing.T) {
+	dsn := "file:" + strings.ReplaceAll(t.Name(), "/", "_") + "?mode=memory&cache=shared"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := db.AutoMigrate(SchemaModels()...); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	db.Create(&models.AllowIP{IP: "198.51.100.0/24"})
+
+	tracker := &OffenseTracker{db: db}
+	tracker.promote("198.51.100.7", "repeat_offender", "test", "test")
+	tracker.promote("203.0.113.7", "repeat_offender", "test", "test")
+
+	var bans []models.BanIP
+	db.Find(&bans)
+	if len(bans) != 1 || bans[0].IP != "203.0.113.7" {
+		t.Fatalf("bans = %+v, want only 203.0.113.7", bans)
+	}
+}
+
+func TestRecurrenceRestartsAfterUnblockAndClear(t *testing.T) {
+	dsn := "file:" + strings.ReplaceAll(t.Name(), "/", "_") + "?mode=memory&cache=shared"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := db.AutoMigrate(SchemaModels()...); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	tracker := &OffenseTracker{db: db, recurrenceCleared: make(map[string]time.Time)}
+	tracker.SetRecurrenceConfig(3, 7)
+	autoBlocks := func(ip string, at time.Time) {
+		for i := 0; i < 3; i++ {
+			LogBlockHistory(db, models.BlockHistory{IP: ip, Action: BlockActionBlocked, Source: "ebpf", Timestamp: at.Add(time.Duration(i) * time.Minute)})
+		}
+	}
+	banned := func(ip string) bool {
+		var count int64
+		db.Model(&models.BanIP{}).Where("ip = ?", ip).Count(&count)
+		return count > 0
+	}
+
+	autoBlocks("203.0.113.1", time.Now().Add(-time.Hour))
+	tracker.checkRecurrence()
+	if !banned("203.0.113.1") {
+		t.Fatal("recurring attacker was not promoted")
+	}
+
+	// Manual unban: the blocks before it must not promote the IP again
+	db.Where("ip = ?", "203.0.113.1").Delete(&models.BanIP{})
+	LogBlockHistory(db, models.BlockHistory{IP: "203.0.113.1", Action: BlockActionUnblocked, Source: "manual"})
+	tracker.checkRecurrence()
+	if banned("203.0.113.1") {
+		t.Fatal("manually unbanned IP was promoted again by old blocks")
+	}
+
+	autoBlocks("203.0.113.2", time.Now().Add(-time.Hour))
+	tracker.ClearOffenses("203.0.113.2")
+	tracker.checkRecurrence()
+	if banned("203.0.113.2") {
+		t.Fatal("IP was promoted by blocks from before ClearOffenses")
+	}
+	autoBlocks("203.0.113.2", time.Now().Add(time.Second))
+	tracker.checkRecurrence()
+	if !banned("203.0.113.2") {
+		t.Fatal("new blocks after ClearOffenses did not promote the IP")
+	}
+}
@@ -1,22 +1,54 @@
 package services
 
 import (
+	"encoding/json"
+	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
 // PCAPService defines the interface for packet capture
 type PCAPService interface {
-	StartCapture(interfaceName string, duration time.Duration, filter string) (string, error)
+	StartCapture(interfaceName string, duration time.Duration, filter string, meta CaptureMeta) (string, error)
 	StopCapture() error
 	IsCapturing() bool
 	GetStatus() PCAPStatus
 	GetCaptureFiles() ([]string, error)
+	ListCaptures() ([]CaptureFile, error)
 	DeleteCaptureFile(filename string) error
 	GetCaptureDir() string
 }
 
+// Capture triggers (CaptureMeta.Trigger)
+const (
+	CaptureTriggerManual = "manual" // Started from the API
+	CaptureTriggerAuto   = "auto"   // Started by auto-capture for an attack event
+)
+
+// ValidCaptureTrigger reports whether t is a known capture trigger
+func ValidCaptureTrigger(t string) bool {
+	return t == CaptureTriggerManual || t == CaptureTriggerAuto
+}
+
+// CaptureMeta describes why a capture was taken. It is stored next to the capture as
+// <file>.json; captures without one are treated as manual.
+type CaptureMeta struct {
+	Trigger       string `json:"trigger"`
+	AttackEventID uint   `json:"attack_event_id,omitempty"` // Event that triggered an auto-capture
+	SourceIP      string `json:"source_ip,omitempty"`       // Attacker the capture is filtered to
+}
+
+// CaptureFile is a capture in the capture directory with its metadata
+type CaptureFile struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	CaptureMeta
+}
+
 // PCAPStatus holds the current status of the capture service
 type PCAPStatus struct {
 	IsCapturing   bool      `json:"is_capturing"`
@@ -25,6 +57,13 @@ type PCAPStatus struct {
 	CurrentFile   string    `json:"current_file"`
 	InterfaceName string    `json:"interface_name"`
 	Filter        string    `json:"filter"`
+	Trigger       string    `json:"trigger"`
+	AttackEventID uint      `json:"attack_event_id,omitempty"`
+
+	// Live progress, refreshed by GetStatus
+	FileSize       int64   `json:"file_size"`       // Bytes written to CurrentFile so far
+	ElapsedSeconds float64 `json:"elapsed_seconds"` // Time since StartTime (final value once stopped)
+	LimitSeconds   float64 `json:"limit_seconds"`   // Configured maximum capture duration
 }
 
 var (
@@ -40,3 +79,56 @@ func getCaptureDir() string {
 	// In a real app this might be configurable
 	return filepath.Join(".", "captures")
 }
+
+// captureMetaPath returns the metadata file of a capture
+func captureMetaPath(dir, filename string) string {
+	return filepath.Join(dir, filename+".json")
+}
+
+// writeCaptureMeta stores the metadata of a capture
+func writeCaptureMeta(dir, filename string, meta CaptureMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(captureMetaPath(dir, filename), data, 0644)
+}
+
+// readCaptureMeta loads the metadata of a capture (manual when missing or unreadable)
+func readCaptureMeta(dir, filename string) CaptureMeta {
+	meta := CaptureMeta{Trigger: CaptureTriggerManual}
+	if data, err := os.ReadFile(captureMetaPath(dir, filename)); err == nil {
+		json.Unmarshal(data, &meta)
+	}
+	if !ValidCaptureTrigger(meta.Trigger) {
+		meta.Trigger = CaptureTriggerManual
+	}
+	return meta
+}
+
+// listCaptures returns the .pcap files in dir with their metadata, newest first
+func listCaptures(dir string) ([]CaptureFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	captures := []CaptureFile{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".pcap") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		captures = append(captures, CaptureFile{
+			Name:        e.Name(),
+			Size:        info.Size(),
+			ModTime:     info.ModTime(),
+			CaptureMeta: readCaptureMeta(dir, e.Name()),
+		})
+	}
+	sort.Slice(captures, func(i, j int) bool { return captures[i].ModTime.After(captures[j].ModTime) })
+	return captures, nil
+}
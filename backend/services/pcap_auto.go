@@ -0,0 +1,157 @@
+package services
+
+import (
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// autoCaptureCooldown is the minimum time between two auto-captures
+const autoCaptureCooldown = 10 * time.Minute
+
+// captureRetentionInterval is how often expired captures are pruned
+const captureRetentionInterval = time.Hour
+
+// autoCapture samples the biggest source of a large attack with tcpdump
+var autoCapture struct {
+	mu       sync.Mutex
+	enabled  bool
+	minPPS   int64
+	duration time.Duration
+	last     time.Time
+}
+
+// Capture retention in days per trigger (0 = keep)
+var (
+	manualCaptureRetentionDays atomic.Int64
+	autoCaptureRetentionDays   atomic.Int64
+)
+
+// SetAutoCapture configures auto-capture: a capture of seconds filtered to the source of the
+// first stored attack event reaching minPPS, at most once per autoCaptureCooldown
+func SetAutoCapture(enabled bool, minPPS, seconds int) {
+	autoCapture.mu.Lock()
+	defer autoCapture.mu.Unlock()
+	autoCapture.enabled = enabled && minPPS > 0 && seconds > 0
+	autoCapture.minPPS = int64(minPPS)
+	autoCapture.duration = time.Duration(seconds) * time.Second
+}
+
+// SetCaptureRetention sets how many days manual and auto captures are kept (0 = forever)
+func SetCaptureRetention(manualDays, autoDays int) {
+	manualCaptureRetentionDays.Store(int64(max(manualDays, 0)))
+	autoCaptureRetentionDays.Store(int64(max(autoDays, 0)))
+}
+
+// autoCaptureAttack starts an auto-capture for the highest-PPS event of a stored batch and links
+// the capture to it. Skipped while another capture runs or within the cooldown.
+func autoCaptureAttack(db *gorm.DB, batch []models.AttackEvent) {
+	autoCapture.mu.Lock()
+	defer autoCapture.mu.Unlock()
+	if !autoCapture.enabled || time.Since(autoCapture.last) < autoCaptureCooldown {
+		return
+	}
+
+	var top *models.AttackEvent
+	for i := range batch {
+		e := &batch[i]
+		if e.ID != 0 && e.PPS >= autoCapture.minPPS && (top == nil || e.PPS > top.PPS) {
+			top = e
+		}
+	}
+	if top == nil || net.ParseIP(top.SourceIP) == nil {
+		return
+	}
+
+	svc := NewPCAPService()
+	if svc.IsCapturing() {
+		return
+	}
+	meta := CaptureMeta{Trigger: CaptureTriggerAuto, AttackEventID: top.ID, SourceIP: top.SourceIP}
+	filename, err := svc.StartCapture("", autoCapture.duration, "host "+top.SourceIP, meta)
+	if err != nil {
+		system.Warn("Auto-capture for attack event %d failed: %v", top.ID, err)
+		return
+	}
+	autoCapture.last = time.Now()
+	top.CaptureFile = filename
+	if db != nil {
+		db.Model(&models.AttackEvent{}).Where("id = ?", top.ID).UpdateColumn("capture_file", filename)
+	}
+	system.Info("Auto-capture %s started for attack event %d (%s, %d pps)", filename, top.ID, top.SourceIP, top.PPS)
+}
+
+// StartCaptureRetention deletes captures older than their trigger's retention every hour
+func StartCaptureRetention(db *gorm.DB) {
+	go func() {
+		ticker := time.NewTicker(captureRetentionInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if removed := pruneCaptures(db, time.Now()); removed > 0 {
+				system.Info("Removed %d expired packet captures", removed)
+			}
+		}
+	}()
+}
+
+// pruneCaptures deletes expired captures (never the running one) and unlinks them from their attack events.
+// Captures without a metadata file predate trigger tagging and are left alone.
+func pruneCaptures(db *gorm.DB, now time.Time) int {
+	svc := NewPCAPService()
+	dir := getCaptureDir()
+	captures, err := svc.ListCaptures()
+	if err != nil {
+		return 0
+	}
+	status := svc.GetStatus()
+
+	removed := 0
+	for _, c := range captures {
+		days := manualCaptureRetentionDays.Load()
+		if c.Trigger == CaptureTriggerAuto {
+			days = autoCaptureRetentionDays.Load()
+		}
+		if days <= 0 || now.Sub(c.ModTime) < time.Duration(days)*24*time.Hour {
+			continue
+		}
+		if status.IsCapturing && status.CurrentFile == c.Name {
+			continue
+		}
+		if _, err := os.Stat(captureMetaPath(dir, c.Name)); err != nil {
+			continue
+		}
+		if err := svc.DeleteCaptureFile(c.Name); err != nil {
+			system.Warn("Failed to remove expired capture %s: %v", c.Name, err)
+			continue
+		}
+		removed++
+		if c.AttackEventID != 0 && db != nil {
+			db.Model(&models.AttackEvent{}).Where("id = ? AND capture_file = ?", c.AttackEventID, c.Name).
+				UpdateColumn("capture_file", "")
+		}
+	}
+	return removed
+}
+
+// CapturesForAttack returns the captures linked to an attack event
+func CapturesForAttack(eventID uint) ([]CaptureFile, error) {
+	captures, err := NewPCAPService().ListCaptures()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list captures: %w", err)
+	}
+	linked := []CaptureFile{}
+	for _, c := range captures {
+		if c.AttackEventID == eventID {
+			linked = append(linked, c)
+		}
+	}
+	return linked, nil
+}
@@ -42,7 +42,7 @@ func newLinuxPCAPService() *LinuxPCAPService {
 	}
 }
 
-func (s *LinuxPCAPService) StartCapture(interfaceName string, duration time.Duration, filter string) (string, error) {
+func (s *LinuxPCAPService) StartCapture(interfaceName string, duration time.Duration, filter string, meta CaptureMeta) (string, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -84,6 +84,12 @@ func (s *LinuxPCAPService) StartCapture(interfaceName string, duration time.Dura
 		cancel()
 		return "", fmt.Errorf("failed to start tcpdump: %w", err)
 	}
+	if meta.Trigger == "" {
+		meta.Trigger = CaptureTriggerManual
+	}
+	if err := writeCaptureMeta(s.captureDir, filename, meta); err != nil {
+		system.Warn("Failed to write capture metadata for %s: %v", filename, err)
+	}
 
 	// Update status
 	s.status = PCAPStatus{
@@ -92,6 +98,9 @@ func (s *LinuxPCAPService) StartCapture(interfaceName string, duration time.Dura
 		CurrentFile:   filename,
 		InterfaceName: interfaceName,
 		Filter:        filter,
+		Trigger:       meta.Trigger,
+		AttackEventID: meta.AttackEventID,
+		LimitSeconds:  duration.Seconds(),
 	}
 
 	// Monitor process in background
@@ -104,6 +113,8 @@ func (s *LinuxPCAPService) StartCapture(interfaceName string, duration time.Dura
 		// But in both cases, we are no longer capturing
 		s.status.IsCapturing = false
 		s.status.Duration = time.Since(s.status.StartTime).String()
+		s.status.ElapsedSeconds = time.Since(s.status.StartTime).Seconds()
+		s.status.FileSize = s.captureFileSize()
 		s.cmd = nil
 		s.cancelFunc = nil // Clear cancel func
 
@@ -147,13 +158,27 @@ func (s *LinuxPCAPService) GetStatus() PCAPStatus {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Update duration on the fly if capturing
+	// Update duration and file size on the fly if capturing
 	if s.status.IsCapturing {
 		s.status.Duration = time.Since(s.status.StartTime).String()
+		s.status.ElapsedSeconds = time.Since(s.status.StartTime).Seconds()
+		s.status.FileSize = s.captureFileSize()
 	}
 	return s.status
 }
 
+// captureFileSize returns the size of the current capture file (caller holds lock)
+func (s *LinuxPCAPService) captureFileSize() int64 {
+	if s.status.CurrentFile == "" {
+		return 0
+	}
+	info, err := os.Stat(filepath.Join(s.captureDir, s.status.CurrentFile))
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
 func (s *LinuxPCAPService) GetCaptureFiles() ([]string, error) {
 	files, err := os.ReadDir(s.captureDir)
 	if err != nil {
@@ -177,12 +202,21 @@ func (s *LinuxPCAPService) GetCaptureFiles() ([]string, error) {
 	return filenames, nil
 }
 
+// ListCaptures returns the capture files with their trigger metadata, newest first
+func (s *LinuxPCAPService) ListCaptures() ([]CaptureFile, error) {
+	return listCaptures(s.captureDir)
+}
+
 func (s *LinuxPCAPService) DeleteCaptureFile(filename string) error {
 	// Sanity check to prevent directory traversal
 	if filepath.Dir(filename) != "." {
 		return fmt.Errorf("invalid filename")
 	}
-	return os.Remove(filepath.Join(s.captureDir, filename))
+	if err := os.Remove(filepath.Join(s.captureDir, filename)); err != nil {
+		return err
+	}
+	os.Remove(captureMetaPath(s.captureDir, filename))
+	return nil
 }
 
 func (s *LinuxPCAPService) GetCaptureDir() string {
@@ -0,0 +1,302 @@
+package services
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"kg-proxy-web-gui/backend/models"
+	"net"
+	"os"
+	"time"
+)
+
+// Link-layer types found in tcpdump captures
+const (
+	linkTypeEthernet = 1
+	linkTypeRaw      = 101
+	linkTypeLinuxSLL = 113
+	linkTypeSLL2     = 276
+)
+
+// pcapMaxSnaplen guards against corrupt record headers allocating huge buffers
+const pcapMaxSnaplen = 262144
+
+// SignatureTestResult reports how a signature fares against a stored capture
+type SignatureTestResult struct {
+	SignatureID    uint                   `json:"signature_id"`
+	File           string                 `json:"file"`
+	PacketsScanned int                    `json:"packets_scanned"`
+	PacketsDecoded int                    `json:"packets_decoded"` // IPv4/IPv6 packets the matcher could inspect
+	Matched        int                    `json:"matched"`
+	MatchRate      float64                `json:"match_rate"` // Percent of decoded packets
+	Truncated      bool                   `json:"truncated"`  // Stopped at the packet cap
+	TimedOut       bool                   `json:"timed_out"`
+	DurationMs     int64                  `json:"duration_ms"`
+	Samples        []SignatureMatchSample `json:"samples"`
+}
+
+// SignatureMatchSample is one matched packet, payload trimmed for display
+type SignatureMatchSample struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Protocol   string    `json:"protocol"`
+	Source     string    `json:"source"`
+	Dest       string    `json:"dest"`
+	Length     int       `json:"length"`
+	PayloadHex string    `json:"payload_hex"`
+}
+
+const (
+	signatureSampleLimit   = 10
+	signatureSamplePayload = 64 // Bytes of payload shown per sample
+)
+
+// TestSignatureAgainstCapture runs a signature over a classic libpcap file (as written by tcpdump -w).
+// Scanning stops after maxPackets packets or once timeout elapses.
+func TestSignatureAgainstCapture(sig models.AttackSignature, path string, maxPackets int, timeout time.Duration) (*SignatureTestResult, error) {
+	matcher, err := CompileSignature(sig)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := newPCAPReader(bufio.NewReaderSize(f, 1<<16))
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	deadline := start.Add(timeout)
+	result := &SignatureTestResult{
+		SignatureID: sig.ID,
+		Samples:     []SignatureMatchSample{},
+	}
+
+	for {
+		if result.PacketsScanned >= maxPackets {
+			result.Truncated = true
+			break
+		}
+		// Checking the clock every packet is wasteful; every 1024 is plenty
+		if result.PacketsScanned%1024 == 0 && time.Now().After(deadline) {
+			result.TimedOut = true
+			break
+		}
+
+		ts, data, origLen, err := r.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// A capture still being written ends mid-record; report what was read
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return nil, err
+		}
+		result.PacketsScanned++
+
+		pkt, ok := decodePacket(r.linkType, data)
+		if !ok {
+			continue
+		}
+		pkt.Length = origLen
+		result.PacketsDecoded++
+
+		if !matcher.Match(pkt) {
+			continue
+		}
+		result.Matched++
+		if len(result.Samples) < signatureSampleLimit {
+			payload := pkt.Payload
+			if len(payload) > signatureSamplePayload {
+				payload = payload[:signatureSamplePayload]
+			}
+			result.Samples = append(result.Samples, SignatureMatchSample{
+				Timestamp:  ts,
+				Protocol:   pkt.Protocol,
+				Source:     net.JoinHostPort(pkt.SrcIP, fmt.Sprintf("%d", pkt.SrcPort)),
+				Dest:       net.JoinHostPort(pkt.DstIP, fmt.Sprintf("%d", pkt.DstPort)),
+				Length:     pkt.Length,
+				PayloadHex: hex.EncodeToString(payload),
+			})
+		}
+	}
+
+	if result.PacketsDecoded > 0 {
+		result.MatchRate = float64(result.Matched) * 100 / float64(result.PacketsDecoded)
+	}
+	result.DurationMs = time.Since(start).Milliseconds()
+	return result, nil
+}
+
+// pcapReader iterates records of a classic pcap file
+type pcapReader struct {
+	r        io.Reader
+	order    binary.ByteOrder
+	nanos    bool
+	linkType uint32
+	header   [16]byte
+}
+
+func newPCAPReader(r io.Reader) (*pcapReader, error) {
+	var hdr [24]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("not a pcap file: %w", err)
+	}
+
+	p := &pcapReader{r: r}
+	switch binary.LittleEndian.Uint32(hdr[0:4]) {
+	case 0xa1b2c3d4:
+		p.order = binary.LittleEndian
+	case 0xd4c3b2a1:
+		p.order = binary.BigEndian
+	case 0xa1b23c4d:
+		p.order, p.nanos = binary.LittleEndian, true
+	case 0x4d3cb2a1:
+		p.order, p.nanos = binary.BigEndian, true
+	case 0x0a0d0d0a:
+		return nil, fmt.Errorf("pcapng captures are not supported; capture with tcpdump -w (classic pcap)")
+	default:
+		return nil, fmt.Errorf("not a pcap file")
+	}
+	p.linkType = p.order.Uint32(hdr[20:24]) & 0x0FFFFFFF
+	return p, nil
+}
+
+// next returns the timestamp, captured bytes and original length of the next record
+func (p *pcapReader) next() (time.Time, []byte, int, error) {
+	if _, err := io.ReadFull(p.r, p.header[:]); err != nil {
+		return time.Time{}, nil, 0, err
+	}
+	sec := p.order.Uint32(p.header[0:4])
+	frac := p.order.Uint32(p.header[4:8])
+	capLen := p.order.Uint32(p.header[8:12])
+	origLen := p.order.Uint32(p.header[12:16])
+	if capLen > pcapMaxSnaplen {
+		return time.Time{}, nil, 0, fmt.Errorf("corrupt pcap record (caplen %d)", capLen)
+	}
+
+	data := make([]byte, capLen)
+	if _, err := io.ReadFull(p.r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return time.Time{}, nil, 0, err
+	}
+
+	nsec := int64(frac) * 1000
+	if p.nanos {
+		nsec = int64(frac)
+	}
+	return time.Unix(int64(sec), nsec), data, int(origLen), nil
+}
+
+// decodePacket strips the link layer and decodes IPv4/IPv6 with a UDP/TCP/ICMP header
+func decodePacket(linkType uint32, data []byte) (*PacketInfo, bool) {
+	var etherType uint16
+	switch linkType {
+	case linkTypeEthernet:
+		if len(data) < 14 {
+			return nil, false
+		}
+		etherType = binary.BigEndian.Uint16(data[12:14])
+		data = data[14:]
+		// Skip 802.1Q VLAN tags
+		for etherType == 0x8100 && len(data) >= 4 {
+			etherType = binary.BigEndian.Uint16(data[2:4])
+			data = data[4:]
+		}
+	case linkTypeLinuxSLL:
+		if len(data) < 16 {
+			return nil, false
+		}
+		etherType = binary.BigEndian.Uint16(data[14:16])
+		data = data[16:]
+	case linkTypeSLL2:
+		if len(data) < 20 {
+			return nil, false
+		}
+		etherType = binary.BigEndian.Uint16(data[0:2])
+		data = data[20:]
+	case linkTypeRaw:
+		if len(data) == 0 {
+			return nil, false
+		}
+		etherType = 0x0800
+		if data[0]>>4 == 6 {
+			etherType = 0x86DD
+		}
+	default:
+		return nil, false
+	}
+
+	pkt := &PacketInfo{}
+	var proto byte
+	switch etherType {
+	case 0x0800:
+		if len(data) < 20 || data[0]>>4 != 4 {
+			return nil, false
+		}
+		ihl := int(data[0]&0x0F) * 4
+		if ihl < 20 || len(data) < ihl {
+			return nil, false
+		}
+		proto = data[9]
+		pkt.SrcIP = net.IP(data[12:16]).String()
+		pkt.DstIP = net.IP(data[16:20]).String()
+		// Non-first fragments carry no L4 header
+		if binary.BigEndian.Uint16(data[6:8])&0x1FFF != 0 {
+			pkt.Protocol = "OTHER"
+			return pkt, true
+		}
+		data = data[ihl:]
+	case 0x86DD:
+		if len(data) < 40 {
+			return nil, false
+		}
+		proto = data[6] // Extension headers are not followed
+		pkt.SrcIP = net.IP(data[8:24]).String()
+		pkt.DstIP = net.IP(data[24:40]).String()
+		data = data[40:]
+	default:
+		return nil, false
+	}
+
+	switch proto {
+	case 17:
+		pkt.Protocol = "UDP"
+		if len(data) < 8 {
+			return pkt, true
+		}
+		pkt.SrcPort = int(binary.BigEndian.Uint16(data[0:2]))
+		pkt.DstPort = int(binary.BigEndian.Uint16(data[2:4]))
+		pkt.Payload = data[8:]
+	case 6:
+		pkt.Protocol = "TCP"
+		if len(data) < 20 {
+			return pkt, true
+		}
+		pkt.SrcPort = int(binary.BigEndian.Uint16(data[0:2]))
+		pkt.DstPort = int(binary.BigEndian.Uint16(data[2:4]))
+		off := int(data[12]>>4) * 4
+		if off >= 20 && off <= len(data) {
+			pkt.Payload = data[off:]
+		}
+	case 1, 58:
+		pkt.Protocol = "ICMP"
+		if len(data) >= 8 {
+			pkt.Payload = data[8:]
+		}
+	default:
+		pkt.Protocol = "OTHER"
+	}
+	return pkt, true
+}
@@ -28,7 +28,7 @@ func newWindowsPCAPService() *WindowsPCAPService {
 	}
 }
 
-func (s *WindowsPCAPService) StartCapture(interfaceName string, duration time.Duration, filter string) (string, error) {
+func (s *WindowsPCAPService) StartCapture(interfaceName string, duration time.Duration, filter string, meta CaptureMeta) (string, error) {
 	return "", fmt.Errorf("packet capture is not supported on Windows in this version")
 }
 
@@ -48,6 +48,10 @@ func (s *WindowsPCAPService) GetCaptureFiles() ([]string, error) {
 	return []string{}, nil
 }
 
+func (s *WindowsPCAPService) ListCaptures() ([]CaptureFile, error) {
+	return []CaptureFile{}, nil
+}
+
 func (s *WindowsPCAPService) DeleteCaptureFile(filename string) error {
 	return nil
 }
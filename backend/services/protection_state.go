@@ -0,0 +1,188 @@
+package services
+
+import (
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"time"
+)
+
+// Protection states reported to the UI banner
+const (
+	ProtectionStateProtected   = "protected"
+	ProtectionStateMaintenance = "maintenance" // All blocking bypassed until MaintenanceUntil
+	ProtectionStateDisabled    = "disabled"    // GlobalProtection off, or firewall rules not enforced
+)
+
+// protectionCheckInterval is how often the reminder loop looks at the protection state
+const protectionCheckInterval = time.Minute
+
+// defaultProtectionReminderMinutes applies when the setting is unset
+const defaultProtectionReminderMinutes = 60
+
+// minProtectionReminderInterval is the floor the reminder cadence escalates down to
+const minProtectionReminderInterval = 15 * time.Minute
+
+// ProtectionState says whether traffic is actually being filtered, and if not, why
+type ProtectionState struct {
+	State  string     `json:"state"`
+	Reason string     `json:"reason,omitempty"`
+	Until  *time.Time `json:"until,omitempty"` // End of maintenance mode
+	Since  *time.Time `json:"since,omitempty"` // When this process first saw the current unprotected state
+}
+
+// Protected reports whether the state is fully protected
+func (p ProtectionState) Protected() bool {
+	return p.State == ProtectionStateProtected
+}
+
+// protectionStateOf derives the state from the settings and the last rule apply
+func protectionStateOf(settings *models.SecuritySettings, applyErr string, now time.Time) ProtectionState {
+	if settings.MaintenanceUntil != nil && settings.MaintenanceUntil.After(now) {
+		until := *settings.MaintenanceUntil
+		return ProtectionState{
+			State:  ProtectionStateMaintenance,
+			Reason: "Maintenance mode: all blocking is bypassed until " + until.Format("2006-01-02 15:04"),
+			Until:  &until,
+		}
+	}
+	if !settings.GlobalProtection {
+		return ProtectionState{State: ProtectionStateDisabled, Reason: "Global protection is turned off: the DDoS filter chain is not installed"}
+	}
+	if caps := system.GetCapabilities(); caps.Degraded {
+		return ProtectionState{State: ProtectionStateDisabled, Reason: "Firewall tools missing, rules are not enforced"}
+	}
+	if applyErr != "" {
+		return ProtectionState{State: ProtectionStateDisabled, Reason: "Last firewall apply failed: " + applyErr}
+	}
+	return ProtectionState{State: ProtectionStateProtected}
+}
+
+// ProtectionState reports the current protection state
+func (s *FirewallService) ProtectionState() ProtectionState {
+	var settings models.SecuritySettings
+	if err := s.DB.First(&settings, 1).Error; err != nil {
+		// ApplyRules falls back to protected defaults without settings
+		settings.GlobalProtection = true
+	}
+	state := protectionStateOf(&settings, s.GetApplyStatus().Error, time.Now())
+
+	s.protectionMu.Lock()
+	defer s.protectionMu.Unlock()
+	if state.Protected() {
+		s.unprotectedState = ""
+		s.lastProtectionReminder = time.Time{}
+		return state
+	}
+	if s.unprotectedState != state.State {
+		s.unprotectedState = state.State
+		s.unprotectedSince = time.Now()
+		s.lastProtectionReminder = time.Time{}
+	}
+	since := s.unprotectedSince
+	state.Since = &since
+	return state
+}
+
+// StartProtectionReminder sends a webhook reminder once protection has stayed disabled or in
+// maintenance for longer than ProtectionReminderMinutes. Reminders repeat at a cadence that
+// halves after each one (down to minProtectionReminderInterval), and a final notice is sent
+// when protection is restored.
+func (s *FirewallService) StartProtectionReminder(webhook *WebhookService) {
+	go func() {
+		ticker := time.NewTicker(protectionCheckInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			s.checkProtectionReminder(webhook)
+		}
+	}()
+}
+
+func (s *FirewallService) checkProtectionReminder(webhook *WebhookService) {
+	state := s.ProtectionState()
+	if state.Protected() {
+		s.protectionMu.Lock()
+		reminded := s.protectionReminders
+		s.protectionReminders = 0
+		s.protectionMu.Unlock()
+		if reminded > 0 {
+			system.Info("Protection restored after %d reminder(s)", reminded)
+			if webhook != nil {
+				if err := webhook.SendSystemAlert("✅ Protection restored", "DDoS protection is active again.", ColorGreen); err != nil {
+					system.Warn("Failed to send protection restored notice: %v", err)
+				}
+			}
+		}
+		return
+	}
+	if state.Since == nil {
+		return
+	}
+
+	minutes := defaultProtectionReminderMinutes
+	var settings models.SecuritySettings
+	if err := s.DB.First(&settings, 1).Error; err == nil {
+		minutes = settings.ProtectionReminderMinutes
+	}
+	if minutes == 0 {
+		return // Reminders turned off
+	}
+	grace := time.Duration(minutes) * time.Minute
+	now := time.Now()
+	if now.Sub(*state.Since) < grace {
+		return
+	}
+
+	s.protectionMu.Lock()
+	interval := protectionReminderInterval(grace, s.protectionReminders)
+	due := s.lastProtectionReminder.IsZero() || now.Sub(s.lastProtectionReminder) >= interval
+	if due {
+		s.lastProtectionReminder = now
+		s.protectionReminders++
+	}
+	s.protectionMu.Unlock()
+	if !due {
+		return
+	}
+
+	elapsed := now.Sub(*state.Since).Round(time.Minute)
+	message := fmt.Sprintf("%s\nUnprotected for %s.", state.Reason, elapsed)
+	system.Warn("Protection still %s after %s: %s", state.State, elapsed, state.Reason)
+	if webhook != nil {
+		title := fmt.Sprintf("⚠️ DDoS protection has been %s for %s", state.State, formatReminderDuration(elapsed))
+		if err := webhook.SendSystemAlert(title, message, ColorOrange); err != nil {
+			system.Warn("Failed to send protection reminder: %v", err)
+		}
+	}
+}
+
+// protectionReminderInterval is the wait before the next reminder after sent reminders:
+// the grace period halved per reminder, never below minProtectionReminderInterval
+// (or the grace period itself when that is shorter)
+func protectionReminderInterval(grace time.Duration, sent int) time.Duration {
+	floor := minProtectionReminderInterval
+	if grace < floor {
+		floor = grace
+	}
+	interval := grace
+	for i := 0; i < sent && interval > floor; i++ {
+		interval /= 2
+	}
+	if interval < floor {
+		interval = floor
+	}
+	return interval
+}
+
+// formatReminderDuration renders whole hours as "2h" and anything else as "2h30m"/"45m"
+func formatReminderDuration(d time.Duration) string {
+	hours, minutes := int(d.Hours()), int(d.Minutes())%60
+	switch {
+	case hours == 0:
+		return fmt.Sprintf("%dm", minutes)
+	case minutes == 0:
+		return fmt.Sprintf("%dh", hours)
+	}
+	return fmt.Sprintf("%dh%dm", hours, minutes)
+}
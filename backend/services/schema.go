@@ -0,0 +1,208 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// schemaBackupsKept is how many pre-migration DB copies are kept next to the database
+const schemaBackupsKept = 5
+
+// SchemaModels is every model persisted in the database, in migration order
+func SchemaModels() []interface{} {
+	return []interface{}{
+		&models.Origin{},
+		&models.Service{},
+		&models.ServicePort{},
+		&models.AllowForeign{},
+		&models.BanIP{},
+		&models.AllowIP{},
+		&models.WireGuardPeer{},
+		&models.Admin{},
+		&models.SecuritySettings{},
+		&models.TrafficSnapshot{},
+		&models.AttackEvent{},
+		&models.AttackSignature{},
+		&models.CountryGroup{},
+		&models.CountryNameOverride{},
+		&models.BlockHistory{},
+		&models.BlockSnapshot{},
+		&models.FloodBlock{},
+		&models.SeenCountry{},
+		&models.CustomRule{},
+		&models.EgressPolicy{},
+		&models.GeoSchedule{},
+		&models.APIKey{},
+		&models.AuditLog{},
+	}
+}
+
+// SchemaStatus describes the database schema the backend is running on
+type SchemaStatus struct {
+	Version     int                      `json:"version"`
+	Fingerprint string                   `json:"fingerprint"`
+	Migrated    bool                     `json:"migrated"` // A migration ran during this startup
+	DBPath      string                   `json:"db_path"`
+	History     []models.SchemaMigration `json:"history"`
+}
+
+var schemaStatus SchemaStatus
+
+// GetSchemaStatus returns the schema version recorded at startup
+func GetSchemaStatus() SchemaStatus {
+	return schemaStatus
+}
+
+// MigrateDatabase brings the schema up to date with SchemaModels.
+// The model set is fingerprinted; if it matches the last recorded migration nothing is touched.
+// Otherwise the database file is copied aside first (SQLite column changes rebuild tables),
+// each model is migrated and logged individually, and the new version is recorded.
+func MigrateDatabase(db *gorm.DB, dbPath string) error {
+	if err := db.AutoMigrate(&models.SchemaMigration{}); err != nil {
+		return fmt.Errorf("schema_migrations: %v", err)
+	}
+
+	schemaModels := SchemaModels()
+	fingerprint := schemaFingerprint(schemaModels)
+
+	var last models.SchemaMigration
+	db.Order("version desc").Limit(1).Find(&last)
+
+	schemaStatus = SchemaStatus{Version: last.Version, Fingerprint: fingerprint, DBPath: dbPath}
+	defer func() {
+		db.Order("version desc").Limit(10).Find(&schemaStatus.History)
+	}()
+
+	if last.Version > 0 && last.Fingerprint == fingerprint {
+		system.Info("Database schema up to date (version %d, %s)", last.Version, fingerprint)
+		return nil
+	}
+
+	// Databases created before versioning have tables but no migration record
+	var existing int64
+	db.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND name != 'schema_migrations'").Scan(&existing)
+
+	migration := models.SchemaMigration{
+		Version:     last.Version + 1,
+		Fingerprint: fingerprint,
+		Tables:      len(schemaModels),
+	}
+	if existing > 0 {
+		backup, err := backupDatabase(db, dbPath, last.Version)
+		if err != nil {
+			return fmt.Errorf("pre-migration backup failed, not migrating: %v", err)
+		}
+		migration.BackupPath = backup
+		system.Info("Database schema changed (version %d -> %d), backup written to %s", last.Version, migration.Version, backup)
+	} else {
+		system.Info("Initializing new database schema (version %d)", migration.Version)
+	}
+
+	migrateFloodGraceSentinel(db)
+
+	start := time.Now()
+	for _, model := range schemaModels {
+		name := reflect.TypeOf(model).Elem().Name()
+		if err := db.AutoMigrate(model); err != nil {
+			if migration.BackupPath != "" {
+				system.Error("Migration of %s failed; restore %s to roll back", name, migration.BackupPath)
+			}
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		system.Info("Migrated %s", name)
+	}
+	migration.DurationMs = time.Since(start).Milliseconds()
+	migration.AppliedAt = time.Now()
+
+	if err := db.Create(&migration).Error; err != nil {
+		return fmt.Errorf("failed to record schema version: %v", err)
+	}
+	schemaStatus.Version = migration.Version
+	schemaStatus.Migrated = true
+	system.Info("Database schema migrated to version %d in %dms", migration.Version, migration.DurationMs)
+	return nil
+}
+
+// migrateFloodGraceSentinel keeps the level default grace periods of databases from before 0
+// meant "no grace": while a flood_grace_sec_* column still defaults to 0, its stored zeros
+// become FloodGraceDefault. AutoMigrate then moves the column default to -1, so this runs once.
+func migrateFloodGraceSentinel(db *gorm.DB) {
+	columns, err := db.Migrator().ColumnTypes(&models.SecuritySettings{})
+	if err != nil {
+		return // No settings table yet
+	}
+	for _, col := range columns {
+		if !strings.HasPrefix(col.Name(), "flood_grace_sec_") {
+			continue
+		}
+		if def, ok := col.DefaultValue(); !ok || def != "0" {
+			continue
+		}
+		result := db.Model(&models.SecuritySettings{}).Where(col.Name()+" = ?", 0).UpdateColumn(col.Name(), FloodGraceDefault)
+		if result.Error != nil {
+			system.Warn("Failed to migrate %s: %v", col.Name(), result.Error)
+		} else if result.RowsAffected > 0 {
+			system.Info("Migrated %s: 0 now disables grace, kept the level default", col.Name())
+		}
+	}
+}
+
+// schemaFingerprint hashes each model's table fields and gorm tags, so any schema-relevant change is detected
+func schemaFingerprint(schemaModels []interface{}) string {
+	var sb strings.Builder
+	for _, model := range schemaModels {
+		writeTypeSchema(&sb, reflect.TypeOf(model).Elem())
+	}
+	sum := sha256.Sum256([]byte(sb.String()))
+	return hex.EncodeToString(sum[:8])
+}
+
+func writeTypeSchema(sb *strings.Builder, t reflect.Type) {
+	sb.WriteString(t.Name() + "{")
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			writeTypeSchema(sb, f.Type)
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("%s %s %q;", f.Name, f.Type, f.Tag.Get("gorm")))
+	}
+	sb.WriteString("}")
+}
+
+// backupDatabase writes a consistent copy of the database (including WAL contents) and prunes old copies
+func backupDatabase(db *gorm.DB, dbPath string, fromVersion int) (string, error) {
+	dir := filepath.Join(filepath.Dir(dbPath), "backups")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	base := strings.TrimSuffix(filepath.Base(dbPath), filepath.Ext(dbPath))
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s-v%d.db", base, time.Now().Format("20060102-150405"), fromVersion))
+
+	if err := db.Exec("VACUUM INTO ?", path).Error; err != nil {
+		return "", err
+	}
+
+	// Timestamped names sort oldest first
+	old, _ := filepath.Glob(filepath.Join(dir, base+"-*-v*.db"))
+	sort.Strings(old)
+	for len(old) > schemaBackupsKept {
+		os.Remove(old[0])
+		old = old[1:]
+	}
+	return path, nil
+}
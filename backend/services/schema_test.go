@@ -0,0 +1,77 @@
+package services
+
+import (
+	"kg-proxy-web-gui/backend/models"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// legacySecuritySettings is the security_settings table from when 0 meant the level default grace
+type legacySecuritySettings struct {
+	ID                    uint `gorm:"primaryKey"`
+	FloodGraceSecLow      int  `gorm:"default:0"`
+	FloodGraceSecStandard int  `gorm:"default:0"`
+	FloodGraceSecHigh     int  `gorm:"default:0"`
+}
+
+func (legacySecuritySettings) TableName() string { return "security_settings" }
+
+func TestMigrateKeepsLevelDefaultGrace(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "kg.db")
+	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := db.AutoMigrate(&legacySecuritySettings{}); err != nil {
+		t.Fatalf("legacy schema: %v", err)
+	}
+	db.Create(&legacySecuritySettings{ID: 1, FloodGraceSecHigh: 20})
+
+	if err := MigrateDatabase(db, dbPath); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	var settings models.SecuritySettings
+	db.First(&settings, 1)
+	if settings.FloodGraceSecLow != FloodGraceDefault || settings.FloodGraceSecStandard != FloodGraceDefault || settings.FloodGraceSecHigh != 20 {
+		t.Fatalf("grace after upgrade = %d/%d/%d, want -1/-1/20",
+			settings.FloodGraceSecLow, settings.FloodGraceSecStandard, settings.FloodGraceSecHigh)
+	}
+
+	// A later migration must not turn a grace period disabled since the upgrade back on
+	db.Model(&settings).Update("flood_grace_sec_low", 0)
+	db.Where("1 = 1").Delete(&models.SchemaMigration{})
+	os.RemoveAll(filepath.Join(filepath.Dir(dbPath), "backups")) // Backup names have second resolution
+	if err := MigrateDatabase(db, dbPath); err != nil {
+		t.Fatalf("second migrate: %v", err)
+	}
+	db.First(&settings, 1)
+	if settings.FloodGraceSecLow != 0 {
+		t.Errorf("flood_grace_sec_low = %d after second migration, want 0", settings.FloodGraceSecLow)
+	}
+}
+
+func TestFloodGraceZeroDisablesGrace(t *testing.T) {
+	fp := &FloodProtection{}
+	for i := range fp.graceOverrides {
+		fp.graceOverrides[i].GracePeriod = FloodGraceDefault
+	}
+	if got := fp.levelThresholds(1).GracePeriod; got != 15*time.Second {
+		t.Fatalf("default standard grace = %s, want 15s", got)
+	}
+	fp.ApplyGraceSettings(&models.SecuritySettings{FloodGraceSecLow: -1, FloodGraceSecStandard: 0, FloodGraceSecHigh: 12})
+	if got := fp.levelThresholds(0).GracePeriod; got != 30*time.Second {
+		t.Errorf("low grace = %s, want the 30s default", got)
+	}
+	if got := fp.levelThresholds(1).GracePeriod; got != 0 {
+		t.Errorf("standard grace = %s, want 0 (disabled)", got)
+	}
+	if got := fp.levelThresholds(2).GracePeriod; got != 12*time.Second {
+		t.Errorf("high grace = %s, want 12s", got)
+	}
+}
@@ -0,0 +1,261 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SecurityReport describes what the box enforces right now: the rules ApplyRules last
+// restored, the eBPF configuration, the allowed countries and the list sizes
+type SecurityReport struct {
+	GeneratedAt   time.Time           `json:"generated_at"`
+	LastApply     FirewallApplyStatus `json:"last_apply"`
+	Maintenance   bool                `json:"maintenance"`
+	IPTablesRules string              `json:"iptables_rules"` // Filter/mangle/nat tables as last restored
+	RawRules      string              `json:"raw_rules"`      // Raw table (NOTRACK) as last restored
+	IPSets        []IPSetReport       `json:"ipsets"`
+	EBPF          EBPFReport          `json:"ebpf"`
+	GeoCountries  []GeoCountryReport  `json:"geo_countries"`
+	Signatures    []SignatureReport   `json:"signatures"` // Enabled signatures only
+	Lists         ListSizes           `json:"lists"`
+	Errors        []string            `json:"errors,omitempty"`
+}
+
+// IPSetReport summarizes one ipset: member lines are counted, not listed
+type IPSetReport struct {
+	Name       string `json:"name"`
+	Definition string `json:"definition"` // ipset create line
+	Generated  int    `json:"generated"`  // Entries in the last generated rules
+	Live       int    `json:"live"`       // Entries in the kernel (-1 if unknown)
+}
+
+// EBPFReport is the XDP side of the security report
+type EBPFReport struct {
+	Enabled    bool          `json:"enabled"`
+	Config     []BPFMapEntry `json:"config,omitempty"`
+	GeoCIDRs   int           `json:"geo_cidrs"`
+	Blocked    int           `json:"blocked"`
+	Interfaces []string      `json:"interfaces,omitempty"`
+}
+
+// GeoCountryReport is one allowed country and its loaded ranges
+type GeoCountryReport struct {
+	Code     string `json:"code"`
+	CIDRs    int    `json:"cidrs"`     // Ranges in the geo_allowed ipset source
+	XDPCIDRs int    `json:"xdp_cidrs"` // Ranges in the XDP map (-1 when eBPF is off)
+}
+
+// SignatureReport is the enforcement-relevant part of an attack signature
+type SignatureReport struct {
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"`
+	SrcPort  int    `json:"src_port"`
+	DstPort  int    `json:"dst_port"`
+	Action   string `json:"action"`
+	PPSLimit int    `json:"pps_limit,omitempty"`
+}
+
+// ListSizes counts the entries of each block/allow list
+type ListSizes struct {
+	Bans         int64 `json:"bans"`
+	AllowIPs     int64 `json:"allow_ips"`
+	AllowForeign int64 `json:"allow_foreign"`
+	FloodBlocked int   `json:"flood_blocked"`
+}
+
+// BuildSecurityReport assembles the security report from the last applied rules and live state
+func (s *FirewallService) BuildSecurityReport() SecurityReport {
+	now := time.Now()
+	report := SecurityReport{GeneratedAt: now, LastApply: s.GetApplyStatus(), Maintenance: s.inMaintenance}
+
+	if data, err := os.ReadFile(iptablesRulesPath); err == nil {
+		report.IPTablesRules = string(data)
+	} else {
+		report.Errors = append(report.Errors, "iptables rules not generated yet: "+err.Error())
+	}
+	if data, err := os.ReadFile(rawRulesPath); err == nil {
+		report.RawRules = string(data)
+	}
+	sets, err := summarizeIPSetRules(ipsetRulesPath)
+	if err != nil {
+		report.Errors = append(report.Errors, "ipset rules not generated yet: "+err.Error())
+	}
+	for i := range sets {
+		sets[i].Live = s.IPSetEntryCount(sets[i].Name)
+	}
+	report.IPSets = sets
+
+	// eBPF
+	var geoMap GeoMapStatus
+	if s.EBPF != nil && s.EBPF.IsEnabled() {
+		report.EBPF.Enabled = true
+		if dump, err := s.EBPF.DumpBPFMap(BPFMapConfig, 0); err == nil {
+			report.EBPF.Config = dump.Entries
+		} else {
+			report.Errors = append(report.Errors, "eBPF config: "+err.Error())
+		}
+		geoMap = s.EBPF.GetGeoMapStatus()
+		report.EBPF.GeoCIDRs = geoMap.TotalCIDRs
+		if blocked, err := s.EBPF.IterateBlockedIPs(); err == nil {
+			report.EBPF.Blocked = len(blocked)
+		}
+		report.EBPF.Interfaces = s.EBPF.GetAttachedInterfaces()
+	}
+
+	// Allowed countries in effect (including geo schedules)
+	var settings models.SecuritySettings
+	if err := s.DB.First(&settings, 1).Error; err == nil {
+		for _, cc := range s.EffectiveGeoCountries(&settings, now) {
+			entry := GeoCountryReport{Code: cc, XDPCIDRs: -1}
+			if s.GeoIP != nil {
+				entry.CIDRs = len(s.GeoIP.GetCountryCIDRs(cc))
+			}
+			if report.EBPF.Enabled {
+				entry.XDPCIDRs = geoMap.Countries[cc]
+			}
+			report.GeoCountries = append(report.GeoCountries, entry)
+		}
+	}
+
+	var signatures []models.AttackSignature
+	s.DB.Where("enabled = ?", true).Order("name ASC").Find(&signatures)
+	for _, sig := range signatures {
+		entry := SignatureReport{Name: sig.Name, Protocol: sig.Protocol, SrcPort: sig.SrcPort, DstPort: sig.DstPort, Action: sig.Action}
+		if sig.Action == "rate_limit" {
+			entry.PPSLimit = sig.PPSLimit
+		}
+		report.Signatures = append(report.Signatures, entry)
+	}
+
+	s.DB.Model(&models.BanIP{}).Where("expires_at IS NULL OR expires_at > ?", now).Count(&report.Lists.Bans)
+	s.DB.Model(&models.AllowIP{}).Count(&report.Lists.AllowIPs)
+	s.DB.Model(&models.AllowForeign{}).Count(&report.Lists.AllowForeign)
+	if s.FloodProtect != nil {
+		report.Lists.FloodBlocked = len(s.FloodProtect.GetBlockedIPs())
+	}
+	return report
+}
+
+// summarizeIPSetRules reads an ipset restore file and counts the add lines per set
+func summarizeIPSetRules(path string) ([]IPSetReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var order []string
+	sets := make(map[string]*IPSetReport)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "create":
+			if _, ok := sets[fields[1]]; !ok {
+				order = append(order, fields[1])
+			}
+			sets[fields[1]] = &IPSetReport{Name: fields[1], Definition: strings.Join(fields[2:], " ")}
+		case "add":
+			if set, ok := sets[fields[1]]; ok {
+				set.Generated++
+			}
+		}
+	}
+
+	out := make([]IPSetReport, 0, len(order))
+	for _, name := range order {
+		out = append(out, *sets[name])
+	}
+	return out, scanner.Err()
+}
+
+// Text renders the report as a plain-text document for download
+func (r SecurityReport) Text() string {
+	var sb strings.Builder
+	line := func(format string, args ...interface{}) {
+		sb.WriteString(fmt.Sprintf(format, args...))
+		sb.WriteString("\n")
+	}
+	section := func(title string) {
+		line("")
+		line("== %s ==", title)
+	}
+
+	line("KG-Proxy security report")
+	line("Generated: %s", r.GeneratedAt.Format(time.RFC3339))
+	if r.LastApply.LastSuccess != nil {
+		line("Last successful apply: %s", r.LastApply.LastSuccess.Format(time.RFC3339))
+	} else {
+		line("Last successful apply: never")
+	}
+	if r.Maintenance {
+		line("MAINTENANCE MODE ACTIVE: all blocking is bypassed")
+	}
+	for _, e := range r.Errors {
+		line("! %s", e)
+	}
+
+	section("Lists")
+	line("Bans: %d, allow IPs: %d, allow foreign: %d, flood blocked: %d",
+		r.Lists.Bans, r.Lists.AllowIPs, r.Lists.AllowForeign, r.Lists.FloodBlocked)
+
+	section("Allowed countries")
+	if len(r.GeoCountries) == 0 {
+		line("(none)")
+	}
+	for _, g := range r.GeoCountries {
+		if g.XDPCIDRs >= 0 {
+			line("%s  %d ranges (XDP: %d)", g.Code, g.CIDRs, g.XDPCIDRs)
+		} else {
+			line("%s  %d ranges", g.Code, g.CIDRs)
+		}
+	}
+
+	section("eBPF / XDP")
+	if !r.EBPF.Enabled {
+		line("Disabled")
+	} else {
+		line("Interfaces: %s", strings.Join(r.EBPF.Interfaces, ", "))
+		line("Geo map ranges: %d, blocked entries: %d", r.EBPF.GeoCIDRs, r.EBPF.Blocked)
+		for _, cfg := range r.EBPF.Config {
+			if cfg.Error != "" {
+				line("%-20s error: %s", cfg.Key, cfg.Error)
+			} else {
+				line("%-20s %v  (%s)", cfg.Key, cfg.Value, cfg.Description)
+			}
+		}
+	}
+
+	section("Attack signatures (enabled)")
+	if len(r.Signatures) == 0 {
+		line("(none)")
+	}
+	sigs := append([]SignatureReport(nil), r.Signatures...)
+	sort.Slice(sigs, func(i, j int) bool { return sigs[i].Name < sigs[j].Name })
+	for _, sig := range sigs {
+		action := sig.Action
+		if sig.PPSLimit > 0 {
+			action = fmt.Sprintf("%s %d pps", action, sig.PPSLimit)
+		}
+		line("%-30s %s src:%d dst:%d -> %s", sig.Name, sig.Protocol, sig.SrcPort, sig.DstPort, action)
+	}
+
+	section("ipsets")
+	for _, set := range r.IPSets {
+		line("%-16s %-50s generated: %d, live: %d", set.Name, set.Definition, set.Generated, set.Live)
+	}
+
+	section("iptables")
+	sb.WriteString(r.IPTablesRules)
+	section("iptables raw")
+	sb.WriteString(r.RawRules)
+	return sb.String()
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServiceTraffic is the eBPF port traffic attributed to one configured service
+type ServiceTraffic struct {
+	ServiceID   uint     `json:"service_id"`
+	Name        string   `json:"name"`
+	OriginID    uint     `json:"origin_id"`
+	Ports       []string `json:"ports"`        // "27015-27030/udp"
+	ActivePorts int      `json:"active_ports"` // Ports of the service that have seen traffic
+	Packets     uint64   `json:"packets"`
+	Bytes       uint64   `json:"bytes"`
+	PPS         float64  `json:"pps"` // Since the previous request (0 on the first)
+	BPS         float64  `json:"bps"`
+}
+
+// serviceTrafficSample remembers the last totals per service so repeated requests yield rates
+var serviceTrafficSample = struct {
+	sync.Mutex
+	at     time.Time
+	totals map[uint][2]uint64 // service ID -> packets, bytes
+}{totals: make(map[uint][2]uint64)}
+
+// ServiceTrafficStats sums per-port counters over each service's public ports (ranges included).
+// port_stats is keyed by destination port only, so a port a service uses for both TCP and UDP
+// counts all its traffic once; ports shared by two services count towards both.
+func ServiceTrafficStats(svcs []models.Service, ports []PortStats) []ServiceTraffic {
+	byPort := make(map[int]PortStats, len(ports))
+	for _, p := range ports {
+		byPort[int(p.Port)] = p
+	}
+
+	result := make([]ServiceTraffic, 0, len(svcs))
+	for _, svc := range svcs {
+		entry := ServiceTraffic{
+			ServiceID: svc.ID,
+			Name:      svc.Name,
+			OriginID:  svc.OriginID,
+			Ports:     make([]string, 0, len(svc.Ports)),
+		}
+		seen := make(map[int]bool)
+		for _, sp := range svc.Ports {
+			start, end := sp.PublicPort, sp.PublicPortEnd
+			if end < start {
+				end = start
+			}
+			label := fmt.Sprintf("%d", start)
+			if end > start {
+				label = fmt.Sprintf("%d-%d", start, end)
+			}
+			entry.Ports = append(entry.Ports, label+"/"+strings.ToLower(sp.Protocol))
+
+			for port := start; port <= end; port++ {
+				if seen[port] {
+					continue
+				}
+				seen[port] = true
+				if stat, ok := byPort[port]; ok && stat.Packets > 0 {
+					entry.ActivePorts++
+					entry.Packets += stat.Packets
+					entry.Bytes += stat.Bytes
+				}
+			}
+		}
+		result = append(result, entry)
+	}
+
+	applyServiceRates(result)
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Packets > result[j].Packets })
+	return result
+}
+
+// applyServiceRates fills PPS/BPS from the difference to the previous sample
+func applyServiceRates(result []ServiceTraffic) {
+	serviceTrafficSample.Lock()
+	defer serviceTrafficSample.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(serviceTrafficSample.at).Seconds()
+	totals := make(map[uint][2]uint64, len(result))
+	for i := range result {
+		r := &result[i]
+		totals[r.ServiceID] = [2]uint64{r.Packets, r.Bytes}
+		prev, ok := serviceTrafficSample.totals[r.ServiceID]
+		// Counters drop when stats are reset; skip the rate for that sample
+		if !ok || elapsed <= 0 || prev[0] > r.Packets || prev[1] > r.Bytes {
+			continue
+		}
+		r.PPS = float64(r.Packets-prev[0]) / elapsed
+		r.BPS = float64(r.Bytes-prev[1]) / elapsed
+	}
+	serviceTrafficSample.at = now
+	serviceTrafficSample.totals = totals
+}
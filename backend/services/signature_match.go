@@ -0,0 +1,63 @@
+package services
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"strings"
+)
+
+// PacketInfo is the decoded L3/L4 view of a packet used for signature matching
+type PacketInfo struct {
+	Protocol string // UDP, TCP, ICMP or OTHER
+	SrcIP    string
+	DstIP    string
+	SrcPort  int
+	DstPort  int
+	Length   int    // Captured wire length
+	Payload  []byte // Transport payload (after UDP/TCP header)
+}
+
+// SignatureMatcher is a compiled AttackSignature
+type SignatureMatcher struct {
+	protocol string
+	srcPort  int
+	dstPort  int
+	payload  []byte
+}
+
+// CompileSignature validates a signature's criteria and prepares it for matching
+func CompileSignature(sig models.AttackSignature) (*SignatureMatcher, error) {
+	m := &SignatureMatcher{
+		protocol: strings.ToUpper(strings.TrimSpace(sig.Protocol)),
+		srcPort:  sig.SrcPort,
+		dstPort:  sig.DstPort,
+	}
+	if p := strings.TrimSpace(sig.Payload); p != "" {
+		payload, err := hex.DecodeString(strings.ReplaceAll(p, " ", ""))
+		if err != nil {
+			return nil, fmt.Errorf("invalid payload hex %q: %w", sig.Payload, err)
+		}
+		m.payload = payload
+	}
+	return m, nil
+}
+
+// Match reports whether the packet satisfies every criterion of the signature.
+// Zero ports and an empty payload match anything; the payload may appear anywhere in the L4 payload.
+func (m *SignatureMatcher) Match(pkt *PacketInfo) bool {
+	if m.protocol != "" && m.protocol != "ANY" && m.protocol != pkt.Protocol {
+		return false
+	}
+	if m.srcPort != 0 && m.srcPort != pkt.SrcPort {
+		return false
+	}
+	if m.dstPort != 0 && m.dstPort != pkt.DstPort {
+		return false
+	}
+	if len(m.payload) > 0 && !bytes.Contains(pkt.Payload, m.payload) {
+		return false
+	}
+	return true
+}
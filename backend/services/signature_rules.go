@@ -0,0 +1,194 @@
+package services
+
+import (
+	"encoding/hex"
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// signatureChain holds the enabled attack signatures in the mangle table
+const signatureChain = "SIG_GUARD"
+
+// maxSignaturePayload is the longest pattern xt_string accepts, in bytes. A longer one makes
+// iptables-restore reject the whole mangle ruleset.
+const maxSignaturePayload = 128
+
+// signatureHitInterval is how often the signature rule counters are added to HitCount
+const signatureHitInterval = time.Minute
+
+// Signature actions
+const (
+	SignatureActionLog       = "log"        // Count matches only
+	SignatureActionRateLimit = "rate_limit" // Drop matches above PPSLimit per source IP
+	SignatureActionBlock     = "block"      // Drop every match
+)
+
+// signatureComment tags the counting rule of a signature, e.g. sig_12
+func signatureComment(id uint) string {
+	return fmt.Sprintf("sig_%d", id)
+}
+
+// signatureMatch renders the iptables match of a signature (without the chain), or an error
+// if iptables cannot express it. Like SignatureMatcher, zero ports and an empty payload match
+// anything and the payload may appear anywhere in the packet.
+func signatureMatch(sig models.AttackSignature) (string, error) {
+	var sb strings.Builder
+	proto := strings.ToLower(strings.TrimSpace(sig.Protocol))
+	switch proto {
+	case "udp", "tcp":
+		sb.WriteString(" -p " + proto)
+		if sig.SrcPort != 0 {
+			sb.WriteString(fmt.Sprintf(" --sport %d", sig.SrcPort))
+		}
+		if sig.DstPort != 0 {
+			sb.WriteString(fmt.Sprintf(" --dport %d", sig.DstPort))
+		}
+	case "icmp":
+		sb.WriteString(" -p icmp")
+	case "", "any":
+		if sig.SrcPort != 0 || sig.DstPort != 0 {
+			return "", fmt.Errorf("ports need protocol UDP or TCP")
+		}
+	default:
+		return "", fmt.Errorf("unsupported protocol %q", sig.Protocol)
+	}
+
+	if p := strings.ReplaceAll(strings.TrimSpace(sig.Payload), " ", ""); p != "" {
+		payload, err := hex.DecodeString(p)
+		if err != nil {
+			return "", fmt.Errorf("invalid payload hex %q", sig.Payload)
+		}
+		if len(payload) > maxSignaturePayload {
+			return "", fmt.Errorf("payload is %d bytes, at most %d are supported", len(payload), maxSignaturePayload)
+		}
+		sb.WriteString(fmt.Sprintf(" -m string --algo bm --hex-string \"|%s|\"", strings.ToLower(p)))
+	}
+
+	if sb.Len() == 0 {
+		return "", fmt.Errorf("matches every packet")
+	}
+	return sb.String(), nil
+}
+
+// ValidateSignatureRule reports why a signature cannot be enforced by the firewall, if it can't
+func ValidateSignatureRule(sig models.AttackSignature) error {
+	switch sig.Action {
+	case "", SignatureActionLog, SignatureActionRateLimit, SignatureActionBlock:
+	default:
+		return fmt.Errorf("action must be %s, %s or %s", SignatureActionLog, SignatureActionRateLimit, SignatureActionBlock)
+	}
+	if sig.PPSLimit < 0 {
+		return fmt.Errorf("pps_limit must not be negative")
+	}
+	if sig.Payload != "" && strings.ReplaceAll(strings.TrimSpace(sig.Payload), " ", "") == "" {
+		return fmt.Errorf("payload is empty")
+	}
+	_, err := signatureMatch(sig)
+	return err
+}
+
+// writeSignatureRules fills SIG_GUARD from the enabled signatures. Every signature gets a
+// counting rule tagged with signatureComment; rate_limit and block add a DROP after it.
+// Established connections are skipped so replies to the host's own requests are never hit.
+func (s *FirewallService) writeSignatureRules(sb *strings.Builder) {
+	var signatures []models.AttackSignature
+	s.DB.Where("enabled = ?", true).Order("id ASC").Find(&signatures)
+
+	sb.WriteString(fmt.Sprintf("-A %s -m conntrack --ctstate RELATED,ESTABLISHED -j RETURN\n", signatureChain))
+	for _, sig := range signatures {
+		match, err := signatureMatch(sig)
+		if err != nil {
+			system.Warn("Signature %q not enforced: %v", sig.Name, err)
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("-A %s%s -m comment --comment %s\n", signatureChain, match, signatureComment(sig.ID)))
+
+		switch sig.Action {
+		case SignatureActionBlock:
+			sb.WriteString(fmt.Sprintf("-A %s%s -j DROP\n", signatureChain, match))
+		case SignatureActionRateLimit:
+			limit := sig.PPSLimit
+			if limit <= 0 {
+				limit = 100
+			}
+			sb.WriteString(fmt.Sprintf("-A %s%s -m hashlimit --hashlimit-name sig_%d --hashlimit-mode srcip --hashlimit-above %d/sec --hashlimit-burst %d -j DROP\n",
+				signatureChain, match, sig.ID, limit, limit))
+		}
+	}
+}
+
+// StartSignatureHitCounter adds the packet counters of the signature rules to
+// AttackSignature.HitCount/LastHit every signatureHitInterval
+func (s *FirewallService) StartSignatureHitCounter() {
+	go func() {
+		ticker := time.NewTicker(signatureHitInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			s.collectSignatureHits()
+		}
+	}()
+}
+
+// collectSignatureHits stores the packets counted since the last collection. Counters restart
+// from zero when the chain is restored, so ApplyRules collects right before and resets after.
+func (s *FirewallService) collectSignatureHits() {
+	output, err := s.Executor.Execute("iptables", "-t", "mangle", "-L", signatureChain, "-v", "-n", "-x")
+	if err != nil {
+		return
+	}
+
+	s.sigHitMu.Lock()
+	defer s.sigHitMu.Unlock()
+	if s.sigHitSeen == nil {
+		s.sigHitSeen = make(map[uint]int64)
+	}
+
+	now := time.Now()
+	for _, line := range strings.Split(output, "\n") {
+		start := strings.Index(line, "/* sig_")
+		if start < 0 {
+			continue
+		}
+		comment := strings.TrimPrefix(line[start:], "/* sig_")
+		end := strings.Index(comment, " */")
+		if end < 0 {
+			continue
+		}
+		id, err := strconv.ParseUint(comment[:end], 10, 32)
+		if err != nil {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 1 {
+			continue
+		}
+		pkts, _ := strconv.ParseInt(fields[0], 10, 64)
+
+		delta := pkts - s.sigHitSeen[uint(id)]
+		if delta < 0 {
+			delta = pkts // Counter restarted outside ApplyRules
+		}
+		s.sigHitSeen[uint(id)] = pkts
+		if delta == 0 {
+			continue
+		}
+		s.DB.Model(&models.AttackSignature{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"hit_count": gorm.Expr("hit_count + ?", delta),
+			"last_hit":  now,
+		})
+	}
+}
+
+// resetSignatureHits forgets the last seen counters after the rules were restored
+func (s *FirewallService) resetSignatureHits() {
+	s.sigHitMu.Lock()
+	defer s.sigHitMu.Unlock()
+	s.sigHitSeen = make(map[uint]int64)
+}
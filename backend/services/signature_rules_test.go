@@ -0,0 +1,30 @@
+package services
+
+import (
+	"kg-proxy-web-gui/backend/models"
+	"strings"
+	"testing"
+)
+
+func TestValidateSignatureRulePayloadLength(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		wantErr bool
+	}{
+		{"no payload", "", false},
+		{"one byte", "ff", false},
+		{"at limit", strings.Repeat("ab", maxSignaturePayload), false},
+		{"at limit with spaces", strings.TrimSpace(strings.Repeat("ab ", maxSignaturePayload)), false},
+		{"over limit", strings.Repeat("ab", maxSignaturePayload+1), true},
+		{"blank", "   ", true},
+		{"odd hex", "abc", true},
+	}
+	for _, tt := range tests {
+		sig := models.AttackSignature{Name: tt.name, Protocol: "udp", DstPort: 7777, Payload: tt.payload, Action: SignatureActionBlock}
+		err := ValidateSignatureRule(sig)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: ValidateSignatureRule() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -217,13 +217,16 @@ func (s *SysInfoService) GetActiveConnections() int {
 	return count
 }
 
-// GetNetworkIO returns network RX/TX bytes for the default interface
+// GetNetworkIO returns network RX/TX bytes summed over the protected WAN interfaces
 func (s *SysInfoService) GetNetworkIO() (rxBytes, txBytes uint64) {
 	if runtime.GOOS != "linux" {
 		return 0, 0
 	}
 
-	primaryIface := system.GetDefaultInterface()
+	wanIfaces := make(map[string]bool)
+	for _, name := range system.GetProtectedInterfaces() {
+		wanIfaces[name] = true
+	}
 
 	// Read /proc/net/dev
 	data, err := os.ReadFile("/proc/net/dev")
@@ -232,23 +235,27 @@ func (s *SysInfoService) GetNetworkIO() (rxBytes, txBytes uint64) {
 	}
 
 	lines := strings.Split(string(data), "\n")
+	found := false
 	for _, line := range lines {
-		// Look for the primary interface entry
-		if strings.Contains(line, primaryIface+":") {
-			parts := strings.Split(line, ":")
-			if len(parts) < 2 {
-				continue
-			}
-
-			fields := strings.Fields(parts[1])
-			if len(fields) < 9 {
-				continue
-			}
+		// Look for the protected interface entries
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) < 2 || !wanIfaces[strings.TrimSpace(parts[0])] {
+			continue
+		}
 
-			rx, _ := strconv.ParseUint(fields[0], 10, 64)
-			tx, _ := strconv.ParseUint(fields[8], 10, 64)
-			return rx, tx
+		fields := strings.Fields(parts[1])
+		if len(fields) < 9 {
+			continue
 		}
+
+		rx, _ := strconv.ParseUint(fields[0], 10, 64)
+		tx, _ := strconv.ParseUint(fields[8], 10, 64)
+		rxBytes += rx
+		txBytes += tx
+		found = true
+	}
+	if found {
+		return rxBytes, txBytes
 	}
 
 	// Fallback: Return first non-loopback interface if primary not found in /proc/net/dev
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Threat signal sources, ordered from weakest to strongest
+const (
+	ThreatSourceIntel   = "ip_intel"
+	ThreatSourceAttack  = "attack_event"
+	ThreatSourceFlood   = "flood"
+	ThreatSourceBlocked = "blocked"
+)
+
+// threatSeverity ranks sources; the strongest signal decides an entry's reason
+var threatSeverity = map[string]int{
+	ThreatSourceIntel:   1,
+	ThreatSourceAttack:  2,
+	ThreatSourceFlood:   3,
+	ThreatSourceBlocked: 4,
+}
+
+// ThreatEntry is one source IP with every signal that currently points at it
+type ThreatEntry struct {
+	IP          string    `json:"ip"`
+	Severity    int       `json:"severity"`
+	Source      string    `json:"source"` // Strongest signal
+	Reason      string    `json:"reason"`
+	Signals     []string  `json:"signals"`
+	CountryCode string    `json:"country_code"`
+	CountryName string    `json:"country_name"`
+	PeakPPS     int64     `json:"peak_pps"`
+	Blocked     bool      `json:"blocked"`
+	ExpiresAt   time.Time `json:"expires_at,omitempty"` // Zero if not blocked or permanent
+	LastSeen    time.Time `json:"last_seen,omitempty"`
+}
+
+// ThreatAggregator merges threat signals from several services, deduplicated by IP
+type ThreatAggregator struct {
+	entries map[string]*ThreatEntry
+}
+
+// NewThreatAggregator creates an empty aggregator
+func NewThreatAggregator() *ThreatAggregator {
+	return &ThreatAggregator{entries: make(map[string]*ThreatEntry)}
+}
+
+// Add records a signal for ip. The reason is replaced only by a stronger source,
+// country is kept from the first signal that knows it.
+func (a *ThreatAggregator) Add(ip, source, reason, countryCode, countryName string, pps int64, seen time.Time) *ThreatEntry {
+	entry, ok := a.entries[ip]
+	if !ok {
+		entry = &ThreatEntry{IP: ip}
+		a.entries[ip] = entry
+	}
+	if severity := threatSeverity[source]; severity > entry.Severity {
+		entry.Severity = severity
+		entry.Source = source
+		entry.Reason = reason
+	}
+	hasSignal := false
+	for _, s := range entry.Signals {
+		if s == source {
+			hasSignal = true
+			break
+		}
+	}
+	if !hasSignal {
+		entry.Signals = append(entry.Signals, source)
+	}
+	if entry.CountryCode == "" && countryCode != "" {
+		entry.CountryCode = strings.ToUpper(countryCode)
+		entry.CountryName = countryName
+	}
+	if pps > entry.PeakPPS {
+		entry.PeakPPS = pps
+	}
+	if seen.After(entry.LastSeen) {
+		entry.LastSeen = seen
+	}
+	return entry
+}
+
+// List returns entries ranked by severity, then by number of signals, then by peak PPS
+func (a *ThreatAggregator) List() []ThreatEntry {
+	list := make([]ThreatEntry, 0, len(a.entries))
+	for _, entry := range a.entries {
+		sort.Slice(entry.Signals, func(i, j int) bool {
+			return threatSeverity[entry.Signals[i]] > threatSeverity[entry.Signals[j]]
+		})
+		list = append(list, *entry)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Severity != list[j].Severity {
+			return list[i].Severity > list[j].Severity
+		}
+		if len(list[i].Signals) != len(list[j].Signals) {
+			return len(list[i].Signals) > len(list[j].Signals)
+		}
+		if list[i].PeakPPS != list[j].PeakPPS {
+			return list[i].PeakPPS > list[j].PeakPPS
+		}
+		return list[i].IP < list[j].IP
+	})
+	return list
+}
@@ -64,3 +64,174 @@ type BlockedIPInfo struct {
 	CountryCode string    `json:"countryCode"`
 	CountryName string    `json:"countryName"`
 }
+
+// AggregatorStats describes the eBPF event aggregator backlog and losses
+type AggregatorStats struct {
+	IntervalSeconds    int    `json:"interval_seconds"`
+	QueueDepth         int    `json:"queue_depth"`    // Events waiting in the channel
+	QueueCapacity      int    `json:"queue_capacity"` // Channel buffer size
+	PendingKeys        int    `json:"pending_keys"`   // Unique IP+Reason pairs in the current batch
+	MaxKeys            int    `json:"max_keys"`
+	ConfiguredQueue    int    `json:"configured_queue_capacity"` // Takes effect on the next eBPF load
+	DroppedChannelFull uint64 `json:"dropped_channel_full"`
+	DroppedMapFull     uint64 `json:"dropped_map_full"`
+	DroppedTotal       uint64 `json:"dropped_total"`    // Attack events missing from logs and stats
+	SkippedInternal    uint64 `json:"skipped_internal"` // Private/WireGuard sources ignored
+
+	LastDropAt *time.Time `json:"last_drop_at,omitempty"`
+}
+
+// MapBenchmarkResult reports blocked_ips update throughput
+type MapBenchmarkResult struct {
+	Entries         int     `json:"entries"`
+	ActiveBlocks    int     `json:"active_blocks"` // Real entries present when the benchmark ran
+	PutMs           float64 `json:"put_ms"`
+	DeleteMs        float64 `json:"delete_ms"`
+	PutOpsPerSec    float64 `json:"put_ops_per_sec"`
+	DeleteOpsPerSec float64 `json:"delete_ops_per_sec"`
+	PutErrors       int     `json:"put_errors"`
+	DeleteErrors    int     `json:"delete_errors"`
+}
+
+// Debug map names accepted by DumpBPFMap
+const (
+	BPFMapGeoAllowed  = "geo_allowed"
+	BPFMapGeoBlocked  = "geo_blocked"
+	BPFMapBlockedIPs  = "blocked_ips"
+	BPFMapWhiteList   = "white_list"
+	BPFMapConfig      = "config"
+	BPFMapGlobalStats = "global_stats"
+)
+
+// BPFMapNames lists the maps the debug API can dump
+var BPFMapNames = []string{BPFMapGeoAllowed, BPFMapGeoBlocked, BPFMapBlockedIPs, BPFMapWhiteList, BPFMapConfig, BPFMapGlobalStats}
+
+// BPFMapInfo describes one map exposed by the BPF map debug API
+type BPFMapInfo struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	MaxEntries uint32 `json:"max_entries"`
+	PinPath    string `json:"pin_path"`
+	Available  bool   `json:"available"`
+}
+
+// BPFMapDump is a structured read of one BPF map
+type BPFMapDump struct {
+	Name      string        `json:"name"`
+	Count     int           `json:"count"`     // Entries in the map
+	Truncated bool          `json:"truncated"` // Entries holds a sample only
+	Entries   []BPFMapEntry `json:"entries"`
+}
+
+// BPFMapEntry is one decoded key/value pair
+type BPFMapEntry struct {
+	Key         string      `json:"key"`
+	Value       interface{} `json:"value"`
+	Description string      `json:"description,omitempty"`
+	Error       string      `json:"error,omitempty"`
+}
+
+// EBPFCounter is one raw global_stats entry
+type EBPFCounter struct {
+	Index       uint32 `json:"index"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Value       uint64 `json:"value"` // Cumulative since load, summed across CPUs
+	CPUs        int    `json:"cpus"`
+	Error       string `json:"error,omitempty"`
+}
+
+// IPStatsSampling describes the last ip_stats scan (top-K selection, adaptive polling)
+type IPStatsSampling struct {
+	TopK            int       `json:"top_k"`
+	BasePollSeconds int       `json:"base_poll_seconds"`
+	PollSeconds     int       `json:"poll_seconds"` // Current interval after backoff
+	TrackedIPs      int       `json:"tracked_ips"`  // Entries in ip_stats at the last scan
+	ReportedIPs     int       `json:"reported_ips"`
+	Truncated       bool      `json:"truncated"` // True when IPs outside the top-K were dropped from the view
+	ScanDurationMs  int64     `json:"scan_duration_ms"`
+	LastScan        time.Time `json:"last_scan"`
+}
+
+// XDPAttachInfo describes how the XDP program is attached to one interface
+type XDPAttachInfo struct {
+	Interface string `json:"interface"`
+	Mode      string `json:"mode"` // native, generic, offload, unknown
+	Driver    string `json:"driver"`
+	Guidance  string `json:"guidance,omitempty"`
+}
+
+// XDPStatus is the attach mode summary exposed on the capabilities endpoint
+type XDPStatus struct {
+	Interfaces      []XDPAttachInfo `json:"interfaces"`
+	GenericFallback bool            `json:"generic_fallback"` // At least one interface runs in slow generic (SKB) mode
+	CheckedAt       time.Time       `json:"checked_at"`
+	Links           []XDPLinkHealth `json:"links"`       // Link watcher state per attached interface
+	Unprotected     []string        `json:"unprotected"` // Interfaces currently not filtered (down or detached)
+}
+
+// XDPLinkHealth tracks one XDP attachment across interface down/up events
+type XDPLinkHealth struct {
+	Interface    string     `json:"interface"`
+	State        string     `json:"state"` // ok, down, detached
+	DownSince    *time.Time `json:"down_since,omitempty"`
+	LastReattach *time.Time `json:"last_reattach,omitempty"`
+	Reattaches   int        `json:"reattaches"`
+	LastError    string     `json:"last_error,omitempty"`
+	CheckedAt    time.Time  `json:"checked_at"`
+}
+
+// TCAttachInfo describes one TC egress attachment
+// ConnectionInfo is one active_connections entry: a remote address an origin recently sent
+// TCP/UDP to. TC egress tracks remote addresses only, not ports or protocol.
+type ConnectionInfo struct {
+	RemoteIP    string    `json:"remote_ip"`
+	CountryCode string    `json:"country_code"`
+	LastSeen    time.Time `json:"last_seen"`
+	AgeSeconds  int64     `json:"age_seconds"`
+	Bypassing   bool      `json:"bypassing"` // Replies from RemoteIP currently skip XDP filtering (age < conn track TTL)
+}
+
+type TCAttachInfo struct {
+	Interface string `json:"interface"`
+	Method    string `json:"method"` // tcx or legacy
+}
+
+// TCStatus reports whether outbound connection tracking (TC egress -> active_connections) is working
+type TCStatus struct {
+	Attached            bool           `json:"attached"`
+	Interfaces          []TCAttachInfo `json:"interfaces"`
+	LoadError           string         `json:"load_error,omitempty"`
+	Warning             string         `json:"warning,omitempty"`
+	ActiveConnections   int            `json:"active_connections"` // Entries in the active_connections map
+	MaxConnections      int            `json:"max_connections"`
+	RecentConnections   int            `json:"recent_connections"` // Entries refreshed within RecentWindowSeconds
+	RecentWindowSeconds int            `json:"recent_window_seconds"`
+	TrackedTotal        uint64         `json:"tracked_total"` // tc_stats counters since load
+	TrackedTCP          uint64         `json:"tracked_tcp"`
+	TrackedUDP          uint64         `json:"tracked_udp"`
+	EgressPackets       uint64         `json:"egress_packets"`
+}
+
+// GeoMapStatus describes the contents of the XDP geo_allowed map after the last update
+type GeoMapStatus struct {
+	Loaded         bool           `json:"loaded"`    // At least one update ran since eBPF was enabled
+	Countries      map[string]int `json:"countries"` // Country code -> CIDRs in the map
+	TotalCIDRs     int            `json:"total_cidrs"`
+	Truncated      bool           `json:"truncated"`        // Map limit reached, some ranges missing
+	FailSafeActive bool           `json:"fail_safe_active"` // Map empty, hard blocking forced off
+	BlockMode      bool           `json:"block_mode"`       // Country blacklist: geo_blocked decides instead of geo_allowed
+	Blocked        map[string]int `json:"blocked"`          // Country code -> CIDRs in geo_blocked
+	BlockedCIDRs   int            `json:"blocked_cidrs"`
+	UpdatedAt      *time.Time     `json:"updated_at"`
+}
+
+// FirewallApplyStatus is the outcome of the last ApplyRules run
+type FirewallApplyStatus struct {
+	LastAttempt *time.Time `json:"last_attempt"`
+	LastSuccess *time.Time `json:"last_success"`
+	Error       string     `json:"error,omitempty"`
+	ErrorKind   string     `json:"error_kind,omitempty"` // missing_binary, rule_rejected, reverted or held
+
+	ConfirmDeadline *time.Time `json:"confirm_deadline,omitempty"` // Rollback time of an unconfirmed apply
+}
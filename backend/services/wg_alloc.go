@@ -0,0 +1,136 @@
+package services
+
+import (
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"net"
+	"strings"
+	"time"
+)
+
+// DefaultWGSubnet is the WireGuard tunnel network origins live on when none is configured
+const DefaultWGSubnet = "10.200.0.0/24"
+
+// wgReservationTTL keeps a freshly allocated address out of the pool until its origin is saved
+const wgReservationTTL = 2 * time.Minute
+
+// wgSubnet is the active tunnel network, set from SystemConfig when the WireGuard service is created
+var wgSubnet = DefaultWGSubnet
+
+// WGSubnet returns the WireGuard tunnel network in CIDR notation
+func WGSubnet() string {
+	return wgSubnet
+}
+
+// setWGSubnet switches the tunnel network and the internal traffic exclusion that covers it
+func setWGSubnet(n *net.IPNet) {
+	wgSubnet = n.String()
+	refreshInternalExclusion()
+}
+
+// ParseWGSubnet validates a WireGuard pool: an IPv4 network between /16 and /29
+func ParseWGSubnet(cidr string) (*net.IPNet, error) {
+	ip, n, err := net.ParseCIDR(strings.TrimSpace(cidr))
+	if err != nil || ip.To4() == nil {
+		return nil, fmt.Errorf("invalid WireGuard subnet %q: must be an IPv4 CIDR", cidr)
+	}
+	if ones, _ := n.Mask.Size(); ones < 16 || ones > 29 {
+		return nil, fmt.Errorf("invalid WireGuard subnet %q: prefix must be between /16 and /29", cidr)
+	}
+	return n, nil
+}
+
+// wgPool returns the tunnel network and its first/last usable origin addresses.
+// The network's first host is the server itself, so origins start at the second.
+func wgPool() (*net.IPNet, uint32, uint32) {
+	n, err := ParseWGSubnet(wgSubnet)
+	if err != nil {
+		n, _ = ParseWGSubnet(DefaultWGSubnet)
+	}
+	base := ipToUint32(n.IP)
+	ones, bits := n.Mask.Size()
+	size := uint32(1) << uint(bits-ones)
+	return n, base + 2, base + size - 2
+}
+
+// wgServerAddress returns the server's tunnel address with prefix, e.g. 10.200.0.1/24
+func wgServerAddress() string {
+	n, first, _ := wgPool()
+	ones, _ := n.Mask.Size()
+	return fmt.Sprintf("%s/%d", uint32ToIP(first-1), ones)
+}
+
+// usedWgIPs returns the tunnel addresses stored on origins, excluding one origin (0 = none)
+func (s *WireGuardService) usedWgIPs(excludeOriginID uint) (map[string]bool, error) {
+	used := make(map[string]bool)
+	if s.DB == nil {
+		return used, nil
+	}
+	var origins []models.Origin
+	if err := s.DB.Select("id", "wg_ip").Find(&origins).Error; err != nil {
+		return nil, err
+	}
+	for _, o := range origins {
+		if o.ID != excludeOriginID && o.WgIP != "" {
+			used[strings.SplitN(o.WgIP, "/", 2)[0]] = true
+		}
+	}
+	return used, nil
+}
+
+// AllocateWgIP hands out the lowest free origin address in the WireGuard subnet.
+// The address is reserved briefly so concurrent creates don't receive the same one.
+func (s *WireGuardService) AllocateWgIP() (string, error) {
+	s.allocMu.Lock()
+	defer s.allocMu.Unlock()
+
+	used, err := s.usedWgIPs(0)
+	if err != nil {
+		return "", fmt.Errorf("failed to read assigned WireGuard IPs: %v", err)
+	}
+	now := time.Now()
+	for ip, until := range s.reserved {
+		if now.After(until) || used[ip] {
+			delete(s.reserved, ip)
+		}
+	}
+
+	n, first, last := wgPool()
+	for v := first; v <= last; v++ {
+		ip := uint32ToIP(v).String()
+		if used[ip] {
+			continue
+		}
+		if _, held := s.reserved[ip]; held {
+			continue
+		}
+		if s.reserved == nil {
+			s.reserved = make(map[string]time.Time)
+		}
+		s.reserved[ip] = now.Add(wgReservationTTL)
+		return ip, nil
+	}
+	return "", fmt.Errorf("WireGuard subnet %s is exhausted", n.String())
+}
+
+// ValidateWgIP checks that ip is an origin address inside the WireGuard subnet and not
+// already assigned to another origin than originID (0 for a new origin)
+func (s *WireGuardService) ValidateWgIP(ip string, originID uint) error {
+	parsed := net.ParseIP(strings.SplitN(strings.TrimSpace(ip), "/", 2)[0]).To4()
+	if parsed == nil {
+		return fmt.Errorf("invalid WireGuard IP %q", ip)
+	}
+	n, first, last := wgPool()
+	if v := ipToUint32(parsed); v < first || v > last {
+		return fmt.Errorf("WireGuard IP %s is outside the origin range of %s", parsed, n.String())
+	}
+
+	used, err := s.usedWgIPs(originID)
+	if err != nil {
+		return fmt.Errorf("failed to read assigned WireGuard IPs: %v", err)
+	}
+	if used[parsed.String()] {
+		return fmt.Errorf("WireGuard IP %s is already assigned to another origin", parsed)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"fmt"
+	"kg-proxy-web-gui/backend/models"
+	"kg-proxy-web-gui/backend/system"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// wgStatsInterval is how often peer handshake/transfer counters are written to the database
+const wgStatsInterval = 30 * time.Second
+
+// WGPeerStats is one peer line of "wg show wg0 dump"
+type WGPeerStats struct {
+	PublicKey     string     `json:"public_key"`
+	Endpoint      string     `json:"endpoint"` // "" when the peer never connected
+	AllowedIPs    string     `json:"allowed_ips"`
+	LastHandshake *time.Time `json:"last_handshake"` // nil when there was no handshake yet
+	RxBytes       int64      `json:"rx_bytes"`
+	TxBytes       int64      `json:"tx_bytes"`
+}
+
+// parseWgDump parses "wg show wg0 dump". The first line describes the interface
+// (private key, public key, port, fwmark); every following line is a tab-separated peer:
+// public-key, preshared-key, endpoint, allowed-ips, latest-handshake (unix seconds, 0 = never),
+// transfer-rx, transfer-tx, persistent-keepalive.
+func parseWgDump(output string) ([]WGPeerStats, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) == 0 || lines[0] == "" {
+		return nil, fmt.Errorf("empty wg dump")
+	}
+
+	var peers []WGPeerStats
+	for i, line := range lines[1:] {
+		fields := strings.Split(strings.TrimRight(line, "\r"), "\t")
+		if len(fields) < 8 {
+			return nil, fmt.Errorf("wg dump line %d: expected 8 fields, got %d", i+2, len(fields))
+		}
+		handshake, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("wg dump line %d: invalid handshake %q", i+2, fields[4])
+		}
+		rx, err := strconv.ParseInt(fields[5], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("wg dump line %d: invalid rx bytes %q", i+2, fields[5])
+		}
+		tx, err := strconv.ParseInt(fields[6], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("wg dump line %d: invalid tx bytes %q", i+2, fields[6])
+		}
+
+		peer := WGPeerStats{PublicKey: fields[0], AllowedIPs: fields[3], RxBytes: rx, TxBytes: tx}
+		if fields[2] != "(none)" {
+			peer.Endpoint = fields[2]
+		}
+		if handshake > 0 {
+			t := time.Unix(handshake, 0)
+			peer.LastHandshake = &t
+		}
+		peers = append(peers, peer)
+	}
+	return peers, nil
+}
+
+// PeerStats reads the live handshake and transfer counters of every wg0 peer
+func (s *WireGuardService) PeerStats() ([]WGPeerStats, error) {
+	if runtime.GOOS != "linux" {
+		return nil, nil
+	}
+	out, err := s.Executor.Execute("wg", "show", "wg0", "dump")
+	if err != nil {
+		return nil, fmt.Errorf("wg show wg0 dump failed: %v: %s", err, strings.TrimSpace(out))
+	}
+	return parseWgDump(out)
+}
+
+// RecordPeerStats stores the current peer counters on the matching WireGuardPeer rows.
+// Counters are the kernel's since wg0 came up, so they restart from zero after a reboot.
+func (s *WireGuardService) RecordPeerStats() error {
+	if s.DB == nil {
+		return nil
+	}
+	peers, err := s.PeerStats()
+	if err != nil {
+		return err
+	}
+	for _, p := range peers {
+		updates := map[string]interface{}{
+			"rx_bytes": p.RxBytes,
+			"tx_bytes": p.TxBytes,
+		}
+		// Keep the last known handshake if the interface was recreated since
+		if p.LastHandshake != nil {
+			updates["last_handshake"] = *p.LastHandshake
+		}
+		if err := s.DB.Model(&models.WireGuardPeer{}).Where("public_key = ?", p.PublicKey).
+			UpdateColumns(updates).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetWebhookService connects the Discord webhook used for stale handshake alerts
+func (s *WireGuardService) SetWebhookService(w *WebhookService) {
+	s.webhook = w
+}
+
+// SetHandshakeAlertMinutes sets how old an origin's last handshake may get before an alert is sent (0 = off)
+func (s *WireGuardService) SetHandshakeAlertMinutes(minutes int) {
+	if minutes < 0 {
+		minutes = 0
+	}
+	s.handshakeAlert.Store(int64(minutes))
+}
+
+// checkStaleHandshakes alerts once when an origin's stored handshake becomes older than the
+// threshold and once when it recovers. Origins that never completed a handshake are skipped,
+// and the first check after startup only records the state (like HealthMonitor).
+func (s *WireGuardService) checkStaleHandshakes() {
+	minutes := s.handshakeAlert.Load()
+	if minutes <= 0 || s.DB == nil {
+		s.handshakeStale = nil
+		return
+	}
+	var origins []models.Origin
+	if err := s.DB.Preload("Peer").Find(&origins).Error; err != nil {
+		return
+	}
+
+	if s.handshakeStale == nil {
+		s.handshakeStale = make(map[uint]bool)
+	}
+	threshold := time.Duration(minutes) * time.Minute
+	now := time.Now()
+	seen := make(map[uint]bool, len(origins))
+	for _, o := range origins {
+		if o.Peer == nil || o.Peer.LastHandshake == nil {
+			continue
+		}
+		seen[o.ID] = true
+		age := now.Sub(*o.Peer.LastHandshake)
+		stale := age > threshold
+
+		wasStale, known := s.handshakeStale[o.ID]
+		s.handshakeStale[o.ID] = stale
+		if !known || stale == wasStale {
+			continue
+		}
+		if stale {
+			system.Warn("WireGuard handshake of origin %s (%s) is %s old", o.Name, o.WgIP, age.Round(time.Second))
+		} else {
+			system.Info("WireGuard handshake of origin %s (%s) recovered", o.Name, o.WgIP)
+		}
+		s.sendHandshakeAlert(o, age, stale)
+	}
+	for id := range s.handshakeStale {
+		if !seen[id] {
+			delete(s.handshakeStale, id)
+		}
+	}
+}
+
+func (s *WireGuardService) sendHandshakeAlert(origin models.Origin, age time.Duration, stale bool) {
+	if s.webhook == nil || !s.webhook.IsEnabled() {
+		return
+	}
+	if stale {
+		msg := fmt.Sprintf("Origin **%s** (%s) has not completed a WireGuard handshake for **%s**. The tunnel is probably down.",
+			origin.Name, origin.WgIP, age.Round(time.Minute))
+		s.webhook.SendSystemAlert("🚨 WireGuard tunnel stale", msg, ColorRed)
+		return
+	}
+	msg := fmt.Sprintf("Origin **%s** (%s) completed a WireGuard handshake again.", origin.Name, origin.WgIP)
+	s.webhook.SendSystemAlert("✅ WireGuard tunnel restored", msg, ColorGreen)
+}
+
+// StartPeerStatsLoop periodically persists peer handshake and transfer stats
+// and checks them for stale handshakes
+func (s *WireGuardService) StartPeerStatsLoop() {
+	if runtime.GOOS != "linux" {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(wgStatsInterval)
+		defer ticker.Stop()
+
+		failing := false
+		for range ticker.C {
+			if err := s.RecordPeerStats(); err != nil {
+				// Log once per outage, not every 30 seconds
+				if !failing {
+					system.Warn("Failed to record WireGuard peer stats: %v", err)
+				}
+				failing = true
+				continue
+			}
+			failing = false
+			s.checkStaleHandshakes()
+		}
+	}()
+}
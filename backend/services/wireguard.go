@@ -12,20 +12,44 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/crypto/curve25519"
+	"gorm.io/gorm"
 )
 
 type WireGuardService struct {
 	Executor system.CommandExecutor
 	Config   *models.SystemConfig
 	DataDir  string
+	DB       *gorm.DB // Origins, for tunnel IP allocation
+
+	allocMu  sync.Mutex
+	reserved map[string]time.Time // Allocated IPs not yet saved on an origin
+
+	webhook        *WebhookService
+	handshakeAlert atomic.Int64  // Stale handshake threshold in minutes (0 = off)
+	handshakeStale map[uint]bool // OriginID -> handshake was stale at the last check (stats loop only)
 }
 
 func NewWireGuardService(exec system.CommandExecutor, cfg *models.SystemConfig, dataDir string) *WireGuardService {
+	if cfg != nil && cfg.WGSubnet != "" {
+		if n, err := ParseWGSubnet(cfg.WGSubnet); err != nil {
+			system.Warn("%v, using %s", err, DefaultWGSubnet)
+		} else {
+			setWGSubnet(n)
+		}
+	}
 	return &WireGuardService{Executor: exec, Config: cfg, DataDir: dataDir}
 }
 
+// SetDB connects the database used to find tunnel IPs already assigned to origins
+func (s *WireGuardService) SetDB(db *gorm.DB) {
+	s.DB = db
+}
+
 // Init ensures the WireGuard interface exists and is configured
 func (s *WireGuardService) Init() error {
 	if runtime.GOOS != "linux" {
@@ -40,17 +64,17 @@ func (s *WireGuardService) Init() error {
 		}
 	}
 
-	// 2. Assign IP (10.200.0.1/24) if not present
-	// Simple check: see if "10.200.0.1" is in the output of ip addr show wg0
+	// 2. Assign the server address (first host of the subnet, e.g. 10.200.0.1/24) if not present
+	serverAddr := wgServerAddress()
 	out, _ := s.Executor.Execute("ip", "addr", "show", "wg0")
-	if !strings.Contains(out, "10.200.0.1") {
-		if _, err := s.Executor.Execute("ip", "addr", "add", "10.200.0.1/24", "dev", "wg0"); err != nil {
+	if !strings.Contains(out, serverAddr) {
+		if _, err := s.Executor.Execute("ip", "addr", "add", serverAddr, "dev", "wg0"); err != nil {
 			return fmt.Errorf("failed to assign IP to wg0: %v", err)
 		}
 	}
 
 	// 3. Ensure Server Private Key
-	keyPath := filepath.Join(s.DataDir, "wg_private.key")
+	keyPath := s.ServerKeyPath()
 	if _, err := os.Stat(keyPath); os.IsNotExist(err) {
 		system.Info("Generating new WireGuard server private key...")
 		privKey, err := s.generateKeyWithWG()
@@ -100,6 +124,22 @@ func (s *WireGuardService) GenerateKeys() (string, string, error) {
 	return s.generateKeyWithGo()
 }
 
+// GeneratePresharedKey returns a base64 32-byte symmetric key for a peer's PresharedKey
+func (s *WireGuardService) GeneratePresharedKey() (string, error) {
+	if runtime.GOOS == "linux" {
+		if output, err := exec.Command("wg", "genpsk").Output(); err == nil {
+			return strings.TrimSpace(string(output)), nil
+		}
+		// Fall back to Go implementation if wg command fails
+	}
+
+	var psk [32]byte
+	if _, err := rand.Read(psk[:]); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(psk[:]), nil
+}
+
 // generateKeyWithWG uses wg command line tools
 func (s *WireGuardService) generateKeyWithWG() (string, error) {
 	cmd := exec.Command("wg", "genkey")
@@ -281,18 +321,35 @@ func networkContains(n1, n2 *net.IPNet) bool {
 	return s1 <= s2 && n1.Contains(n2.IP)
 }
 
-func (s *WireGuardService) generateClientConfig(peer *models.WireGuardPeer, vpsIP string) string {
-	return fmt.Sprintf(`[Interface]
-Address = 10.200.0.%d/32
-PrivateKey = %s
-DNS = 168.126.63.1
-
-[Peer]
-PublicKey = <VPS_PUB_KEY>
-Endpoint = %s:51820
-AllowedIPs = %s
-PersistentKeepalive = 25
-`, peer.OriginID+2, peer.PrivateKey, vpsIP, "0.0.0.0/0, ::/0")
+// GenerateClientConfig builds the wg-quick config an origin uses to connect to this server.
+// dns is a comma-separated resolver list; the DNS line is left out when it is empty.
+func (s *WireGuardService) GenerateClientConfig(peer *models.WireGuardPeer, wgIP, endpoint, allowedIPs, dns string) (string, error) {
+	serverKey := s.GetServerPublicKey()
+	if serverKey == "UNKNOWN_SERVER_KEY" {
+		return "", fmt.Errorf("server public key unavailable (is wg0 up?)")
+	}
+
+	address := wgIP
+	if !strings.Contains(address, "/") {
+		address += "/32"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("[Interface]\n")
+	sb.WriteString(fmt.Sprintf("Address = %s\n", address))
+	sb.WriteString(fmt.Sprintf("PrivateKey = %s\n", peer.PrivateKey))
+	if dns = strings.TrimSpace(dns); dns != "" {
+		sb.WriteString(fmt.Sprintf("DNS = %s\n", dns))
+	}
+	sb.WriteString("\n[Peer]\n")
+	sb.WriteString(fmt.Sprintf("PublicKey = %s\n", serverKey))
+	if peer.PresharedKey != "" {
+		sb.WriteString(fmt.Sprintf("PresharedKey = %s\n", peer.PresharedKey))
+	}
+	sb.WriteString(fmt.Sprintf("Endpoint = %s\n", endpoint))
+	sb.WriteString(fmt.Sprintf("AllowedIPs = %s\n", allowedIPs))
+	sb.WriteString("PersistentKeepalive = 25\n")
+	return sb.String(), nil
 }
 
 // GetServerPublicKey returns the public key of the WireGuard server interface (wg0)
@@ -308,10 +365,70 @@ func (s *WireGuardService) GetServerPublicKey() string {
 		return strings.TrimSpace(string(out))
 	}
 
-	// If failed (maybe interface down?), try reading config or return error
+	// wg0 down or wg missing: derive it from the stored private key
+	if key, err := os.ReadFile(s.ServerKeyPath()); err == nil {
+		if pub, err := s.derivePublicKey(strings.TrimSpace(string(key))); err == nil {
+			return pub
+		}
+	}
 	return "UNKNOWN_SERVER_KEY"
 }
 
+// ServerKeyPath returns the file holding the wg0 private key
+func (s *WireGuardService) ServerKeyPath() string {
+	return filepath.Join(s.DataDir, "wg_private.key")
+}
+
+// ServerKeyModTime returns when the server key was last generated or rotated (zero if unknown)
+func (s *WireGuardService) ServerKeyModTime() time.Time {
+	info, err := os.Stat(s.ServerKeyPath())
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// RotateServerKey generates a new wg0 keypair, applies it to the running interface and
+// re-adds every origin peer from the database. Every origin keeps the old server public key
+// in its [Peer] section, so handshakes fail until each origin config is updated.
+// The previous key is kept as wg_private.key.prev for manual rollback.
+func (s *WireGuardService) RotateServerKey() (string, error) {
+	if runtime.GOOS != "linux" {
+		return "", fmt.Errorf("server key rotation is only supported on Linux")
+	}
+
+	privKey, pubKey, err := s.GenerateKeys()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate server key: %v", err)
+	}
+
+	keyPath := s.ServerKeyPath()
+	newPath := keyPath + ".new"
+	if err := os.WriteFile(newPath, []byte(privKey), 0600); err != nil {
+		return "", fmt.Errorf("failed to save server key: %v", err)
+	}
+
+	// Apply before replacing the stored key so a failure leaves wg0 and the file consistent
+	if _, err := s.Executor.Execute("wg", "set", "wg0", "private-key", newPath); err != nil {
+		os.Remove(newPath)
+		return "", fmt.Errorf("failed to apply new key to wg0: %v", err)
+	}
+	s.resyncPeers()
+
+	if old, err := os.ReadFile(keyPath); err == nil {
+		if err := os.WriteFile(keyPath+".prev", old, 0600); err != nil {
+			system.Warn("Failed to back up previous WireGuard server key: %v", err)
+		}
+	}
+	if err := os.Rename(newPath, keyPath); err != nil {
+		// wg0 already runs the new key; keep it on disk so a restart doesn't revert it
+		return pubKey, fmt.Errorf("new key is active but could not be saved to %s: %v", keyPath, err)
+	}
+
+	system.Warn("WireGuard server key rotated; all origin configs must be updated with the new server public key")
+	return pubKey, nil
+}
+
 // AddPeer adds a peer to the running WireGuard interface
 func (s *WireGuardService) AddPeer(peer *models.WireGuardPeer, wgIP string) error {
 	if runtime.GOOS != "linux" {
@@ -324,11 +441,39 @@ func (s *WireGuardService) AddPeer(peer *models.WireGuardPeer, wgIP string) erro
 		clientIP = clientIP + "/32"
 	}
 
-	// command: wg set wg0 peer <PUBKEY> allowed-ips <IP/32>
-	_, err := s.Executor.Execute("wg", "set", "wg0", "peer", peer.PublicKey, "allowed-ips", clientIP)
+	// command: wg set wg0 peer <PUBKEY> allowed-ips <IP/32> [preshared-key <FILE>]
+	args := []string{"set", "wg0", "peer", peer.PublicKey, "allowed-ips", clientIP}
+	if peer.PresharedKey != "" {
+		// wg only reads the key from a file, so it never shows up in the process list
+		pskPath, err := s.writePresharedKeyFile(peer.PresharedKey)
+		if err != nil {
+			return fmt.Errorf("failed to stage preshared key: %v", err)
+		}
+		defer os.Remove(pskPath)
+		args = append(args, "preshared-key", pskPath)
+	}
+	_, err := s.Executor.Execute("wg", args...)
 	return err
 }
 
+// writePresharedKeyFile stores a preshared key in a private temporary file for "wg set"
+func (s *WireGuardService) writePresharedKeyFile(psk string) (string, error) {
+	f, err := os.CreateTemp(s.DataDir, "wg_psk_*")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if err := f.Chmod(0600); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	if _, err := f.WriteString(psk + "\n"); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
 // RemovePeer removes a peer from the WireGuard interface
 func (s *WireGuardService) RemovePeer(peer *models.WireGuardPeer) error {
 	if runtime.GOOS != "linux" {
@@ -359,6 +504,21 @@ func (s *WireGuardService) SyncPeers(db interface{}) error {
 	return nil
 }
 
+// resyncPeers re-adds the peers of every origin in the database to wg0
+func (s *WireGuardService) resyncPeers() {
+	if s.DB == nil {
+		return
+	}
+	var origins []models.Origin
+	if err := s.DB.Preload("Peer").Find(&origins).Error; err != nil {
+		system.Warn("Failed to fetch origins for peer sync: %v", err)
+		return
+	}
+	if err := s.SyncOriginsToPeers(origins); err != nil {
+		system.Warn("Failed to sync WireGuard peers: %v", err)
+	}
+}
+
 // SyncOriginsToPeers syncs all origins from DB to WireGuard interface
 func (s *WireGuardService) SyncOriginsToPeers(origins []models.Origin) error {
 	if runtime.GOOS != "linux" {
@@ -379,6 +539,10 @@ func (s *WireGuardService) SyncOriginsToPeers(origins []models.Origin) error {
 		if origin.WgIP == "" {
 			continue
 		}
+		// Drained origins stay disconnected until the drain is cancelled
+		if origin.DrainState == OriginDrainDrained {
+			continue
+		}
 
 		// Only sync if we have a peer config (need PrivKey/PubKey)
 		// Usually origins are created with keys.
@@ -399,10 +563,19 @@ func (s *WireGuardService) SyncOriginsToPeers(origins []models.Origin) error {
 	return nil
 }
 
-// GetStatus returns the current status of the WireGuard interface
-func (s *WireGuardService) GetStatus() (map[string]interface{}, error) {
+// WGStatus is the state of wg0 and the live counters of its peers
+type WGStatus struct {
+	Interface string        `json:"interface"`
+	Up        bool          `json:"up"`
+	MTU       int           `json:"mtu"`
+	Peers     []WGPeerStats `json:"peers"`
+	MockMode  bool          `json:"mock_mode,omitempty"`
+}
+
+// GetStatus returns the state of the WireGuard interface and its peers ("wg show wg0 dump")
+func (s *WireGuardService) GetStatus() (*WGStatus, error) {
 	if runtime.GOOS == "windows" {
-		return map[string]interface{}{"status": "active (windows mockup)"}, nil
+		return &WGStatus{Interface: "wg0", Up: true, Peers: []WGPeerStats{}, MockMode: true}, nil
 	}
 
 	// Check if interface exists
@@ -411,12 +584,18 @@ func (s *WireGuardService) GetStatus() (map[string]interface{}, error) {
 		return nil, fmt.Errorf("interface wg0 not found")
 	}
 
-	isUp := iface.Flags&net.FlagUp != 0
+	peers, err := s.PeerStats()
+	if err != nil {
+		return nil, err
+	}
+	if peers == nil {
+		peers = []WGPeerStats{}
+	}
 
-	return map[string]interface{}{
-		"interface": "wg0",
-		"up":        isUp,
-		"mtu":       iface.MTU,
-		"mac":       iface.HardwareAddr.String(),
+	return &WGStatus{
+		Interface: "wg0",
+		Up:        iface.Flags&net.FlagUp != 0,
+		MTU:       iface.MTU,
+		Peers:     peers,
 	}, nil
 }
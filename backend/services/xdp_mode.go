@@ -0,0 +1,62 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// XDP attach modes as reported by `ip link`
+const (
+	XDPModeNative  = "native"
+	XDPModeGeneric = "generic"
+	XDPModeOffload = "offload"
+	XDPModeUnknown = "unknown"
+)
+
+// nativeXDPDrivers lists common drivers with native (driver-mode) XDP support
+var nativeXDPDrivers = map[string]bool{
+	"virtio_net": true, "ixgbe": true, "ixgbevf": true, "i40e": true, "ice": true, "igb": true, "igc": true,
+	"mlx4_en": true, "mlx4_core": true, "mlx5_core": true, "bnxt_en": true, "ena": true, "gve": true,
+	"hv_netvsc": true, "qede": true, "nfp": true, "sfc": true, "veth": true, "tun": true,
+}
+
+// parseXDPMode extracts the attach mode from `ip -d link show` output
+func parseXDPMode(out string) string {
+	for _, field := range strings.Fields(out) {
+		switch field {
+		case "xdpgeneric":
+			return XDPModeGeneric
+		case "xdpoffload":
+			return XDPModeOffload
+		case "xdp", "xdpdrv":
+			return XDPModeNative
+		}
+	}
+	return XDPModeUnknown
+}
+
+// interfaceDriver returns the kernel driver behind a network interface ("" if virtual/unknown)
+func interfaceDriver(iface string) string {
+	target, err := os.Readlink(filepath.Join("/sys/class/net", iface, "device", "driver"))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(target)
+}
+
+// xdpGenericGuidance explains why an interface fell back to generic mode and what to do about it
+func xdpGenericGuidance(iface, driver string) string {
+	switch {
+	case driver == "":
+		return "Interface " + iface + " has no physical driver (bridge, bond or tunnel?). Attach to the underlying NIC for native XDP."
+	case driver == "virtio_net":
+		return "virtio_net supports native XDP, but only when LRO/GRO_HW are off and the VM has enough queues. " +
+			"Try `ethtool -K " + iface + " lro off gro-hw off` and `ethtool -L " + iface + " combined <2 x vCPUs>`, or ask the provider to raise the virtio queue count."
+	case nativeXDPDrivers[driver]:
+		return "Driver " + driver + " normally supports native XDP; check the kernel version, MTU (native XDP usually needs MTU <= 3498) and `dmesg` for XDP attach errors."
+	default:
+		return "Driver " + driver + " has no native XDP support. Expect much lower drop throughput; use a NIC/driver with native XDP " +
+			"(Intel ixgbe/i40e/ice, Mellanox mlx5, Broadcom bnxt, AWS ena, GCP gve, virtio_net)."
+	}
+}
@@ -0,0 +1,136 @@
+//go:build linux
+
+package services
+
+import (
+	"fmt"
+	"kg-proxy-web-gui/backend/system"
+	"net"
+	"os/exec"
+	"time"
+
+	"github.com/cilium/ebpf/link"
+)
+
+// xdpWatchInterval is how often attached interfaces are checked for link loss
+const xdpWatchInterval = 10 * time.Second
+
+// XDP link health states
+const (
+	XDPLinkOK       = "ok"
+	XDPLinkDown     = "down"     // Interface missing or administratively/operationally down
+	XDPLinkDetached = "detached" // Interface up but the program is gone and reattaching failed
+)
+
+// watchXDPLinks re-verifies every XDP attachment until stop is closed.
+// NIC resets and cloud live-migrations can recreate the interface or drop the program
+// while the service still looks enabled; the filter is reattached once the link is back.
+func (e *EBPFService) watchXDPLinks(stop chan struct{}) {
+	ticker := time.NewTicker(xdpWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			e.checkXDPLinks()
+		}
+	}
+}
+
+// checkXDPLinks updates the health of each attachment and reattaches lost programs
+func (e *EBPFService) checkXDPLinks() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	objs, ok := e.objs.(*xdpObjects)
+	if !ok || !e.isRunning {
+		return
+	}
+	if e.linkHealth == nil {
+		e.linkHealth = make(map[string]*XDPLinkHealth)
+	}
+
+	reattached := false
+	now := time.Now()
+	for name, l := range e.links {
+		health := e.linkHealth[name]
+		if health == nil {
+			health = &XDPLinkHealth{Interface: name, State: XDPLinkOK}
+			e.linkHealth[name] = health
+		}
+		health.CheckedAt = now
+
+		iface, err := net.InterfaceByName(name)
+		if err != nil || iface.Flags&net.FlagUp == 0 {
+			if health.State != XDPLinkDown {
+				health.State = XDPLinkDown
+				health.DownSince = &now
+				system.Warn("⚠️ Interface %s is down, XDP filtering on it is interrupted", name)
+				e.alertXDPLink("⚠️ Protected Interface Down",
+					fmt.Sprintf("Interface **%s** went down. XDP filtering will be reattached when it recovers.", name), ColorRed)
+			}
+			continue
+		}
+
+		// A recreated interface gets a new index; the old attachment died with it
+		if iface.Index == e.xdpIfindex[name] && xdpAttached(name) {
+			if health.State != XDPLinkOK {
+				system.Info("Interface %s is back up with XDP still attached", name)
+				health.State = XDPLinkOK
+				health.DownSince = nil
+			}
+			continue
+		}
+
+		l.Close()
+		newLink, err := link.AttachXDP(link.XDPOptions{
+			Program:   objs.XdpTrafficFilter,
+			Interface: iface.Index,
+		})
+		if err != nil {
+			if health.State != XDPLinkDetached {
+				system.Error("Interface %s is up but XDP could not be reattached: %v", name, err)
+				e.alertXDPLink("🚨 XDP Reattach Failed",
+					fmt.Sprintf("Interface **%s** is up but the XDP filter could not be reattached: %v\nTraffic on it is NOT filtered until this is fixed.", name, err), ColorRed)
+			}
+			health.State = XDPLinkDetached
+			health.LastError = err.Error()
+			continue
+		}
+
+		e.links[name] = newLink
+		e.xdpIfindex[name] = iface.Index
+		health.State = XDPLinkOK
+		health.DownSince = nil
+		health.LastError = ""
+		health.LastReattach = &now
+		health.Reattaches++
+		reattached = true
+		system.Info("XDP filter reattached to %s (ifindex %d)", name, iface.Index)
+		e.alertXDPLink("✅ XDP Filter Reattached",
+			fmt.Sprintf("Interface **%s** recovered and the XDP filter was reattached.", name), ColorGreen)
+	}
+
+	if reattached {
+		e.checkXDPModes()
+	}
+}
+
+// xdpAttached reports whether `ip link` shows an XDP program on the interface.
+// If it can't be checked the attachment is assumed to be intact.
+func xdpAttached(name string) bool {
+	out, err := exec.Command("ip", "-d", "link", "show", "dev", name).CombinedOutput()
+	if err != nil {
+		return true
+	}
+	return parseXDPMode(string(out)) != XDPModeUnknown
+}
+
+// alertXDPLink sends a link state webhook (caller holds lock, so never blocks on HTTP)
+func (e *EBPFService) alertXDPLink(title, message string, color int) {
+	if e.webhook != nil && e.webhook.IsEnabled() {
+		go e.webhook.SendSystemAlert(title, message, color)
+	}
+}
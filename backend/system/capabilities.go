@@ -0,0 +1,95 @@
+package system
+
+import (
+	"os/exec"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Binary is an external tool the backend shells out to
+type Binary struct {
+	Name     string `json:"name"`
+	Path     string `json:"path,omitempty"`
+	Found    bool   `json:"found"`
+	Required bool   `json:"required"` // Without it the firewall is not enforced
+	Purpose  string `json:"purpose"`
+}
+
+// Capabilities is the result of the startup tool check
+type Capabilities struct {
+	OS        string    `json:"os"`
+	Checked   bool      `json:"checked"` // False on platforms where commands are mocked
+	Binaries  []Binary  `json:"binaries"`
+	Missing   []string  `json:"missing"`  // Required binaries that were not found
+	Degraded  bool      `json:"degraded"` // Running without firewall enforcement
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// knownBinaries lists the tools used at runtime and whether the firewall depends on them
+var knownBinaries = []Binary{
+	{Name: "ipset", Required: true, Purpose: "GeoIP, ban and whitelist sets"},
+	{Name: "iptables-restore", Required: true, Purpose: "Firewall rule loading"},
+	{Name: "iptables", Required: true, Purpose: "Firewall status and counters"},
+	{Name: "wg", Purpose: "WireGuard peer management"},
+	{Name: "ip", Purpose: "Interface and route management"},
+	{Name: "conntrack", Purpose: "Session counts and connection flushing"},
+	{Name: "sysctl", Purpose: "Kernel hardening"},
+}
+
+var (
+	capabilities   Capabilities
+	capabilitiesMu sync.RWMutex
+)
+
+// DetectCapabilities checks that the external tools the backend relies on are installed.
+// On Windows commands are mocked, so nothing is checked.
+func DetectCapabilities() Capabilities {
+	caps := Capabilities{
+		OS:        runtime.GOOS,
+		Binaries:  make([]Binary, 0, len(knownBinaries)),
+		Missing:   make([]string, 0),
+		CheckedAt: time.Now(),
+	}
+
+	if !IsWindows() {
+		caps.Checked = true
+		for _, bin := range knownBinaries {
+			if path, err := exec.LookPath(bin.Name); err == nil {
+				bin.Path = path
+				bin.Found = true
+			} else if bin.Required {
+				caps.Missing = append(caps.Missing, bin.Name)
+			}
+			caps.Binaries = append(caps.Binaries, bin)
+		}
+		caps.Degraded = len(caps.Missing) > 0
+	}
+
+	capabilitiesMu.Lock()
+	capabilities = caps
+	capabilitiesMu.Unlock()
+	return caps
+}
+
+// GetCapabilities returns the last capability check
+func GetCapabilities() Capabilities {
+	capabilitiesMu.RLock()
+	defer capabilitiesMu.RUnlock()
+	return capabilities
+}
+
+// MissingBinaries returns which of the given tools are not on PATH (always none on Windows).
+// Looked up on every call so installing a package recovers without a restart.
+func MissingBinaries(names ...string) []string {
+	missing := make([]string, 0)
+	if IsWindows() {
+		return missing
+	}
+	for _, name := range names {
+		if _, err := exec.LookPath(name); err != nil {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
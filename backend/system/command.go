@@ -7,6 +7,7 @@ import (
 	"os/exec"
 	"runtime"
 	"strings"
+	"sync"
 )
 
 // IsWindows returns true if the current OS is Windows
@@ -69,12 +70,97 @@ func Ping(ip string) bool {
 	return cmd.Run() == nil
 }
 
+// Explicit WAN interface configured by the operator (overrides auto-detection)
+// plus additional public interfaces that must be protected as well (multi-homed boxes)
+var (
+	wanInterface         string
+	additionalInterfaces []string
+	wanInterfaceMu       sync.RWMutex
+)
+
+// SetWANInterface sets the WAN interface override. An empty name restores auto-detection.
+func SetWANInterface(name string) {
+	wanInterfaceMu.Lock()
+	defer wanInterfaceMu.Unlock()
+	wanInterface = strings.TrimSpace(name)
+}
+
+// GetWANInterface returns the configured WAN interface override ("" = auto-detect)
+func GetWANInterface() string {
+	wanInterfaceMu.RLock()
+	defer wanInterfaceMu.RUnlock()
+	return wanInterface
+}
+
+// SetAdditionalInterfaces sets extra interfaces protected alongside the primary WAN interface
+func SetAdditionalInterfaces(names []string) {
+	wanInterfaceMu.Lock()
+	defer wanInterfaceMu.Unlock()
+	additionalInterfaces = names
+}
+
+// ParseInterfaceList splits a comma-separated interface list, dropping blanks and duplicates
+func ParseInterfaceList(list string) []string {
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// GetProtectedInterfaces returns the primary WAN interface followed by any additional interfaces
+func GetProtectedInterfaces() []string {
+	primary := GetDefaultInterface()
+
+	wanInterfaceMu.RLock()
+	defer wanInterfaceMu.RUnlock()
+
+	names := []string{primary}
+	for _, name := range additionalInterfaces {
+		if name != primary {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// ValidateInterface checks that a network interface exists and is up
+func ValidateInterface(name string) error {
+	if runtime.GOOS == "windows" {
+		return nil // Interfaces cannot be validated on Windows dev machines
+	}
+
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return fmt.Errorf("interface %s not found", name)
+	}
+	if iface.Flags&net.FlagUp == 0 {
+		return fmt.Errorf("interface %s is down", name)
+	}
+	if iface.Flags&net.FlagLoopback != 0 {
+		return fmt.Errorf("interface %s is a loopback interface", name)
+	}
+	return nil
+}
+
 // GetDefaultInterface returns the default network interface name (e.g., "eth0", "enp1s0")
+// If a WAN interface is configured it is returned as-is, without auto-detection.
 func GetDefaultInterface() string {
 	if runtime.GOOS == "windows" {
 		return "lo" // Mock for windows
 	}
 
+	// Method 0: Operator-configured WAN interface always wins
+	if name := GetWANInterface(); name != "" {
+		return name
+	}
+
 	// Method 1: Robust parsing of /proc/net/route to find default gateway interface
 	// This is the most reliable way to find the primary WAN interface.
 	data, err := os.ReadFile("/proc/net/route")
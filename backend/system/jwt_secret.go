@@ -0,0 +1,85 @@
+package system
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// jwtSecretSize is the length of a generated JWT signing key in bytes
+const jwtSecretSize = 32
+
+// knownWeakJWTSecrets are defaults that shipped in source or docs and must never sign tokens
+var knownWeakJWTSecrets = []string{
+	"super-secret-key-change-me",
+	"secret",
+	"changeme",
+	"change-me",
+	"your-secret-key",
+}
+
+// LoadOrCreateJWTSecret returns the JWT signing key. KG_JWT_SECRET takes precedence (for
+// clusters sharing a key); otherwise the key is read from <dataDir>/jwt.key, generating and
+// persisting a random one (mode 0600) on first boot. Tokens signed by a previous key stop
+// validating, so upgraded installs simply log in again.
+func LoadOrCreateJWTSecret(dataDir string) ([]byte, error) {
+	if env := os.Getenv("KG_JWT_SECRET"); env != "" {
+		secret := []byte(env)
+		if reason := WeakJWTSecret(secret); reason != "" {
+			Error("SECURITY: KG_JWT_SECRET is weak (%s). Anyone who guesses it can forge admin tokens; rotate it now (e.g. openssl rand -hex 32)", reason)
+		}
+		return secret, nil
+	}
+
+	path := filepath.Join(dataDir, "jwt.key")
+
+	secret, err := os.ReadFile(path)
+	if err == nil {
+		if reason := WeakJWTSecret(secret); reason != "" {
+			return nil, fmt.Errorf("%s is weak (%s); delete it to generate a new key", path, reason)
+		}
+		// Tighten permissions of keys written by hand
+		if info, err := os.Stat(path); err == nil && info.Mode().Perm() != 0600 {
+			os.Chmod(path, 0600)
+		}
+		return secret, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	secret = make([]byte, jwtSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate JWT secret: %w", err)
+	}
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, secret, 0600); err != nil {
+		return nil, fmt.Errorf("failed to save %s: %w", path, err)
+	}
+	Info("Generated new JWT signing key at %s (existing sessions must log in again)", path)
+	return secret, nil
+}
+
+// WeakJWTSecret returns why secret is unsafe for signing tokens, or "" if it looks fine
+func WeakJWTSecret(secret []byte) string {
+	for _, weak := range knownWeakJWTSecrets {
+		if strings.EqualFold(strings.TrimSpace(string(secret)), weak) {
+			return "known default value"
+		}
+	}
+	if len(secret) < jwtSecretSize {
+		return fmt.Sprintf("shorter than %d bytes", jwtSecretSize)
+	}
+	distinct := make(map[byte]bool)
+	for _, b := range secret {
+		distinct[b] = true
+	}
+	if len(distinct) < 8 {
+		return "too few distinct characters"
+	}
+	return ""
+}
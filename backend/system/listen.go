@@ -0,0 +1,107 @@
+package system
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultListenAddr is the management GUI/API address used when KG_LISTEN_ADDR is unset
+const DefaultListenAddr = ":8080"
+
+var (
+	listenAddr   = DefaultListenAddr
+	listenAddrMu sync.RWMutex
+)
+
+// ResolveListenAddr turns a KG_LISTEN_ADDR value into a host:port address.
+// Accepted forms: "8080", ":8080", "127.0.0.1:8080", "localhost:8080" and "<interface>:8080"
+// (e.g. "wg0:8080", bound to the interface's IPv4 address).
+func ResolveListenAddr(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return DefaultListenAddr, nil
+	}
+	if !strings.Contains(value, ":") {
+		value = ":" + value
+	}
+
+	host, portStr, err := net.SplitHostPort(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid listen address %q: %w", value, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return "", fmt.Errorf("invalid listen port %q", portStr)
+	}
+
+	switch {
+	case host == "" || host == "localhost" || net.ParseIP(host) != nil:
+		if host == "localhost" {
+			host = "127.0.0.1"
+		}
+	default:
+		// Interface name: bind to its first IPv4 address
+		iface, err := net.InterfaceByName(host)
+		if err != nil {
+			return "", fmt.Errorf("listen interface %s not found", host)
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return "", fmt.Errorf("failed to read addresses of %s: %w", host, err)
+		}
+		resolved := ""
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+				resolved = ipNet.IP.String()
+				break
+			}
+		}
+		if resolved == "" {
+			return "", fmt.Errorf("listen interface %s has no IPv4 address", host)
+		}
+		host = resolved
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+// SetListenAddr records the address the management server listens on
+func SetListenAddr(addr string) {
+	listenAddrMu.Lock()
+	defer listenAddrMu.Unlock()
+	listenAddr = addr
+}
+
+// GetListenAddr returns the management server listen address (host:port)
+func GetListenAddr() string {
+	listenAddrMu.RLock()
+	defer listenAddrMu.RUnlock()
+	return listenAddr
+}
+
+// GetListenHost returns the bind IP, or "" when listening on all interfaces
+func GetListenHost() string {
+	host, _, _ := net.SplitHostPort(GetListenAddr())
+	if host == "0.0.0.0" || host == "::" {
+		return ""
+	}
+	return host
+}
+
+// GetListenPort returns the management server port
+func GetListenPort() int {
+	_, portStr, _ := net.SplitHostPort(GetListenAddr())
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return 8080
+	}
+	return port
+}
+
+// IsListenPublic reports whether the management server is reachable on all interfaces (including WAN)
+func IsListenPublic() bool {
+	return GetListenHost() == ""
+}
@@ -0,0 +1,77 @@
+package system
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// logStreamBuffer is the per-subscriber queue; lines are dropped for clients that fall behind
+const logStreamBuffer = 512
+
+// LogLine is a single log entry pushed to live subscribers
+type LogLine struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+}
+
+var (
+	logSubscribers   = make(map[uint64]chan LogLine)
+	logSubscribersMu sync.RWMutex
+	logSubscriberID  uint64
+)
+
+// SubscribeLogs registers a live log listener.
+// The returned cancel func must be called when the listener goes away; it closes the channel.
+func SubscribeLogs() (<-chan LogLine, func()) {
+	ch := make(chan LogLine, logStreamBuffer)
+
+	logSubscribersMu.Lock()
+	logSubscriberID++
+	id := logSubscriberID
+	logSubscribers[id] = ch
+	logSubscribersMu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			logSubscribersMu.Lock()
+			delete(logSubscribers, id)
+			logSubscribersMu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
+
+// ParseLogLevel maps "info", "warn"/"warning" and "error" to a LogLevel
+func ParseLogLevel(value string) (LogLevel, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "info":
+		return LevelInfo, true
+	case "warn", "warning":
+		return LevelWarn, true
+	case "error":
+		return LevelError, true
+	}
+	return LevelInfo, false
+}
+
+// publishLog fans a written log line out to subscribers without blocking the caller
+func publishLog(level LogLevel, ts time.Time, message string) {
+	logSubscribersMu.RLock()
+	defer logSubscribersMu.RUnlock()
+
+	if len(logSubscribers) == 0 {
+		return
+	}
+	line := LogLine{Time: ts, Level: level.String(), Message: message}
+	for _, ch := range logSubscribers {
+		select {
+		case ch <- line:
+		default:
+			// Subscriber is behind; never stall logging
+		}
+	}
+}
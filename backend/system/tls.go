@@ -0,0 +1,159 @@
+package system
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// CertReloader serves a certificate from disk and reloads it when the files change,
+// so renewals (e.g. certbot) apply without restarting the backend.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewCertReloader loads the key pair once to fail fast on bad paths
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ValidateKeyPair checks that the certificate and key files exist and match
+func ValidateKeyPair(certFile, keyFile string) error {
+	if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		return fmt.Errorf("invalid TLS certificate/key: %w", err)
+	}
+	return nil
+}
+
+func (r *CertReloader) reload() error {
+	info, err := os.Stat(r.certFile)
+	if err != nil {
+		return fmt.Errorf("TLS certificate: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("invalid TLS certificate/key: %w", err)
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = info.ModTime()
+	r.mu.Unlock()
+	return nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if info, err := os.Stat(r.certFile); err == nil {
+		r.mu.RLock()
+		changed := info.ModTime().After(r.modTime)
+		r.mu.RUnlock()
+		if changed {
+			if err := r.reload(); err != nil {
+				Warn("Keeping previous TLS certificate: %v", err)
+			} else {
+				Info("TLS certificate reloaded from %s", r.certFile)
+			}
+		}
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// TLSConfig returns a server TLS config backed by the reloader
+func (r *CertReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+}
+
+// NewAutocertManager obtains and renews a Let's Encrypt certificate for domain, keeping the
+// account key and certificates in cacheDir. The HTTP-01 challenge is answered by StartHTTPSRedirect.
+func NewAutocertManager(domain, email, cacheDir string) *autocert.Manager {
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(domain),
+		Cache:      autocert.DirCache(cacheDir),
+		Email:      email,
+	}
+}
+
+// ValidateAutocertDomain checks that domain is a public DNS name Let's Encrypt can issue for
+func ValidateAutocertDomain(domain string) error {
+	if net.ParseIP(domain) != nil {
+		return fmt.Errorf("tls_autocert_domain: Let's Encrypt does not issue certificates for IP addresses")
+	}
+	if len(domain) > 253 || !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return fmt.Errorf("tls_autocert_domain: %q is not a fully qualified domain name", domain)
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return fmt.Errorf("tls_autocert_domain: %q is not a valid domain name", domain)
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+				return fmt.Errorf("tls_autocert_domain: %q is not a valid domain name", domain)
+			}
+		}
+	}
+	return nil
+}
+
+// AutocertTLSConfig returns a server TLS config backed by the manager. Unlike m.TLSConfig it
+// does not offer h2, which fasthttp does not speak.
+func AutocertTLSConfig(m *autocert.Manager) *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: m.GetCertificate,
+		NextProtos:     []string{"http/1.1", "acme-tls/1"},
+	}
+}
+
+// StartHTTPSRedirect serves permanent redirects to https on httpAddr (e.g. ":80"). With acme
+// set it also answers the ACME HTTP-01 challenges.
+func StartHTTPSRedirect(httpAddr string, httpsPort int, acme *autocert.Manager) {
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host, _, err := net.SplitHostPort(req.Host)
+		if err != nil {
+			host = req.Host
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		}
+		http.Redirect(w, req, "https://"+host+req.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+	if acme != nil {
+		handler = acme.HTTPHandler(handler)
+	}
+
+	go func() {
+		server := &http.Server{
+			Addr:              httpAddr,
+			Handler:           handler,
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			Warn("HTTP->HTTPS redirect listener on %s stopped: %v", httpAddr, err)
+		}
+	}()
+}
@@ -7,6 +7,12 @@ const client = axios.create({
   },
 });
 
+// Read a cookie value by name
+const getCookie = (name) => {
+  const match = document.cookie.split('; ').find((row) => row.startsWith(`${name}=`));
+  return match ? decodeURIComponent(match.split('=')[1]) : null;
+};
+
 // Request interceptor - attach token from localStorage
 client.interceptors.request.use(
   (config) => {
@@ -14,6 +20,14 @@ client.interceptors.request.use(
     if (token) {
       config.headers.Authorization = `Bearer ${token}`;
     }
+    // Echo the CSRF cookie (only set when the server enables CSRF protection)
+    const method = (config.method || 'get').toLowerCase();
+    if (!['get', 'head', 'options'].includes(method)) {
+      const csrf = getCookie('kg_csrf');
+      if (csrf) {
+        config.headers['X-CSRF-Token'] = csrf;
+      }
+    }
     return config;
   },
   (error) => Promise.reject(error)
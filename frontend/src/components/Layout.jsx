@@ -1,4 +1,4 @@
-import React, { useState } from 'react';
+import React, { useState, useEffect } from 'react';
 import { Outlet, useNavigate, useLocation } from 'react-router-dom';
 import {
     Box, CssBaseline, AppBar, Toolbar, Typography, Drawer, List, ListItem,
@@ -9,6 +9,7 @@ import {
     Hub as HubIcon, Security as SecurityIcon, Logout as LogoutIcon, Settings, Speed, People, Block, History, Public as PublicIcon
 } from '@mui/icons-material';
 import logo from '../assets/logo.png';
+import client from '../api/client';
 
 const drawerWidth = 260;
 
@@ -31,6 +32,25 @@ export default function Layout() {
     const navigate = useNavigate();
     const location = useLocation();
 
+    // Firewall applies roll back unless confirmed; reaching the API afterwards proves the
+    // management port is still open, so confirm any apply that is waiting
+    useEffect(() => {
+        const confirmPendingApply = async () => {
+            try {
+                const res = await client.get('/firewall/apply-status');
+                if (res.data.confirm_deadline) {
+                    await client.post('/firewall/confirm');
+                }
+            } catch (e) {
+                console.error('Failed to confirm firewall apply:', e);
+            }
+        };
+
+        confirmPendingApply();
+        const interval = setInterval(confirmPendingApply, 5000);
+        return () => clearInterval(interval);
+    }, []);
+
     const handleLogout = () => {
         localStorage.removeItem('token');
         navigate('/login');
@@ -188,6 +188,15 @@ Environment=GOMEMLIMIT=3500MiB
 # Optional: Set your MaxMind license key for accurate GeoIP filtering
 # Get a free key at: https://www.maxmind.com/en/geolite2/signup
 # Environment=MAXMIND_LICENSE_KEY=your_license_key_here
+# Optional: Restrict the management GUI (default :8080 on all interfaces), e.g. VPN-only or SSH tunnel
+# Environment=KG_LISTEN_ADDR=wg0:8080
+# Environment=KG_LISTEN_ADDR=127.0.0.1:8080
+# Optional: Require a CSRF token (issued at login) on state-changing API requests
+# Environment=KG_CSRF_PROTECTION=true
+# Optional: Share one JWT signing key between instances (default: generated into $DATA_DIR/jwt.key)
+# Environment=KG_JWT_SECRET=<output of: openssl rand -hex 32>
+# Optional: Browser cache time in seconds for unhashed frontend files (index.html is never cached)
+# Environment=KG_STATIC_MAX_AGE=3600
 LimitNOFILE=65535
 StartLimitInterval=0
 